@@ -0,0 +1,381 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package agent is a gops agent that Decred programs can start instead of
+// the one of github.com/google/gops/agent. It serves the stock gops signals
+// and those of github.com/dcrlabs/dcrps/signal, among them the application
+// stats the program registers with Register, which dcrps shows with its
+// appstats command.
+//
+// The agent exposes an endpoint via a TCP connection that can be used by any
+// program on the system. Review your security requirements before starting
+// it.
+package agent
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	gosignal "os/signal"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"runtime/trace"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dcrlabs/dcrps/internal"
+	dcrsignal "github.com/dcrlabs/dcrps/signal"
+	"github.com/google/gops/signal"
+)
+
+const defaultAddr = "127.0.0.1:0"
+
+// The windows of the traces and CPU profiles requested without one, as the
+// stock agent captures them.
+const (
+	defaultTraceWindow      = 5 * time.Second
+	defaultCPUProfileWindow = 30 * time.Second
+)
+
+// capabilities are the dcrps commands the agent serves, as it reports them.
+var capabilities = []string{
+	"stack", "gc", "setgc", "memstats", "version", "stats",
+	"pprof-heap", "pprof-cpu", "pprof-mutex", "pprof-block",
+	"trace", dcrsignal.TraceDuration, dcrsignal.CPUProfileDuration, "appstats",
+	dcrsignal.ProfileRates, dcrsignal.GCEventStream,
+}
+
+var (
+	mu        sync.Mutex
+	portfile  string
+	listener  net.Listener
+	started   time.Time
+	blockRate int // as SetBlockProfileRate last set it
+)
+
+// Options configures the agent.
+type Options struct {
+	// Addr is the host:port the agent listens at. Defaults to a free port
+	// of 127.0.0.1.
+	Addr string
+
+	// ConfigDir is the directory of the file holding the port of the
+	// agent, named after the PID, where dcrps and gops find it. Defaults
+	// to the gops config dir.
+	ConfigDir string
+
+	// ShutdownCleanup closes the agent and exits the process when it
+	// receives an interrupt. Otherwise, call Close before shutting down.
+	ShutdownCleanup bool
+}
+
+// Listen starts the agent. It fails when the agent is already listening.
+func Listen(opts Options) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if portfile != "" {
+		return fmt.Errorf("agent already listening at %v", listener.Addr())
+	}
+	dir := opts.ConfigDir
+	if dir == "" {
+		var err error
+		dir, err = internal.ConfigDir()
+		if err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	addr := opts.Addr
+	if addr == "" {
+		addr = defaultAddr
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	file := filepath.Join(dir, strconv.Itoa(os.Getpid()))
+	if err := ioutil.WriteFile(file, []byte(strconv.Itoa(port)), os.ModePerm); err != nil {
+		ln.Close()
+		return err
+	}
+	listener, portfile, started = ln, file, time.Now()
+	if opts.ShutdownCleanup {
+		gracefulShutdown()
+	}
+	go listen(ln)
+	return nil
+}
+
+// Addr returns the address the agent listens at, or nil when it doesn't.
+func Addr() net.Addr {
+	mu.Lock()
+	defer mu.Unlock()
+	if portfile == "" {
+		return nil
+	}
+	return listener.Addr()
+}
+
+// Close closes the agent, removing its port file. It does nothing when the
+// agent isn't listening.
+func Close() {
+	mu.Lock()
+	defer mu.Unlock()
+	if portfile == "" {
+		return
+	}
+	os.Remove(portfile)
+	listener.Close()
+	portfile = ""
+}
+
+func gracefulShutdown() {
+	c := make(chan os.Signal, 1)
+	gosignal.Notify(c, os.Interrupt)
+	go func() {
+		<-c
+		Close()
+		os.Exit(1)
+	}()
+}
+
+// listen serves the requests of the connections to ln, one at a time as the
+// stock agent does, but for the GC event streams, until it is closed.
+func listen(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return
+		}
+		// The request is the signal byte and its params, which arrive
+		// together.
+		r := bufio.NewReader(conn)
+		sig, err := r.ReadByte()
+		if err == nil && sig == dcrsignal.GCEvents {
+			// The stream lasts until dcrps hangs up.
+			go streamGCEvents(conn)
+			continue
+		}
+		if err == nil {
+			err = handle(conn, r, sig)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "agent: %v\n", err)
+		}
+		conn.Close()
+	}
+}
+
+// handle writes the response to the signal sig to w, reading its params from
+// r. The signals it doesn't know get no response.
+func handle(w io.Writer, r *bufio.Reader, sig byte) error {
+	switch sig {
+	case signal.StackTrace:
+		return pprof.Lookup("goroutine").WriteTo(w, 2)
+	case signal.GC:
+		runtime.GC()
+		_, err := io.WriteString(w, "ok")
+		return err
+	case signal.MemStats:
+		var s runtime.MemStats
+		runtime.ReadMemStats(&s)
+		return writeMemStats(w, &s)
+	case dcrsignal.MemStatsJSON:
+		var s runtime.MemStats
+		runtime.ReadMemStats(&s)
+		return json.NewEncoder(w).Encode(&s)
+	case signal.Version:
+		_, err := fmt.Fprintf(w, "%v\n", runtime.Version())
+		return err
+	case signal.HeapProfile:
+		return pprof.WriteHeapProfile(w)
+	case signal.CPUProfile:
+		window, err := readWindow(r, defaultCPUProfileWindow)
+		if err != nil {
+			return err
+		}
+		if err := pprof.StartCPUProfile(w); err != nil {
+			return err
+		}
+		time.Sleep(window)
+		pprof.StopCPUProfile()
+	case dcrsignal.MutexProfile:
+		return writeProfile(w, "mutex")
+	case dcrsignal.BlockProfile:
+		return writeProfile(w, "block")
+	case signal.Stats:
+		fmt.Fprintf(w, "goroutines: %v\n", runtime.NumGoroutine())
+		fmt.Fprintf(w, "OS threads: %v\n", pprof.Lookup("threadcreate").Count())
+		fmt.Fprintf(w, "GOMAXPROCS: %v\n", runtime.GOMAXPROCS(0))
+		_, err := fmt.Fprintf(w, "num CPU: %v\n", runtime.NumCPU())
+		return err
+	case signal.BinaryDump:
+		path, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(w, f)
+		return err
+	case signal.Trace:
+		window, err := readWindow(r, defaultTraceWindow)
+		if err != nil {
+			return err
+		}
+		if err := trace.Start(w); err != nil {
+			return err
+		}
+		time.Sleep(window)
+		trace.Stop()
+	case signal.SetGCPercent:
+		perc, err := binary.ReadVarint(r)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "New GC percent set to %v. Previous value was %v.\n",
+			perc, debug.SetGCPercent(int(perc)))
+		return err
+	case dcrsignal.Capabilities:
+		_, err := io.WriteString(w, strings.Join(capabilities, "\n")+"\n")
+		return err
+	case dcrsignal.Info:
+		return writeInfo(w)
+	case dcrsignal.AppStats:
+		return json.NewEncoder(w).Encode(appStats())
+	case dcrsignal.SetMutexProfileFraction:
+		rate, err := binary.ReadVarint(r)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%d\n", runtime.SetMutexProfileFraction(int(rate)))
+		return err
+	case dcrsignal.SetBlockProfileRate:
+		rate, err := binary.ReadVarint(r)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		prev := blockRate
+		blockRate = int(rate)
+		mu.Unlock()
+		runtime.SetBlockProfileRate(int(rate))
+		_, err = fmt.Fprintf(w, "%d\n", prev)
+		return err
+	}
+	return nil
+}
+
+// readWindow reads the window of a capture from the varint of its
+// milliseconds following the signal, or returns def when there is none, as
+// dcrps only sends the ones it was given.
+func readWindow(r *bufio.Reader, def time.Duration) (time.Duration, error) {
+	if r.Buffered() == 0 {
+		return def, nil
+	}
+	ms, err := binary.ReadVarint(r)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// writeProfile writes the named profile to w, nothing when the process
+// didn't enable it and it has no samples.
+func writeProfile(w io.Writer, name string) error {
+	p := pprof.Lookup(name)
+	if p.Count() == 0 {
+		return nil
+	}
+	return p.WriteTo(w, 0)
+}
+
+// writeInfo writes what the agent knows of its process to w as "key: value"
+// lines.
+func writeInfo(w io.Writer) error {
+	mu.Lock()
+	since := started
+	mu.Unlock()
+	path, _ := os.Executable()
+	fmt.Fprintf(w, "pid: %d\n", os.Getpid())
+	fmt.Fprintf(w, "ppid: %d\n", os.Getppid())
+	fmt.Fprintf(w, "path: %s\n", path)
+	fmt.Fprintf(w, "go: %s\n", runtime.Version())
+	fmt.Fprintf(w, "agent: dcrps\n")
+	_, err := fmt.Fprintf(w, "listening since: %s\n", since.Format(time.RFC3339))
+	return err
+}
+
+// writeMemStats writes s to w as the stock agent does.
+func writeMemStats(w io.Writer, s *runtime.MemStats) error {
+	fmt.Fprintf(w, "alloc: %v\n", formatBytes(s.Alloc))
+	fmt.Fprintf(w, "total-alloc: %v\n", formatBytes(s.TotalAlloc))
+	fmt.Fprintf(w, "sys: %v\n", formatBytes(s.Sys))
+	fmt.Fprintf(w, "lookups: %v\n", s.Lookups)
+	fmt.Fprintf(w, "mallocs: %v\n", s.Mallocs)
+	fmt.Fprintf(w, "frees: %v\n", s.Frees)
+	fmt.Fprintf(w, "heap-alloc: %v\n", formatBytes(s.HeapAlloc))
+	fmt.Fprintf(w, "heap-sys: %v\n", formatBytes(s.HeapSys))
+	fmt.Fprintf(w, "heap-idle: %v\n", formatBytes(s.HeapIdle))
+	fmt.Fprintf(w, "heap-in-use: %v\n", formatBytes(s.HeapInuse))
+	fmt.Fprintf(w, "heap-released: %v\n", formatBytes(s.HeapReleased))
+	fmt.Fprintf(w, "heap-objects: %v\n", s.HeapObjects)
+	fmt.Fprintf(w, "stack-in-use: %v\n", formatBytes(s.StackInuse))
+	fmt.Fprintf(w, "stack-sys: %v\n", formatBytes(s.StackSys))
+	fmt.Fprintf(w, "stack-mspan-inuse: %v\n", formatBytes(s.MSpanInuse))
+	fmt.Fprintf(w, "stack-mspan-sys: %v\n", formatBytes(s.MSpanSys))
+	fmt.Fprintf(w, "stack-mcache-inuse: %v\n", formatBytes(s.MCacheInuse))
+	fmt.Fprintf(w, "stack-mcache-sys: %v\n", formatBytes(s.MCacheSys))
+	fmt.Fprintf(w, "other-sys: %v\n", formatBytes(s.OtherSys))
+	fmt.Fprintf(w, "gc-sys: %v\n", formatBytes(s.GCSys))
+	fmt.Fprintf(w, "next-gc: when heap-alloc >= %v\n", formatBytes(s.NextGC))
+	lastGC := "-"
+	if s.LastGC != 0 {
+		lastGC = fmt.Sprint(time.Unix(0, int64(s.LastGC)))
+	}
+	fmt.Fprintf(w, "last-gc: %v\n", lastGC)
+	fmt.Fprintf(w, "gc-pause-total: %v\n", time.Duration(s.PauseTotalNs))
+	fmt.Fprintf(w, "gc-pause: %v\n", s.PauseNs[(s.NumGC+255)%256])
+	fmt.Fprintf(w, "num-gc: %v\n", s.NumGC)
+	fmt.Fprintf(w, "enable-gc: %v\n", s.EnableGC)
+	_, err := fmt.Fprintf(w, "debug-gc: %v\n", s.DebugGC)
+	return err
+}
+
+var units = []string{" bytes", "KB", "MB", "GB", "TB", "PB"}
+
+func formatBytes(val uint64) string {
+	var i int
+	var target uint64
+	for i = range units {
+		target = 1 << uint(10*(i+1))
+		if val < target {
+			break
+		}
+	}
+	if i > 0 {
+		return fmt.Sprintf("%0.2f%s (%d bytes)", float64(val)/(float64(target)/1024), units[i], val)
+	}
+	return fmt.Sprintf("%d bytes", val)
+}
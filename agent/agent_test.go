@@ -0,0 +1,152 @@
+package agent
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	dcrsignal "github.com/dcrlabs/dcrps/signal"
+	"github.com/google/gops/signal"
+)
+
+// request sends the signal sig with its params to the agent and returns the
+// response.
+func request(t *testing.T, sig byte, params ...byte) []byte {
+	conn, err := net.Dial("tcp", Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write(append([]byte{sig}, params...)); err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestAgent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := Listen(Options{ConfigDir: dir}); err != nil {
+		t.Fatal(err)
+	}
+	defer Close()
+	if err := Listen(Options{ConfigDir: dir}); err == nil {
+		t.Error("second Listen: got no error")
+	}
+
+	port, err := ioutil.ReadFile(filepath.Join(dir, strconv.Itoa(os.Getpid())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strconv.Itoa(Addr().(*net.TCPAddr).Port); string(port) != want {
+		t.Errorf("port file: got=%q want=%q", port, want)
+	}
+
+	caps := strings.Fields(string(request(t, dcrsignal.Capabilities)))
+	for _, c := range []string{"appstats", dcrsignal.TraceDuration} {
+		if !containsString(caps, c) {
+			t.Errorf("capabilities: %q missing from %q", c, caps)
+		}
+	}
+	if out := request(t, signal.Version); len(out) == 0 {
+		t.Error("version: no response")
+	}
+	if !strings.Contains(string(request(t, dcrsignal.Info)), "pid: "+strconv.Itoa(os.Getpid())+"\n") {
+		t.Error("info: no pid")
+	}
+	if out := request(t, dcrsignal.MutexProfile); len(out) != 0 {
+		t.Errorf("mutex profile not enabled: got %d bytes", len(out))
+	}
+	var ms struct{ NumGC uint32 }
+	if err := json.Unmarshal(request(t, dcrsignal.MemStatsJSON), &ms); err != nil {
+		t.Errorf("memstats JSON: %v", err)
+	}
+
+	// A 1ms trace rather than the default 5s.
+	buf := make([]byte, binary.MaxVarintLen64)
+	if out := request(t, signal.Trace, buf[:binary.PutVarint(buf, 1)]...); len(out) == 0 {
+		t.Error("trace: no response")
+	}
+
+	// The rates answer the previous ones, and the mutex one is restored.
+	rate := func(sig byte, n int64) string {
+		return string(request(t, sig, buf[:binary.PutVarint(buf, n)]...))
+	}
+	if got := rate(dcrsignal.SetMutexProfileFraction, 5); got != "0\n" {
+		t.Errorf("mutex fraction: got previous %q", got)
+	}
+	if got := rate(dcrsignal.SetMutexProfileFraction, 0); got != "5\n" {
+		t.Errorf("mutex fraction: got previous %q", got)
+	}
+	if got := rate(dcrsignal.SetBlockProfileRate, 1); got != "0\n" {
+		t.Errorf("block rate: got previous %q", got)
+	}
+	if got := rate(dcrsignal.SetBlockProfileRate, 0); got != "1\n" {
+		t.Errorf("block rate: got previous %q", got)
+	}
+
+	// The GC stream runs alongside the other requests.
+	conn, err := net.Dial("tcp", Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte{dcrsignal.GCEvents}); err != nil {
+		t.Fatal(err)
+	}
+	if out := request(t, signal.Version); len(out) == 0 {
+		t.Error("version during the GC stream: no response")
+	}
+	var e gcEvent
+	for i := 0; i < 50 && e.HeapAfter == 0; i++ {
+		runtime.GC()
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		dec := json.NewDecoder(conn)
+		for dec.Decode(&e) == nil && e.HeapAfter == 0 {
+		}
+	}
+	if e.NumGC == 0 || e.HeapAfter == 0 || e.Goal == 0 {
+		t.Errorf("GC stream: got %+v", e)
+	}
+
+	Register("peers", func() interface{} { return 8 })
+	Register("syncing", func() interface{} { return "headers" })
+	Register("broken", func() interface{} { panic("no chain") })
+	defer Register("peers", nil)
+	defer Register("syncing", nil)
+	defer Register("broken", nil)
+	var stats map[string]interface{}
+	if err := json.Unmarshal(request(t, dcrsignal.AppStats), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats["peers"] != 8.0 || stats["syncing"] != "headers" {
+		t.Errorf("app stats: got %v", stats)
+	}
+	if broken, _ := stats["broken"].(map[string]interface{}); broken["error"] != "no chain" {
+		t.Errorf("app stat that panics: got %v", stats["broken"])
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
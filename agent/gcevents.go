@@ -0,0 +1,135 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"runtime"
+	"sync"
+)
+
+// gcEvent is a GC cycle, as dcrsignal.GCEvents streams it.
+type gcEvent struct {
+	NumGC      uint32 `json:"numGC"`
+	End        uint64 `json:"end"`
+	PauseNs    uint64 `json:"pauseNs"`
+	HeapBefore uint64 `json:"heapBefore"`
+	HeapAfter  uint64 `json:"heapAfter"`
+	Goal       uint64 `json:"goal"`
+}
+
+var (
+	gcMu    sync.Mutex
+	gcSubs  = make(map[chan gcEvent]bool)
+	gcArmed bool   // whether a sentinel waits for the next cycle
+	gcSeen  uint32 // the cycles published
+	gcGoal  uint64 // the goal of the cycle after gcSeen
+)
+
+// gcSentinel is garbage as soon as it is allocated, so that its finalizer
+// runs after the next GC cycle. It holds a pointer to stay out of the tiny
+// allocator, whose blocks may outlive the cycle.
+type gcSentinel struct {
+	_ *gcSentinel
+}
+
+// armGCSentinel sets a sentinel for the next GC cycle, which publishes the
+// cycles and sets the next one while there are subscribers.
+func armGCSentinel() {
+	runtime.SetFinalizer(&gcSentinel{}, func(*gcSentinel) {
+		if publishGC() {
+			armGCSentinel()
+		}
+	})
+}
+
+// publishGC sends the cycles that ran since the published ones to the
+// subscribers, dropping them for those that lag behind. It reports whether
+// there still are subscribers.
+func publishGC() bool {
+	var s runtime.MemStats
+	runtime.ReadMemStats(&s)
+	gcMu.Lock()
+	defer gcMu.Unlock()
+	if len(gcSubs) == 0 {
+		gcArmed = false
+		return false
+	}
+	first := gcSeen + 1
+	if s.NumGC > 256 && first < s.NumGC-255 {
+		// The older pauses are gone from the ring of the memstats.
+		first = s.NumGC - 255
+	}
+	for n := first; n <= s.NumGC; n++ {
+		e := gcEvent{
+			NumGC:   n,
+			End:     s.PauseEnd[(n+255)%256],
+			PauseNs: s.PauseNs[(n+255)%256],
+		}
+		if n == gcSeen+1 {
+			e.HeapBefore = gcGoal
+		}
+		if n == s.NumGC {
+			e.HeapAfter, e.Goal = s.HeapAlloc, s.NextGC
+		}
+		for ch := range gcSubs {
+			select {
+			case ch <- e:
+			default:
+			}
+		}
+	}
+	gcSeen, gcGoal = s.NumGC, s.NextGC
+	return true
+}
+
+// subscribeGC returns a channel receiving the GC cycles from now on.
+func subscribeGC() chan gcEvent {
+	ch := make(chan gcEvent, 64)
+	gcMu.Lock()
+	defer gcMu.Unlock()
+	if !gcArmed {
+		var s runtime.MemStats
+		runtime.ReadMemStats(&s)
+		gcSeen, gcGoal = s.NumGC, s.NextGC
+		gcArmed = true
+		armGCSentinel()
+	}
+	gcSubs[ch] = true
+	return ch
+}
+
+func unsubscribeGC(ch chan gcEvent) {
+	gcMu.Lock()
+	delete(gcSubs, ch)
+	gcMu.Unlock()
+}
+
+// streamGCEvents writes the GC cycles to conn as JSON lines until it is
+// closed.
+func streamGCEvents(conn net.Conn) {
+	defer conn.Close()
+	ch := subscribeGC()
+	defer unsubscribeGC(ch)
+	hungUp := make(chan struct{})
+	go func() {
+		io.Copy(ioutil.Discard, conn)
+		close(hungUp)
+	}()
+	enc := json.NewEncoder(conn)
+	for {
+		select {
+		case e := <-ch:
+			if err := enc.Encode(e); err != nil {
+				return
+			}
+		case <-hungUp:
+			return
+		}
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"fmt"
+	"sync"
+)
+
+// StatFunc returns the current value of an application stat, such as the
+// peer count of a node. The value is encoded as JSON.
+type StatFunc func() interface{}
+
+var (
+	statsMu sync.Mutex
+	stats   = make(map[string]StatFunc)
+)
+
+// Register registers the application stat name, whose value fn returns when
+// dcrps asks for the stats, e.g.
+//
+//	agent.Register("peers", func() interface{} { return server.ConnectedCount() })
+//
+// Registering a name again replaces its func, and a nil fn unregisters it.
+// fn is called from the agent goroutine and must be safe for that.
+func Register(name string, fn StatFunc) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	if fn == nil {
+		delete(stats, name)
+		return
+	}
+	stats[name] = fn
+}
+
+// appStats returns the values of the registered stats. A stat whose func
+// panics gets the panic message as its "error".
+func appStats() map[string]interface{} {
+	statsMu.Lock()
+	fns := make(map[string]StatFunc, len(stats))
+	for name, fn := range stats {
+		fns[name] = fn
+	}
+	statsMu.Unlock()
+
+	values := make(map[string]interface{}, len(fns))
+	for name, fn := range fns {
+		values[name] = statValue(fn)
+	}
+	return values
+}
+
+func statValue(fn StatFunc) (v interface{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			v = map[string]string{"error": fmt.Sprint(r)}
+		}
+	}()
+	return fn()
+}
@@ -0,0 +1,97 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/dcrlabs/dcrps/pkg/dcrps"
+	dcrsignal "github.com/dcrlabs/dcrps/signal"
+	"github.com/google/gops/signal"
+)
+
+// agentInfo dials the agent of a process and dumps what it says about
+// itself, raw, along with the connection details. The PID the agent reports
+// is compared to the host PID of local targets, as they differ for processes
+// in another PID namespace, e.g. in a container.
+func agentInfo(args []string) error {
+	fs := flag.NewFlagSet("agent-info", flag.ExitOnError)
+	target := parseTargetFlags(fs, args)
+	if target == "" {
+		return errors.New("missing PID, exec name or address")
+	}
+	hostPID := -1
+	if !strings.Contains(target, ":") {
+		pid, err := resolver.PID(target)
+		if err != nil {
+			return err
+		}
+		hostPID = pid
+	}
+	addr, err := resolver.Resolve(target)
+	if err != nil {
+		return err
+	}
+
+	wait := agentTimeout()
+	if wait == 0 {
+		wait = 10 * time.Second
+	}
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", addr.String(), wait)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("agent:\t%v\n", addr)
+	fmt.Printf("connected from:\t%v in %v\n", conn.LocalAddr(),
+		time.Since(start).Round(time.Microsecond))
+	conn.Close()
+	fmt.Println("protocol:\tgops, one signal byte and its params per connection, answered until close")
+
+	version, err := cmdDeadline(*addr, wait, signal.Version)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("version:\t%q\n", version)
+
+	info, err := cmdDeadline(*addr, wait, dcrsignal.Info)
+	if err != nil {
+		return err
+	}
+	if len(info) == 0 {
+		fmt.Println("info:\tnot reported, the agent only knows the stock gops signals")
+	} else {
+		fmt.Printf("info (signal %#x):\n%s", dcrsignal.Info, info)
+		if !strings.HasSuffix(string(info), "\n") {
+			fmt.Println()
+		}
+	}
+
+	if hostPID < 0 {
+		return nil
+	}
+	fmt.Printf("host PID:\t%d\n", hostPID)
+	fmt.Println(agentPIDLine(info, hostPID))
+	return nil
+}
+
+// agentPIDLine returns the line of the PID the agent reports in info against
+// the hostPID of its process.
+func agentPIDLine(info []byte, hostPID int) string {
+	agentPID, ok := intValue(dcrps.ParseKeyValues(info), "pid")
+	switch {
+	case !ok:
+		return "agent PID:\tunknown"
+	case agentPID != int64(hostPID):
+		return fmt.Sprintf("agent PID:\t%d, differs from the host PID: the process runs in "+
+			"another PID namespace", agentPID)
+	}
+	return fmt.Sprintf("agent PID:\t%d", agentPID)
+}
@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestAgentPIDLine(t *testing.T) {
+	tests := []struct {
+		info    string
+		hostPID int
+		want    string
+	}{
+		{"pid: 4242\nversion: 1\n", 4242, "agent PID:\t4242"},
+		{"pid: 1\nversion: 1\n", 4242, "agent PID:\t1, differs from the host PID: " +
+			"the process runs in another PID namespace"},
+		// A stock agent, which doesn't answer the info signal.
+		{"", 4242, "agent PID:\tunknown"},
+		{"pid: ?\n", 4242, "agent PID:\tunknown"},
+	}
+	for _, test := range tests {
+		if got := agentPIDLine([]byte(test.info), test.hostPID); got != test.want {
+			t.Errorf("agentPIDLine(%q, %d): got %q, want %q", test.info, test.hostPID, got, test.want)
+		}
+	}
+}
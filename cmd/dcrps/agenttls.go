@@ -0,0 +1,122 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// tlsScheme is the prefix of the targets whose agent is dialed over TLS,
+// through a TLS proxy in front of it as gops agents only serve plain TCP.
+const tlsScheme = "tls://"
+
+// tlsServerName is the host name of the tls:// target, set in main. The
+// agents are dialed over TLS when it is set.
+var tlsServerName string
+
+// splitTLSTarget strips the tls:// scheme of target and returns the target
+// and its host name, or the target unchanged and "" when it has none.
+func splitTLSTarget(target string) (string, string) {
+	if !strings.HasPrefix(target, tlsScheme) {
+		return target, ""
+	}
+	target = strings.TrimPrefix(target, tlsScheme)
+	host := target
+	if h, _, err := net.SplitHostPort(target); err == nil {
+		host = h
+	}
+	return target, host
+}
+
+// agentTLSConfig returns the TLS config of the agent connections, from
+// -cert, -key and -ca, verifying the proxy as serverName.
+func agentTLSConfig(serverName string) (*tls.Config, error) {
+	config := &tls.Config{ServerName: serverName}
+	if *tlsCert != "" {
+		key := *tlsKey
+		if key == "" {
+			// A PEM file may hold the key after the certificate.
+			key = *tlsCert
+		}
+		cert, err := tls.LoadX509KeyPair(*tlsCert, key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -cert: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if *tlsCA != "" {
+		b, err := ioutil.ReadFile(*tlsCA)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -ca: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("invalid -ca: no PEM certificate in %s", *tlsCA)
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+// agentToken returns the token authenticating dcrps to the TLS proxy: the
+// first line of -token-file, or else $DCRPS_AGENT_TOKEN. It is "" when
+// neither is set.
+func agentToken() (string, error) {
+	if *tokenFile == "" {
+		return os.Getenv("DCRPS_AGENT_TOKEN"), nil
+	}
+	b, err := ioutil.ReadFile(*tokenFile)
+	if err != nil {
+		return "", fmt.Errorf("invalid -token-file: %v", err)
+	}
+	token := strings.TrimSpace(strings.SplitN(string(b), "\n", 2)[0])
+	if token == "" {
+		return "", fmt.Errorf("invalid -token-file: %s holds no token", *tokenFile)
+	}
+	return token, nil
+}
+
+// dialAgentTLS runs the TLS handshake with the proxy of the agent on conn,
+// which it closes on failure, and sends the token when there is one, as a
+// line of its own ahead of the request.
+func dialAgentTLS(conn net.Conn) (net.Conn, error) {
+	config, err := agentTLSConfig(tlsServerName)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	token, err := agentToken()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if strings.ContainsAny(token, "\r\n") {
+		conn.Close()
+		return nil, errors.New("the agent token spans several lines")
+	}
+	tc := tls.Client(conn, config)
+	// The handshake is part of the connection, timed by -connect-timeout.
+	tc.SetDeadline(time.Now().Add(*dialTimeout))
+	if err := tc.Handshake(); err != nil {
+		tc.Close()
+		return nil, fmt.Errorf("TLS handshake: %v", err)
+	}
+	if token != "" {
+		if _, err := tc.Write([]byte(token + "\n")); err != nil {
+			tc.Close()
+			return nil, err
+		}
+	}
+	tc.SetDeadline(time.Time{})
+	return tc, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gops/signal"
+)
+
+// tlsProxy serves a TLS proxy for localhost that reads the token line and the
+// signal of a request and answers "ok". It returns its listener, the PEM of
+// its certificate and the channel of the tokens it reads. Closing l stops it.
+func tlsProxy(t *testing.T) (l net.Listener, caPEM []byte, tokens chan string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	l, err = tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens = make(chan string, 1)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			r := bufio.NewReader(conn)
+			token, _ := r.ReadString('\n')
+			r.ReadByte()
+			tokens <- token
+			conn.Write([]byte("ok"))
+			conn.Close()
+		}
+	}()
+	return l, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), tokens
+}
+
+func TestDialAgentTLS(t *testing.T) {
+	l, caPEM, tokens := tlsProxy(t)
+	defer l.Close()
+	addr := l.Addr().(*net.TCPAddr)
+	dir, err := ioutil.TempDir("", "dcrps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca := filepath.Join(dir, "ca.pem")
+	token := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(ca, caPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(token, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer func(ca, token, name string) {
+		*tlsCA, *tokenFile, tlsServerName = ca, token, name
+	}(*tlsCA, *tokenFile, tlsServerName)
+	*tlsCA, *tokenFile, tlsServerName = ca, token, "localhost"
+
+	out, err := cmd(*addr, signal.Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "ok" {
+		t.Errorf("response: got=%q want=%q", out, "ok")
+	}
+	if got := <-tokens; got != "s3cret\n" {
+		t.Errorf("token: got=%q want=%q", got, "s3cret\n")
+	}
+
+	// The proxy isn't the host it was given as.
+	tlsServerName = "vps.example.com"
+	if _, err := cmd(*addr, signal.Version); err == nil {
+		t.Error("wrong server name: got no error")
+	}
+}
+
+func TestSplitTLSTarget(t *testing.T) {
+	tests := []struct {
+		target, want, host string
+	}{
+		{"tls://vps.example.com:9443", "vps.example.com:9443", "vps.example.com"},
+		{"tls://10.0.0.5", "10.0.0.5", "10.0.0.5"},
+		{"10.0.0.5:9000", "10.0.0.5:9000", ""},
+		{"dcrd", "dcrd", ""},
+	}
+	for _, test := range tests {
+		got, host := splitTLSTarget(test.target)
+		if got != test.want || host != test.host {
+			t.Errorf("splitTLSTarget(%q): got=%q, %q want=%q, %q", test.target, got, host, test.want, test.host)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// alertMetrics are the metrics alert expressions can test.
+var alertMetrics = []string{"memory", "rss", "cpu", "threads", "goroutines", "connections"}
+
+// alertExpr is a "metric op number" threshold expression such as
+// "memory>80".
+type alertExpr struct {
+	metric    string
+	op        string
+	threshold float64
+}
+
+var alertExprRE = regexp.MustCompile(`^\s*([a-z]+)\s*(>=|<=|==|!=|>|<)\s*([-+0-9.eE]+)\s*$`)
+
+func parseAlertExpr(s string) (alertExpr, error) {
+	m := alertExprRE.FindStringSubmatch(s)
+	if m == nil {
+		return alertExpr{}, fmt.Errorf("invalid alert %q, want metric op number", s)
+	}
+	if !containsString(alertMetrics, m[1]) {
+		return alertExpr{}, fmt.Errorf("invalid alert metric %q, want one of %s",
+			m[1], strings.Join(alertMetrics, ", "))
+	}
+	threshold, err := strconv.ParseFloat(m[3], 64)
+	if err != nil {
+		return alertExpr{}, fmt.Errorf("invalid alert threshold %q", m[3])
+	}
+	return alertExpr{metric: m[1], op: m[2], threshold: threshold}, nil
+}
+
+// eval reports whether value crosses the threshold.
+func (e alertExpr) eval(value float64) bool {
+	switch e.op {
+	case ">":
+		return value > e.threshold
+	case ">=":
+		return value >= e.threshold
+	case "<":
+		return value < e.threshold
+	case "<=":
+		return value <= e.threshold
+	case "==":
+		return value == e.threshold
+	case "!=":
+		return value != e.threshold
+	}
+	return false
+}
+
+func (e alertExpr) String() string {
+	return e.metric + e.op + strconv.FormatFloat(e.threshold, 'f', -1, 64)
+}
+
+// alertFlag collects the repeated -alert flags.
+type alertFlag []alertExpr
+
+func (f *alertFlag) String() string {
+	s := make([]string, len(*f))
+	for i, e := range *f {
+		s[i] = e.String()
+	}
+	return strings.Join(s, ",")
+}
+
+func (f *alertFlag) Set(s string) error {
+	e, err := parseAlertExpr(s)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, e)
+	return nil
+}
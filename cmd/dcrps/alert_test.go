@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestParseAlertExpr(t *testing.T) {
+	tests := []struct {
+		expr  string
+		value float64
+		want  bool
+	}{
+		{"memory>80", 85, true},
+		{"memory>80", 80, false},
+		{"memory >= 80", 80, true},
+		{" cpu < 5.5 ", 5, true},
+		{"threads<=10", 11, false},
+		{"goroutines==0", 0, true},
+		{"connections!=8", 8, false},
+	}
+	for _, test := range tests {
+		e, err := parseAlertExpr(test.expr)
+		if err != nil {
+			t.Errorf("parseAlertExpr(%q): %v", test.expr, err)
+			continue
+		}
+		if got := e.eval(test.value); got != test.want {
+			t.Errorf("%q.eval(%v): got=%v want=%v", test.expr, test.value, got, test.want)
+		}
+	}
+
+	for _, expr := range []string{"", "memory", "memory>", "disk>80", "memory=>80", "memory>x"} {
+		if _, err := parseAlertExpr(expr); err == nil {
+			t.Errorf("parseAlertExpr(%q): expected an error", expr)
+		}
+	}
+}
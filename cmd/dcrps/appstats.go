@@ -0,0 +1,64 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+
+	"github.com/dcrlabs/dcrps/pkg/dcrps"
+)
+
+// errNoAppStats is the error of the agents that don't serve the application
+// stats.
+var errNoAppStats = dcrps.ErrNoAppStats
+
+// readAppStats reads the application stats of the agent at addr, the JSON
+// of each by name.
+func readAppStats(addr net.TCPAddr) (map[string]json.RawMessage, error) {
+	values, err := agentClient().AppStats(addr)
+	return values, agentError(err)
+}
+
+// writeAppStats writes the application stats to w as "name: value" lines
+// sorted by name, the strings unquoted and the other values as JSON.
+func writeAppStats(w io.Writer, values map[string]json.RawMessage) {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v := string(values[name])
+		var s string
+		if err := json.Unmarshal(values[name], &s); err == nil {
+			v = s
+		}
+		fmt.Fprintf(w, "%s: %s\n", name, v)
+	}
+}
+
+// appStats prints the application stats the process registered with the
+// agent of github.com/dcrlabs/dcrps/agent, such as its peer count.
+func appStats(addr net.TCPAddr, _ []string) error {
+	values, err := readAppStats(addr)
+	if err != nil {
+		return err
+	}
+	if *jsonOutput {
+		printJSON(values)
+		return nil
+	}
+	if len(values) == 0 {
+		fmt.Println("the process registered no application stats")
+		return nil
+	}
+	writeAppStats(os.Stdout, values)
+	return nil
+}
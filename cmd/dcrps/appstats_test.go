@@ -0,0 +1,21 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestWriteAppStats(t *testing.T) {
+	values := map[string]json.RawMessage{
+		"sync-height": json.RawMessage(`412000`),
+		"network":     json.RawMessage(`"mainnet"`),
+		"mempool":     json.RawMessage(`{"txs":12}`),
+	}
+	var b bytes.Buffer
+	writeAppStats(&b, values)
+	want := "mempool: {\"txs\":12}\nnetwork: mainnet\nsync-height: 412000\n"
+	if got := b.String(); got != want {
+		t.Errorf("got:\n%swant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/dcrlabs/dcrps/resolve"
+	"github.com/google/gops/goprocess"
+)
+
+// batchTarget is the target that runs an agent command against every process
+// running the agent.
+const batchTarget = "all"
+
+// toolCommands are the agent commands that launch a Go tool on their capture
+// or serve it, watch until interrupted or wait for a key, which can't run
+// against several processes.
+var toolCommands = map[string]bool{
+	"pprof-heap":  true,
+	"pprof-cpu":   true,
+	"pprof-mutex": true,
+	"pprof-block": true,
+	"trace":       true,
+	"flame":       true,
+	"gcwatch":     true,
+	"compare":     true,
+	"pprof-wall":  true,
+}
+
+// batchProcesses returns the processes an agent command runs against when
+// target stands for several: every process running the agent for "all" and,
+// with -each, every process sharing the exec name target. It returns false
+// when target is a single process or address.
+func batchProcesses(target string) ([]goprocess.P, bool) {
+	if *sshHost != "" {
+		return remoteBatchProcesses(target)
+	}
+	var ps []goprocess.P
+	switch {
+	case target == batchTarget:
+		for _, p := range dcrProcesses() {
+			if p.Agent {
+				ps = append(ps, p)
+			}
+		}
+	case *each:
+		// All of them, rather than the one the user would be asked for.
+		resolver.Choose = nil
+		_, err := resolver.PID(target)
+		ae, ok := err.(*resolve.AmbiguousError)
+		if !ok {
+			return nil, false
+		}
+		ps = ae.Processes
+	default:
+		return nil, false
+	}
+	sort.Slice(ps, func(i, j int) bool {
+		if ps[i].Exec != ps[j].Exec {
+			return ps[i].Exec < ps[j].Exec
+		}
+		return ps[i].PID < ps[j].PID
+	})
+	return ps, true
+}
+
+// runBatch runs the agent command name against each of ps under a header
+// naming the process, written to the standard error with -json so that the
+// standard output holds only the JSON. It goes on after a failure and
+// returns the exit code of the first one, or 0.
+func runBatch(name string, ac agentCommand, ps []goprocess.P, params []string) int {
+	var headers io.Writer = os.Stdout
+	if *jsonOutput {
+		headers = os.Stderr
+	}
+	code := 0
+	for i, p := range ps {
+		if i > 0 {
+			fmt.Fprintln(headers)
+		}
+		fmt.Fprintf(headers, "==> %s (PID %d) <==\n", p.Exec, p.PID)
+		err := func() error {
+			addr, err := resolveAgent(strconv.Itoa(p.PID))
+			if err != nil {
+				return err
+			}
+			cmdTimeout = ac.timeout
+			return ac.fn(*addr, params)
+		}()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s (PID %d): %v\n", name, p.Exec, p.PID, err)
+			if code == 0 {
+				code = exitCode(err)
+			}
+		}
+	}
+	return code
+}
@@ -0,0 +1,89 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// benchPhases accumulates the time spent in each phase of a run for
+// -benchmark. Phases may be timed concurrently.
+var benchPhases = struct {
+	sync.Mutex
+	start  time.Time
+	names  []string // in the order they first ran
+	totals map[string]time.Duration
+	counts map[string]int
+}{
+	start:  time.Now(),
+	totals: make(map[string]time.Duration),
+	counts: make(map[string]int),
+}
+
+// benchPhase starts timing a run of the phase name and returns the func that
+// ends it, for use as
+//
+//	defer benchPhase("enumeration")()
+//
+// It costs next to nothing without -benchmark.
+func benchPhase(name string) func() {
+	if !*benchmark {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		d := time.Since(start)
+		benchPhases.Lock()
+		defer benchPhases.Unlock()
+		if _, ok := benchPhases.totals[name]; !ok {
+			benchPhases.names = append(benchPhases.names, name)
+		}
+		benchPhases.totals[name] += d
+		benchPhases.counts[name]++
+	}
+}
+
+// printBenchmark prints the time spent in each phase to the standard error
+// with -benchmark.
+func printBenchmark() {
+	if !*benchmark {
+		return
+	}
+	writeBenchmark(os.Stderr, time.Since(benchPhases.start))
+}
+
+// writeBenchmark writes the table of the phases timed so far to out, with
+// the wall time of the run.
+func writeBenchmark(out io.Writer, wall time.Duration) {
+	benchPhases.Lock()
+	defer benchPhases.Unlock()
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "phase\truns\ttotal\tper run\t")
+	for _, name := range benchPhases.names {
+		total, n := benchPhases.totals[name], benchPhases.counts[name]
+		fmt.Fprintf(w, "%s\t%d\t%v\t%v\t\n", name, n,
+			total.Round(time.Microsecond), (total / time.Duration(n)).Round(time.Microsecond))
+	}
+	fmt.Fprintf(w, "wall\t\t%v\t\t\n", wall.Round(time.Microsecond))
+	w.Flush()
+}
+
+// benchConn times the "agent request" phase of a connection to an agent,
+// from its dial to its close.
+type benchConn struct {
+	net.Conn
+	done func()
+}
+
+func (c *benchConn) Close() error {
+	c.done()
+	return c.Conn.Close()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// resetBenchPhases clears the phases timed so far, turning -benchmark to on,
+// and returns the func restoring them.
+func resetBenchPhases(on bool) func() {
+	benchPhases.Lock()
+	defer benchPhases.Unlock()
+	names, totals, counts, enabled := benchPhases.names, benchPhases.totals, benchPhases.counts, *benchmark
+	benchPhases.names = nil
+	benchPhases.totals = make(map[string]time.Duration)
+	benchPhases.counts = make(map[string]int)
+	*benchmark = on
+	return func() {
+		benchPhases.Lock()
+		defer benchPhases.Unlock()
+		benchPhases.names, benchPhases.totals, benchPhases.counts, *benchmark = names, totals, counts, enabled
+	}
+}
+
+func TestBenchPhase(t *testing.T) {
+	defer resetBenchPhases(true)()
+	end := benchPhase("enumeration")
+	time.Sleep(2 * time.Millisecond)
+	end()
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer benchPhase("agent request")()
+		}()
+	}
+	wg.Wait()
+	benchPhase("enumeration")()
+
+	if got, want := strings.Join(benchPhases.names, ","), "enumeration,agent request"; got != want {
+		t.Errorf("phases: got %s, want %s in the order they first ran", got, want)
+	}
+	if benchPhases.counts["enumeration"] != 2 || benchPhases.counts["agent request"] != 3 {
+		t.Errorf("runs: got %v", benchPhases.counts)
+	}
+	if d := benchPhases.totals["enumeration"]; d < 2*time.Millisecond {
+		t.Errorf("enumeration total: got %v, want at least the 2ms slept", d)
+	}
+}
+
+func TestBenchPhaseDisabled(t *testing.T) {
+	defer resetBenchPhases(false)()
+	benchPhase("enumeration")()
+	if len(benchPhases.names) != 0 || len(benchPhases.counts) != 0 {
+		t.Errorf("without -benchmark: got phases %v", benchPhases.counts)
+	}
+}
+
+func TestWriteBenchmark(t *testing.T) {
+	defer resetBenchPhases(true)()
+	benchPhases.names = []string{"enumeration", "agent request"}
+	benchPhases.totals["enumeration"] = 1500 * time.Microsecond
+	benchPhases.counts["enumeration"] = 1
+	benchPhases.totals["agent request"] = 9 * time.Millisecond
+	benchPhases.counts["agent request"] = 3
+	var b bytes.Buffer
+	writeBenchmark(&b, 12*time.Millisecond)
+	want := "          phase  runs  total  per run\n" +
+		"    enumeration     1  1.5ms    1.5ms\n" +
+		"  agent request     3    9ms      3ms\n" +
+		"           wall         12ms         \n"
+	if got := b.String(); got != want {
+		t.Errorf("got:\n%swant:\n%s", got, want)
+	}
+}
+
+func TestBenchConn(t *testing.T) {
+	defer resetBenchPhases(true)()
+	client, server := net.Pipe()
+	defer server.Close()
+	c := &benchConn{Conn: client, done: benchPhase("agent request")}
+	c.Close()
+	if benchPhases.counts["agent request"] != 1 {
+		t.Errorf("runs: got %v, want the request timed once closed", benchPhases.counts)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/shirou/gopsutil/process"
+)
+
+// connectionCheck is a process and the most connections it may have.
+type connectionCheck struct {
+	target string
+	max    int
+}
+
+// parseConnectionChecks parses the <exec|pid>[=max] arguments of
+// check-connections, using defaultMax for those without a maximum.
+func parseConnectionChecks(args []string, defaultMax int) ([]connectionCheck, error) {
+	var checks []connectionCheck
+	for _, arg := range args {
+		c := connectionCheck{target: arg, max: defaultMax}
+		if i := strings.LastIndex(arg, "="); i >= 0 {
+			max, err := strconv.Atoi(arg[i+1:])
+			if err != nil || max < 0 {
+				return nil, fmt.Errorf("invalid maximum in %q", arg)
+			}
+			c.target, c.max = arg[:i], max
+		}
+		if c.target == "" {
+			return nil, fmt.Errorf("missing PID or exec name in %q", arg)
+		}
+		if c.max < 0 {
+			return nil, fmt.Errorf("no maximum for %s, use -max or %s=max", c.target, c.target)
+		}
+		checks = append(checks, c)
+	}
+	return checks, nil
+}
+
+// checkConnections checks the connection counts of processes against their
+// maximums and fails when any exceeds its maximum.
+func checkConnections(args []string) error {
+	fs := flag.NewFlagSet("check-connections", flag.ExitOnError)
+	max := fs.Int("max", -1, "default maximum number of connections")
+	positional := parseInterspersedFlags(fs, args)
+	if len(positional) == 0 {
+		return errors.New("missing PID or exec name")
+	}
+	checks, err := parseConnectionChecks(positional, *max)
+	if err != nil {
+		return err
+	}
+	resolver = exactResolver()
+
+	var exceeded int
+	for _, c := range checks {
+		pid, err := resolver.PID(c.target)
+		if err != nil {
+			return err
+		}
+		p, err := process.NewProcess(int32(pid))
+		if err != nil {
+			return fmt.Errorf("cannot read process info: %v", err)
+		}
+		conns, err := p.Connections()
+		if err != nil {
+			return fmt.Errorf("cannot read connections of %s: %v", c.target, err)
+		}
+		var n int
+		for _, conn := range conns {
+			if conn.Status != "LISTEN" {
+				n++
+			}
+		}
+		status := "ok"
+		if n > c.max {
+			status = "EXCEEDED"
+			exceeded++
+		}
+		fmt.Printf("%s %s (PID %d): %d connections, max %d\n", status, c.target, pid, n, c.max)
+	}
+	if exceeded > 0 {
+		return fmt.Errorf("%d of %d processes exceed their connection maximum", exceeded, len(checks))
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseConnectionChecks(t *testing.T) {
+	tests := []struct {
+		args       []string
+		defaultMax int
+		want       []connectionCheck
+		wantErr    bool
+	}{
+		{[]string{"dcrd"}, 150, []connectionCheck{{"dcrd", 150}}, false},
+		{[]string{"dcrd", "dcrwallet=20"}, 150, []connectionCheck{{"dcrd", 150}, {"dcrwallet", 20}}, false},
+		{[]string{"1234=0"}, -1, []connectionCheck{{"1234", 0}}, false},
+		// The last = splits the maximum off.
+		{[]string{"a=b=3"}, -1, []connectionCheck{{"a=b", 3}}, false},
+		{[]string{"dcrd"}, -1, nil, true}, // no -max
+		{[]string{"dcrd=", "dcrwallet"}, 5, nil, true},
+		{[]string{"dcrd=x"}, 5, nil, true},
+		{[]string{"dcrd=-1"}, 5, nil, true},
+		{[]string{"=20"}, 5, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseConnectionChecks(tt.args, tt.defaultMax)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: got error %v", tt.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %v want %v", tt.args, got, tt.want)
+		}
+	}
+}
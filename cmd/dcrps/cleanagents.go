@@ -0,0 +1,132 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/dcrlabs/dcrps/internal"
+	"github.com/google/gops/goprocess"
+	"github.com/shirou/gopsutil/process"
+)
+
+// agentEntry is a PID file the gops agent left in its config dir.
+type agentEntry struct {
+	pid  int
+	path string
+}
+
+// agentEntries returns the PID files in the gops config dir, by PID.
+func agentEntries() ([]agentEntry, error) {
+	dir, err := internal.ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []agentEntry
+	for _, f := range files {
+		pid, err := strconv.Atoi(f.Name())
+		if err != nil || pid <= 0 || f.IsDir() {
+			continue
+		}
+		entries = append(entries, agentEntry{pid, filepath.Join(dir, f.Name())})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].pid < entries[j].pid })
+	return entries, nil
+}
+
+// staleness is why an agent entry is stale.
+type staleness int
+
+const (
+	notStale staleness = iota
+	// pidGone entries are of processes that have exited.
+	pidGone
+	// pidReused entries name a PID that a process that isn't a Go
+	// program now has, most likely reused since the agent exited.
+	pidReused
+)
+
+// agentStaleness judges an entry from whether its PID exists and, when it
+// does, whether it is a Go process. Entries of live non-dcr Go processes
+// belong to other programs and are never stale, and a Go process found for a
+// PID said not to exist is taken as live, as only pidGone entries are pruned.
+func agentStaleness(exists, goProcess bool) staleness {
+	switch {
+	case goProcess:
+		return notStale
+	case !exists:
+		return pidGone
+	}
+	return pidReused
+}
+
+// cleanAgents reports the stale entries of the gops config dir, which make
+// dcrps resolve a target to a process that is gone or to an unrelated one,
+// and removes the entries of exited processes with -prune. Reused PIDs are
+// only reported, since their entries can't be told apart for sure from
+// those of a process in another PID namespace.
+func cleanAgents(args []string) error {
+	fs := flag.NewFlagSet("clean-agents", flag.ExitOnError)
+	prune := fs.Bool("prune", false, "remove the entries of exited processes")
+	parseCommandFlags(fs, args)
+
+	entries, err := agentEntries()
+	if err != nil {
+		return err
+	}
+	var gone, reused, pruned int
+	for _, e := range entries {
+		exists, err := process.PidExists(int32(e.pid))
+		if err != nil {
+			return fmt.Errorf("cannot check PID %d: %v", e.pid, err)
+		}
+		var p goprocess.P
+		var goProcess bool
+		if exists {
+			p, goProcess, _ = goprocess.Find(e.pid)
+			if goProcess && !resolver.Match(p.Exec) {
+				continue
+			}
+		}
+		switch agentStaleness(exists, goProcess) {
+		case pidGone:
+			gone++
+			if !*prune {
+				fmt.Printf("%d\tstale, process exited\t%s\n", e.pid, e.path)
+				continue
+			}
+			// PID files are only removed when the process is still
+			// gone right before.
+			if exists, err := process.PidExists(int32(e.pid)); err != nil || exists {
+				fmt.Printf("%d\tkept, process appeared\t%s\n", e.pid, e.path)
+				continue
+			}
+			if err := os.Remove(e.path); err != nil {
+				return err
+			}
+			pruned++
+			fmt.Printf("%d\tpruned\t%s\n", e.pid, e.path)
+		case pidReused:
+			reused++
+			fmt.Printf("%d\tstale, PID reused by a non-Go process\t%s\n", e.pid, e.path)
+		}
+	}
+	fmt.Printf("%d entries: %d of exited processes, %d of reused PIDs, %d pruned\n",
+		len(entries), gone, reused, pruned)
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAgentEntries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gops")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"42", "7", "0", "notapid"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("1234"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "9"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("GOPS_CONFIG_DIR", os.Getenv("GOPS_CONFIG_DIR"))
+	os.Setenv("GOPS_CONFIG_DIR", dir)
+
+	entries, err := agentEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].pid != 7 || entries[1].pid != 42 {
+		t.Fatalf("agentEntries: got %+v, want PIDs 7 and 42", entries)
+	}
+	if want := filepath.Join(dir, "7"); entries[0].path != want {
+		t.Errorf("agentEntries: got path %v want %v", entries[0].path, want)
+	}
+}
+
+func TestAgentStaleness(t *testing.T) {
+	tests := []struct {
+		exists, goProcess bool
+		want              staleness
+	}{
+		{false, false, pidGone},
+		{true, false, pidReused},
+		{true, true, notStale},
+		// Found as a Go process in between: not known to be gone.
+		{false, true, notStale},
+	}
+	for _, test := range tests {
+		got := agentStaleness(test.exists, test.goProcess)
+		if got != test.want {
+			t.Errorf("agentStaleness(exists %v, Go %v): got=%v want=%v",
+				test.exists, test.goProcess, got, test.want)
+		}
+		// Only the entries of exited processes are pruned.
+		if test.exists || test.goProcess {
+			if got == pidGone {
+				t.Errorf("agentStaleness(exists %v, Go %v): prunable", test.exists, test.goProcess)
+			}
+		}
+	}
+}
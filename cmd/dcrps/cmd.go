@@ -0,0 +1,696 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	ossignal "os/signal"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dcrlabs/dcrps/pkg/dcrps"
+	"github.com/dcrlabs/dcrps/resolve"
+	dcrsignal "github.com/dcrlabs/dcrps/signal"
+	"github.com/google/gops/goprocess"
+	"github.com/google/gops/signal"
+	"github.com/shirou/gopsutil/process"
+)
+
+// agentCommand is a command sent to the agent of a single process.
+type agentCommand struct {
+	fn func(addr net.TCPAddr, params []string) error
+	// timeout is the default timeout of each of its round trips to the
+	// agent, which -timeout overrides. The captures take a fixed window
+	// on the agent side and get more time than the quick commands.
+	timeout time.Duration
+}
+
+var cmds = map[string]agentCommand{
+	"stack":      {stackTrace, 10 * time.Second},
+	"gc":         {gc, time.Minute},
+	"memstats":   {memStats, 10 * time.Second},
+	"version":    {version, 10 * time.Second},
+	"pprof-heap": {pprofHeap, time.Minute},
+	"pprof-cpu":  {pprofCPU, 2 * time.Minute},
+	"stats":      {stats, 10 * time.Second},
+	"trace":      {trace, defaultTraceWindow + traceTimeoutSlack},
+	"setgc":      {setGC, 10 * time.Second},
+	"commands":   {commands, 10 * time.Second},
+
+	"pprof-mutex": {pprofMutex, time.Minute},
+	"pprof-block": {pprofBlock, time.Minute},
+	"appstats":    {appStats, 10 * time.Second},
+
+	"pprof-heap-diff": {pprofHeapDiff, time.Minute},
+	"flame":           {flameGraph, 2 * time.Minute},
+	"gcwatch":         {gcWatch, 10 * time.Second},
+	"compare":         {compare, 10 * time.Second},
+	"pprof-wall":      {pprofWall, 10 * time.Second},
+}
+
+// cmdTimeout is the default timeout of the agent command being run, set in
+// main. It is zero for the other commands.
+var cmdTimeout time.Duration
+
+// agentTimeout returns the timeout of a round trip to the agent: -timeout
+// when set, else the default of the command being run. Zero means none.
+func agentTimeout() time.Duration {
+	if *timeout > 0 {
+		return *timeout
+	}
+	return cmdTimeout
+}
+
+// agentClient returns the client of the requests to the agents, which gives
+// each round trip agentTimeout and retries the read-only ones up to -retry
+// times when the connection is reset while reading the response, as happens
+// to busy agents.
+func agentClient() *dcrps.Client {
+	return &dcrps.Client{
+		Timeout: agentTimeout(),
+		Retries: *retry,
+		Dial: func(addr net.TCPAddr) (net.Conn, error) {
+			conn, err := dialAgent(addr)
+			if err != nil {
+				return nil, err
+			}
+			return &benchConn{Conn: conn, done: benchPhase("agent request")}, nil
+		},
+		OnRetry: func(err error) {
+			fmt.Fprintf(os.Stderr, "retrying after %v\n", err)
+		},
+	}
+}
+
+// cmd sends the signal c with its params to the agent at addr and returns the
+// response.
+func cmd(addr net.TCPAddr, c byte, params ...byte) ([]byte, error) {
+	out, err := agentClient().Request(addr, c, params...)
+	return out, agentError(err)
+}
+
+// agentError points the timeouts of the requests to the agents at -timeout,
+// and those of the connections at -connect-timeout. The dial errors stay
+// *dcrps.DialError for exitCode.
+func agentError(err error) error {
+	switch e := err.(type) {
+	case *dcrps.TimeoutError:
+		return fmt.Errorf("%v, see -timeout to wait longer", e)
+	case *dcrps.DialError:
+		if e.Timeout > 0 {
+			return &dcrps.DialError{Addr: e.Addr, Err: fmt.Errorf("%v; see -connect-timeout", e)}
+		}
+	}
+	return err
+}
+
+// dialAgent connects to the agent at addr within -connect-timeout, through the
+// -ssh host when set, and over TLS for a tls:// target. Its errors are
+// *dcrps.DialError, as those of the client dialing itself.
+func dialAgent(addr net.TCPAddr) (net.Conn, error) {
+	defer benchPhase("agent dial")()
+	var conn net.Conn
+	var err error
+	if *sshHost != "" {
+		conn, err = dialSSH(addr)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr.String(), *dialTimeout)
+	}
+	if err == nil && tlsServerName != "" {
+		conn, err = dialAgentTLS(conn)
+	}
+	if err != nil {
+		de := &dcrps.DialError{Addr: addr, Err: err}
+		if err, ok := err.(net.Error); ok && err.Timeout() {
+			de.Timeout = *dialTimeout
+		}
+		return nil, de
+	}
+	return conn, nil
+}
+
+// cmdDeadline is like cmd but gives up when the agent hasn't connected and
+// answered within timeout, and never retries.
+func cmdDeadline(addr net.TCPAddr, timeout time.Duration, c byte, params ...byte) ([]byte, error) {
+	client := agentClient()
+	client.Timeout, client.Retries = timeout, 0
+	return client.Request(addr, c, params...)
+}
+
+func cmdWithPrint(addr net.TCPAddr, c byte, params ...byte) error {
+	fmt.Println(addr)
+	out, err := cmd(addr, c, params...)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s", out)
+	return nil
+}
+
+// preflightAgent checks that the local process target refers to runs the agent,
+// without dialing it. Address targets and targets found through the port file
+// can't be checked and always pass, as do those of -ssh, which only resolve to
+// agents. A target with no process is a *resolve.NoProcessError, one several
+// processes match a *resolve.AmbiguousError and one with no agent a
+// *resolve.NoAgentError, for exitCode.
+func preflightAgent(target string) error {
+	if strings.Contains(target, ":") || *agentPortFile != "" || *sshHost != "" {
+		return nil
+	}
+	pid, err := resolver.PID(target)
+	if err != nil {
+		return err
+	}
+	if exists, err := process.PidExists(int32(pid)); err == nil && !exists {
+		return &resolve.NoProcessError{Target: target}
+	}
+	p, ok, err := goprocess.Find(pid)
+	if err != nil {
+		return fmt.Errorf("cannot read process %d: %v", pid, err)
+	}
+	if !ok {
+		return &resolve.NoAgentError{PID: pid, Err: errors.New("not a Go process")}
+	}
+	if !p.Agent {
+		return &resolve.NoAgentError{PID: pid, Err: fmt.Errorf("%s is not running the agent", p.Exec)}
+	}
+	return nil
+}
+
+// The actual commands:
+
+func setGC(addr net.TCPAddr, params []string) error {
+	if len(params) != 1 {
+		return errors.New("missing gc percentage")
+	}
+	perc, err := strconv.ParseInt(params[0], 10, strconv.IntSize)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, binary.MaxVarintLen64)
+	binary.PutVarint(buf, perc)
+	return cmdWithPrint(addr, signal.SetGCPercent, buf...)
+}
+
+func stackTrace(addr net.TCPAddr, params []string) error {
+	fs := flag.NewFlagSet("stack", flag.ExitOnError)
+	dedupe := fs.Bool("dedupe", false, "print the identical stacks once with a count")
+	fs.BoolVar(dedupe, "dedup", false, "shorthand for -dedupe")
+	parseCommandFlags(fs, params)
+	if !*dedupe {
+		return cmdWithPrint(addr, signal.StackTrace)
+	}
+	fmt.Println(addr)
+	out, err := cmd(addr, signal.StackTrace)
+	if err != nil {
+		return err
+	}
+	fmt.Print(dedupeReport(dcrps.ParseStack(out)))
+	return nil
+}
+
+func gc(addr net.TCPAddr, _ []string) error {
+	_, err := cmd(addr, signal.GC)
+	return err
+}
+
+func stats(addr net.TCPAddr, _ []string) error {
+	fmt.Println(addr)
+	out, err := cmd(addr, signal.Stats)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s", out)
+
+	// The host CPU count is only known for processes on this host.
+	if !addr.IP.IsLoopback() || *sshHost != "" {
+		return nil
+	}
+	hostCPUs := runtime.NumCPU()
+	fmt.Printf("host CPUs: %v\n", hostCPUs)
+	if w := gomaxprocsWarning(dcrps.ParseKeyValues(out), hostCPUs); w != "" {
+		fmt.Println(w)
+	}
+	return nil
+}
+
+// gomaxprocsWarning returns the warning of the GOMAXPROCS of the stats values
+// differing from the hostCPUs, or "" when it doesn't or isn't reported.
+func gomaxprocsWarning(values map[string]string, hostCPUs int) string {
+	gomaxprocs, ok := intValue(values, "GOMAXPROCS")
+	if !ok || gomaxprocs == int64(hostCPUs) {
+		return ""
+	}
+	return fmt.Sprintf("warning: GOMAXPROCS %v differs from the %v host CPUs; "+
+		"a containerized process may not be aware of its cgroup CPU limit",
+		gomaxprocs, hostCPUs)
+}
+
+func version(addr net.TCPAddr, _ []string) error {
+	return cmdWithPrint(addr, signal.Version)
+}
+
+func pprofHeap(addr net.TCPAddr, params []string) error {
+	httpAddr, err := parsePprofFlags("pprof-heap", params)
+	if err != nil {
+		return err
+	}
+	return pprof(addr, signal.HeapProfile, httpAddr)
+}
+
+func pprofCPU(addr net.TCPAddr, params []string) error {
+	httpAddr, err := parsePprofFlags("pprof-cpu", params)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Profiling CPU now, will take 30 secs...")
+	return pprof(addr, signal.CPUProfile, httpAddr)
+}
+
+func pprofMutex(addr net.TCPAddr, params []string) error {
+	fs := flag.NewFlagSet("pprof-mutex", flag.ExitOnError)
+	fraction := fs.Int("fraction", -1, "sample 1 in n mutex contention events for -duration first")
+	window := fs.Duration("duration", defaultSamplingWindow, "time to sample for with -fraction")
+	httpAddr, err := parsePprofFlagSet(fs, params)
+	if err != nil {
+		return err
+	}
+	if *fraction < 0 {
+		return pprof(addr, dcrsignal.MutexProfile, httpAddr)
+	}
+	err = sampleProfile(addr, dcrsignal.SetMutexProfileFraction, "mutex profile fraction", *fraction, *window)
+	if err != nil {
+		return err
+	}
+	err = pprof(addr, dcrsignal.MutexProfile, httpAddr)
+	if _, ok := err.(*emptyProfileError); ok {
+		return fmt.Errorf("no mutex contention was sampled in %v", *window)
+	}
+	return err
+}
+
+func pprofBlock(addr net.TCPAddr, params []string) error {
+	fs := flag.NewFlagSet("pprof-block", flag.ExitOnError)
+	rate := fs.Int("rate", -1, "sample a blocking event per n nanoseconds blocked for -duration first")
+	window := fs.Duration("duration", defaultSamplingWindow, "time to sample for with -rate")
+	httpAddr, err := parsePprofFlagSet(fs, params)
+	if err != nil {
+		return err
+	}
+	if *rate < 0 {
+		return pprof(addr, dcrsignal.BlockProfile, httpAddr)
+	}
+	err = sampleProfile(addr, dcrsignal.SetBlockProfileRate, "block profile rate", *rate, *window)
+	if err != nil {
+		return err
+	}
+	err = pprof(addr, dcrsignal.BlockProfile, httpAddr)
+	if _, ok := err.(*emptyProfileError); ok {
+		return fmt.Errorf("no blocking event was sampled in %v", *window)
+	}
+	return err
+}
+
+// defaultSamplingWindow is the time pprof-mutex and pprof-block sample for
+// at the rate they are given.
+const defaultSamplingWindow = 10 * time.Second
+
+// setProfileRate sets the rate of sig, SetMutexProfileFraction or
+// SetBlockProfileRate, and returns the previous one.
+func setProfileRate(addr net.TCPAddr, sig byte, rate int) (int, error) {
+	buf := make([]byte, binary.MaxVarintLen64)
+	out, err := cmd(addr, sig, buf[:binary.PutVarint(buf, int64(rate))]...)
+	if err != nil {
+		return 0, err
+	}
+	prev, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid previous rate %q", out)
+	}
+	return prev, nil
+}
+
+// sampleProfile samples the profile whose rate sig sets at rate over window,
+// then restores its previous rate, so that the profile read next holds the
+// events of the window. An interrupt ends the window early, restoring the
+// rate all the same, as the process would otherwise keep paying for it.
+func sampleProfile(addr net.TCPAddr, sig byte, name string, rate int, window time.Duration) error {
+	if window <= 0 {
+		return fmt.Errorf("invalid -duration %v", window)
+	}
+	ok, err := agentCapable(addr, dcrsignal.ProfileRates)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("the agent can't set the %s, the process must set it itself; "+
+			"the agent of github.com/dcrlabs/dcrps/agent can", name)
+	}
+	prev, err := setProfileRate(addr, sig, rate)
+	if err != nil {
+		return err
+	}
+	interrupt := make(chan os.Signal, 1)
+	ossignal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer ossignal.Stop(interrupt)
+	fmt.Printf("Sampling with the %s set to %d for %v...\n", name, rate, window)
+	var interrupted bool
+	select {
+	case <-time.After(window):
+	case <-interrupt:
+		interrupted = true
+	}
+	if _, err := setProfileRate(addr, sig, prev); err != nil {
+		return fmt.Errorf("cannot restore the %s to %d: %v", name, prev, err)
+	}
+	if interrupted {
+		return fmt.Errorf("interrupted, the %s is restored to %d", name, prev)
+	}
+	return nil
+}
+
+// emptyProfileError is the error of an empty response to one of the profiles
+// of emptyProfileErrors.
+type emptyProfileError struct {
+	profile byte
+}
+
+func (e *emptyProfileError) Error() string {
+	return emptyProfileErrors[e.profile]
+}
+
+// emptyProfileErrors explain the empty responses to the profiles that the
+// process must enable, or that the stock agent doesn't know.
+var emptyProfileErrors = map[byte]string{
+	dcrsignal.MutexProfile: "the agent returned no mutex profile: the process must enable " +
+		"it with runtime.SetMutexProfileFraction, and its agent support it, which the " +
+		"stock gops agent doesn't",
+	dcrsignal.BlockProfile: "the agent returned no block profile: the process must enable " +
+		"it with runtime.SetBlockProfileRate, and its agent support it, which the " +
+		"stock gops agent doesn't",
+}
+
+// parsePprofFlags parses the flags of the pprof commands and returns the
+// validated -http address, if any.
+func parsePprofFlags(name string, params []string) (string, error) {
+	return parsePprofFlagSet(flag.NewFlagSet(name, flag.ExitOnError), params)
+}
+
+// parsePprofFlagSet parses params with fs and the -http flag of the pprof
+// commands, returning its address.
+func parsePprofFlagSet(fs *flag.FlagSet, params []string) (string, error) {
+	httpAddr := fs.String("http", "", "serve the pprof web UI at host:port")
+	parseCommandFlags(fs, params)
+	if *httpAddr == "" {
+		return "", nil
+	}
+	_, port, err := net.SplitHostPort(*httpAddr)
+	if err != nil {
+		return "", fmt.Errorf("invalid -http address: %v", err)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return "", fmt.Errorf("invalid -http port %q", port)
+	}
+	return *httpAddr, nil
+}
+
+// pprofWebURL returns the URL of the pprof web UI served at the -http address
+// httpAddr, on localhost when it has no host.
+func pprofWebURL(httpAddr string) string {
+	host, port, _ := net.SplitHostPort(httpAddr)
+	if host == "" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port) + "/"
+}
+
+// defaultTraceWindow is the window of the runtime tracer when trace is given
+// none, the fixed one of the stock agent.
+const defaultTraceWindow = 5 * time.Second
+
+// traceTimeoutSlack is the time the agent gets to answer a trace on top of
+// its window.
+const traceTimeoutSlack = 25 * time.Second
+
+// traceOptions are the flags of the trace command.
+type traceOptions struct {
+	window time.Duration
+	out    string // the file to save the trace to, "" for a temporary one
+	launch bool   // whether to launch go tool trace on it
+}
+
+// parseTraceFlags parses the flags of the trace command, its window given
+// with -duration or as a positional param.
+func parseTraceFlags(params []string) (traceOptions, error) {
+	fs := flag.NewFlagSet("trace", flag.ExitOnError)
+	window := fs.Duration("duration", defaultTraceWindow, "window of the runtime tracer")
+	out := fs.String("out", "", "save the trace to file, kept after go tool trace exits")
+	noLaunch := fs.Bool("no-launch", false, "only save the trace, without launching go tool trace")
+	positional := parseInterspersedFlags(fs, params)
+	durationSet := false
+	fs.Visit(func(f *flag.Flag) { durationSet = durationSet || f.Name == "duration" })
+	switch {
+	case len(positional) > 1:
+		return traceOptions{}, fmt.Errorf("unexpected params %q", positional[1:])
+	case len(positional) == 1 && durationSet:
+		return traceOptions{}, errors.New("give the trace duration either with -duration or as a param")
+	case len(positional) == 1:
+		d, err := time.ParseDuration(positional[0])
+		if err != nil {
+			return traceOptions{}, fmt.Errorf("invalid trace duration: %v", err)
+		}
+		*window = d
+	}
+	if *window < time.Millisecond {
+		return traceOptions{}, fmt.Errorf("invalid trace duration %v, it must be at least 1ms", *window)
+	}
+	return traceOptions{window: *window, out: *out, launch: !*noLaunch}, nil
+}
+
+// agentCapable reports whether the agent at addr lists capability among the
+// ones it reports. The stock agent reports none.
+func agentCapable(addr net.TCPAddr, capability string) (bool, error) {
+	ok, err := agentClient().Capable(addr, capability)
+	return ok, agentError(err)
+}
+
+// trace runs the runtime tracer for the window given with -duration and
+// launches "go tool trace" on the capture. The agents with the TraceDuration
+// capability are sent the window after the signal; the others, such as the
+// stock agent, trace for their fixed 5s.
+func trace(addr net.TCPAddr, params []string) error {
+	opts, err := parseTraceFlags(params)
+	if err != nil {
+		return err
+	}
+	window := opts.window
+	var buf []byte
+	if window != defaultTraceWindow {
+		ok, err := agentCapable(addr, dcrsignal.TraceDuration)
+		if err != nil {
+			return err
+		}
+		if ok {
+			buf = make([]byte, binary.MaxVarintLen64)
+			buf = buf[:binary.PutVarint(buf, int64(window/time.Millisecond))]
+		} else {
+			fmt.Fprintf(os.Stderr, "warning: the agent doesn't support -duration, "+
+				"it traces for %v\n", defaultTraceWindow)
+			window = defaultTraceWindow
+		}
+	}
+	cmdTimeout = window + traceTimeoutSlack
+	fmt.Printf("Tracing now, will take %v...\n", window)
+	out, err := cmd(addr, signal.Trace, buf...)
+	if err != nil {
+		return err
+	}
+	if len(out) == 0 {
+		return errors.New("nothing has traced")
+	}
+	path := opts.out
+	if path != "" {
+		if err := writeFileAtomic(path, out); err != nil {
+			return err
+		}
+	} else {
+		tmpfile, err := ioutil.TempFile("", "trace")
+		if err != nil {
+			return err
+		}
+		path = tmpfile.Name()
+		if err := ioutil.WriteFile(path, out, 0); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Trace dump saved to: %s\n", path)
+	if !opts.launch {
+		return nil
+	}
+	// If go tool chain not found, stopping here and keep trace file.
+	if _, err := exec.LookPath("go"); err != nil {
+		return nil
+	}
+	if opts.out == "" {
+		defer os.Remove(path)
+	}
+	cmd := exec.Command("go", "tool", "trace", path)
+	cmd.Env = os.Environ()
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// profileError returns the error of the response out to the profile p when
+// it is empty, an *emptyProfileError for those of emptyProfileErrors.
+func profileError(p byte, out []byte) error {
+	if len(out) > 0 {
+		return nil
+	}
+	if _, ok := emptyProfileErrors[p]; ok {
+		return &emptyProfileError{p}
+	}
+	return errors.New("failed to read the profile")
+}
+
+// pprof reads the profile p and launches "go tool pprof" on it, serving its
+// web UI at httpAddr when set.
+func pprof(addr net.TCPAddr, p byte, httpAddr string) error {
+	tmpDumpFile, err := ioutil.TempFile("", "profile")
+	if err != nil {
+		return err
+	}
+	{
+		out, err := cmd(addr, p)
+		if err != nil {
+			return err
+		}
+		if err := profileError(p, out); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(tmpDumpFile.Name(), out, 0); err != nil {
+			return err
+		}
+		fmt.Printf("Profile dump saved to: %s\n", tmpDumpFile.Name())
+		// If go tool chain not found, stopping here and keep dump file.
+		if _, err := exec.LookPath("go"); err != nil {
+			return nil
+		}
+		defer os.Remove(tmpDumpFile.Name())
+	}
+
+	// Download running binary.
+	tmpBinFile, err := ioutil.TempFile("", "binary")
+	if err != nil {
+		return err
+	}
+	{
+		out, err := cmd(addr, signal.BinaryDump)
+		if err != nil {
+			return fmt.Errorf("failed to read the binary: %v", err)
+		}
+		if len(out) == 0 {
+			return errors.New("failed to read the binary")
+		}
+		defer os.Remove(tmpBinFile.Name())
+		if err := ioutil.WriteFile(tmpBinFile.Name(), out, 0); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Profiling dump saved to: %s\n", tmpDumpFile.Name())
+	fmt.Printf("Binary file saved to: %s\n", tmpBinFile.Name())
+	args := []string{"tool", "pprof"}
+	if httpAddr != "" {
+		fmt.Printf("Serving the pprof web UI at %s\n", pprofWebURL(httpAddr))
+		args = append(args, "-http="+httpAddr)
+	}
+	args = append(args, tmpBinFile.Name(), tmpDumpFile.Name())
+	cmd := exec.Command("go", args...)
+	cmd.Env = os.Environ()
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// stockCommands are the commands of the stock gops agent, with the Go
+// release each first needs.
+var stockCommands = []struct {
+	name    string
+	goMinor int
+}{
+	{"stack", 0},
+	{"gc", 0},
+	{"setgc", 0},
+	{"memstats", 0},
+	{"version", 0},
+	{"stats", 0},
+	{"pprof-heap", 0},
+	{"pprof-cpu", 0},
+	{"trace", 5}, // runtime/trace
+}
+
+// goMinorVersion returns the minor version of a "go1.N[.P]" release, or -1.
+func goMinorVersion(release string) int {
+	release = strings.TrimPrefix(strings.TrimSpace(release), "go1.")
+	if i := strings.IndexAny(release, ".rb"); i >= 0 {
+		release = release[:i]
+	}
+	minor, err := strconv.Atoi(release)
+	if err != nil {
+		return -1
+	}
+	return minor
+}
+
+func commands(addr net.TCPAddr, _ []string) error {
+	out, err := cmd(addr, dcrsignal.Capabilities)
+	if err != nil {
+		return err
+	}
+	if len(out) > 0 {
+		fmt.Println("supported commands, as reported by the agent:")
+		fmt.Printf("%s", out)
+		return nil
+	}
+
+	// The agent doesn't report its capabilities; assume it is the stock
+	// gops agent and infer them from the Go version.
+	release, err := cmd(addr, signal.Version)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("supported commands, inferred from %s (the agent doesn't report them):\n",
+		strings.TrimSpace(string(release)))
+	for _, name := range inferredCommands(string(release)) {
+		fmt.Println(name)
+	}
+	return nil
+}
+
+// inferredCommands returns the stockCommands an agent built with the Go
+// release supports, all of them when the release can't be told.
+func inferredCommands(release string) []string {
+	minor := goMinorVersion(release)
+	var names []string
+	for _, c := range stockCommands {
+		if minor < 0 || minor >= c.goMinor {
+			names = append(names, c.name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dcrlabs/dcrps/pkg/dcrps"
+	"github.com/dcrlabs/dcrps/resolve"
+	"github.com/google/gops/signal"
+)
+
+// resetServer serves an agent that resets as many connections as resets
+// midway through the response and answers "ok" on the next ones. It returns
+// its address and the count of the requests it got.
+func resetServer(t *testing.T, resets int) (*net.TCPAddr, *int) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var requests int
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Read(make([]byte, 1))
+			requests++
+			if requests <= resets {
+				conn.Write([]byte("o"))
+				conn.(*net.TCPConn).SetLinger(0)
+			} else {
+				conn.Write([]byte("ok"))
+			}
+			conn.Close()
+		}
+	}()
+	return l.Addr().(*net.TCPAddr), &requests
+}
+
+func TestCmdRetry(t *testing.T) {
+	defer func(n int) { *retry = n }(*retry)
+	*retry = 2
+
+	addr, requests := resetServer(t, 2)
+	out, err := cmd(*addr, signal.Stats)
+	if err != nil || string(out) != "ok" {
+		t.Errorf("stats: got %q, %v; want ok after 2 retries", out, err)
+	}
+	if *requests != 3 {
+		t.Errorf("stats: got %d requests want 3", *requests)
+	}
+
+	addr, requests = resetServer(t, 1)
+	if _, err := cmd(*addr, signal.GC); err == nil {
+		t.Errorf("gc: got no error from the reset connection")
+	}
+	if *requests != 1 {
+		t.Errorf("gc: got %d requests, want 1: gc must never be retried", *requests)
+	}
+}
+
+func TestParseTraceFlags(t *testing.T) {
+	tests := []struct {
+		params []string
+		want   time.Duration // zero when invalid
+	}{
+		{nil, defaultTraceWindow},
+		{[]string{"-duration", "30s"}, 30 * time.Second},
+		{[]string{"45s"}, 45 * time.Second},
+		{[]string{"1m", "-duration", "2m"}, 0},
+		{[]string{"-duration", "0s"}, 0},
+		{[]string{"-duration", "-5s"}, 0},
+		{[]string{"soon"}, 0},
+		{[]string{"1s", "2s"}, 0},
+	}
+	for _, test := range tests {
+		opts, err := parseTraceFlags(test.params)
+		got := opts.window
+		if test.want == 0 {
+			if err == nil {
+				t.Errorf("parseTraceFlags(%q): expected an error, got %v", test.params, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("parseTraceFlags(%q): got=%v,%v want=%v", test.params, got, err, test.want)
+		}
+	}
+
+	opts, err := parseTraceFlags([]string{"-duration", "45s", "-out", "stall.trace", "-no-launch"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (traceOptions{45 * time.Second, "stall.trace", false}); opts != want {
+		t.Errorf("parseTraceFlags: got=%+v want=%+v", opts, want)
+	}
+}
+
+func TestToolCommands(t *testing.T) {
+	for name := range toolCommands {
+		if _, ok := cmds[name]; !ok {
+			t.Errorf("tool command %q is no agent command", name)
+		}
+	}
+}
+
+// TestHelperProcess is another Go process named as the test binary, run by
+// the tests that need one.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("DCRPS_TEST_HELPER") != "1" {
+		return
+	}
+	time.Sleep(30 * time.Second)
+}
+
+func TestPreflightAgent(t *testing.T) {
+	defer func(r *resolve.Resolver) { resolver = r }(resolver)
+	exe := filepath.Base(os.Args[0])
+	resolver = &resolve.Resolver{Prefixes: []string{exe}, Exact: true}
+
+	// The test binary is a Go process running no agent.
+	err := preflightAgent(strconv.Itoa(os.Getpid()))
+	if _, ok := err.(*resolve.NoAgentError); !ok {
+		t.Errorf("no agent: got %v", err)
+	}
+	if code := exitCode(err); code != exitAgentUnreachable {
+		t.Errorf("no agent: got exit status %d", code)
+	}
+
+	err = preflightAgent(strconv.Itoa(1 << 30))
+	if code := exitCode(err); code != exitNoProcess {
+		t.Errorf("no process: got %v, exit status %d", err, code)
+	}
+	err = preflightAgent("dcrnone")
+	if code := exitCode(err); code != exitNoProcess {
+		t.Errorf("no process named dcrnone: got %v, exit status %d", err, code)
+	}
+
+	helper := exec.Command(os.Args[0], "-test.run=^TestHelperProcess$")
+	helper.Env = append(os.Environ(), "DCRPS_TEST_HELPER=1")
+	if err := helper.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer helper.Wait()
+	defer helper.Process.Kill()
+	// Until the helper runs as the test binary rather than being started.
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		resolver = &resolve.Resolver{Prefixes: []string{exe}, Exact: true}
+		err = preflightAgent(exe)
+		if _, ok := err.(*resolve.AmbiguousError); ok || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if code := exitCode(err); code != exitUnresolved {
+		t.Errorf("ambiguous: got %v, exit status %d", err, code)
+	}
+}
+
+func TestAgentError(t *testing.T) {
+	err := agentError(&dcrps.DialError{Err: errors.New("i/o timeout"), Timeout: 5 * time.Second})
+	if _, ok := err.(*dcrps.DialError); !ok || !strings.Contains(err.Error(), "-connect-timeout") {
+		t.Errorf("dial timeout: got %T %v", err, err)
+	}
+	if code := exitCode(err); code != exitAgentUnreachable {
+		t.Errorf("dial timeout: got exit status %d", code)
+	}
+	err = agentError(&dcrps.TimeoutError{Timeout: time.Second})
+	if !strings.Contains(err.Error(), "-timeout") {
+		t.Errorf("request timeout: got %v", err)
+	}
+}
+
+func TestGoMinorVersion(t *testing.T) {
+	tests := []struct {
+		release string
+		want    int
+	}{
+		{"go1.12", 12},
+		{"go1.12.5\n", 12},
+		{"go1.4", 4},
+		{"go1.13rc1", 13},
+		{"go1.13beta1", 13},
+		{"devel +a1b2c3", -1},
+		{"", -1},
+	}
+	for _, test := range tests {
+		if got := goMinorVersion(test.release); got != test.want {
+			t.Errorf("goMinorVersion(%q): got=%v want=%v", test.release, got, test.want)
+		}
+	}
+}
+
+func TestInferredCommands(t *testing.T) {
+	tests := []struct {
+		release string
+		trace   bool
+	}{
+		{"go1.4.2", false},
+		{"go1.5", true},
+		{"go1.12.5\n", true},
+		// An unknown release is assumed to support them all.
+		{"devel +a1b2c3", true},
+	}
+	for _, test := range tests {
+		names := inferredCommands(test.release)
+		if trace := names[len(names)-1] == "trace"; trace != test.trace {
+			t.Errorf("inferredCommands(%q): got %v, want trace %v", test.release, names, test.trace)
+		}
+		if len(names) < len(stockCommands)-1 {
+			t.Errorf("inferredCommands(%q): got %v", test.release, names)
+		}
+	}
+}
+
+func TestParsePprofFlags(t *testing.T) {
+	tests := []struct {
+		params []string
+		want   string
+		err    bool
+	}{
+		{nil, "", false},
+		{[]string{"-http", ":8080"}, ":8080", false},
+		{[]string{"-http=127.0.0.1:0"}, "127.0.0.1:0", false},
+		{[]string{"-http", "[::1]:6060"}, "[::1]:6060", false},
+		{[]string{"-http", "8080"}, "", true},
+		{[]string{"-http", "localhost:http"}, "", true},
+		{[]string{"-http", ":65536"}, "", true},
+	}
+	for _, test := range tests {
+		got, err := parsePprofFlags("pprof-heap", test.params)
+		if (err != nil) != test.err || got != test.want {
+			t.Errorf("parsePprofFlags(%q): got=%q,%v want=%q, error %v",
+				test.params, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestPprofWebURL(t *testing.T) {
+	tests := []struct {
+		httpAddr string
+		want     string
+	}{
+		{":8080", "http://localhost:8080/"},
+		{"0.0.0.0:8080", "http://0.0.0.0:8080/"},
+		{"[::1]:6060", "http://[::1]:6060/"},
+	}
+	for _, test := range tests {
+		if got := pprofWebURL(test.httpAddr); got != test.want {
+			t.Errorf("pprofWebURL(%q): got=%v want=%v", test.httpAddr, got, test.want)
+		}
+	}
+}
+
+func TestAgentTimeout(t *testing.T) {
+	defer func(flagged, cmdDefault time.Duration) {
+		*timeout, cmdTimeout = flagged, cmdDefault
+	}(*timeout, cmdTimeout)
+	tests := []struct {
+		flagged, cmdDefault time.Duration
+		want                time.Duration
+	}{
+		{0, 0, 0},
+		{0, 10 * time.Second, 10 * time.Second},
+		{time.Second, 2 * time.Minute, time.Second},
+		{time.Hour, 0, time.Hour},
+	}
+	for _, test := range tests {
+		*timeout, cmdTimeout = test.flagged, test.cmdDefault
+		if got := agentTimeout(); got != test.want {
+			t.Errorf("agentTimeout with -timeout %v and default %v: got=%v want=%v",
+				test.flagged, test.cmdDefault, got, test.want)
+		}
+	}
+	for name, c := range cmds {
+		if c.timeout <= 0 {
+			t.Errorf("%s: no default timeout", name)
+		}
+	}
+}
+
+func TestCmdTimeout(t *testing.T) {
+	// The agent takes the request and never answers.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	defer func(d time.Duration) { cmdTimeout = d }(cmdTimeout)
+	cmdTimeout = 50 * time.Millisecond
+	_, err = cmd(*l.Addr().(*net.TCPAddr), signal.Version)
+	if err == nil || !strings.Contains(err.Error(), "see -timeout") {
+		t.Errorf("got %v, want a timeout pointing at -timeout", err)
+	}
+}
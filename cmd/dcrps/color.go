@@ -0,0 +1,131 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// sgrReset is the ANSI SGR code ending a color.
+const sgrReset = "\x1b[0m"
+
+// theme is the palette of the colored output, as ANSI SGR codes.
+type theme struct {
+	highlight string // the highlighted processes of the tree
+	alert     string // the alert lines of watch
+	agent     string // the agent mark of the listing
+	// heat are the colors of the heatmap, from idle to busy.
+	heat []string
+}
+
+// themes are the palettes -theme selects from. The "none" theme turns color
+// off.
+var themes = map[string]*theme{
+	"dark": {
+		highlight: "\x1b[1;33m", // bold yellow
+		alert:     "\x1b[1;31m", // bold red
+		agent:     "\x1b[32m",   // green
+		heat: []string{
+			"\x1b[38;5;46m", "\x1b[38;5;118m", "\x1b[38;5;226m", "\x1b[38;5;208m", "\x1b[38;5;196m",
+		},
+	},
+	"light": {
+		highlight: "\x1b[1;34m", // bold blue
+		alert:     "\x1b[1;31m", // bold red
+		agent:     "\x1b[32m",   // green
+		heat: []string{
+			"\x1b[38;5;28m", "\x1b[38;5;64m", "\x1b[38;5;136m", "\x1b[38;5;166m", "\x1b[38;5;160m",
+		},
+	},
+	"none": nil,
+}
+
+// themeNames are the values of -theme.
+var themeNames = []string{"dark", "light", "none"}
+
+// backgroundTheme returns the theme suiting the terminal background as given
+// by $COLORFGBG, "fg;bg" in the 16 ANSI colors, which some terminals set. It
+// returns dark when the background is unknown.
+func backgroundTheme(colorfgbg string) string {
+	fields := strings.Split(colorfgbg, ";")
+	bg, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil {
+		return "dark"
+	}
+	// White and the bright colors but dark gray are light backgrounds.
+	if bg == 7 || (bg >= 9 && bg <= 15) {
+		return "light"
+	}
+	return "dark"
+}
+
+// currentTheme returns the theme selected with -theme, or the one suiting
+// the terminal background, or nil when color is off.
+func currentTheme() *theme {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok || !isTerminal(os.Stdout) {
+		return nil
+	}
+	name := *themeName
+	if name == "" {
+		name = backgroundTheme(os.Getenv("COLORFGBG"))
+	}
+	return themes[name]
+}
+
+// colorEnabled reports whether the standard output is colored: it must be a
+// terminal, $NO_COLOR must be unset and the theme must not be none.
+func colorEnabled() bool {
+	return currentTheme() != nil
+}
+
+// paint colors s with the SGR code of the current theme picked by color,
+// when color is enabled.
+func paint(s string, color func(t *theme) string) string {
+	t := currentTheme()
+	if t == nil {
+		return s
+	}
+	return color(t) + s + sgrReset
+}
+
+// highlight marks s to stand out, in color when enabled and with an arrow
+// otherwise.
+func highlight(s string) string {
+	if !colorEnabled() {
+		return s + " <=="
+	}
+	return paint(s, func(t *theme) string { return t.highlight })
+}
+
+// alertLine makes an alert line stand out, in color when enabled.
+func alertLine(s string) string {
+	return paint(s, func(t *theme) string { return t.alert })
+}
+
+// agentMark colors the agent mark of the listing, when color is enabled.
+func agentMark(s string) string {
+	return paint(s, func(t *theme) string { return t.agent })
+}
+
+// heat colors s by a CPU usage in percent of a CPU, from idle to busy from
+// 80%, when color is enabled.
+func heat(s string, percent float64) string {
+	return paint(s, func(t *theme) string { return t.heatColor(percent) })
+}
+
+// heatColor returns the heat color of a CPU usage in percent of a CPU, a
+// step each 20%.
+func (t *theme) heatColor(percent float64) string {
+	i := int(percent / 20)
+	switch {
+	case i < 0:
+		i = 0
+	case i >= len(t.heat):
+		i = len(t.heat) - 1
+	}
+	return t.heat[i]
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestBackgroundTheme(t *testing.T) {
+	tests := []struct {
+		colorfgbg string
+		want      string
+	}{
+		{"15;0", "dark"},
+		{"0;15", "light"},
+		{"0;7", "light"},
+		{"7;8", "dark"},
+		{"0;default;15", "light"},
+		{"default;default", "dark"},
+		{"", "dark"},
+	}
+	for _, test := range tests {
+		if got := backgroundTheme(test.colorfgbg); got != test.want {
+			t.Errorf("backgroundTheme(%q): got=%v want=%v", test.colorfgbg, got, test.want)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	v, set := os.LookupEnv("NO_COLOR")
+	os.Setenv("NO_COLOR", "")
+	defer func() {
+		if set {
+			os.Setenv("NO_COLOR", v)
+		} else {
+			os.Unsetenv("NO_COLOR")
+		}
+	}()
+	if got, want := highlight("100 dcrd"), "100 dcrd <=="; got != want {
+		t.Errorf("highlight with NO_COLOR: got %q, want %q", got, want)
+	}
+}
+
+func TestHeatColor(t *testing.T) {
+	dark := themes["dark"]
+	tests := []struct {
+		percent float64
+		want    int
+	}{
+		{0, 0},
+		{19.9, 0},
+		{20, 1},
+		{55, 2},
+		{79, 3},
+		{80, 4},
+		// Busy on several CPUs.
+		{350, 4},
+		{-1, 0},
+	}
+	for _, test := range tests {
+		if got := dark.heatColor(test.percent); got != dark.heat[test.want] {
+			t.Errorf("heatColor(%v): got %q, want %q", test.percent, got, dark.heat[test.want])
+		}
+	}
+	for name, th := range themes {
+		if th != nil && len(th.heat) != len(dark.heat) {
+			t.Errorf("theme %s: %d heat colors, want %d", name, len(th.heat), len(dark.heat))
+		}
+	}
+}
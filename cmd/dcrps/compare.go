@@ -0,0 +1,289 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	ossignal "os/signal"
+	"runtime"
+	"sort"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dcrlabs/dcrps/pkg/dcrps"
+	"github.com/google/gops/signal"
+)
+
+// compareSnapshot is what compare reads of a process at one time.
+type compareSnapshot struct {
+	time       time.Time
+	mem        *runtime.MemStats
+	stats      *dcrps.Stats
+	goroutines []goroutine
+}
+
+// takeCompareSnapshot reads the memstats, the runtime stats and the stacks
+// of the agent at addr.
+func takeCompareSnapshot(addr net.TCPAddr) (*compareSnapshot, error) {
+	s := &compareSnapshot{time: time.Now()}
+	var err error
+	if s.mem, _, err = readMemStats(addr); err != nil {
+		return nil, err
+	}
+	if s.stats, err = agentClient().Stats(addr); err != nil {
+		return nil, agentError(err)
+	}
+	out, err := cmd(addr, signal.StackTrace)
+	if err != nil {
+		return nil, err
+	}
+	s.goroutines = dcrps.ParseStack(out)
+	return s, nil
+}
+
+// compareRow is the change of a metric between two snapshots.
+type compareRow struct {
+	Metric string `json:"metric"`
+	Before int64  `json:"before"`
+	After  int64  `json:"after"`
+	Change int64  `json:"change"`
+	// Percent is the change in percent of Before, for the metrics that
+	// aren't counters and were above zero.
+	Percent float64 `json:"percent,omitempty"`
+	// PerSec is the change per second, for the counters.
+	PerSec float64 `json:"perSec,omitempty"`
+	// Significant is set for the metrics that grew by more than the
+	// threshold.
+	Significant bool `json:"significant"`
+
+	bytes   bool
+	counter bool
+}
+
+// newCompareRow returns the row of metric, from before to after over
+// interval, significant when it grew by more than threshold percent.
+func newCompareRow(metric string, before, after int64, bytes, counter bool,
+	interval time.Duration, threshold float64) compareRow {
+
+	r := compareRow{Metric: metric, Before: before, After: after, Change: after - before,
+		bytes: bytes, counter: counter}
+	switch {
+	case counter:
+		if secs := interval.Seconds(); secs > 0 {
+			r.PerSec = float64(r.Change) / secs
+		}
+	case before > 0:
+		r.Percent = 100 * float64(r.Change) / float64(before)
+		r.Significant = r.Percent > threshold
+	default:
+		r.Significant = after > 0
+	}
+	return r
+}
+
+// compareRows returns the rows of the runtime metrics from before to after.
+func compareRows(before, after *compareSnapshot, threshold float64) []compareRow {
+	interval := after.time.Sub(before.time)
+	b, a := before.mem, after.mem
+	gauge := func(metric string, before, after uint64, bytes bool) compareRow {
+		return newCompareRow(metric, int64(before), int64(after), bytes, false, interval, threshold)
+	}
+	counter := func(metric string, before, after uint64, bytes bool) compareRow {
+		return newCompareRow(metric, int64(before), int64(after), bytes, true, interval, threshold)
+	}
+	return []compareRow{
+		gauge("heap-alloc", b.HeapAlloc, a.HeapAlloc, true),
+		gauge("heap-in-use", b.HeapInuse, a.HeapInuse, true),
+		gauge("heap-objects", b.HeapObjects, a.HeapObjects, false),
+		gauge("stack-in-use", b.StackInuse, a.StackInuse, true),
+		gauge("sys", b.Sys, a.Sys, true),
+		gauge("goroutines", uint64(before.stats.Goroutines), uint64(after.stats.Goroutines), false),
+		gauge("OS threads", uint64(before.stats.OSThreads), uint64(after.stats.OSThreads), false),
+		counter("total-alloc", b.TotalAlloc, a.TotalAlloc, true),
+		counter("mallocs", b.Mallocs, a.Mallocs, false),
+		counter("num-gc", uint64(b.NumGC), uint64(a.NumGC), false),
+	}
+}
+
+// maxCompareFuncs is how many functions compare lists the goroutine counts
+// of.
+const maxCompareFuncs = 10
+
+// compareFuncRows returns the rows of the goroutine counts by the function at
+// the top of their stacks that changed from before to after, the largest
+// changes first.
+func compareFuncRows(before, after []goroutine, threshold float64) []compareRow {
+	counts := make(map[string][2]int64)
+	for _, fc := range topFrames(before) {
+		c := counts[fc.Func]
+		c[0] = int64(fc.Count)
+		counts[fc.Func] = c
+	}
+	for _, fc := range topFrames(after) {
+		c := counts[fc.Func]
+		c[1] = int64(fc.Count)
+		counts[fc.Func] = c
+	}
+	var rows []compareRow
+	for fn, c := range counts {
+		if c[0] != c[1] {
+			rows = append(rows, newCompareRow(fn, c[0], c[1], false, false, 0, threshold))
+		}
+	}
+	abs := func(n int64) int64 {
+		if n < 0 {
+			return -n
+		}
+		return n
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if ci, cj := abs(rows[i].Change), abs(rows[j].Change); ci != cj {
+			return ci > cj
+		}
+		return rows[i].Metric < rows[j].Metric
+	})
+	if len(rows) > maxCompareFuncs {
+		rows = rows[:maxCompareFuncs]
+	}
+	return rows
+}
+
+// formatCompareValue formats the value n of r.
+func formatCompareValue(r compareRow, n int64) string {
+	if !r.bytes {
+		return fmt.Sprint(n)
+	}
+	if n < 0 {
+		return "-" + formatBytes(uint64(-n))
+	}
+	return formatBytes(uint64(n))
+}
+
+// formatCompareChange formats the change of r with its percentage or rate.
+func formatCompareChange(r compareRow) string {
+	s := formatCompareValue(r, r.Change)
+	if r.Change >= 0 {
+		s = "+" + s
+	}
+	switch {
+	case r.counter && r.bytes:
+		s += fmt.Sprintf(" (%s/s)", formatBytes(uint64(r.PerSec)))
+	case r.counter:
+		s += fmt.Sprintf(" (%.1f/s)", r.PerSec)
+	case r.Before > 0 && r.Change != 0:
+		s += fmt.Sprintf(" (%+.1f%%)", r.Percent)
+	}
+	return s
+}
+
+// writeCompareRows writes rows as a table, highlighting the significant
+// ones.
+func writeCompareRows(w io.Writer, rows []compareRow) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, r := range rows {
+		change := formatCompareChange(r)
+		if r.Significant {
+			change = highlight(change)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Metric,
+			formatCompareValue(r, r.Before), formatCompareValue(r, r.After), change)
+	}
+	return tw.Flush()
+}
+
+// waitForKey waits for a key to be typed on the terminal of the standard
+// input, which must read each key as typed, or for an interrupt, which it
+// reports with an error.
+func waitForKey() error {
+	interrupt := make(chan os.Signal, 1)
+	ossignal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer ossignal.Stop(interrupt)
+	key := make(chan error, 1)
+	go func() {
+		_, err := os.Stdin.Read(make([]byte, 1))
+		key <- err
+	}()
+	select {
+	case err := <-key:
+		return err
+	case <-interrupt:
+		return errors.New("interrupted before the second snapshot")
+	}
+}
+
+// compare snapshots the memstats, the goroutines and the threads of a
+// process twice, -after apart or around a key typed in between, and prints
+// their changes.
+func compare(addr net.TCPAddr, params []string) error {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	after := fs.Duration("after", 0, "take the second snapshot after this long instead of on a key")
+	threshold := fs.Float64("threshold", 10, "highlight the metrics that grew by more than this percent")
+	parseCommandFlags(fs, params)
+	if *after < 0 || *threshold < 0 {
+		return errors.New("-after and -threshold must be positive")
+	}
+	if *after == 0 {
+		errNoKeys := errors.New("without a terminal to type a key on, -after is required")
+		if !isTerminal(os.Stdin) {
+			return errNoKeys
+		}
+		restore, err := cbreakTerminal()
+		if err != nil {
+			return errNoKeys
+		}
+		defer restore()
+	}
+
+	before, err := takeCompareSnapshot(addr)
+	if err != nil {
+		return err
+	}
+	if *after > 0 {
+		fmt.Fprintf(os.Stderr, "First snapshot taken, taking the second in %v...\n", *after)
+		time.Sleep(*after)
+	} else {
+		fmt.Fprintln(os.Stderr, "First snapshot taken, press a key to take the second...")
+		if err := waitForKey(); err != nil {
+			return err
+		}
+	}
+	snap, err := takeCompareSnapshot(addr)
+	if err != nil {
+		return err
+	}
+	if snap.mem.TotalAlloc < before.mem.TotalAlloc || snap.mem.NumGC < before.mem.NumGC {
+		return errors.New("the memstats counters went back, the process may have restarted")
+	}
+
+	interval := snap.time.Sub(before.time)
+	rows := compareRows(before, snap, *threshold)
+	funcs := compareFuncRows(before.goroutines, snap.goroutines, *threshold)
+	if *jsonOutput {
+		if funcs == nil {
+			funcs = []compareRow{}
+		}
+		printJSON(struct {
+			Interval   time.Duration `json:"intervalNs"`
+			Metrics    []compareRow  `json:"metrics"`
+			Goroutines []compareRow  `json:"goroutinesByFunc"`
+		}{interval, rows, funcs})
+		return nil
+	}
+	fmt.Printf("changes over %v:\n", interval.Round(time.Millisecond))
+	if err := writeCompareRows(os.Stdout, rows); err != nil {
+		return err
+	}
+	if len(funcs) > 0 {
+		fmt.Println("\ngoroutines by the function at the top of their stacks:")
+		return writeCompareRows(os.Stdout, funcs)
+	}
+	return nil
+}
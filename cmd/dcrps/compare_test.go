@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dcrlabs/dcrps/pkg/dcrps"
+)
+
+func TestCompareRows(t *testing.T) {
+	start := time.Now()
+	before := &compareSnapshot{
+		time:  start,
+		mem:   &runtime.MemStats{HeapAlloc: 100 << 20, HeapObjects: 1000, TotalAlloc: 1 << 30, NumGC: 10},
+		stats: &dcrps.Stats{Goroutines: 40, OSThreads: 10},
+	}
+	after := &compareSnapshot{
+		time:  start.Add(10 * time.Second),
+		mem:   &runtime.MemStats{HeapAlloc: 105 << 20, HeapObjects: 2000, TotalAlloc: 1<<30 + 10<<20, NumGC: 12},
+		stats: &dcrps.Stats{Goroutines: 1040, OSThreads: 10},
+	}
+	rows := make(map[string]compareRow)
+	for _, r := range compareRows(before, after, 10) {
+		rows[r.Metric] = r
+	}
+	if r := rows["heap-alloc"]; r.Change != 5<<20 || r.Percent != 5 || r.Significant {
+		t.Errorf("heap-alloc: got %+v, want +5%% below the threshold", r)
+	}
+	if r := rows["heap-objects"]; r.Percent != 100 || !r.Significant {
+		t.Errorf("heap-objects: got %+v, want +100%% significant", r)
+	}
+	if r := rows["goroutines"]; r.Change != 1000 || !r.Significant {
+		t.Errorf("goroutines: got %+v", r)
+	}
+	if r := rows["OS threads"]; r.Change != 0 || r.Significant {
+		t.Errorf("OS threads: got %+v", r)
+	}
+	if r := rows["total-alloc"]; r.PerSec != 1<<20 || r.Significant {
+		t.Errorf("total-alloc: got %+v, want 1MB/s and counters never significant", r)
+	}
+	if got := formatCompareChange(rows["total-alloc"]); got != "+10.00MB (1.00MB/s)" {
+		t.Errorf("total-alloc change: got %q", got)
+	}
+}
+
+func TestCompareFuncRows(t *testing.T) {
+	worker := goroutine{Frames: []frame{{Func: "main.worker"}}}
+	idle := goroutine{Frames: []frame{{Func: "main.idle"}}}
+	before := []goroutine{worker, idle, idle}
+	after := []goroutine{worker, worker, worker, idle, idle}
+	rows := compareFuncRows(before, after, 10)
+	if len(rows) != 1 || rows[0].Metric != "main.worker" || rows[0].Change != 2 || !rows[0].Significant {
+		t.Fatalf("got %+v, want main.worker +2", rows)
+	}
+	var buf bytes.Buffer
+	writeCompareRows(&buf, rows)
+	if got := buf.String(); !strings.HasPrefix(got, "main.worker  1  3  +2 (+200.0%)") {
+		t.Errorf("got %q", got)
+	}
+}
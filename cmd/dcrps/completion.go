@@ -0,0 +1,251 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The completion scripts count the words of the command line, skipping the
+// flags and the values of those taking one, to tell the subcommand from its
+// target. They complete the names and PIDs of the running processes from
+// "dcrps completion -targets", run on each completion.
+
+const bashCompletion = `# bash completion for dcrps, from "dcrps completion bash".
+_dcrps() {
+	local cur=${COMP_WORDS[COMP_CWORD]} word cmd= n=0 i
+	for ((i = 1; i < COMP_CWORD; i++)); do
+		word=${COMP_WORDS[i]}
+		case $word in
+		@VALUEFLAGS@) ((i++)) ;;
+		-*) ;;
+		*) if [[ -z $cmd ]]; then cmd=$word; else ((n++)); fi ;;
+		esac
+	done
+	local targets
+	COMPREPLY=()
+	if ((i > COMP_CWORD)); then
+		return # the value of a flag
+	elif [[ $cur == -* ]]; then
+		COMPREPLY=($(compgen -W "@FLAGS@" -- "$cur"))
+	elif [[ -z $cmd ]]; then
+		targets=$(dcrps completion -targets 2>/dev/null)
+		COMPREPLY=($(compgen -W "@COMMANDS@ $targets" -- "$cur"))
+	elif ((n == 0)); then
+		case $cmd in
+		completion) COMPREPLY=($(compgen -W "bash zsh fish" -- "$cur")) ;;
+		help) ;;
+		@AGENTCMDS@)
+			targets=$(dcrps completion -targets 2>/dev/null)
+			COMPREPLY=($(compgen -W "all $targets" -- "$cur")) ;;
+		*)
+			targets=$(dcrps completion -targets 2>/dev/null)
+			COMPREPLY=($(compgen -W "$targets" -- "$cur")) ;;
+		esac
+	else
+		COMPREPLY=($(compgen -f -- "$cur"))
+	fi
+}
+complete -o default -F _dcrps dcrps
+`
+
+const zshCompletion = `#compdef dcrps
+# zsh completion for dcrps, from "dcrps completion zsh".
+_dcrps() {
+	local word cmd= n=0 i
+	for ((i = 2; i < CURRENT; i++)); do
+		word=${words[i]}
+		case $word in
+		@VALUEFLAGS@) ((i++)) ;;
+		-*) ;;
+		*) if [[ -z $cmd ]]; then cmd=$word; else ((n++)); fi ;;
+		esac
+	done
+	if ((i > CURRENT)); then
+		_files # the value of a flag
+	elif [[ ${words[CURRENT]} == -* ]]; then
+		compadd -- @FLAGS@
+	elif [[ -z $cmd ]]; then
+		compadd -- @COMMANDS@ $(dcrps completion -targets 2>/dev/null)
+	elif ((n == 0)); then
+		case $cmd in
+		completion) compadd -- bash zsh fish ;;
+		help) ;;
+		@AGENTCMDS@) compadd -- all $(dcrps completion -targets 2>/dev/null) ;;
+		*) compadd -- $(dcrps completion -targets 2>/dev/null) ;;
+		esac
+	else
+		_files
+	fi
+}
+if [[ $funcstack[1] == _dcrps ]]; then
+	_dcrps "$@"
+else
+	compdef _dcrps dcrps
+fi
+`
+
+const fishCompletion = `# fish completion for dcrps, from "dcrps completion fish".
+function __dcrps_complete
+	set -l words (commandline -opc)
+	set -e words[1]
+	set -l cmd
+	set -l n 0
+	set -l skip 0
+	for word in $words
+		if test $skip = 1
+			set skip 0
+			continue
+		end
+		switch $word
+			case @VALUEFLAGS@
+				set skip 1
+			case '-*'
+			case '*'
+				if test -z "$cmd"
+					set cmd $word
+				else
+					set n (math $n + 1)
+				end
+		end
+	end
+	if test $skip = 1
+		__fish_complete_path (commandline -ct) # the value of a flag
+	else if string match -q -- '-*' (commandline -ct)
+		printf '%s\n' @FLAGS@
+	else if test -z "$cmd"
+		printf '%s\n' @COMMANDS@
+		dcrps completion -targets 2>/dev/null
+	else if test $n -gt 0
+		__fish_complete_path (commandline -ct)
+	else
+		switch $cmd
+			case completion
+				printf '%s\n' bash zsh fish
+			case help
+			case @AGENTCMDS@
+				echo all
+				dcrps completion -targets 2>/dev/null
+			case '*'
+				dcrps completion -targets 2>/dev/null
+		end
+	end
+end
+complete -c dcrps -f -a '(__dcrps_complete)'
+`
+
+// completion is registered here rather than in localCmds, which the
+// scripts list, as that would be an initialization cycle.
+func init() {
+	localCmds["completion"] = completion
+}
+
+// completionScripts are the completion scripts by shell.
+var completionScripts = map[string]string{
+	"bash": bashCompletion,
+	"zsh":  zshCompletion,
+	"fish": fishCompletion,
+}
+
+// isBoolFlag reports whether f takes no value, as -json.
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// completionScript returns the completion script of shell for the global
+// flags, the commands and the aliases.
+func completionScript(shell string) (string, error) {
+	script, ok := completionScripts[shell]
+	if !ok {
+		return "", fmt.Errorf("no completion for the %q shell, only bash, zsh and fish", shell)
+	}
+	var flags, valueFlags []string
+	flag.VisitAll(func(f *flag.Flag) {
+		flags = append(flags, "-"+f.Name)
+		if !isBoolFlag(f) {
+			valueFlags = append(valueFlags, "-"+f.Name, "--"+f.Name)
+		}
+	})
+	var commands, agentCmds []string
+	for name := range cmds {
+		commands = append(commands, name)
+		agentCmds = append(agentCmds, name)
+	}
+	for name := range localCmds {
+		commands = append(commands, name)
+	}
+	if cfg, err := loadConfig(configPath()); err == nil {
+		for name := range cfg.aliases {
+			commands = append(commands, name)
+		}
+	}
+	commands = append(commands, "help")
+	sort.Strings(commands)
+	sort.Strings(agentCmds)
+
+	// The patterns of case are separated by | in bash and zsh, and by
+	// spaces in fish.
+	sep := "|"
+	if shell == "fish" {
+		sep = " "
+	}
+	return strings.NewReplacer(
+		"@FLAGS@", strings.Join(flags, " "),
+		"@VALUEFLAGS@", strings.Join(valueFlags, sep),
+		"@COMMANDS@", strings.Join(commands, " "),
+		"@AGENTCMDS@", strings.Join(agentCmds, sep),
+	).Replace(script), nil
+}
+
+// writeCompletionTargets writes the exec names of the running processes,
+// each once, and then their PIDs, one a line, leaving out dcrps itself.
+func writeCompletionTargets(w io.Writer) {
+	seen := make(map[string]bool)
+	var names, pids []string
+	for _, p := range dcrProcesses() {
+		if p.PID == os.Getpid() {
+			continue
+		}
+		if !seen[p.Exec] {
+			seen[p.Exec] = true
+			names = append(names, p.Exec)
+		}
+		pids = append(pids, strconv.Itoa(p.PID))
+	}
+	sort.Strings(names)
+	for _, s := range append(names, pids...) {
+		fmt.Fprintln(w, s)
+	}
+}
+
+// completion writes the completion script of the shell given, which
+// completes the commands, the global flags and the names and PIDs of the
+// running processes. The scripts list the processes with -targets.
+func completion(args []string) error {
+	fs := flag.NewFlagSet("completion", flag.ExitOnError)
+	targets := fs.Bool("targets", false, "list the names and PIDs of the running processes")
+	fs.Parse(args)
+	if *targets {
+		writeCompletionTargets(os.Stdout)
+		return nil
+	}
+	if fs.NArg() != 1 {
+		return errors.New("missing shell: bash, zsh or fish")
+	}
+	script, err := completionScript(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Print(script)
+	return nil
+}
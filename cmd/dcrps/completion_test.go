@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestCompletionScript(t *testing.T) {
+	for shell := range completionScripts {
+		script, err := completionScript(shell)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if regexp.MustCompile(`@[A-Z]+@`).MatchString(script) {
+			t.Errorf("%s: a placeholder is left", shell)
+		}
+		for _, word := range []string{"stack", "tree", "completion", "-json", "-prefix"} {
+			if !strings.Contains(script, word) {
+				t.Errorf("%s: no %s", shell, word)
+			}
+		}
+		if _, err := exec.LookPath(shell); err != nil {
+			continue
+		}
+		dir, err := ioutil.TempDir("", "completion")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "dcrps."+shell)
+		if err := ioutil.WriteFile(path, []byte(script), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if out, err := exec.Command(shell, "-n", path).CombinedOutput(); err != nil {
+			t.Errorf("%s -n: %v\n%s", shell, err, out)
+		}
+	}
+	if _, err := completionScript("ksh"); err == nil {
+		t.Error("ksh: got no error")
+	}
+}
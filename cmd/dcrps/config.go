@@ -0,0 +1,253 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dcrlabs/dcrps/internal"
+)
+
+const configEnvKey = "DCRPS_CONFIG"
+
+// config holds the settings read from the configuration file.
+type config struct {
+	// aliases maps alias names to the command and preset arguments they
+	// expand to.
+	aliases map[string][]string
+
+	// prefix and match are the defaults of -prefix and -match, nil when
+	// unset, and all that of -all.
+	prefix, match *string
+	all           bool
+
+	// format is the default of -o, "" when unset.
+	format string
+
+	// agents maps the names of remote agents to their address.
+	agents map[string]string
+}
+
+// configPath returns the path of the configuration file, $DCRPS_CONFIG or
+// .dcrps.toml in the home directory.
+func configPath() string {
+	if path := os.Getenv(configEnvKey); path != "" {
+		return path
+	}
+	home := internal.HomeDir()
+	if home == "" {
+		return ""
+	}
+	return filepath.Join(home, ".dcrps.toml")
+}
+
+// loadConfig reads the configuration file at path. A missing file is not an
+// error and yields the empty configuration.
+func loadConfig(path string) (*config, error) {
+	if path == "" {
+		return parseConfig(strings.NewReader(""))
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return parseConfig(strings.NewReader(""))
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cfg, err := parseConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// parseConfig parses the configuration file format, a subset of TOML made of
+// [section] headers and key = value lines, where values may be quoted
+// strings. Lines starting with # are comments.
+//
+//	[aliases]
+//	hprof = "pprof-heap -svg"
+//
+//	[processes]
+//	prefix = "dcr,politeia"
+//	match = "^vspd$"
+//	all = false
+//
+//	[output]
+//	format = "json"
+//
+//	[agents]
+//	vps-dcrd = "tls://vps.example.com:9443"
+func parseConfig(r io.Reader) (*config, error) {
+	cfg := &config{aliases: make(map[string][]string), agents: make(map[string]string)}
+	var section string
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("line %d: expected key = value", n)
+		}
+		key := strings.TrimSpace(line[:i])
+		value := strings.TrimSpace(line[i+1:])
+		if strings.HasPrefix(value, `"`) {
+			v, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: bad quoted value: %v", n, err)
+			}
+			value = v
+		}
+		switch section {
+		case "aliases":
+			if err := cfg.addAlias(key, value); err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+		case "processes":
+			if err := cfg.setProcesses(key, value); err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+		case "output":
+			if key != "format" {
+				return nil, fmt.Errorf("line %d: unknown output key %q", n, key)
+			}
+			if !containsString(outputFormats, value) {
+				return nil, fmt.Errorf("line %d: invalid format %q, want %s", n, value,
+					strings.Join(outputFormats, ", "))
+			}
+			cfg.format = value
+		case "agents":
+			if _, err := strconv.Atoi(key); err == nil || isBuiltinCommand(key) {
+				return nil, fmt.Errorf("line %d: agent name %q shadows a PID or command", n, key)
+			}
+			if value == "" {
+				return nil, fmt.Errorf("line %d: agent %q has no address", n, key)
+			}
+			cfg.agents[key] = value
+		default:
+			return nil, fmt.Errorf("line %d: unknown section %q", n, section)
+		}
+	}
+	return cfg, scanner.Err()
+}
+
+// setProcesses sets the key of the [processes] section, which defines the
+// processes dcrps counts as Decred processes.
+func (cfg *config) setProcesses(key, value string) error {
+	switch key {
+	case "prefix":
+		cfg.prefix = &value
+	case "match":
+		if _, err := regexp.Compile(value); err != nil {
+			return fmt.Errorf("invalid match: %v", err)
+		}
+		cfg.match = &value
+	case "all":
+		all, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid all %q, want true or false", value)
+		}
+		cfg.all = all
+	default:
+		return fmt.Errorf("unknown processes key %q", key)
+	}
+	return nil
+}
+
+// applyDefaults sets the flags the configuration has defaults for, unless
+// they were given. $DCRPS_PREFIX too overrides the prefix.
+func (cfg *config) applyDefaults() error {
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	if _, ok := os.LookupEnv("DCRPS_PREFIX"); cfg.prefix != nil && !ok && !given["prefix"] {
+		*prefix = *cfg.prefix
+	}
+	if cfg.match != nil && !given["match"] {
+		*execMatch = *cfg.match
+	}
+	if cfg.all && !given["all"] {
+		*allProcs = true
+	}
+	if cfg.format != "" && !given["o"] && !given["json"] {
+		return outFormat.Set(cfg.format)
+	}
+	return nil
+}
+
+// agentAddr returns the address of the agent named target, or target when no
+// agent is named so.
+func (cfg *config) agentAddr(target string) string {
+	if addr, ok := cfg.agents[target]; ok {
+		return addr
+	}
+	return target
+}
+
+// addAlias defines an alias, rejecting names that would shadow a built-in
+// command or a PID and expansions that aren't a built-in command.
+func (cfg *config) addAlias(name, expansion string) error {
+	if isBuiltinCommand(name) {
+		return fmt.Errorf("alias %q shadows a built-in command", name)
+	}
+	if _, err := strconv.Atoi(name); err == nil {
+		return fmt.Errorf("alias %q shadows a PID", name)
+	}
+	words := strings.Fields(expansion)
+	if len(words) == 0 {
+		return fmt.Errorf("alias %q is empty", name)
+	}
+	if !isBuiltinCommand(words[0]) {
+		return fmt.Errorf("alias %q expands to unknown command %q", name, words[0])
+	}
+	cfg.aliases[name] = words
+	return nil
+}
+
+// expandAlias replaces an alias at the start of args with its command. The
+// preset arguments are placed where the command expects its flags: after the
+// target for agent commands and after the command name otherwise.
+func (cfg *config) expandAlias(args []string) []string {
+	if len(args) == 0 {
+		return args
+	}
+	words, ok := cfg.aliases[args[0]]
+	if !ok {
+		return args
+	}
+	expanded := []string{words[0]}
+	rest := args[1:]
+	if _, ok := cmds[words[0]]; ok && len(rest) > 0 {
+		expanded = append(expanded, rest[0])
+		rest = rest[1:]
+	}
+	expanded = append(expanded, words[1:]...)
+	return append(expanded, rest...)
+}
+
+func isBuiltinCommand(name string) bool {
+	if name == "help" {
+		return true
+	}
+	if _, ok := cmds[name]; ok {
+		return true
+	}
+	_, ok := localCmds[name]
+	return ok
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseConfigAliases(t *testing.T) {
+	cfg, err := parseConfig(strings.NewReader(`
+# team shortcuts
+[aliases]
+hprof = "pprof-heap -svg"
+top5 = threads -sort threads
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"hprof", "dcrd"}, []string{"pprof-heap", "dcrd", "-svg"}},
+		{[]string{"hprof", "dcrd", "-x"}, []string{"pprof-heap", "dcrd", "-svg", "-x"}},
+		{[]string{"top5", "-json"}, []string{"threads", "-sort", "threads", "-json"}},
+		{[]string{"stack", "dcrd"}, []string{"stack", "dcrd"}},
+	}
+	for _, test := range tests {
+		if got := cfg.expandAlias(test.args); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("expandAlias(%q): got=%q want=%q", test.args, got, test.want)
+		}
+	}
+}
+
+func TestParseConfigRejectsShadowing(t *testing.T) {
+	for _, conf := range []string{
+		"[aliases]\nstack = memstats",
+		"[aliases]\n123 = memstats",
+		"[aliases]\nhprof = nosuchcommand",
+		"[nosuchsection]\nkey = value",
+	} {
+		if _, err := parseConfig(strings.NewReader(conf)); err == nil {
+			t.Errorf("parseConfig(%q): expected an error", conf)
+		}
+	}
+}
+
+func TestParseConfigProcesses(t *testing.T) {
+	cfg, err := parseConfig(strings.NewReader(`
+[processes]
+prefix = "dcr,politeia"
+match = "^vspd$"
+all = true
+
+[output]
+format = csv
+
+[agents]
+vps-dcrd = "tls://vps.example.com:9443"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.prefix == nil || *cfg.prefix != "dcr,politeia" {
+		t.Errorf("prefix: got=%v", cfg.prefix)
+	}
+	if cfg.match == nil || *cfg.match != "^vspd$" {
+		t.Errorf("match: got=%v", cfg.match)
+	}
+	if !cfg.all || cfg.format != "csv" {
+		t.Errorf("all, format: got=%v, %q", cfg.all, cfg.format)
+	}
+	if got := cfg.agentAddr("vps-dcrd"); got != "tls://vps.example.com:9443" {
+		t.Errorf("agentAddr(vps-dcrd): got=%q", got)
+	}
+	if got := cfg.agentAddr("dcrd"); got != "dcrd" {
+		t.Errorf("agentAddr(dcrd): got=%q", got)
+	}
+
+	for _, conf := range []string{
+		"[processes]\nmatch = \"(\"",
+		"[processes]\nall = maybe",
+		"[processes]\nsuffix = d",
+		"[output]\nformat = yaml",
+		"[agents]\nstack = 10.0.0.5:9000",
+		"[agents]\n123 = 10.0.0.5:9000",
+	} {
+		if _, err := parseConfig(strings.NewReader(conf)); err == nil {
+			t.Errorf("parseConfig(%q): expected an error", conf)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/google/gops/goprocess"
+	gpsnet "github.com/shirou/gopsutil/net"
+	"github.com/shirou/gopsutil/process"
+)
+
+// parseIPNet parses an IP address or a CIDR range. An address is the range
+// of that address only.
+func parseIPNet(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, ipnet, err := net.ParseCIDR(s)
+		return ipnet, err
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q", s)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// connectedTo reports whether one of conns is established to a remote in
+// ipnet.
+func connectedTo(conns []gpsnet.ConnectionStat, ipnet *net.IPNet) bool {
+	for _, c := range conns {
+		if c.Status != "ESTABLISHED" {
+			continue
+		}
+		if ip := net.ParseIP(c.Raddr.IP); ip != nil && ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterConnectedTo keeps the processes of ps with an established connection
+// to a remote in ipnet.
+func filterConnectedTo(ps []goprocess.P, ipnet *net.IPNet) []goprocess.P {
+	defer benchPhase("process collection")()
+	var kept []goprocess.P
+	for _, p := range ps {
+		pr, err := process.NewProcess(int32(p.PID))
+		if err != nil {
+			continue
+		}
+		conns, err := pr.Connections()
+		if err == nil && connectedTo(conns, ipnet) {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
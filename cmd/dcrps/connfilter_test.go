@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	gpsnet "github.com/shirou/gopsutil/net"
+)
+
+func TestConnectedTo(t *testing.T) {
+	conns := []gpsnet.ConnectionStat{
+		{Status: "LISTEN", Raddr: gpsnet.Addr{IP: "0.0.0.0"}},
+		{Status: "TIME_WAIT", Raddr: gpsnet.Addr{IP: "10.0.0.9"}},
+		{Status: "ESTABLISHED", Raddr: gpsnet.Addr{IP: "192.0.2.7", Port: 9108}},
+		{Status: "ESTABLISHED", Raddr: gpsnet.Addr{IP: "2001:db8::1", Port: 9108}},
+	}
+	tests := []struct {
+		peer string
+		want bool
+	}{
+		{"192.0.2.7", true},
+		{"192.0.2.8", false},
+		{"192.0.2.0/24", true},
+		{"10.0.0.0/8", false}, // not established
+		{"0.0.0.0/0", true},
+		{"2001:db8::/32", true},
+		{"::ffff:192.0.2.7", true},
+	}
+	for _, test := range tests {
+		ipnet, err := parseIPNet(test.peer)
+		if err != nil {
+			t.Errorf("parseIPNet(%q): %v", test.peer, err)
+			continue
+		}
+		if got := connectedTo(conns, ipnet); got != test.want {
+			t.Errorf("connectedTo(%q): got=%v want=%v", test.peer, got, test.want)
+		}
+	}
+	for _, bad := range []string{"", "192.0.2", "192.0.2.0/33", "dcrd"} {
+		if _, err := parseIPNet(bad); err == nil {
+			t.Errorf("parseIPNet(%q): got no error", bad)
+		}
+	}
+}
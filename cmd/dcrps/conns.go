@@ -0,0 +1,309 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/google/gops/goprocess"
+	gpsnet "github.com/shirou/gopsutil/net"
+	"github.com/shirou/gopsutil/process"
+)
+
+// decredPort is what a well-known port of the Decred software serves.
+type decredPort struct {
+	class   string
+	network string // empty when the port isn't specific to a network
+}
+
+// decredPorts are the default ports of the Decred software.
+var decredPorts = map[uint32]decredPort{
+	9108:  {"p2p", "mainnet"},
+	19108: {"p2p", "testnet"},
+	18555: {"p2p", "simnet"},
+	18655: {"p2p", "regnet"},
+	9109:  {"dcrd-rpc", "mainnet"},
+	19109: {"dcrd-rpc", "testnet"},
+	19556: {"dcrd-rpc", "simnet"},
+	18656: {"dcrd-rpc", "regnet"},
+	9110:  {"wallet-rpc", "mainnet"},
+	19110: {"wallet-rpc", "testnet"},
+	19557: {"wallet-rpc", "simnet"},
+	9111:  {"wallet-grpc", "mainnet"},
+	19111: {"wallet-grpc", "testnet"},
+	19558: {"wallet-grpc", "simnet"},
+	8800:  {"vspd", ""},
+	7777:  {"dcrdata", ""},
+	4443:  {"politeia", ""},
+	9735:  {"ln-p2p", ""},
+	10009: {"ln-grpc", ""},
+}
+
+// connClasses are the classes of decredPorts, in the order the summaries list
+// them, followed by the other connections.
+var connClasses = []string{
+	"p2p", "dcrd-rpc", "wallet-rpc", "wallet-grpc", "vspd", "dcrdata",
+	"politeia", "ln-p2p", "ln-grpc", "other",
+}
+
+// Directions of the connections.
+const (
+	dirListen   = "listen"
+	dirInbound  = "inbound"
+	dirOutbound = "outbound"
+)
+
+// classifiedConn is a connection with what its Decred port serves and whether
+// the process accepted or dialed it.
+type classifiedConn struct {
+	gpsnet.ConnectionStat
+	class     string
+	network   string
+	direction string // empty when unknown, as for UDP sockets
+}
+
+// classifyConnections classifies conns, the connections of a process, by the
+// well-known Decred ports. A connection is inbound when its local port is one
+// the process listens on, and then classified by that port, and outbound
+// otherwise, classified by the remote port.
+func classifyConnections(conns []gpsnet.ConnectionStat) []classifiedConn {
+	listening := make(map[uint32]bool)
+	for _, c := range conns {
+		if c.Status == "LISTEN" {
+			listening[c.Laddr.Port] = true
+		}
+	}
+	cs := make([]classifiedConn, len(conns))
+	for i, c := range conns {
+		port := c.Raddr.Port
+		switch {
+		case c.Status == "LISTEN":
+			cs[i].direction, port = dirListen, c.Laddr.Port
+		case c.Raddr.Port == 0:
+		case listening[c.Laddr.Port]:
+			cs[i].direction, port = dirInbound, c.Laddr.Port
+		default:
+			cs[i].direction = dirOutbound
+		}
+		cs[i].ConnectionStat = c
+		cs[i].class = "other"
+		if dp, ok := decredPorts[port]; ok && cs[i].direction != "" {
+			cs[i].class, cs[i].network = dp.class, dp.network
+		}
+	}
+	return cs
+}
+
+// connSummary counts the connections of a class by direction.
+type connSummary struct {
+	Class     string `json:"class"`
+	Network   string `json:"network,omitempty"`
+	Listening int    `json:"listening"`
+	Inbound   int    `json:"inbound"`
+	Outbound  int    `json:"outbound"`
+	Unknown   int    `json:"unknown,omitempty"`
+}
+
+// summarizeConnections counts cs by class and network, in the order of
+// connClasses and then of the networks.
+func summarizeConnections(cs []classifiedConn) []connSummary {
+	index := make(map[decredPort]int)
+	var sums []connSummary
+	for _, c := range cs {
+		key := decredPort{c.class, c.network}
+		i, ok := index[key]
+		if !ok {
+			i = len(sums)
+			index[key] = i
+			sums = append(sums, connSummary{Class: c.class, Network: c.network})
+		}
+		switch c.direction {
+		case dirListen:
+			sums[i].Listening++
+		case dirInbound:
+			sums[i].Inbound++
+		case dirOutbound:
+			sums[i].Outbound++
+		default:
+			sums[i].Unknown++
+		}
+	}
+	rank := func(class string) int {
+		for i, c := range connClasses {
+			if c == class {
+				return i
+			}
+		}
+		return len(connClasses)
+	}
+	sort.Slice(sums, func(i, j int) bool {
+		if sums[i].Class != sums[j].Class {
+			return rank(sums[i].Class) < rank(sums[j].Class)
+		}
+		return indexOf(networks, sums[i].Network) < indexOf(networks, sums[j].Network)
+	})
+	return sums
+}
+
+// indexOf returns the index of s in list, or len(list) when it isn't there.
+func indexOf(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return len(list)
+}
+
+// lostOutboundPeers reports whether a dcrd, or any process serving or having
+// P2P peers, has no outbound P2P peer left, as by sums.
+func lostOutboundPeers(exec string, sums []connSummary) bool {
+	p2p := exec == "dcrd"
+	for _, s := range sums {
+		if s.Class != "p2p" {
+			continue
+		}
+		if s.Outbound > 0 {
+			return false
+		}
+		p2p = true
+	}
+	return p2p
+}
+
+// formatConnClass formats class with its network, if any, such as
+// "p2p mainnet".
+func formatConnClass(class, network string) string {
+	if network == "" {
+		return class
+	}
+	return class + " " + network
+}
+
+func formatAddr(a gpsnet.Addr) string {
+	return net.JoinHostPort(a.IP, strconv.Itoa(int(a.Port)))
+}
+
+// writeConnections writes cs to w, a connection per line.
+func writeConnections(w io.Writer, cs []classifiedConn) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DIRECTION\tCLASS\tLOCAL\tREMOTE\tSTATUS")
+	for _, c := range cs {
+		dir, status := c.direction, c.Status
+		if dir == "" {
+			dir = "-"
+		}
+		if status == "" {
+			status = "NONE"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", dir, formatConnClass(c.class, c.network),
+			formatAddr(c.Laddr), formatAddr(c.Raddr), status)
+	}
+	return tw.Flush()
+}
+
+// writeConnSummary writes sums to w, a class per line.
+func writeConnSummary(w io.Writer, sums []connSummary) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CLASS\tLISTENING\tINBOUND\tOUTBOUND")
+	for _, s := range sums {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\n", formatConnClass(s.Class, s.Network),
+			s.Listening, s.Inbound, s.Outbound)
+	}
+	return tw.Flush()
+}
+
+// conns lists the connections of a process classified by the well-known
+// Decred ports, or with -summary their counts by class and direction, and
+// warns when a node has no outbound P2P peer left.
+func conns(args []string) error {
+	fs := flag.NewFlagSet("conns", flag.ExitOnError)
+	summary := fs.Bool("summary", false, "print the counts by class and direction")
+	target := parseTargetFlags(fs, args)
+	if target == "" {
+		return errors.New("missing PID or exec name")
+	}
+	pid, err := resolver.PID(target)
+	if err != nil {
+		return err
+	}
+	pr, err := process.NewProcess(int32(pid))
+	if err != nil {
+		return fmt.Errorf("cannot read process info: %v", err)
+	}
+	v, err := pr.Connections()
+	if err != nil {
+		return fmt.Errorf("cannot read connections of %s: %v", target, err)
+	}
+	cs := classifyConnections(v)
+	sums := summarizeConnections(cs)
+	exec := target
+	if p, ok, err := goprocess.Find(pid); err == nil && ok {
+		exec = p.Exec
+	}
+	lost := lostOutboundPeers(exec, sums)
+
+	if *jsonOutput {
+		out := struct {
+			Connections       []connectionJSON `json:"connections,omitempty"`
+			Summary           []connSummary    `json:"summary"`
+			NoOutboundP2PPeer bool             `json:"noOutboundP2PPeer"`
+		}{Summary: sums, NoOutboundP2PPeer: lost}
+		if out.Summary == nil {
+			out.Summary = []connSummary{}
+		}
+		if !*summary {
+			out.Connections = make([]connectionJSON, 0, len(cs))
+			for _, c := range cs {
+				out.Connections = append(out.Connections, newConnectionJSON(c))
+			}
+		}
+		printJSON(out)
+		return nil
+	}
+	if *summary {
+		err = writeConnSummary(os.Stdout, sums)
+	} else {
+		err = writeConnections(os.Stdout, cs)
+	}
+	if err != nil {
+		return err
+	}
+	if lost {
+		fmt.Fprintf(os.Stderr, "warning: %s (PID %d) has no outbound P2P peer\n", exec, pid)
+	}
+	return nil
+}
+
+// newConnectionJSON returns the JSON of the connection c.
+func newConnectionJSON(c classifiedConn) connectionJSON {
+	return connectionJSON{
+		Local:     formatAddr(c.Laddr),
+		Remote:    formatAddr(c.Raddr),
+		Status:    c.Status,
+		Class:     c.class,
+		Network:   c.network,
+		Direction: c.direction,
+	}
+}
+
+// connClassList formats the class and direction of c for the process info,
+// such as "p2p mainnet outbound".
+func connClassList(c classifiedConn) string {
+	parts := []string{formatConnClass(c.class, c.network)}
+	if c.direction != "" {
+		parts = append(parts, c.direction)
+	}
+	return strings.Join(parts, " ")
+}
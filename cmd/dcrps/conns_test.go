@@ -0,0 +1,76 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	gpsnet "github.com/shirou/gopsutil/net"
+)
+
+func connStat(lport uint32, rip string, rport uint32, status string) gpsnet.ConnectionStat {
+	return gpsnet.ConnectionStat{
+		Laddr:  gpsnet.Addr{IP: "10.0.0.1", Port: lport},
+		Raddr:  gpsnet.Addr{IP: rip, Port: rport},
+		Status: status,
+	}
+}
+
+func TestClassifyConnections(t *testing.T) {
+	conns := []gpsnet.ConnectionStat{
+		connStat(9108, "0.0.0.0", 0, "LISTEN"),
+		connStat(9108, "10.0.0.2", 50123, "ESTABLISHED"),
+		connStat(41000, "10.0.0.3", 9108, "ESTABLISHED"),
+		connStat(41001, "10.0.0.4", 19109, "ESTABLISHED"),
+		connStat(41002, "10.0.0.5", 443, "ESTABLISHED"),
+		connStat(5353, "", 0, ""),
+	}
+	type class struct {
+		class, network, direction string
+	}
+	want := []class{
+		{"p2p", "mainnet", dirListen},
+		{"p2p", "mainnet", dirInbound},
+		{"p2p", "mainnet", dirOutbound},
+		{"dcrd-rpc", "testnet", dirOutbound},
+		{"other", "", dirOutbound},
+		{"other", "", ""},
+	}
+	cs := classifyConnections(conns)
+	var got []class
+	for _, c := range cs {
+		got = append(got, class{c.class, c.network, c.direction})
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("classifyConnections: got=%v want=%v", got, want)
+	}
+
+	sums := summarizeConnections(cs)
+	wantSums := []connSummary{
+		{Class: "p2p", Network: "mainnet", Listening: 1, Inbound: 1, Outbound: 1},
+		{Class: "dcrd-rpc", Network: "testnet", Outbound: 1},
+		{Class: "other", Outbound: 1, Unknown: 1},
+	}
+	if !reflect.DeepEqual(sums, wantSums) {
+		t.Errorf("summarizeConnections: got=%+v want=%+v", sums, wantSums)
+	}
+}
+
+func TestLostOutboundPeers(t *testing.T) {
+	inboundOnly := []connSummary{{Class: "p2p", Network: "mainnet", Listening: 1, Inbound: 3}}
+	tests := []struct {
+		exec string
+		sums []connSummary
+		want bool
+	}{
+		{"dcrd", nil, true},
+		{"dcrd", inboundOnly, true},
+		{"dcrd", []connSummary{{Class: "p2p", Network: "mainnet", Outbound: 8}}, false},
+		{"dcrwallet", inboundOnly, true},
+		{"dcrwallet", []connSummary{{Class: "dcrd-rpc", Network: "mainnet", Outbound: 1}}, false},
+	}
+	for _, test := range tests {
+		if got := lostOutboundPeers(test.exec, test.sums); got != test.want {
+			t.Errorf("lostOutboundPeers(%q, %+v): got=%v want=%v", test.exec, test.sums, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/gops/goprocess"
+	"github.com/shirou/gopsutil/process"
+)
+
+// coreExitWait is how long core -abort waits for the process to exit.
+const coreExitWait = 30 * time.Second
+
+// coreBaseName returns the name the files of the core dump of p start with,
+// such as "core-dcrd-1234-20190102T150405".
+func coreBaseName(p goprocess.P, now time.Time) string {
+	return fmt.Sprintf("core-%s-%d-%s", safeFileName(p.Exec), p.PID, now.Format("20060102T150405"))
+}
+
+// processBinary returns the path to read the binary of p from, which on Linux
+// stays readable after the file is replaced, as by an upgrade.
+func processBinary(p goprocess.P) string {
+	if runtime.GOOS == "linux" {
+		return fmt.Sprintf("/proc/%d/exe", p.PID)
+	}
+	return p.Path
+}
+
+// goBuildInfo returns the build info of the binary at path, as "go version
+// -m" prints it, or "" without a go tool that reads it.
+func goBuildInfo(path string) string {
+	out, err := exec.Command("go", "version", "-m", path).Output()
+	if err != nil {
+		return ""
+	}
+	return string(out)
+}
+
+// tracebackCrash reports whether the process with the given PID runs with
+// GOTRACEBACK=crash, without which the Go runtime exits on SIGABRT with no
+// core dump. known is false when its environment can't be read, as off
+// Linux.
+func tracebackCrash(pid int) (crash, known bool) {
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/environ", pid))
+	if err != nil {
+		return false, false
+	}
+	for _, kv := range bytes.Split(b, []byte{0}) {
+		if string(kv) == "GOTRACEBACK=crash" {
+			return true, true
+		}
+	}
+	return false, true
+}
+
+// corePattern returns where the kernel writes the core dumps, the
+// core_pattern of Linux, or "" when unknown.
+func corePattern() string {
+	b, err := ioutil.ReadFile("/proc/sys/kernel/core_pattern")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// coreInfo is what core records next to a core dump for a debugger to open
+// it later.
+type coreInfo struct {
+	p         goprocess.P
+	time      time.Time
+	cmdline   string
+	binary    string // the copy of the binary, "" when not copied
+	core      string // the core dump, "" when the kernel wrote it
+	pattern   string // the core_pattern the kernel wrote it by
+	buildInfo string
+}
+
+// writeCoreInfo writes info to w.
+func writeCoreInfo(w io.Writer, info *coreInfo) {
+	fmt.Fprintf(w, "dcrps core of %s (PID %d) at %s\n\n", info.p.Exec, info.p.PID, info.time.Format(time.RFC3339))
+	fmt.Fprintf(w, "path:\t%s\n", info.p.Path)
+	fmt.Fprintf(w, "go version:\t%s\n", info.p.BuildVersion)
+	if info.cmdline != "" {
+		fmt.Fprintf(w, "cmd+args:\t%s\n", info.cmdline)
+	}
+	binary := info.p.Path
+	if info.binary != "" {
+		fmt.Fprintf(w, "binary:\t%s\n", info.binary)
+		binary = info.binary
+	}
+	core := info.core
+	if core != "" {
+		fmt.Fprintf(w, "core:\t%s\n", core)
+	} else {
+		core = "<core>"
+		pattern := info.pattern
+		if pattern == "" {
+			pattern = "unknown"
+		}
+		fmt.Fprintf(w, "core:\twritten by the kernel, core_pattern %s\n", pattern)
+	}
+	if info.buildInfo != "" {
+		fmt.Fprintf(w, "\nbuild info:\n%s", info.buildInfo)
+	}
+	fmt.Fprintf(w, "\nopen with:\tdlv core %s %s\n", binary, core)
+}
+
+// dumpCore writes the core of the running process with the given PID to
+// base.<pid> with gcore, which leaves it running, and returns its path.
+func dumpCore(pid int, base string) (string, error) {
+	c := exec.Command("gcore", "-o", base, strconv.Itoa(pid))
+	c.Stdout = os.Stderr
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		return "", fmt.Errorf("gcore: %v", err)
+	}
+	path := base + "." + strconv.Itoa(pid)
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("gcore wrote no core: %v", err)
+	}
+	return path, nil
+}
+
+// abortForCore sends SIGABRT to the process with the given PID for the Go
+// runtime to crash it into a core dump, and waits for it to exit.
+func abortForCore(pid int) error {
+	if _, known := tracebackCrash(pid); !known {
+		fmt.Fprintln(os.Stderr, "warning: cannot tell whether the process runs with GOTRACEBACK=crash, "+
+			"without which it exits with no core dump")
+	}
+	pr, err := process.NewProcess(int32(pid))
+	if err != nil {
+		return fmt.Errorf("cannot read process info: %v", err)
+	}
+	if limits, err := pr.Rlimit(); err == nil {
+		for _, l := range limits {
+			if l.Resource == process.RLIMIT_CORE && l.Soft == 0 {
+				fmt.Fprintln(os.Stderr, "warning: the core size limit of the process is 0, "+
+					"the kernel may write no core dump")
+			}
+		}
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	if err := p.Signal(syscall.SIGABRT); err != nil {
+		return err
+	}
+	for deadline := time.Now().Add(coreExitWait); time.Now().Before(deadline); {
+		if ok, err := process.PidExists(int32(pid)); err == nil && !ok {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("the process didn't exit within %v of SIGABRT", coreExitWait)
+}
+
+// core dumps the core of a process, wedged as it may be, into a directory
+// along with a copy of its binary and its build info, for delve to open.
+func core(args []string) error {
+	fs := flag.NewFlagSet("core", flag.ExitOnError)
+	dir := fs.String("out", ".", "directory to write the core dump to")
+	abort := fs.Bool("abort", false, "crash the process with SIGABRT into a core dump written by the kernel")
+	noBinary := fs.Bool("no-binary", false, "don't copy the binary next to the core dump")
+	target := parseTargetFlags(fs, args)
+	if target == "" {
+		return errors.New("missing PID or exec name")
+	}
+	if *abort {
+		resolver = exactResolver()
+	}
+	pid, err := resolver.PID(target)
+	if err != nil {
+		return err
+	}
+	p, ok, err := goprocess.Find(pid)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("PID %d is not a Go process", pid)
+	}
+	if *abort {
+		if crash, known := tracebackCrash(pid); known && !crash {
+			return errors.New("the process doesn't run with GOTRACEBACK=crash, " +
+				"SIGABRT would kill it without a core dump")
+		}
+	} else if _, err := exec.LookPath("gcore"); err != nil {
+		return errors.New("gcore, part of gdb, is needed to dump the core of a running " +
+			"process, or use -abort to crash it into a core dump")
+	}
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	base := filepath.Join(*dir, coreBaseName(p, now))
+	info := &coreInfo{p: p, time: now}
+	if pr, err := process.NewProcess(int32(pid)); err == nil {
+		info.cmdline, _ = pr.Cmdline()
+	}
+	// The binary is copied first, as -abort ends the process and an
+	// upgrade may replace the file.
+	if !*noBinary {
+		data, err := ioutil.ReadFile(processBinary(p))
+		if err != nil {
+			return fmt.Errorf("cannot copy the binary, use -no-binary to skip it: %v", err)
+		}
+		info.binary = base + ".bin"
+		if err := writeFileAtomic(info.binary, data); err != nil {
+			return err
+		}
+		info.buildInfo = goBuildInfo(info.binary)
+	} else {
+		info.buildInfo = goBuildInfo(processBinary(p))
+	}
+
+	if *abort {
+		info.pattern = corePattern()
+		err = abortForCore(pid)
+	} else {
+		info.core, err = dumpCore(pid, base)
+	}
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	writeCoreInfo(&b, info)
+	if err := writeFileAtomic(base+".txt", b.Bytes()); err != nil {
+		return err
+	}
+	if info.core != "" {
+		fmt.Printf("Core dump saved to: %s\n", info.core)
+	} else {
+		fmt.Printf("Core dump written by the kernel, core_pattern %s\n", info.pattern)
+	}
+	fmt.Printf("Info saved to: %s\n", base+".txt")
+	return nil
+}
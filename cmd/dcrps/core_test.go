@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gops/goprocess"
+)
+
+func TestWriteCoreInfo(t *testing.T) {
+	now := time.Date(2019, 1, 2, 15, 4, 5, 0, time.UTC)
+	p := goprocess.P{PID: 1234, Exec: "dcrd", Path: "/usr/bin/dcrd", BuildVersion: "go1.12"}
+	if got, want := coreBaseName(p, now), "core-dcrd-1234-20190102T150405"; got != want {
+		t.Errorf("coreBaseName: got=%q want=%q", got, want)
+	}
+
+	tests := []struct {
+		info *coreInfo
+		want []string
+	}{
+		{
+			&coreInfo{p: p, time: now, binary: "out/core.bin", core: "out/core.1234"},
+			[]string{"path:\t/usr/bin/dcrd\n", "go version:\tgo1.12\n", "core:\tout/core.1234\n",
+				"open with:\tdlv core out/core.bin out/core.1234\n"},
+		},
+		{
+			&coreInfo{p: p, time: now, pattern: "|/usr/lib/systemd/systemd-coredump %P"},
+			[]string{"core_pattern |/usr/lib/systemd/systemd-coredump %P\n",
+				"open with:\tdlv core /usr/bin/dcrd <core>\n"},
+		},
+	}
+	for i, test := range tests {
+		var b strings.Builder
+		writeCoreInfo(&b, test.info)
+		for _, want := range test.want {
+			if !strings.Contains(b.String(), want) {
+				t.Errorf("%d: info lacks %q:\n%s", i, want, b.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/process"
+)
+
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// asciiSparkBlocks stand in for sparkBlocks where the output can't show them.
+var asciiSparkBlocks = []rune("_.-:=+*#")
+
+// sparkline renders values as block characters scaled to the largest value.
+func sparkline(values []float64) string {
+	return sparklineOf(values, sparkBlocks)
+}
+
+// sparklineOf renders values as the characters of blocks, from the lowest to
+// the highest, scaled to the largest value.
+func sparklineOf(values []float64, sparkBlocks []rune) string {
+	var max float64
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	var b strings.Builder
+	for _, v := range values {
+		i := 0
+		if max > 0 {
+			i = int(v / max * float64(len(sparkBlocks)-1))
+		}
+		b.WriteRune(sparkBlocks[i])
+	}
+	return b.String()
+}
+
+// numericHistory renders values as space separated percentages, for when the
+// output can't show the sparkline glyphs.
+func numericHistory(values []float64) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = fmt.Sprintf("%.1f", v)
+	}
+	return strings.Join(s, " ")
+}
+
+// cpuHistory samples the CPU usage of a process and prints the samples as a
+// sparkline.
+func cpuHistory(args []string) error {
+	fs := flag.NewFlagSet("cpu-history", flag.ExitOnError)
+	samples := fs.Int("samples", 10, "number of samples")
+	interval := fs.Duration("interval", time.Second, "time between samples")
+	target := parseTargetFlags(fs, args)
+	if target == "" {
+		return errors.New("missing PID or exec name")
+	}
+	if *samples < 1 || *interval <= 0 {
+		return errors.New("samples and interval must be positive")
+	}
+
+	pid, err := resolver.PID(target)
+	if err != nil {
+		return err
+	}
+	p, err := process.NewProcess(int32(pid))
+	if err != nil {
+		return fmt.Errorf("cannot read process info: %v", err)
+	}
+	// The first call only records the CPU times to measure from.
+	if _, err := p.Percent(0); err != nil {
+		return err
+	}
+
+	glyphs := isTerminal(os.Stdout) && utf8Locale()
+	render := numericHistory
+	if glyphs {
+		render = sparkline
+	}
+	values := make([]float64, 0, *samples)
+	for len(values) < *samples {
+		time.Sleep(*interval)
+		v, err := p.Percent(0)
+		if err != nil {
+			return err
+		}
+		values = append(values, v)
+		if glyphs {
+			// Redraw the line in place as the samples come in.
+			fmt.Printf("\rcpu %s %.1f%%", render(values), v)
+		}
+	}
+
+	var min, max float64 = values[0], values[0]
+	for _, v := range values {
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+	if glyphs {
+		fmt.Print("\r")
+	}
+	fmt.Printf("cpu %s %.1f%% (min %.1f%%, max %.1f%%)\n", render(values),
+		values[len(values)-1], min, max)
+	return nil
+}
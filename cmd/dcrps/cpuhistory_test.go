@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestSparkline(t *testing.T) {
+	tests := []struct {
+		values []float64
+		want   string
+		ascii  string
+	}{
+		{[]float64{0, 50, 100}, "▁▄█", "_:#"},
+		{[]float64{10, 20, 40, 80}, "▁▂▄█", "_.:#"},
+		// All idle, nothing to scale to.
+		{[]float64{0, 0}, "▁▁", "__"},
+		// A busy process on several cores goes past 100.
+		{[]float64{150, 300}, "▄█", ":#"},
+		{nil, "", ""},
+	}
+	for _, test := range tests {
+		if got := sparkline(test.values); got != test.want {
+			t.Errorf("sparkline(%v): got %q, want %q", test.values, got, test.want)
+		}
+		if got := sparklineOf(test.values, asciiSparkBlocks); got != test.ascii {
+			t.Errorf("sparklineOf(%v) in ASCII: got %q, want %q", test.values, got, test.ascii)
+		}
+	}
+}
+
+func TestNumericHistory(t *testing.T) {
+	if got, want := numericHistory([]float64{0, 12.34, 100}), "0.0 12.3 100.0"; got != want {
+		t.Errorf("numericHistory: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,339 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	ossignal "os/signal"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dcrlabs/dcrps/pkg/dcrps"
+	"github.com/google/gops/goprocess"
+	"github.com/google/gops/signal"
+)
+
+// dashSeries is the history of a value of the dashboard, the latest last.
+type dashSeries struct {
+	values []float64
+	known  bool // whether the latest sample read the value
+}
+
+// add appends v, dropping the oldest values beyond n.
+func (s *dashSeries) add(v float64, n int) {
+	s.values = append(s.values, v)
+	if len(s.values) > n {
+		s.values = s.values[len(s.values)-n:]
+	}
+	s.known = true
+}
+
+func (s *dashSeries) latest() float64 {
+	if len(s.values) == 0 {
+		return 0
+	}
+	return s.values[len(s.values)-1]
+}
+
+// dashState is what the dashboard shows of a process.
+type dashState struct {
+	p        goprocess.P
+	interval time.Duration
+	history  int  // samples of each series
+	glyphs   bool // whether the output shows the sparkline glyphs
+
+	cpu, heap, goroutines, conns dashSeries
+
+	memStats  *runtime.MemStats // nil when the agent didn't answer
+	fullStats bool              // whether memStats holds the pause history
+	prevNumGC uint32
+	gcs       int // since the previous sample, -1 when unknown
+	status    string
+}
+
+// sample reads the usage of the process with s and its runtime stats at addr.
+func (d *dashState) sample(addr net.TCPAddr, s *usageSampler) {
+	usage := s.sample([]goprocess.P{d.p})
+	d.cpu.known, d.heap.known, d.goroutines.known, d.conns.known = false, false, false, false
+	if u, ok := usage[d.p.PID]; ok && u.cpuKnown {
+		d.cpu.add(u.cpu, d.history)
+	}
+	if pr, ok := s.procs[d.p.PID]; ok {
+		if n, ok := activeConnections(pr); ok {
+			d.conns.add(float64(n), d.history)
+		}
+	}
+
+	cmdTimeout = 10 * time.Second
+	if out, err := cmd(addr, signal.Stats); err == nil {
+		if n, ok := intValue(dcrps.ParseKeyValues(out), "goroutines"); ok {
+			d.goroutines.add(float64(n), d.history)
+		}
+	}
+	ms, full, err := readMemStats(addr)
+	if err != nil {
+		d.memStats, d.gcs = nil, -1
+		return
+	}
+	d.gcs = -1
+	if d.memStats != nil {
+		d.gcs = int(ms.NumGC - d.prevNumGC)
+	}
+	d.memStats, d.fullStats, d.prevNumGC = ms, full, ms.NumGC
+	d.heap.add(float64(ms.HeapAlloc), d.history)
+}
+
+// pauseBuckets are the upper bounds of the buckets of the GC pause histogram,
+// the last catching the longer pauses.
+var pauseBuckets = []time.Duration{
+	100 * time.Microsecond, 500 * time.Microsecond, time.Millisecond,
+	5 * time.Millisecond, 10 * time.Millisecond, 50 * time.Millisecond,
+}
+
+// pauseHistogram counts the latest GC pauses of s, up to the 256 it holds,
+// by pauseBuckets, with one more bucket for the longer ones.
+func pauseHistogram(s *runtime.MemStats) []int {
+	counts := make([]int, len(pauseBuckets)+1)
+	n := int(s.NumGC)
+	if n > len(s.PauseNs) {
+		n = len(s.PauseNs)
+	}
+	for i := 0; i < n; i++ {
+		pause := time.Duration(s.PauseNs[(int(s.NumGC)-1-i+len(s.PauseNs))%len(s.PauseNs)])
+		b := len(pauseBuckets)
+		for j, bound := range pauseBuckets {
+			if pause < bound {
+				b = j
+				break
+			}
+		}
+		counts[b]++
+	}
+	return counts
+}
+
+// writeDash writes the dashboard of d to w.
+func writeDash(w io.Writer, d *dashState, now time.Time) {
+	fmt.Fprintf(w, "dcrps dash - %s (PID %d), %s, %s, every %v\n\n",
+		d.p.Exec, d.p.PID, d.p.BuildVersion, now.Format("15:04:05"), d.interval)
+
+	blocks := asciiSparkBlocks
+	if d.glyphs {
+		blocks = sparkBlocks
+	}
+	row := func(name, value string, s dashSeries) {
+		if !s.known {
+			value = "-"
+		}
+		fmt.Fprintf(w, "%-11s %10s  %s\n", name, value, sparklineOf(s.values, blocks))
+	}
+	row("cpu", fmt.Sprintf("%.1f%%", d.cpu.latest()), d.cpu)
+	row("heap", formatBytes(uint64(d.heap.latest())), d.heap)
+	row("goroutines", fmt.Sprint(d.goroutines.latest()), d.goroutines)
+	row("conns", fmt.Sprint(d.conns.latest()), d.conns)
+
+	fmt.Fprintln(w)
+	ms := d.memStats
+	if ms == nil {
+		fmt.Fprintln(w, "gc          the agent didn't answer")
+	} else {
+		since := "-"
+		if d.gcs >= 0 {
+			since = fmt.Sprint(d.gcs)
+		}
+		fmt.Fprintf(w, "gc          %d cycles, %s since the last refresh, next at %s, paused %v in total\n",
+			ms.NumGC, since, formatBytes(ms.NextGC), time.Duration(ms.PauseTotalNs))
+		if d.fullStats {
+			writePauseHistogram(w, pauseHistogram(ms))
+		} else {
+			fmt.Fprintln(w, "            the agent doesn't report the pause history")
+		}
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "keys: g gc, s save the stacks, t trace 5s, q quit")
+	if d.status != "" {
+		fmt.Fprintln(w, d.status)
+	}
+}
+
+// writePauseHistogram writes the bars of the counts of pauseHistogram to w.
+func writePauseHistogram(w io.Writer, counts []int) {
+	const width = 40
+	var max int
+	for _, n := range counts {
+		if n > max {
+			max = n
+		}
+	}
+	for i, n := range counts {
+		label := ">=" + pauseBuckets[len(pauseBuckets)-1].String()
+		if i < len(pauseBuckets) {
+			label = "<" + pauseBuckets[i].String()
+		}
+		bar := 0
+		if max > 0 {
+			bar = (n*width + max - 1) / max
+		}
+		fmt.Fprintf(w, "  %8s %5d %s\n", label, n, strings.Repeat("#", bar))
+	}
+}
+
+// dashFileName returns the name of a file dash saves for p, such as
+// "dcrps-stack-dcrd-1234-20190102T150405.txt".
+func dashFileName(kind string, p goprocess.P, now time.Time, ext string) string {
+	return fmt.Sprintf("dcrps-%s-%s-%d-%s%s", kind, safeFileName(p.Exec), p.PID,
+		now.Format("20060102T150405"), ext)
+}
+
+// dashAction runs the action of key on the process at addr and returns the
+// status line reporting it.
+func dashAction(key byte, addr net.TCPAddr, p goprocess.P) string {
+	now := time.Now()
+	switch key {
+	case 'g':
+		cmdTimeout = time.Minute
+		if _, err := cmd(addr, signal.GC); err != nil {
+			return "gc: " + err.Error()
+		}
+		return "gc: done at " + now.Format("15:04:05")
+	case 's':
+		cmdTimeout = 10 * time.Second
+		out, err := cmd(addr, signal.StackTrace)
+		if err != nil {
+			return "stacks: " + err.Error()
+		}
+		path := dashFileName("stack", p, now, ".txt")
+		if err := writeFileAtomic(path, out); err != nil {
+			return "stacks: " + err.Error()
+		}
+		gs := dcrps.ParseStack(out)
+		return fmt.Sprintf("stacks: %d goroutines, %d unique stacks, saved to %s",
+			len(gs), len(dedupeGoroutines(gs)), path)
+	case 't':
+		cmdTimeout = defaultTraceWindow + traceTimeoutSlack
+		out, err := cmd(addr, signal.Trace)
+		if err == nil && len(out) == 0 {
+			err = errors.New("nothing has traced")
+		}
+		if err != nil {
+			return "trace: " + err.Error()
+		}
+		path := dashFileName("trace", p, now, ".out")
+		if err := writeFileAtomic(path, out); err != nil {
+			return "trace: " + err.Error()
+		}
+		return "trace: saved to " + path + ", open it with go tool trace"
+	}
+	return ""
+}
+
+// dash redraws a dashboard of a process every interval until interrupted:
+// the history of its CPU usage, heap, goroutines and connections, its GC
+// cycles and the histogram of its latest GC pauses, with keys to run a GC,
+// save its stacks or trace it.
+func dash(args []string) error {
+	fs := flag.NewFlagSet("dash", flag.ExitOnError)
+	interval := fs.Duration("interval", 2*time.Second, "refresh interval")
+	history := fs.Int("history", 60, "samples of the graphs")
+	target := parseTargetFlags(fs, args)
+	if target == "" {
+		return errors.New("missing PID or exec name")
+	}
+	if *interval <= 0 {
+		return fmt.Errorf("invalid -interval %v", *interval)
+	}
+	if *history < 1 {
+		return fmt.Errorf("invalid -history %d", *history)
+	}
+	if !isTerminal(os.Stdout) {
+		return errors.New("dash needs a terminal, use top or watch otherwise")
+	}
+	pid, err := resolver.PID(target)
+	if err != nil {
+		return err
+	}
+	p, ok, err := goprocess.Find(pid)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("PID %d is not a Go process", pid)
+	}
+	addr, err := resolver.Resolve(target)
+	if err != nil {
+		return err
+	}
+
+	d := &dashState{p: p, interval: *interval, history: *history, glyphs: utf8Locale(), gcs: -1}
+	keys := make(chan byte)
+	if isTerminal(os.Stdin) {
+		restore, err := cbreakTerminal()
+		if err != nil {
+			d.status = "keys disabled: " + err.Error()
+		} else {
+			defer restore()
+			go func() {
+				b := make([]byte, 1)
+				for {
+					if _, err := os.Stdin.Read(b); err != nil {
+						return
+					}
+					keys <- b[0]
+				}
+			}()
+		}
+	}
+	interrupt := make(chan os.Signal, 1)
+	ossignal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer ossignal.Stop(interrupt)
+	fmt.Print(hideCursor)
+	defer fmt.Print(showCursor)
+
+	sampler := &usageSampler{}
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	draw := func() {
+		var b strings.Builder
+		writeDash(&b, d, time.Now())
+		fmt.Print(clearScreen + b.String())
+	}
+	// The actions block the redraws, as the agent serves one request at
+	// a time.
+	pending := map[byte]string{
+		'g': "gc: running...",
+		's': "stacks: reading...",
+		't': fmt.Sprintf("trace: tracing for %v...", defaultTraceWindow),
+	}
+	d.sample(*addr, sampler)
+	draw()
+	for {
+		select {
+		case <-ticker.C:
+			d.sample(*addr, sampler)
+		case key := <-keys:
+			if key == 'q' {
+				return nil
+			}
+			status, ok := pending[key]
+			if !ok {
+				continue
+			}
+			d.status = status
+			draw()
+			d.status = dashAction(key, *addr, p)
+		case <-interrupt:
+			return nil
+		}
+		draw()
+	}
+}
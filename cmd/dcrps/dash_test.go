@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gops/goprocess"
+)
+
+func TestDashSeries(t *testing.T) {
+	var s dashSeries
+	for i := 1; i <= 5; i++ {
+		s.add(float64(i), 3)
+	}
+	if want := []float64{3, 4, 5}; !reflect.DeepEqual(s.values, want) {
+		t.Errorf("add: got=%v want=%v", s.values, want)
+	}
+	if s.latest() != 5 {
+		t.Errorf("latest: got=%v want=5", s.latest())
+	}
+}
+
+func TestPauseHistogram(t *testing.T) {
+	var s runtime.MemStats
+	// 258 GCs wrap around the 256 pauses held.
+	s.NumGC = 258
+	for i := range s.PauseNs {
+		s.PauseNs[i] = uint64(200 * time.Microsecond)
+	}
+	s.PauseNs[0] = uint64(2 * time.Millisecond)
+	s.PauseNs[1] = uint64(time.Second)
+	got := pauseHistogram(&s)
+	want := []int{0, 254, 0, 1, 0, 0, 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pauseHistogram: got=%v want=%v", got, want)
+	}
+}
+
+func TestWriteDash(t *testing.T) {
+	d := &dashState{
+		p:        goprocess.P{PID: 1234, Exec: "dcrd", BuildVersion: "go1.12"},
+		interval: 2 * time.Second,
+		history:  10,
+		gcs:      -1,
+		status:   "gc: done at 15:04:05",
+	}
+	d.cpu.add(12.5, d.history)
+	d.goroutines.add(42, d.history)
+	d.memStats = &runtime.MemStats{NumGC: 3}
+	var b strings.Builder
+	writeDash(&b, d, time.Date(2019, 1, 2, 15, 4, 5, 0, time.UTC))
+	out := b.String()
+	for _, want := range []string{
+		"dcrps dash - dcrd (PID 1234), go1.12, 15:04:05, every 2s\n",
+		"cpu              12.5%  #\n",
+		"heap                 -  \n",
+		"goroutines          42  #\n",
+		"gc          3 cycles, - since the last refresh",
+		"the agent doesn't report the pause history",
+		"gc: done at 15:04:05\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("writeDash: missing %q in:\n%s", want, out)
+		}
+	}
+}
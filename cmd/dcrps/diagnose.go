@@ -0,0 +1,259 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dcrlabs/dcrps/pkg/dcrps"
+	"github.com/dcrlabs/dcrps/resolve"
+	"github.com/google/gops/signal"
+	gpsnet "github.com/shirou/gopsutil/net"
+	"github.com/shirou/gopsutil/process"
+)
+
+// briefMemStats are the memstats included in the diagnose report.
+var briefMemStats = []string{
+	"alloc", "sys", "heap-alloc", "heap-in-use", "heap-objects",
+	"next-gc", "last-gc", "num-gc", "gc-pause-total",
+}
+
+// stateCount is the number of connections in a given state.
+type stateCount struct {
+	State string
+	Count int
+}
+
+// connectionStates counts conns by their status, most common first.
+func connectionStates(conns []gpsnet.ConnectionStat) []stateCount {
+	counts := make(map[string]int)
+	for _, c := range conns {
+		state := c.Status
+		if state == "" {
+			state = "NONE" // e.g. UDP sockets
+		}
+		counts[state]++
+	}
+	scs := make([]stateCount, 0, len(counts))
+	for state, n := range counts {
+		scs = append(scs, stateCount{state, n})
+	}
+	sort.Slice(scs, func(i, j int) bool {
+		if scs[i].Count != scs[j].Count {
+			return scs[i].Count > scs[j].Count
+		}
+		return scs[i].State < scs[j].State
+	})
+	return scs
+}
+
+// gcPressure judges how much of its life a process spends collecting
+// garbage from its memstats and uptime. It returns "low", "moderate" or
+// "high" along with the figures the verdict is based on.
+func gcPressure(memstats map[string]string, uptime time.Duration) (string, string) {
+	numGC, ok1 := intValue(memstats, "num-gc")
+	pause, ok2 := durationValue(memstats, "gc-pause-total")
+	if !ok1 || !ok2 || uptime <= 0 {
+		return "unknown", "missing the GC stats or the uptime"
+	}
+	perSec := float64(numGC) / uptime.Seconds()
+	paused := 100 * pause.Seconds() / uptime.Seconds()
+	verdict := "low"
+	switch {
+	case paused >= 5 || perSec >= 10:
+		verdict = "high"
+	case paused >= 1 || perSec >= 1:
+		verdict = "moderate"
+	}
+	return verdict, fmt.Sprintf("%.2f GCs/s, %.3f%% of the time paused over %v uptime",
+		perSec, paused, uptime.Round(time.Second))
+}
+
+// diagnoseReport is what diagnose found out about a target, for
+// writeDiagnose.
+type diagnoseReport struct {
+	Target string
+	At     time.Time
+	// PID is the local process of the target, 0 for an address target,
+	// and Info its process info, as the process info command prints it.
+	PID  int
+	Info []byte
+	// Conns counts the connections of the process by state, nil when
+	// they can't be read.
+	Conns  []stateCount
+	Uptime time.Duration
+
+	// Agent is "ok", "missing" when the process runs no agent, or
+	// "unreachable", for AgentError.
+	Agent      string
+	AgentAddr  string
+	AgentError error
+	// The runtime sections, nil past the first that couldn't be read.
+	Stats      []byte
+	MemStats   map[string]string
+	Goroutines []goroutine
+}
+
+// agentState returns the Agent of a report from the error of resolving the
+// target to its agent and then reaching it.
+func agentState(err error) string {
+	switch err.(type) {
+	case nil:
+		return "ok"
+	case *resolve.NoAgentError:
+		return "missing"
+	}
+	return "unreachable"
+}
+
+// collectDiagnose gathers the report on target, whose local process is pid
+// when local. It returns no report when the process info can't be read, and
+// the report of what came before along with the error of a runtime section
+// failing past the first.
+func collectDiagnose(target string, local bool, pid int) (*diagnoseReport, error) {
+	r := &diagnoseReport{Target: target, At: time.Now()}
+	if local {
+		var info bytes.Buffer
+		if err := writeProcessInfo(&info, pid, false); err != nil {
+			return nil, fmt.Errorf("cannot read process info: %v", err)
+		}
+		r.PID, r.Info = pid, info.Bytes()
+		p, _ := process.NewProcess(int32(pid))
+		if created, err := p.CreateTime(); err == nil {
+			r.Uptime = time.Since(time.Unix(0, created*int64(time.Millisecond)))
+		}
+		if conns, err := p.Connections(); err == nil {
+			r.Conns = connectionStates(conns)
+		}
+	}
+
+	addr, err := resolver.Resolve(target)
+	if err == nil {
+		r.AgentAddr = addr.String()
+		// A wedged agent, as triage often meets, must not hang the
+		// report.
+		cmdTimeout = 10 * time.Second
+		r.Stats, err = cmd(*addr, signal.Stats)
+	}
+	r.Agent, r.AgentError = agentState(err), err
+	if err != nil {
+		return r, nil
+	}
+
+	memOut, err := cmd(*addr, signal.MemStats)
+	if err != nil {
+		return r, err
+	}
+	r.MemStats = dcrps.ParseKeyValues(memOut)
+	stackOut, err := cmd(*addr, signal.StackTrace)
+	if err != nil {
+		return r, err
+	}
+	r.Goroutines = dcrps.ParseStack(stackOut)
+	return r, nil
+}
+
+// writeDiagnose writes the sections of the report r to w.
+func writeDiagnose(w io.Writer, r *diagnoseReport) {
+	fmt.Fprintf(w, "dcrps diagnose %s at %s\n", r.Target, r.At.Format(time.RFC3339))
+	if r.PID > 0 {
+		fmt.Fprintf(w, "\n== process %d\n%s", r.PID, r.Info)
+	}
+	if r.Conns != nil {
+		var n int
+		for _, sc := range r.Conns {
+			n += sc.Count
+		}
+		fmt.Fprintf(w, "\n== connections (%d)\n", n)
+		for _, sc := range r.Conns {
+			fmt.Fprintf(w, "%s:\t%d\n", strings.ToLower(sc.State), sc.Count)
+		}
+	}
+
+	fmt.Fprintf(w, "\n== agent\n")
+	if r.AgentError != nil {
+		fmt.Fprintf(w, "%s, runtime sections skipped: %v\n", r.Agent, r.AgentError)
+		return
+	}
+	fmt.Fprintf(w, "%s at %s\n", r.Agent, r.AgentAddr)
+	fmt.Fprintf(w, "\n== runtime\n%s", r.Stats)
+
+	if r.MemStats == nil {
+		return
+	}
+	fmt.Fprintf(w, "\n== memstats\n")
+	for _, key := range briefMemStats {
+		fmt.Fprintf(w, "%s: %s\n", key, r.MemStats[key])
+	}
+	verdict, detail := gcPressure(r.MemStats, r.Uptime)
+	fmt.Fprintf(w, "\n== gc pressure\n%s (%s)\n", verdict, detail)
+
+	if r.Goroutines == nil {
+		return
+	}
+	fmt.Fprintf(w, "\n== top stack frames (%d goroutines)\n", len(r.Goroutines))
+	for i, fc := range topFrames(r.Goroutines) {
+		if i == 10 {
+			break
+		}
+		fmt.Fprintf(w, "%6d %s\n", fc.Count, fc.Func)
+	}
+}
+
+// diagnose prints a triage report on a process gathering its info, runtime
+// stats, memstats, connections and stacks.
+func diagnose(args []string) error {
+	fs := flag.NewFlagSet("diagnose", flag.ExitOnError)
+	out := fs.String("o", "", "write the report to file")
+	target := parseTargetFlags(fs, args)
+	if target == "" {
+		return errors.New("missing PID, exec name or address")
+	}
+
+	// Address targets have no local process to report on. The others are
+	// resolved before -o is created, so that no empty report is left.
+	local := !strings.Contains(target, ":")
+	var pid int
+	if local {
+		var err error
+		pid, err = resolver.PID(target)
+		if err != nil {
+			return err
+		}
+		if exists, err := process.PidExists(int32(pid)); err == nil && !exists {
+			return &resolve.NoProcessError{Target: target}
+		}
+	}
+
+	r, err := collectDiagnose(target, local, pid)
+	if r == nil {
+		return err
+	}
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	writeDiagnose(w, r)
+	if err != nil {
+		return err
+	}
+	if *out != "" {
+		fmt.Printf("Report saved to: %s\n", *out)
+	}
+	return nil
+}
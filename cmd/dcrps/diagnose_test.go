@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dcrlabs/dcrps/resolve"
+	gpsnet "github.com/shirou/gopsutil/net"
+)
+
+func TestConnectionStates(t *testing.T) {
+	got := connectionStates([]gpsnet.ConnectionStat{
+		{Status: "ESTABLISHED"}, {Status: "LISTEN"}, {Status: "ESTABLISHED"},
+		{Status: "TIME_WAIT"}, {Status: ""},
+	})
+	want := []stateCount{{"ESTABLISHED", 2}, {"LISTEN", 1}, {"NONE", 1}, {"TIME_WAIT", 1}}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got %v, want %v", got, want)
+			break
+		}
+	}
+}
+
+func TestGCPressure(t *testing.T) {
+	tests := []struct {
+		numGC, pause string
+		uptime       time.Duration
+		want         string
+	}{
+		{"100", "10ms", time.Hour, "low"},
+		{"7200", "10ms", time.Hour, "moderate"},
+		{"100", "1m", time.Hour, "moderate"},
+		{"100", "5m", time.Hour, "high"},
+		{"100", "10ms", 0, "unknown"},
+		{"", "10ms", time.Hour, "unknown"},
+	}
+	for _, test := range tests {
+		memstats := map[string]string{"num-gc": test.numGC, "gc-pause-total": test.pause}
+		if got, detail := gcPressure(memstats, test.uptime); got != test.want {
+			t.Errorf("gcPressure(%s GCs, %s paused, %v): got %s (%s), want %s",
+				test.numGC, test.pause, test.uptime, got, detail, test.want)
+		}
+	}
+}
+
+func TestAgentState(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, "ok"},
+		{&resolve.NoAgentError{PID: 42}, "missing"},
+		{errors.New("dial tcp 127.0.0.1:1: connect: connection refused"), "unreachable"},
+		{errors.New("the agent didn't answer within 10s, see -timeout to wait longer"), "unreachable"},
+	}
+	for _, test := range tests {
+		if got := agentState(test.err); got != test.want {
+			t.Errorf("agentState(%v): got=%v want=%v", test.err, got, test.want)
+		}
+	}
+}
+
+func TestWriteDiagnose(t *testing.T) {
+	at := time.Date(2019, 5, 14, 4, 12, 53, 0, time.UTC)
+	process := diagnoseReport{
+		Target: "dcrd", At: at, PID: 42, Info: []byte("threads:\t4\n"),
+		Conns:  []stateCount{{"ESTABLISHED", 8}, {"LISTEN", 2}},
+		Uptime: time.Hour,
+	}
+	withAgent := func(r diagnoseReport, agent string, err error) *diagnoseReport {
+		r.Agent, r.AgentError = agent, err
+		if err == nil {
+			r.AgentAddr = "127.0.0.1:9000"
+			r.Stats = []byte("goroutines: 2\n")
+		}
+		return &r
+	}
+	full := withAgent(process, "ok", nil)
+	full.MemStats = map[string]string{"alloc": "1.00MB (1048576 bytes)", "num-gc": "36", "gc-pause-total": "10ms"}
+	full.Goroutines = []goroutine{
+		{Frames: []frame{{Func: "time.Sleep"}}},
+		{Frames: []frame{{Func: "time.Sleep"}}},
+	}
+	noStacks := withAgent(process, "ok", nil)
+	noStacks.MemStats = full.MemStats
+
+	tests := []struct {
+		name   string
+		report *diagnoseReport
+		want   []string // the lines, in order
+		absent []string
+	}{
+		{"full", full, []string{
+			"dcrps diagnose dcrd at 2019-05-14T04:12:53Z",
+			"== process 42", "threads:\t4",
+			"== connections (10)", "established:\t8", "listen:\t2",
+			"== agent", "ok at 127.0.0.1:9000",
+			"== runtime", "goroutines: 2",
+			"== memstats", "alloc: 1.00MB (1048576 bytes)", "sys: ",
+			"== gc pressure", "low (0.01 GCs/s",
+			"== top stack frames (2 goroutines)", "     2 time.Sleep",
+		}, nil},
+		{"missing agent", withAgent(process, "missing", &resolve.NoAgentError{PID: 42}), []string{
+			"== process 42",
+			"== agent", "missing, runtime sections skipped: ",
+		}, []string{"== runtime", "== memstats"}},
+		{"unreachable agent", withAgent(process, "unreachable", errors.New("connection refused")), []string{
+			"== connections (10)",
+			"== agent", "unreachable, runtime sections skipped: connection refused",
+		}, []string{"== runtime", "== memstats"}},
+		{"address target", withAgent(diagnoseReport{Target: "10.0.0.5:9000", At: at}, "ok", nil), []string{
+			"dcrps diagnose 10.0.0.5:9000 at 2019-05-14T04:12:53Z",
+			"== agent", "ok at 127.0.0.1:9000", "== runtime",
+		}, []string{"== process", "== connections", "== memstats"}},
+		// The stack dump failed: the report ends with the sections read.
+		{"failed stacks", noStacks, []string{"== memstats", "== gc pressure"},
+			[]string{"== top stack frames"}},
+	}
+	for _, test := range tests {
+		var b bytes.Buffer
+		writeDiagnose(&b, test.report)
+		out := b.String()
+		rest := out
+		for _, line := range test.want {
+			i := strings.Index(rest, line)
+			if i < 0 {
+				t.Errorf("%s: no %q in order in:\n%s", test.name, line, out)
+				break
+			}
+			rest = rest[i+len(line):]
+		}
+		for _, s := range test.absent {
+			if strings.Contains(out, s) {
+				t.Errorf("%s: got %q in:\n%s", test.name, s, out)
+			}
+		}
+	}
+}
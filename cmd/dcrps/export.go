@@ -0,0 +1,158 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	ossignal "os/signal"
+	"runtime"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/gops/goprocess"
+)
+
+// runtimeMetricFamily is a metric of the Prometheus text format read from the
+// memstats of the agent of a process.
+type runtimeMetricFamily struct {
+	name, typ, help string
+	read            func(s *runtime.MemStats) float64
+}
+
+// runtimeMetricFamilies are the metrics of the agent-enabled processes.
+var runtimeMetricFamilies = []runtimeMetricFamily{
+	{"dcrps_go_memstats_heap_alloc_bytes", "gauge", "Bytes of allocated heap objects.",
+		func(s *runtime.MemStats) float64 { return float64(s.HeapAlloc) }},
+	{"dcrps_go_memstats_heap_objects", "gauge", "Number of allocated heap objects.",
+		func(s *runtime.MemStats) float64 { return float64(s.HeapObjects) }},
+	{"dcrps_go_memstats_sys_bytes", "gauge", "Bytes of memory obtained from the OS.",
+		func(s *runtime.MemStats) float64 { return float64(s.Sys) }},
+	{"dcrps_go_memstats_next_gc_bytes", "gauge", "Heap size target of the next GC in bytes.",
+		func(s *runtime.MemStats) float64 { return float64(s.NextGC) }},
+	{"dcrps_go_memstats_alloc_bytes_total", "counter", "Cumulative bytes allocated for heap objects.",
+		func(s *runtime.MemStats) float64 { return float64(s.TotalAlloc) }},
+	{"dcrps_go_memstats_mallocs_total", "counter", "Cumulative count of heap objects allocated.",
+		func(s *runtime.MemStats) float64 { return float64(s.Mallocs) }},
+	{"dcrps_go_memstats_frees_total", "counter", "Cumulative count of heap objects freed.",
+		func(s *runtime.MemStats) float64 { return float64(s.Frees) }},
+	{"dcrps_go_gc_cycles_total", "counter", "Number of completed GC cycles.",
+		func(s *runtime.MemStats) float64 { return float64(s.NumGC) }},
+	{"dcrps_go_gc_pause_seconds_total", "counter", "Cumulative GC stop-the-world pause time in seconds.",
+		func(s *runtime.MemStats) float64 { return float64(s.PauseTotalNs) / 1e9 }},
+}
+
+// readRuntimeMetrics reads the memstats of the agent-enabled processes of ps,
+// leaving out those whose agent didn't answer.
+func readRuntimeMetrics(ps []goprocess.P) map[int]*runtime.MemStats {
+	stats := make(map[int]*runtime.MemStats)
+	for _, p := range ps {
+		if !p.Agent {
+			continue
+		}
+		addr, err := resolver.Resolve(strconv.Itoa(p.PID))
+		if err != nil {
+			continue
+		}
+		if s, _, err := readMemStats(*addr); err == nil {
+			stats[p.PID] = s
+		}
+	}
+	return stats
+}
+
+// writeRuntimeMetrics writes the runtime metrics of ps whose memstats are in
+// stats to w in the Prometheus text format.
+func writeRuntimeMetrics(w io.Writer, ps []goprocess.P, stats map[int]*runtime.MemStats) {
+	for _, m := range runtimeMetricFamilies {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ)
+		for _, p := range ps {
+			if s, ok := stats[p.PID]; ok {
+				fmt.Fprintf(w, "%s{%s} %v\n", m.name, processLabels(p), m.read(s))
+			}
+		}
+	}
+}
+
+// exporter serves the metrics of the last scrape.
+type exporter struct {
+	mu      sync.Mutex
+	metrics []byte // nil until the first scrape
+}
+
+// scrape collects the metrics of the dcr processes, the runtime ones through
+// their agents.
+func (e *exporter) scrape() {
+	ps := dcrProcesses()
+	var buf bytes.Buffer
+	writeRuntimeMetrics(&buf, ps, readRuntimeMetrics(ps))
+	writeMetrics(&buf, ps, time.Now())
+	e.mu.Lock()
+	e.metrics = buf.Bytes()
+	e.mu.Unlock()
+}
+
+func (e *exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/metrics" {
+		http.NotFound(w, r)
+		return
+	}
+	e.mu.Lock()
+	metrics := e.metrics
+	e.mu.Unlock()
+	if metrics == nil {
+		http.Error(w, "no scrape yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(metrics)
+}
+
+// export serves the metrics of the dcr processes to Prometheus at /metrics,
+// scraped every interval, until interrupted.
+func export(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	listen := fs.String("listen", ":9123", "address to serve /metrics at")
+	interval := fs.Duration("interval", 15*time.Second, "time between scrapes")
+	parseCommandFlags(fs, args)
+	if *interval <= 0 {
+		return errors.New("interval must be positive")
+	}
+
+	// An agent that hangs must not stall the scrapes for good.
+	cmdTimeout = 10 * time.Second
+	e := &exporter{}
+	e.scrape()
+	srv := &http.Server{Addr: *listen, Handler: e}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.ListenAndServe() }()
+	fmt.Fprintf(os.Stderr, "serving the metrics at %s/metrics, scraped every %v\n", *listen, *interval)
+
+	interrupt := make(chan os.Signal, 1)
+	ossignal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer ossignal.Stop(interrupt)
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			e.scrape()
+		case err := <-serveErr:
+			return err
+		case <-interrupt:
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			return srv.Shutdown(ctx)
+		}
+	}
+}
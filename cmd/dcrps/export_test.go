@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/google/gops/goprocess"
+)
+
+func TestWriteRuntimeMetrics(t *testing.T) {
+	ps := []goprocess.P{
+		{PID: 10, Exec: "dcrd", BuildVersion: "go1.12", Agent: true},
+		// No agent.
+		{PID: 11, Exec: "dcrctl", BuildVersion: "go1.12"},
+	}
+	stats := map[int]*runtime.MemStats{10: {HeapAlloc: 4096, NumGC: 7, PauseTotalNs: 1500000000}}
+	var b bytes.Buffer
+	writeRuntimeMetrics(&b, ps, stats)
+	out := b.String()
+	for _, want := range []string{
+		"dcrps_go_memstats_heap_alloc_bytes{pid=\"10\",exec=\"dcrd\",version=\"go1.12\"} 4096\n",
+		"dcrps_go_gc_cycles_total{pid=\"10\",exec=\"dcrd\",version=\"go1.12\"} 7\n",
+		"dcrps_go_gc_pause_seconds_total{pid=\"10\",exec=\"dcrd\",version=\"go1.12\"} 1.5\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, `pid="11"`) {
+		t.Errorf("metrics of the process without the agent:\n%s", out)
+	}
+}
+
+func TestExporter(t *testing.T) {
+	e := &exporter{}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != 503 {
+		t.Errorf("before the first scrape: got status %d want 503", rec.Code)
+	}
+
+	e.metrics = []byte("dcrps_metrics_timestamp_seconds 1\n")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != 200 || rec.Body.String() != string(e.metrics) {
+		t.Errorf("got status %d, body %q", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != 404 {
+		t.Errorf("/: got status %d want 404", rec.Code)
+	}
+}
@@ -0,0 +1,310 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dcrlabs/dcrps/resolve"
+	"github.com/shirou/gopsutil/process"
+)
+
+// The kinds of the open files, by what their descriptor refers to.
+const (
+	fdSocket   = "socket"
+	fdDatabase = "database" // the block database, the wallet and the like
+	fdLog      = "log"
+	fdFile     = "file" // the other files
+	fdPipe     = "pipe"
+	fdDevice   = "device"
+	fdOther    = "other" // the anonymous inodes, such as epoll instances
+)
+
+// fdKinds are the kinds of the open files, in the order they are printed.
+var fdKinds = []string{fdSocket, fdDatabase, fdLog, fdFile, fdPipe, fdDevice, fdOther}
+
+// databaseExts are the extensions of the files of the databases: the block
+// files of ffldb, the tables of leveldb, bolt and SQLite.
+var databaseExts = map[string]bool{".fdb": true, ".ldb": true, ".sst": true, ".db": true, ".sqlite": true}
+
+// classifyFD returns the kind of the open file the /proc/<pid>/fd link of a
+// descriptor points to. The files in a directory whose name ends with "db",
+// such as the blocks_ffldb of dcrd, are database files, as the logs,
+// manifests and locks of leveldb are; the .log files elsewhere are logs.
+func classifyFD(target string) string {
+	switch {
+	case strings.HasPrefix(target, "socket:"):
+		return fdSocket
+	case strings.HasPrefix(target, "pipe:"):
+		return fdPipe
+	case strings.HasPrefix(target, "/dev/"):
+		return fdDevice
+	case !strings.HasPrefix(target, "/"):
+		return fdOther
+	}
+	path := strings.TrimSuffix(target, deletedSuffix)
+	if databaseExts[strings.ToLower(filepath.Ext(path))] {
+		return fdDatabase
+	}
+	dirs := strings.Split(filepath.Dir(path), "/")
+	for _, dir := range dirs {
+		if strings.HasSuffix(strings.ToLower(dir), "db") {
+			return fdDatabase
+		}
+	}
+	base := filepath.Base(path)
+	if strings.HasSuffix(base, ".log") || strings.Contains(base, ".log.") {
+		return fdLog
+	}
+	for _, dir := range dirs {
+		if dir == "logs" || dir == "log" {
+			return fdLog
+		}
+	}
+	return fdFile
+}
+
+// openFD is an open file descriptor of a process.
+type openFD struct {
+	FD     int    `json:"fd"`
+	Kind   string `json:"kind"`
+	Target string `json:"target"`
+}
+
+// readOpenFDs returns the open file descriptors of the process with the
+// given PID, sorted, from /proc/<pid>/fd on Linux.
+func readOpenFDs(pid int) ([]openFD, error) {
+	if runtime.GOOS != "linux" {
+		return nil, errors.New("the open files can only be told apart on Linux")
+	}
+	dir := fmt.Sprintf("/proc/%d/fd", pid)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	fds := make([]openFD, 0, len(entries))
+	for _, e := range entries {
+		fd, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		target, err := os.Readlink(filepath.Join(dir, e.Name()))
+		if err != nil {
+			continue // closed since
+		}
+		fds = append(fds, openFD{FD: fd, Kind: classifyFD(target), Target: target})
+	}
+	sort.Slice(fds, func(i, j int) bool { return fds[i].FD < fds[j].FD })
+	return fds, nil
+}
+
+// memoryMapsJSON counts the memory mapped regions of a process, against the
+// vm.max_map_count limit of the system.
+type memoryMapsJSON struct {
+	Regions int `json:"regions"`
+	Files   int `json:"files"` // the regions mapping files
+	Limit   int `json:"limit"`
+}
+
+// parseMaps counts the regions of a /proc/<pid>/maps file and those mapping
+// files.
+func parseMaps(maps []byte) (regions, files int) {
+	scanner := bufio.NewScanner(bytes.NewReader(maps))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		regions++
+		if len(fields) >= 6 && strings.HasPrefix(fields[5], "/") {
+			files++
+		}
+	}
+	return regions, files
+}
+
+// readMemoryMaps counts the memory mapped regions of the process with the
+// given PID on Linux.
+func readMemoryMaps(pid int) (*memoryMapsJSON, error) {
+	if runtime.GOOS != "linux" {
+		return nil, errors.New("the memory maps can only be read on Linux")
+	}
+	maps, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/maps", pid))
+	if err != nil {
+		return nil, err
+	}
+	m := new(memoryMapsJSON)
+	m.Regions, m.Files = parseMaps(maps)
+	if b, err := ioutil.ReadFile("/proc/sys/vm/max_map_count"); err == nil {
+		m.Limit, _ = strconv.Atoi(strings.TrimSpace(string(b)))
+	}
+	return m, nil
+}
+
+// fdReport is the use of the open files of a process and of its memory
+// maps. The fields that can't be read are null.
+type fdReport struct {
+	Open  *int32              `json:"open"`
+	Limit *openFilesLimitJSON `json:"limit"`
+	// Percent is the share of the soft limit open, unless unlimited.
+	Percent *float64        `json:"percent"`
+	ByKind  map[string]int  `json:"byKind"`
+	Maps    *memoryMapsJSON `json:"memoryMaps"`
+	// Warnings tell the limits used past -fd-warn percent.
+	Warnings []string `json:"warnings"`
+	FDs      []openFD `json:"fds,omitempty"`
+}
+
+// readFDReport reads the fdReport of p, with the list of its descriptors
+// when list is set.
+func readFDReport(p *process.Process, list bool) *fdReport {
+	r := &fdReport{Warnings: []string{}}
+	pid := int(p.Pid)
+	if v, err := p.NumFDs(); err == nil {
+		r.Open = &v
+	}
+	if soft, hard, ok := openFilesLimit(p); ok {
+		r.Limit = &openFilesLimitJSON{Soft: soft, Hard: hard}
+	}
+	if fds, err := readOpenFDs(pid); err == nil {
+		r.ByKind = make(map[string]int)
+		for _, fd := range fds {
+			r.ByKind[fd.Kind]++
+		}
+		if list {
+			r.FDs = fds
+		}
+	}
+	if m, err := readMemoryMaps(pid); err == nil {
+		r.Maps = m
+	}
+
+	if r.Open != nil && r.Limit != nil && r.Limit.Soft > 0 {
+		v := 100 * float64(*r.Open) / float64(r.Limit.Soft)
+		r.Percent = &v
+		if v >= *fdWarn {
+			r.Warnings = append(r.Warnings, fmt.Sprintf("%.0f%% of the open files limit of %d is used, "+
+				"raise it with LimitNOFILE= of its unit or ulimit -n", v, r.Limit.Soft))
+		}
+	}
+	if m := r.Maps; m != nil && m.Limit > 0 {
+		if v := 100 * float64(m.Regions) / float64(m.Limit); v >= *fdWarn {
+			r.Warnings = append(r.Warnings, fmt.Sprintf("%.0f%% of the vm.max_map_count of %d "+
+				"memory maps is used", v, m.Limit))
+		}
+	}
+	return r
+}
+
+// formatFDKinds formats the counts of byKind, e.g. "socket 130, database 370",
+// leaving out the kinds with none.
+func formatFDKinds(byKind map[string]int) string {
+	var counts []string
+	for _, kind := range fdKinds {
+		if n := byKind[kind]; n > 0 {
+			counts = append(counts, fmt.Sprintf("%s %d", kind, n))
+		}
+	}
+	return strings.Join(counts, ", ")
+}
+
+// formatFDKindsCSV formats the counts of byKind as "kind=count" pairs
+// separated by spaces, for the CSV process info.
+func formatFDKindsCSV(byKind map[string]int) string {
+	var counts []string
+	for _, kind := range fdKinds {
+		if n := byKind[kind]; n > 0 {
+			counts = append(counts, fmt.Sprintf("%s=%d", kind, n))
+		}
+	}
+	return strings.Join(counts, " ")
+}
+
+// writeFDReport writes the lines of r in the tab-separated format of the
+// process info.
+func writeFDReport(w io.Writer, r *fdReport) {
+	if r.Open != nil {
+		fmt.Fprintf(w, "open files:\t%v", *r.Open)
+		if len(r.ByKind) > 0 {
+			fmt.Fprintf(w, " (%s)", formatFDKinds(r.ByKind))
+		}
+		fmt.Fprintln(w)
+	}
+	if l := r.Limit; l != nil {
+		fmt.Fprintf(w, "open files limit:\t%v (hard %v)", formatLimit(l.Soft), formatLimit(l.Hard))
+		if r.Percent != nil {
+			fmt.Fprintf(w, ", %.0f%% used", *r.Percent)
+		}
+		fmt.Fprintln(w)
+	}
+	if m := r.Maps; m != nil {
+		fmt.Fprintf(w, "memory maps:\t%d (%d of files", m.Regions, m.Files)
+		if m.Limit > 0 {
+			fmt.Fprintf(w, ", limit %d", m.Limit)
+		}
+		fmt.Fprintln(w, ")")
+	}
+	for _, warning := range r.Warnings {
+		fmt.Fprintf(w, "warning:\t%s\n", highlight(warning))
+	}
+}
+
+// fds reports the open files of a process against its limit, by kind, and
+// its memory maps, listing every descriptor with -list. It fails when a
+// limit is used past -fd-warn percent.
+func fds(args []string) error {
+	fs := flag.NewFlagSet("fds", flag.ExitOnError)
+	list := fs.Bool("list", false, "list every open file descriptor")
+	target := parseTargetFlags(fs, args)
+	if target == "" {
+		return errors.New("missing PID or exec name")
+	}
+	pid, err := resolver.PID(target)
+	if err != nil {
+		return err
+	}
+	if exists, err := process.PidExists(int32(pid)); err == nil && !exists {
+		return &resolve.NoProcessError{Target: target}
+	}
+	p, err := process.NewProcess(int32(pid))
+	if err != nil {
+		return err
+	}
+	r := readFDReport(p, *list)
+	if r.Open == nil {
+		return fmt.Errorf("cannot read the open files of PID %d, run as its user or root", pid)
+	}
+
+	if *jsonOutput {
+		printJSON(r)
+	} else {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		writeFDReport(tw, r)
+		if *list && len(r.FDs) > 0 {
+			fmt.Fprintln(tw, "\nFD\tKIND\tTARGET")
+			for _, fd := range r.FDs {
+				fmt.Fprintf(tw, "%d\t%s\t%s\n", fd.FD, fd.Kind, fd.Target)
+			}
+		}
+		tw.Flush()
+	}
+	if len(r.Warnings) > 0 {
+		return fmt.Errorf("PID %d uses its limits past %v%%", pid, *fdWarn)
+	}
+	return nil
+}
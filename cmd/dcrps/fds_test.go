@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/shirou/gopsutil/process"
+)
+
+func TestClassifyFD(t *testing.T) {
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"socket:[232892]", fdSocket},
+		{"pipe:[1234]", fdPipe},
+		{"anon_inode:[eventpoll]", fdOther},
+		{"/dev/null", fdDevice},
+		{"/home/u/.dcrd/data/mainnet/blocks_ffldb/000000123.fdb", fdDatabase},
+		{"/home/u/.dcrd/data/mainnet/blocks_ffldb/metadata/000321.log", fdDatabase},
+		{"/home/u/.dcrd/data/mainnet/blocks_ffldb/metadata/MANIFEST-000002", fdDatabase},
+		{"/home/u/.dcrwallet/mainnet/wallet.db", fdDatabase},
+		{"/home/u/.dcrd/logs/mainnet/dcrd.log", fdLog},
+		{"/var/log/dcrd/current", fdLog},
+		{"/home/u/.dcrd/logs/mainnet/dcrd.log.1 (deleted)", fdLog},
+		{"/home/u/.dcrd/rpc.cert", fdFile},
+	}
+	for _, tt := range tests {
+		if got := classifyFD(tt.target); got != tt.want {
+			t.Errorf("%s: got %s want %s", tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestParseMaps(t *testing.T) {
+	maps := `55d0c4a00000-55d0c4c2f000 r-xp 00000000 08:01 1311 /usr/bin/dcrd
+c000000000-c004000000 rw-p 00000000 00:00 0
+7f3e4c000000-7f3e4e000000 r--s 00000000 08:01 4242 /home/u/.dcrwallet/mainnet/wallet.db
+7ffd2b1fe000-7ffd2b21f000 rw-p 00000000 00:00 0                          [stack]
+`
+	regions, files := parseMaps([]byte(maps))
+	if regions != 4 || files != 2 {
+		t.Errorf("got %d regions, %d of files", regions, files)
+	}
+}
+
+func TestReadFDReport(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the kinds are Linux only")
+	}
+	p, err := process.NewProcess(int32(os.Getpid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(v float64) { *fdWarn = v }(*fdWarn)
+	*fdWarn = 0
+	r := readFDReport(p, true)
+	if r.Open == nil || len(r.FDs) == 0 || r.Maps == nil || r.Maps.Regions == 0 {
+		t.Fatalf("got %+v", r)
+	}
+	n := 0
+	for _, c := range r.ByKind {
+		n += c
+	}
+	if n != len(r.FDs) {
+		t.Errorf("by kind: got %d of %d", n, len(r.FDs))
+	}
+	if r.Limit != nil && r.Limit.Soft > 0 && len(r.Warnings) == 0 {
+		t.Error("-fd-warn 0: got no warning")
+	}
+}
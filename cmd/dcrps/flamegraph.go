@@ -0,0 +1,117 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	ossignal "os/signal"
+	"syscall"
+	"time"
+
+	"github.com/dcrlabs/dcrps/flame"
+)
+
+// renderFlameGraph renders the CPU profile prof, captured over window from
+// the agent at addr, as an SVG flame graph.
+func renderFlameGraph(prof []byte, addr net.TCPAddr, window time.Duration) ([]byte, error) {
+	p, err := flame.Parse(prof)
+	if err != nil {
+		return nil, fmt.Errorf("invalid profile: %v", err)
+	}
+	typ := p.DefaultSampleType
+	unit := p.SampleTypes[typ][1]
+	root := flame.Tree(p, typ)
+	if root.Value == 0 {
+		return nil, errors.New("the CPU profile has no samples, the process was idle")
+	}
+	title := fmt.Sprintf("CPU of %v over %v, %s sampled, at %s", &addr, window,
+		flame.FormatValue(root.Value, unit), time.Now().Format("2006-01-02 15:04:05"))
+	var b bytes.Buffer
+	if err := flame.WriteSVG(&b, root, title, unit); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// flameGraph captures a CPU profile and renders it as an interactive SVG
+// flame graph, saved to a file or served over HTTP until interrupted, with
+// no need for the go tool or Graphviz.
+func flameGraph(addr net.TCPAddr, params []string) error {
+	fs := flag.NewFlagSet("flame", flag.ExitOnError)
+	window := fs.Duration("duration", 30*time.Second, "window of the CPU profile")
+	out := fs.String("out", "", "write the flame graph to file")
+	serve := fs.String("serve", "", "serve the flame graph at host:port")
+	parseCommandFlags(fs, params)
+	if *window <= 0 {
+		return fmt.Errorf("invalid -duration %v", *window)
+	}
+	if *serve != "" {
+		if _, _, err := net.SplitHostPort(*serve); err != nil {
+			return fmt.Errorf("invalid -serve address: %v", err)
+		}
+	} else if *out == "" {
+		*out = "flame-" + time.Now().Format("20060102T150405") + ".svg"
+	}
+
+	prof, err := captureCPUProfile(addr, *window)
+	if err != nil {
+		return err
+	}
+	if len(prof) == 0 {
+		return errors.New("failed to read the profile")
+	}
+	svg, err := renderFlameGraph(prof, addr, *window)
+	if err != nil {
+		return err
+	}
+	if *out != "" {
+		if err := writeFileAtomic(*out, svg); err != nil {
+			return err
+		}
+		fmt.Printf("Flame graph saved to: %s\n", *out)
+	}
+	if *serve == "" {
+		return nil
+	}
+
+	l, err := net.Listen("tcp", *serve)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Write(svg)
+	})}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.Serve(l) }()
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		host = "localhost"
+	}
+	fmt.Printf("Serving the flame graph at http://%s/, interrupt to stop\n", net.JoinHostPort(host, port))
+
+	interrupt := make(chan os.Signal, 1)
+	ossignal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer ossignal.Stop(interrupt)
+	select {
+	case err := <-serveErr:
+		return err
+	case <-interrupt:
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return srv.Shutdown(ctx)
+	}
+}
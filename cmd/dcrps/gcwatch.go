@@ -0,0 +1,319 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	ossignal "os/signal"
+	"runtime"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	dcrsignal "github.com/dcrlabs/dcrps/signal"
+)
+
+// gcCycle is a GC cycle gcwatch reports, as dcrsignal.GCEvents streams it.
+// The heap sizes are 0 when unknown.
+type gcCycle struct {
+	NumGC      uint32 `json:"numGC"`
+	End        uint64 `json:"end"` // of its pause, in Unix nanoseconds
+	PauseNs    uint64 `json:"pauseNs"`
+	HeapBefore uint64 `json:"heapBefore"` // the goal it ran to
+	HeapAfter  uint64 `json:"heapAfter"`
+	Goal       uint64 `json:"goal"` // of the next cycle
+}
+
+// gcCyclesBetween returns the cycles that ran between the memstats prev and
+// cur, and the count of those it can't tell, for the polls of gcwatch. The
+// full memstats hold the pauses of the last 256 cycles, the text of the
+// stock agent only that of the last one.
+func gcCyclesBetween(prev, cur *runtime.MemStats, full bool) (cycles []gcCycle, missed int) {
+	if cur.NumGC <= prev.NumGC {
+		return nil, 0
+	}
+	first := prev.NumGC + 1
+	if !full {
+		first = cur.NumGC
+	} else if cur.NumGC-prev.NumGC > 256 {
+		first = cur.NumGC - 255
+	}
+	missed = int(first - prev.NumGC - 1)
+	for n := first; n <= cur.NumGC; n++ {
+		c := gcCycle{NumGC: n, PauseNs: cur.PauseNs[(n+255)%256]}
+		if full {
+			c.End = cur.PauseEnd[(n+255)%256]
+		} else {
+			c.End = cur.LastGC
+		}
+		if n == prev.NumGC+1 {
+			c.HeapBefore = prev.NextGC
+		}
+		if n == cur.NumGC {
+			c.HeapAfter, c.Goal = cur.HeapAlloc, cur.NextGC
+		}
+		cycles = append(cycles, c)
+	}
+	return cycles, missed
+}
+
+func formatHeapSize(n uint64) string {
+	if n == 0 {
+		return "?"
+	}
+	return formatBytes(n)
+}
+
+// writeGCCycle writes the line of c to w.
+func writeGCCycle(w io.Writer, c gcCycle) {
+	at := "?"
+	if c.End != 0 {
+		at = time.Unix(0, int64(c.End)).Format("15:04:05.000")
+	}
+	fmt.Fprintf(w, "%s  gc %-6d pause %-10v heap %s -> %s, goal %s\n", at, c.NumGC,
+		time.Duration(c.PauseNs), formatHeapSize(c.HeapBefore), formatHeapSize(c.HeapAfter),
+		formatHeapSize(c.Goal))
+}
+
+// gcPauseBuckets are the upper bounds of the buckets of the pause histogram.
+var gcPauseBuckets = []time.Duration{
+	100 * time.Microsecond, 500 * time.Microsecond, time.Millisecond,
+	5 * time.Millisecond, 10 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond,
+}
+
+// percentile returns the p-th percentile of the sorted durations ds.
+func percentile(ds []time.Duration, p float64) time.Duration {
+	i := int(float64(len(ds))*p/100+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(ds) {
+		i = len(ds) - 1
+	}
+	return ds[i]
+}
+
+// writeGCSummary writes the count, rate and percentiles of the pauses of the
+// cycles watched over elapsed to w, with their histogram.
+func writeGCSummary(w io.Writer, pauses []time.Duration, missed int, elapsed time.Duration) {
+	fmt.Fprintf(w, "\n%d GC cycles in %v", len(pauses)+missed, elapsed.Round(time.Second))
+	if elapsed >= time.Second {
+		fmt.Fprintf(w, " (%.1f/min)", float64(len(pauses)+missed)/elapsed.Minutes())
+	}
+	if missed > 0 {
+		fmt.Fprintf(w, ", %d of them between polls without their pause", missed)
+	}
+	fmt.Fprintln(w)
+	if len(pauses) == 0 {
+		return
+	}
+	sorted := append([]time.Duration(nil), pauses...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	fmt.Fprintf(w, "pauses: total %v, mean %v, p50 %v, p99 %v, max %v\n", total,
+		total/time.Duration(len(sorted)), percentile(sorted, 50), percentile(sorted, 99),
+		sorted[len(sorted)-1])
+
+	counts := make([]int, len(gcPauseBuckets)+1)
+	for _, d := range sorted {
+		i := sort.Search(len(gcPauseBuckets), func(i int) bool { return d < gcPauseBuckets[i] })
+		counts[i]++
+	}
+	largest := 0
+	for _, n := range counts {
+		if n > largest {
+			largest = n
+		}
+	}
+	const barWidth = 40
+	for i, n := range counts {
+		label := "< " + gcPauseBuckets[0].String()
+		switch {
+		case i == len(gcPauseBuckets):
+			label = ">= " + gcPauseBuckets[i-1].String()
+		case i > 0:
+			label = gcPauseBuckets[i-1].String() + "-" + gcPauseBuckets[i].String()
+		}
+		bar := (n*barWidth + largest - 1) / largest
+		fmt.Fprintf(w, "  %-12s %6d %s\n", label, n, strings.Repeat("#", bar))
+	}
+}
+
+// streamGCCycles sends the cycles the agent at addr streams to cycles until
+// stop is closed, or the stream ends with an error.
+func streamGCCycles(addr net.TCPAddr, cycles chan<- gcCycle, stop <-chan struct{}) error {
+	conn, err := dialAgent(addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte{dcrsignal.GCEvents}); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		s := bufio.NewScanner(conn)
+		for s.Scan() {
+			var c gcCycle
+			if err := json.Unmarshal(s.Bytes(), &c); err != nil {
+				done <- fmt.Errorf("invalid GC event: %v", err)
+				return
+			}
+			select {
+			case cycles <- c:
+			case <-stop:
+				return
+			}
+		}
+		err := s.Err()
+		if err == nil {
+			err = errors.New("the agent closed the GC stream")
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-stop:
+		return nil
+	}
+}
+
+// pollGCCycles sends the cycles found by reading the memstats of the agent at
+// addr every interval to cycles until stop is closed, and the count of those
+// it can't tell to missed.
+func pollGCCycles(addr net.TCPAddr, interval time.Duration, cycles chan<- gcCycle, missed chan<- int,
+	stop <-chan struct{}) error {
+	prev, _, err := readMemStats(addr)
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+		cur, full, err := readMemStats(addr)
+		if err != nil {
+			return err
+		}
+		cs, n := gcCyclesBetween(prev, cur, full)
+		if n > 0 {
+			select {
+			case missed <- n:
+			case <-stop:
+				return nil
+			}
+		}
+		for _, c := range cs {
+			select {
+			case cycles <- c:
+			case <-stop:
+				return nil
+			}
+		}
+		prev = cur
+	}
+}
+
+// gcWatch prints a line per GC cycle of the process with its pause and heap
+// sizes until interrupted, then the histogram of the pauses. The agents with
+// the GCEventStream capability stream the cycles, the others are polled.
+func gcWatch(addr net.TCPAddr, params []string) error {
+	fs := flag.NewFlagSet("gcwatch", flag.ExitOnError)
+	interval := fs.Duration("interval", 250*time.Millisecond,
+		"time between the reads of the memstats of the agents that don't stream the cycles")
+	duration := fs.Duration("duration", 0, "stop after this long, 0 for until interrupted")
+	poll := fs.Bool("poll", false, "poll the memstats even when the agent streams the cycles")
+	parseCommandFlags(fs, params)
+	if *interval <= 0 || *duration < 0 {
+		return errors.New("-interval must be positive and -duration not negative")
+	}
+
+	stream := false
+	if !*poll {
+		ok, err := agentCapable(addr, dcrsignal.GCEventStream)
+		if err != nil {
+			return err
+		}
+		stream = ok
+	}
+	if stream {
+		fmt.Printf("Streaming the GC cycles of %v, interrupt to stop\n", &addr)
+	} else {
+		fmt.Printf("Polling the GC cycles of %v every %v, interrupt to stop\n", &addr, *interval)
+	}
+
+	cycles := make(chan gcCycle, 256)
+	missedc := make(chan int, 16)
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		if stream {
+			done <- streamGCCycles(addr, cycles, stop)
+		} else {
+			done <- pollGCCycles(addr, *interval, cycles, missedc, stop)
+		}
+	}()
+	interrupt := make(chan os.Signal, 1)
+	ossignal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer ossignal.Stop(interrupt)
+	var timeout <-chan time.Time
+	if *duration > 0 {
+		timeout = time.After(*duration)
+	}
+
+	start := time.Now()
+	var (
+		pauses []time.Duration
+		missed int
+		err    error
+	)
+loop:
+	for {
+		select {
+		case c := <-cycles:
+			writeGCCycle(os.Stdout, c)
+			pauses = append(pauses, time.Duration(c.PauseNs))
+		case n := <-missedc:
+			fmt.Printf("(%d cycles ran between polls, see -interval)\n", n)
+			missed += n
+		case err = <-done:
+			break loop
+		case <-interrupt:
+			break loop
+		case <-timeout:
+			break loop
+		}
+	}
+	close(stop)
+	// The cycles read before stopping are still reported.
+	for drained := false; !drained; {
+		select {
+		case c := <-cycles:
+			writeGCCycle(os.Stdout, c)
+			pauses = append(pauses, time.Duration(c.PauseNs))
+		default:
+			drained = true
+		}
+	}
+	writeGCSummary(os.Stdout, pauses, missed, time.Since(start))
+	return err
+}
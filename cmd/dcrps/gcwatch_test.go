@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGCCyclesBetween(t *testing.T) {
+	prev := &runtime.MemStats{NumGC: 10, NextGC: 4 << 20}
+	cur := &runtime.MemStats{NumGC: 12, NextGC: 8 << 20, HeapAlloc: 3 << 20, LastGC: 900}
+	cur.PauseNs[(11+255)%256], cur.PauseEnd[(11+255)%256] = 100, 800
+	cur.PauseNs[(12+255)%256], cur.PauseEnd[(12+255)%256] = 200, 900
+
+	cycles, missed := gcCyclesBetween(prev, cur, true)
+	want := []gcCycle{
+		{NumGC: 11, End: 800, PauseNs: 100, HeapBefore: 4 << 20},
+		{NumGC: 12, End: 900, PauseNs: 200, HeapAfter: 3 << 20, Goal: 8 << 20},
+	}
+	if !reflect.DeepEqual(cycles, want) || missed != 0 {
+		t.Errorf("full: got=%+v, %d want=%+v, 0", cycles, missed, want)
+	}
+
+	// The stock agent only tells the last pause.
+	cycles, missed = gcCyclesBetween(prev, cur, false)
+	want = []gcCycle{{NumGC: 12, End: 900, PauseNs: 200, HeapAfter: 3 << 20, Goal: 8 << 20}}
+	if !reflect.DeepEqual(cycles, want) || missed != 1 {
+		t.Errorf("stock: got=%+v, %d want=%+v, 1", cycles, missed, want)
+	}
+
+	if cycles, _ := gcCyclesBetween(cur, cur, true); cycles != nil {
+		t.Errorf("no cycle: got=%+v", cycles)
+	}
+
+	// The ring of the memstats only holds the last 256 pauses.
+	cur.NumGC = 1000
+	cycles, missed = gcCyclesBetween(prev, cur, true)
+	if len(cycles) != 256 || cycles[0].NumGC != 745 || missed != 734 {
+		t.Errorf("beyond the ring: got %d cycles from %d, %d missed", len(cycles), cycles[0].NumGC, missed)
+	}
+}
+
+func TestWriteGCSummary(t *testing.T) {
+	pauses := []time.Duration{
+		50 * time.Microsecond, 60 * time.Microsecond, 70 * time.Microsecond,
+		2 * time.Millisecond, 200 * time.Millisecond,
+	}
+	var b bytes.Buffer
+	writeGCSummary(&b, pauses, 1, time.Minute)
+	out := b.String()
+	for _, want := range []string{
+		"6 GC cycles in 1m0s (6.0/min), 1 of them between polls without their pause\n",
+		"p50 70µs, p99 200ms, max 200ms\n",
+		"  < 100µs           3 " + strings.Repeat("#", 40) + "\n",
+		"  1ms-5ms           1 " + strings.Repeat("#", 14) + "\n",
+		"  >= 100ms          1 #",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("summary: %q missing from\n%s", want, out)
+		}
+	}
+}
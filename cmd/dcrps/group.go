@@ -0,0 +1,58 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sort"
+
+	"github.com/google/gops/goprocess"
+)
+
+// groupKinds are the valid -group-by values.
+var groupKinds = []string{"network", "exec"}
+
+// groupProcesses splits ps by the given kind of group. It returns the group
+// names in display order along with the members of each group, which keep
+// their order from ps.
+func groupProcesses(ps []goprocess.P, kind string) ([]string, map[string][]goprocess.P) {
+	groups := make(map[string][]goprocess.P)
+	for _, p := range ps {
+		var key string
+		switch kind {
+		case "network":
+			key = processNetwork(p.PID)
+		case "exec":
+			key = resolver.Key(p.Exec)
+		}
+		groups[key] = append(groups[key], p)
+	}
+
+	var keys []string
+	if kind == "network" {
+		// Known networks come first in their usual order.
+		for _, n := range networks {
+			if _, ok := groups[n]; ok {
+				keys = append(keys, n)
+			}
+		}
+	}
+	var rest []string
+	for k := range groups {
+		if !containsString(keys, k) {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+	return append(keys, rest...), groups
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,464 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dcrlabs/dcrps/internal"
+	"github.com/dcrlabs/dcrps/pkg/dcrps"
+	"github.com/dcrlabs/dcrps/resolve"
+	"github.com/google/gops/goprocess"
+	"github.com/shirou/gopsutil/process"
+)
+
+// rpcApp is how a Decred app configures its JSON-RPC server, by the keys of
+// its config file, which are also the long names of its command line flags.
+type rpcApp struct {
+	user, pass string // the credentials
+	noTLS      string // serves plain HTTP when true
+	class      string // of its ports in decredPorts
+}
+
+// rpcApps are the apps health queries the JSON-RPC server of.
+var rpcApps = map[string]rpcApp{
+	"dcrd":      {user: "rpcuser", pass: "rpcpass", noTLS: "notls", class: "dcrd-rpc"},
+	"dcrwallet": {user: "username", pass: "password", noTLS: "noservertls", class: "wallet-rpc"},
+}
+
+// rpcSettings returns the settings of the RPC server of app, started with
+// the command line args, from the options of its config file overridden by
+// its command line.
+func rpcSettings(app rpcApp, args []string, options map[string]string) map[string]string {
+	settings := make(map[string]string)
+	for k, v := range options {
+		settings[k] = v
+	}
+	valued := map[string]bool{app.user: true, app.pass: true, "rpclisten": true, "rpccert": true}
+	boolean := map[string]bool{app.noTLS: true, "testnet": true, "simnet": true, "regnet": true}
+	for i := 0; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "-") {
+			continue
+		}
+		name, value, inline := args[i], "", false
+		if j := strings.Index(name, "="); j >= 0 {
+			name, value, inline = name[:j], name[j+1:], true
+		}
+		switch name {
+		case "-u":
+			name = app.user
+		case "-P":
+			name = app.pass
+		default:
+			if !strings.HasPrefix(name, "--") {
+				continue
+			}
+			name = name[2:]
+		}
+		switch {
+		case valued[name] && !inline && i+1 < len(args):
+			i++
+			value = args[i]
+		case boolean[name] && !inline:
+			value = "1"
+		case !valued[name] && !boolean[name]:
+			continue
+		}
+		settings[name] = value
+	}
+	return settings
+}
+
+// settingTrue reports whether the boolean setting v, such as "1", is true.
+func settingTrue(v string) bool {
+	b, err := strconv.ParseBool(v)
+	return err == nil && b
+}
+
+// rpcDefaultPort returns the default port of class on network.
+func rpcDefaultPort(class, network string) uint32 {
+	for port, dp := range decredPorts {
+		if dp.class == class && dp.network == network {
+			return port
+		}
+	}
+	return 0
+}
+
+// dialableHost returns the host to dial a listener on ip at, the loopback
+// one for the unspecified addresses.
+func dialableHost(ip string) string {
+	switch ip {
+	case "", "0.0.0.0":
+		return "127.0.0.1"
+	case "::":
+		return "::1"
+	}
+	return ip
+}
+
+// rpcServerAddr returns the address of the RPC server of a process with the
+// listening sockets listens: the one on the port of its rpclisten setting
+// listen when it has one, else the one on a port of class, else the default
+// port on the loopback.
+func rpcServerAddr(listens []classifiedConn, listen, class string, defaultPort uint32) (string, error) {
+	var port uint32
+	if listen != "" {
+		if _, p, err := net.SplitHostPort(listen); err == nil {
+			n, err := strconv.ParseUint(p, 10, 16)
+			if err != nil {
+				return "", fmt.Errorf("invalid rpclisten %q", listen)
+			}
+			port = uint32(n)
+		}
+	}
+	for _, c := range listens {
+		if port != 0 && c.Laddr.Port == port || port == 0 && c.class == class {
+			return net.JoinHostPort(dialableHost(c.Laddr.IP), strconv.Itoa(int(c.Laddr.Port))), nil
+		}
+	}
+	if port != 0 {
+		host, _, _ := net.SplitHostPort(listen)
+		return net.JoinHostPort(dialableHost(host), strconv.Itoa(int(port))), nil
+	}
+	if defaultPort == 0 {
+		return "", fmt.Errorf("no %s listener among the sockets of the process", class)
+	}
+	return net.JoinHostPort("127.0.0.1", strconv.Itoa(int(defaultPort))), nil
+}
+
+// expandHome expands a leading ~ of path to the home directory, as the
+// Decred apps do with the paths of their config.
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		return filepath.Join(internal.HomeDir(), path[1:])
+	}
+	return path
+}
+
+// rpcClient calls the methods of the JSON-RPC server of dcrd or dcrwallet.
+type rpcClient struct {
+	url        string
+	user, pass string
+	client     *http.Client
+}
+
+// newRPCClient returns the client of the server at addr, over TLS with the
+// certificate in certFile unless noTLS.
+func newRPCClient(addr, user, pass, certFile string, noTLS bool, timeout time.Duration) (*rpcClient, error) {
+	c := &rpcClient{url: "http://" + addr, user: user, pass: pass, client: &http.Client{Timeout: timeout}}
+	if noTLS {
+		return c, nil
+	}
+	pem, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the RPC certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate in %s", certFile)
+	}
+	c.url = "https://" + addr
+	c.client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	return c, nil
+}
+
+// call calls method with params and decodes its result into result.
+func (c *rpcClient) call(method string, result interface{}, params ...interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	body, err := json.Marshal(struct {
+		JSONRPC string        `json:"jsonrpc"`
+		ID      int           `json:"id"`
+		Method  string        `json:"method"`
+		Params  []interface{} `json:"params"`
+	}{"1.0", 1, method, params})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.user, c.pass)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		return errors.New("the RPC server refused the credentials")
+	}
+	var r struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("%s: %s", method, resp.Status)
+		}
+		return fmt.Errorf("%s: invalid response: %v", method, err)
+	}
+	if r.Error != nil {
+		return fmt.Errorf("%s: %s (code %d)", method, r.Error.Message, r.Error.Code)
+	}
+	return json.Unmarshal(r.Result, result)
+}
+
+// healthReport is what health found out about a process.
+type healthReport struct {
+	PID       int          `json:"pid"`
+	App       string       `json:"app"`
+	Runtime   *dcrps.Stats `json:"runtime,omitempty"`
+	HeapAlloc uint64       `json:"heapAlloc,omitempty"`
+	// AgentError is why the runtime stats are missing.
+	AgentError string `json:"agentError,omitempty"`
+
+	RPCServer string `json:"rpcServer,omitempty"`
+	RPCError  string `json:"rpcError,omitempty"`
+	Height    *int64 `json:"height,omitempty"`
+	// SyncHeight is the height of the best chain of the peers of dcrd.
+	SyncHeight    *int64 `json:"syncHeight,omitempty"`
+	Peers         *int   `json:"peers,omitempty"`
+	DcrdConnected *bool  `json:"dcrdConnected,omitempty"`
+	Unlocked      *bool  `json:"unlocked,omitempty"`
+}
+
+// queryDcrd reads the sync height and the peer count of dcrd into r.
+func queryDcrd(c *rpcClient, r *healthReport) error {
+	var info struct {
+		Blocks     int64 `json:"blocks"`
+		SyncHeight int64 `json:"syncheight"`
+	}
+	if err := c.call("getblockchaininfo", &info); err != nil {
+		return err
+	}
+	var peers int
+	if err := c.call("getconnectioncount", &peers); err != nil {
+		return err
+	}
+	r.Height, r.SyncHeight, r.Peers = &info.Blocks, &info.SyncHeight, &peers
+	return nil
+}
+
+// queryWallet reads the height, the peer count, when it has peers of its
+// own, and the unlock state of dcrwallet into r.
+func queryWallet(c *rpcClient, r *healthReport) error {
+	var height int64
+	if err := c.call("getblockcount", &height); err != nil {
+		return err
+	}
+	var info struct {
+		DaemonConnected bool `json:"daemonconnected"`
+		Unlocked        bool `json:"unlocked"`
+	}
+	if err := c.call("walletinfo", &info); err != nil {
+		return err
+	}
+	r.Height, r.DcrdConnected, r.Unlocked = &height, &info.DaemonConnected, &info.Unlocked
+	var peers []json.RawMessage
+	if c.call("getpeerinfo", &peers) == nil {
+		n := len(peers)
+		r.Peers = &n
+	}
+	return nil
+}
+
+// queryRPC finds the RPC server of the process with the given PID running
+// app and its credentials and queries it into r.
+func queryRPC(pid int, app rpcApp, flags healthFlags, r *healthReport) error {
+	p, err := process.NewProcess(int32(pid))
+	if err != nil {
+		return err
+	}
+	args, err := p.CmdlineSlice()
+	if err != nil {
+		return fmt.Errorf("cannot read the command line: %v", err)
+	}
+	paths := resolve.AppPathsFromArgs(args)
+	options, err := resolve.ReadAppConfig(paths.ConfigFile)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot read the config: %v", err)
+	}
+	settings := rpcSettings(app, args[1:], options)
+	if settings[app.user] == "" || settings[app.pass] == "" {
+		return fmt.Errorf("no %s and %s in %s or on the command line", app.user, app.pass, paths.ConfigFile)
+	}
+
+	addr := flags.server
+	if addr == "" {
+		network := networks[0]
+		for _, n := range networks[1:] {
+			if settingTrue(settings[n]) {
+				network = n
+			}
+		}
+		var listens []classifiedConn
+		if conns, err := p.Connections(); err == nil {
+			for _, c := range classifyConnections(conns) {
+				if c.direction == dirListen {
+					listens = append(listens, c)
+				}
+			}
+		}
+		addr, err = rpcServerAddr(listens, settings["rpclisten"], app.class, rpcDefaultPort(app.class, network))
+		if err != nil {
+			return err
+		}
+	}
+	r.RPCServer = addr
+
+	cert := flags.cert
+	if cert == "" {
+		cert = expandHome(settings["rpccert"])
+	}
+	if cert == "" {
+		cert = filepath.Join(paths.DataDir, "rpc.cert")
+	}
+	timeout := agentTimeout()
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	c, err := newRPCClient(addr, settings[app.user], settings[app.pass], cert,
+		flags.noTLS || settingTrue(settings[app.noTLS]), timeout)
+	if err != nil {
+		return err
+	}
+	if r.App == "dcrd" {
+		return queryDcrd(c, r)
+	}
+	return queryWallet(c, r)
+}
+
+// healthFlags are the flags of health.
+type healthFlags struct {
+	server, cert string
+	noTLS        bool
+}
+
+// health reports on the runtime of a dcrd or dcrwallet process and on its
+// JSON-RPC server, the sync height and the peer count of the node and the
+// unlock state of the wallet.
+func health(args []string) error {
+	fs := flag.NewFlagSet("health", flag.ExitOnError)
+	var flags healthFlags
+	fs.StringVar(&flags.server, "rpcserver", "", "query the RPC server at host:port instead of the one found")
+	fs.StringVar(&flags.cert, "rpccert", "", "the certificate of the RPC server, instead of the one of the config")
+	fs.BoolVar(&flags.noTLS, "notls", false, "query the RPC server over plain HTTP")
+	target := parseTargetFlags(fs, args)
+	if target == "" {
+		return errors.New("missing PID or exec name")
+	}
+	pid, err := resolver.PID(target)
+	if err != nil {
+		return err
+	}
+	p, ok, err := goprocess.Find(pid)
+	if err != nil {
+		return fmt.Errorf("cannot read process %d: %v", pid, err)
+	}
+	if !ok {
+		return fmt.Errorf("process %d is not a Go process", pid)
+	}
+	r := healthReport{PID: pid, App: resolve.NormalizeExec(p.Exec)}
+	app, ok := rpcApps[r.App]
+	if !ok {
+		return fmt.Errorf("health knows the RPC servers of dcrd and dcrwallet, not of %s", p.Exec)
+	}
+
+	cmdTimeout = 10 * time.Second
+	if addr, err := resolver.Resolve(target); err != nil {
+		r.AgentError = err.Error()
+	} else if stats, err := agentClient().Stats(*addr); err != nil {
+		r.AgentError = agentError(err).Error()
+	} else {
+		r.Runtime = stats
+		if ms, _, err := readMemStats(*addr); err == nil {
+			r.HeapAlloc = ms.HeapAlloc
+		}
+	}
+	if err := queryRPC(pid, app, flags, &r); err != nil {
+		r.RPCError = err.Error()
+	}
+
+	if *jsonOutput {
+		printJSON(r)
+	} else if err := writeHealth(os.Stdout, r); err != nil {
+		return err
+	}
+	if r.RPCError != "" {
+		return fmt.Errorf("the RPC server of %s (%d) is unhealthy", r.App, pid)
+	}
+	return nil
+}
+
+// writeHealth writes r as health prints it.
+func writeHealth(w io.Writer, r healthReport) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "process:\t%s (%d)\n", r.App, r.PID)
+	if r.Runtime != nil {
+		fmt.Fprintf(tw, "runtime:\t%d goroutines, %d OS threads", r.Runtime.Goroutines, r.Runtime.OSThreads)
+		if r.HeapAlloc > 0 {
+			fmt.Fprintf(tw, ", heap %s", formatBytes(r.HeapAlloc))
+		}
+		fmt.Fprintln(tw)
+	} else {
+		fmt.Fprintf(tw, "runtime:\tunknown, %s\n", r.AgentError)
+	}
+	if r.RPCServer != "" {
+		fmt.Fprintf(tw, "rpc server:\t%s\n", r.RPCServer)
+	}
+	if r.RPCError != "" {
+		fmt.Fprintf(tw, "rpc:\t%s\n", r.RPCError)
+		return tw.Flush()
+	}
+	switch {
+	case r.SyncHeight == nil:
+		fmt.Fprintf(tw, "height:\t%d\n", *r.Height)
+	case *r.Height >= *r.SyncHeight:
+		fmt.Fprintf(tw, "height:\t%d of %d, synced\n", *r.Height, *r.SyncHeight)
+	default:
+		fmt.Fprintf(tw, "height:\t%d of %d, syncing\n", *r.Height, *r.SyncHeight)
+	}
+	if r.Peers != nil {
+		fmt.Fprintf(tw, "peers:\t%d\n", *r.Peers)
+	}
+	if r.DcrdConnected != nil {
+		state := "connected"
+		if !*r.DcrdConnected {
+			state = "disconnected"
+		}
+		fmt.Fprintf(tw, "dcrd:\t%s\n", state)
+	}
+	if r.Unlocked != nil {
+		state := "unlocked"
+		if !*r.Unlocked {
+			state = "locked"
+		}
+		fmt.Fprintf(tw, "wallet:\t%s\n", state)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gpsnet "github.com/shirou/gopsutil/net"
+)
+
+func TestRPCSettings(t *testing.T) {
+	options := map[string]string{"rpcuser": "conf", "rpcpass": "secret", "rpclisten": ":9109"}
+	args := []string{"-u", "alice", "--rpclisten=127.0.0.1:19109", "--testnet", "--notls=false", "--debuglevel", "info"}
+	got := rpcSettings(rpcApps["dcrd"], args, options)
+	want := map[string]string{
+		"rpcuser":   "alice",
+		"rpcpass":   "secret",
+		"rpclisten": "127.0.0.1:19109",
+		"testnet":   "1",
+		"notls":     "false",
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s: got %q want %q", k, got[k], v)
+		}
+	}
+	if options["rpcuser"] != "conf" {
+		t.Error("the options of the config were modified")
+	}
+}
+
+func TestRPCServerAddr(t *testing.T) {
+	listens := classifyConnections([]gpsnet.ConnectionStat{
+		{Status: "LISTEN", Laddr: gpsnet.Addr{IP: "0.0.0.0", Port: 9108}},
+		{Status: "LISTEN", Laddr: gpsnet.Addr{IP: "::", Port: 9109}},
+		{Status: "LISTEN", Laddr: gpsnet.Addr{IP: "10.0.0.5", Port: 7000}},
+	})
+	tests := []struct {
+		listen string
+		want   string
+	}{
+		{"", "[::1]:9109"},
+		{":7000", "10.0.0.5:7000"},
+		{"192.168.1.2:8000", "192.168.1.2:8000"},
+		{"localhost", "[::1]:9109"},
+	}
+	for _, test := range tests {
+		got, err := rpcServerAddr(listens, test.listen, "dcrd-rpc", 9109)
+		if err != nil || got != test.want {
+			t.Errorf("rpclisten %q: got %q, %v; want %q", test.listen, got, err, test.want)
+		}
+	}
+	if got, _ := rpcServerAddr(nil, "", "wallet-rpc", 19110); got != "127.0.0.1:19110" {
+		t.Errorf("no listener: got %q, want the default port", got)
+	}
+	if _, err := rpcServerAddr(nil, ":port", "dcrd-rpc", 9109); err == nil {
+		t.Error("invalid rpclisten: got no error")
+	}
+}
+
+// rpcServer serves the results of the JSON-RPC methods of results.
+func rpcServer(t *testing.T, results map[string]interface{}) *rpcClient {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "u" || pass != "p" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var req struct{ Method string }
+		json.NewDecoder(r.Body).Decode(&req)
+		result, ok := results[req.Method]
+		if !ok {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": map[string]interface{}{"code": -32601, "message": "Method not found"},
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": result})
+	}))
+	c, err := newRPCClient(strings.TrimPrefix(srv.URL, "http://"), "u", "p", "", true, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestQueryRPC(t *testing.T) {
+	c := rpcServer(t, map[string]interface{}{
+		"getblockchaininfo":  map[string]interface{}{"blocks": 800, "syncheight": 812},
+		"getconnectioncount": 8,
+	})
+	var r healthReport
+	if err := queryDcrd(c, &r); err != nil {
+		t.Fatal(err)
+	}
+	if *r.Height != 800 || *r.SyncHeight != 812 || *r.Peers != 8 {
+		t.Errorf("dcrd: got height %d of %d with %d peers", *r.Height, *r.SyncHeight, *r.Peers)
+	}
+
+	c = rpcServer(t, map[string]interface{}{
+		"getblockcount": 812,
+		"walletinfo":    map[string]interface{}{"daemonconnected": true, "unlocked": false},
+	})
+	r = healthReport{}
+	if err := queryWallet(c, &r); err != nil {
+		t.Fatal(err)
+	}
+	if *r.Height != 812 || !*r.DcrdConnected || *r.Unlocked || r.Peers != nil {
+		t.Errorf("dcrwallet: got %+v", r)
+	}
+
+	c.user = "mallory"
+	if err := queryWallet(c, &r); err == nil || !strings.Contains(err.Error(), "credentials") {
+		t.Errorf("wrong credentials: got %v", err)
+	}
+}
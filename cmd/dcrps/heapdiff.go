@@ -0,0 +1,97 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/google/gops/signal"
+)
+
+// heapSampleIndexes are the samples of the heap profiles, the first the
+// default of pprof-heap-diff.
+var heapSampleIndexes = []string{"inuse_space", "inuse_objects", "alloc_space", "alloc_objects"}
+
+// diffHeapProfiles writes the n allocation sites of the heap profile at path
+// that grew the most since the one at base to w, comparing their sample
+// values, through "go tool pprof -base".
+func diffHeapProfiles(w io.Writer, base, path string, n int, sample string) error {
+	if _, err := exec.LookPath("go"); err != nil {
+		return errors.New("the go tool is needed to diff the profiles")
+	}
+	args := []string{"tool", "pprof", "-top", "-nodecount=" + strconv.Itoa(n),
+		"-sample_index=" + sample, "-base", base, path}
+	cmd := exec.Command("go", args...)
+	cmd.Env = os.Environ()
+	cmd.Stdout = w
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("go tool pprof: %v", err)
+	}
+	return nil
+}
+
+// pprofHeapDiff reads a fresh heap profile and prints its top growing
+// allocation sites against the baseline profile of -baseline.
+func pprofHeapDiff(addr net.TCPAddr, params []string) error {
+	fs := flag.NewFlagSet("pprof-heap-diff", flag.ExitOnError)
+	baseline := fs.String("baseline", "", "heap profile to compare with")
+	save := fs.String("save", "", "write the fresh heap profile to file, e.g. as the next baseline")
+	n := fs.Int("n", 20, "number of allocation sites to print")
+	sample := fs.String("sample", heapSampleIndexes[0],
+		"sample to compare: "+strings.Join(heapSampleIndexes, ", "))
+	parseCommandFlags(fs, params)
+	if *baseline == "" {
+		return errors.New("missing -baseline profile")
+	}
+	if *n <= 0 {
+		return fmt.Errorf("invalid -n %d", *n)
+	}
+	if !containsString(heapSampleIndexes, *sample) {
+		return fmt.Errorf("invalid -sample %q, want one of %s", *sample, strings.Join(heapSampleIndexes, ", "))
+	}
+	if _, err := os.Stat(*baseline); err != nil {
+		return fmt.Errorf("invalid -baseline: %v", err)
+	}
+
+	out, err := cmd(addr, signal.HeapProfile)
+	if err != nil {
+		return err
+	}
+	if len(out) == 0 {
+		return errors.New("failed to read the profile")
+	}
+	path := *save
+	if path != "" {
+		if err := writeFileAtomic(path, out); err != nil {
+			return err
+		}
+		fmt.Printf("Profile dump saved to: %s\n", path)
+	} else {
+		f, err := ioutil.TempFile("", "profile")
+		if err != nil {
+			return err
+		}
+		path = f.Name()
+		defer os.Remove(path)
+		_, err = f.Write(out)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return diffHeapProfiles(os.Stdout, *baseline, path, *n, *sample)
+}
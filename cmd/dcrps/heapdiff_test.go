@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"strings"
+	"testing"
+)
+
+var heapDiffSink [][]byte
+
+func writeTestHeapProfile(t *testing.T, path string) {
+	runtime.GC()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := runtimepprof.WriteHeapProfile(f); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiffHeapProfiles(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("no go tool")
+	}
+	dir, err := ioutil.TempDir("", "dcrps-heapdiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	base := filepath.Join(dir, "base.pprof")
+	writeTestHeapProfile(t, base)
+	for i := 0; i < 64; i++ {
+		heapDiffSink = append(heapDiffSink, make([]byte, 1<<20))
+	}
+	path := filepath.Join(dir, "heap.pprof")
+	writeTestHeapProfile(t, path)
+
+	var out bytes.Buffer
+	if err := diffHeapProfiles(&out, base, path, 5, "alloc_space"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Type: alloc_space", "TestDiffHeapProfiles"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("diffHeapProfiles: missing %q in:\n%s", want, out.String())
+		}
+	}
+}
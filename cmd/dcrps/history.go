@@ -0,0 +1,177 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	ossignal "os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/dcrlabs/dcrps/internal"
+	"github.com/dcrlabs/dcrps/pkg/dcrps"
+	"github.com/google/gops/goprocess"
+	"github.com/google/gops/signal"
+	"github.com/shirou/gopsutil/process"
+)
+
+const historyEnvKey = "DCRPS_HISTORY"
+
+// historyPath returns the path of the history database, $DCRPS_HISTORY or
+// .dcrps-history.jsonl in the home directory.
+func historyPath() string {
+	if path := os.Getenv(historyEnvKey); path != "" {
+		return path
+	}
+	home := internal.HomeDir()
+	if home == "" {
+		return ""
+	}
+	return filepath.Join(home, ".dcrps-history.jsonl")
+}
+
+// historyRecord is a sample of a process in the history database, which
+// holds one per line as JSON. The values that couldn't be read are null, as
+// the runtime stats of the processes without the agent.
+type historyRecord struct {
+	Time         time.Time `json:"time"`
+	PID          int       `json:"pid"`
+	Exec         string    `json:"exec"`
+	RSS          *uint64   `json:"rss"`
+	HeapAlloc    *uint64   `json:"heapAlloc"`
+	HeapObjects  *uint64   `json:"heapObjects"`
+	Sys          *uint64   `json:"sys"`
+	Goroutines   *int64    `json:"goroutines"`
+	NumGC        *uint32   `json:"numGC"`
+	PauseTotalNs *uint64   `json:"pauseTotalNs"`
+}
+
+// sampleHistory samples the resident memory of p and, through its agent, its
+// runtime stats.
+func sampleHistory(p goprocess.P, now time.Time) historyRecord {
+	r := historyRecord{Time: now, PID: p.PID, Exec: p.Exec}
+	if pr, err := process.NewProcess(int32(p.PID)); err == nil {
+		if v, err := pr.MemoryInfo(); err == nil {
+			r.RSS = &v.RSS
+		}
+	}
+	if !p.Agent {
+		return r
+	}
+	addr, err := resolver.Resolve(strconv.Itoa(p.PID))
+	if err != nil {
+		return r
+	}
+	cmdTimeout = 10 * time.Second
+	if out, err := cmd(*addr, signal.Stats); err == nil {
+		if v, ok := intValue(dcrps.ParseKeyValues(out), "goroutines"); ok {
+			r.Goroutines = &v
+		}
+	}
+	if ms, _, err := readMemStats(*addr); err == nil {
+		r.HeapAlloc, r.HeapObjects, r.Sys = &ms.HeapAlloc, &ms.HeapObjects, &ms.Sys
+		r.NumGC, r.PauseTotalNs = &ms.NumGC, &ms.PauseTotalNs
+	}
+	return r
+}
+
+// appendHistory appends records to the history database at path, creating
+// it when missing.
+func appendHistory(path string, records []historyRecord) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for i := range records {
+		if err := enc.Encode(&records[i]); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	err = w.Flush()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// readHistory reads the records of target, an exec name or a PID, sampled
+// since since from the history database r, in the order they were recorded.
+// The lines that aren't valid records, such as one cut short by a crash of
+// record, are skipped.
+func readHistory(r io.Reader, target string, since time.Time) ([]historyRecord, error) {
+	var records []historyRecord
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	for s.Scan() {
+		var rec historyRecord
+		if err := json.Unmarshal(s.Bytes(), &rec); err != nil {
+			continue
+		}
+		if rec.Time.Before(since) {
+			continue
+		}
+		if rec.Exec == target || strconv.Itoa(rec.PID) == target {
+			records = append(records, rec)
+		}
+	}
+	return records, s.Err()
+}
+
+// record samples the processes every interval into the history database
+// until interrupted, for report to print their trends over days.
+func record(args []string) error {
+	fs := flag.NewFlagSet("record", flag.ExitOnError)
+	interval := fs.Duration("interval", time.Minute, "sampling interval")
+	db := fs.String("db", historyPath(), "history database")
+	targets := parseInterspersedFlags(fs, args)
+	if *interval <= 0 {
+		return fmt.Errorf("invalid -interval %v", *interval)
+	}
+	if *db == "" {
+		return errors.New("no home directory for the history database, use -db or $" + historyEnvKey)
+	}
+	only := make(map[string]bool)
+	for _, t := range targets {
+		only[t] = true
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	ossignal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer ossignal.Stop(interrupt)
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	fmt.Fprintf(os.Stderr, "recording into %s every %v\n", *db, *interval)
+	for {
+		now := time.Now()
+		var records []historyRecord
+		for _, p := range dcrProcesses() {
+			if len(only) > 0 && !only[p.Exec] && !only[strconv.Itoa(p.PID)] {
+				continue
+			}
+			records = append(records, sampleHistory(p, now))
+		}
+		// A failed write, such as of a full disk, must not end the
+		// recording.
+		if err := appendHistory(*db, records); err != nil {
+			fmt.Fprintf(os.Stderr, "record: %v\n", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-interrupt:
+			return nil
+		}
+	}
+}
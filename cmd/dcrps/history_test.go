@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistoryRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcrps-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history.jsonl")
+
+	start := time.Date(2019, 1, 2, 15, 0, 0, 0, time.UTC)
+	rss := uint64(100 << 20)
+	records := []historyRecord{
+		{Time: start, PID: 10, Exec: "dcrd", RSS: &rss},
+		{Time: start.Add(time.Minute), PID: 11, Exec: "dcrwallet"},
+		{Time: start.Add(2 * time.Minute), PID: 10, Exec: "dcrd"},
+	}
+	if err := appendHistory(path, records[:2]); err != nil {
+		t.Fatal(err)
+	}
+	if err := appendHistory(path, records[2:]); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A line cut short by a crash is skipped.
+	data = append(data, `{"time":"2019-01-02T15:03:00Z","pid":10,"ex`...)
+
+	got, err := readHistory(bytes.NewReader(data), "dcrd", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].PID != 10 || got[0].RSS == nil || *got[0].RSS != rss || got[1].RSS != nil {
+		t.Errorf("readHistory dcrd: got=%+v", got)
+	}
+	got, _ = readHistory(bytes.NewReader(data), "11", time.Time{})
+	if len(got) != 1 || got[0].Exec != "dcrwallet" {
+		t.Errorf("readHistory 11: got=%+v", got)
+	}
+	got, _ = readHistory(bytes.NewReader(data), "dcrd", start.Add(time.Minute))
+	if len(got) != 1 || !got[0].Time.Equal(start.Add(2*time.Minute)) {
+		t.Errorf("readHistory since: got=%+v", got)
+	}
+}
+
+func TestHistoryReport(t *testing.T) {
+	start := time.Date(2019, 1, 2, 0, 0, 0, 0, time.UTC)
+	record := func(hours int, pid int, heap uint64, numGC uint32, pause uint64) historyRecord {
+		return historyRecord{
+			Time: start.Add(time.Duration(hours) * time.Hour), PID: pid, Exec: "dcrd",
+			HeapAlloc: &heap, NumGC: &numGC, PauseTotalNs: &pause,
+		}
+	}
+	records := []historyRecord{
+		record(0, 10, 100, 5, 1000),
+		record(1, 10, 150, 15, 3000),
+		record(2, 10, 120, 20, 4000),
+		// The counters restart with the process.
+		record(3, 20, 90, 2, 500),
+		record(4, 20, 200, 4, 1500),
+	}
+	rep := newHistoryReport("dcrd", records)
+	if rep.Restarts != 1 {
+		t.Errorf("restarts: got=%d want=1", rep.Restarts)
+	}
+	if len(rep.Metrics) != 1 {
+		t.Fatalf("metrics: got=%+v, want only heap", rep.Metrics)
+	}
+	heap := rep.Metrics[0]
+	if heap.Name != "heap" || heap.First != 100 || heap.Last != 200 || heap.Min != 90 || heap.Max != 200 || heap.PerHour != 25 {
+		t.Errorf("heap trend: got=%+v", heap)
+	}
+	if rep.GCCycles == nil || *rep.GCCycles != 17 || *rep.GCPauseNs != 4000 {
+		t.Errorf("gc: got cycles=%v pause=%v, want 17 and 4000", rep.GCCycles, rep.GCPauseNs)
+	}
+
+	var b strings.Builder
+	if err := writeHistoryReport(&b, rep, 60, asciiSparkBlocks); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"5 samples", "1 restart", "+25B/h", "gc: 17 cycles, 4.2/h"} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("report lacks %q:\n%s", want, b.String())
+		}
+	}
+}
+
+func TestDownsample(t *testing.T) {
+	values := []float64{1, 3, 5, 7, 9, 11}
+	if got, want := downsample(values, 3), []float64{2, 6, 10}; !reflect.DeepEqual(got, want) {
+		t.Errorf("downsample: got=%v want=%v", got, want)
+	}
+	if got := downsample(values, 10); !reflect.DeepEqual(got, values) {
+		t.Errorf("downsample: got=%v want=%v", got, values)
+	}
+}
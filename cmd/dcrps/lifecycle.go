@@ -0,0 +1,324 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dcrlabs/dcrps/internal"
+	"github.com/dcrlabs/dcrps/pkg/dcrps"
+	"github.com/dcrlabs/dcrps/resolve"
+	"github.com/shirou/gopsutil/process"
+)
+
+const (
+	// defaultStopTimeout is how long stop and restart wait for a process
+	// to exit before killing it. dcrd may take a while to flush its
+	// database.
+	defaultStopTimeout = time.Minute
+	// killWait is how long they wait for a process to exit once killed.
+	killWait = 5 * time.Second
+)
+
+// lifecycleTarget is the process stop, restart and hup act on.
+type lifecycleTarget struct {
+	pid  int
+	exec string
+	// created is the start time of the process in milliseconds, which
+	// tells it from a later process reusing its PID.
+	created int64
+}
+
+// findLifecycleTarget finds the local process target is the PID or the exact
+// exec name of.
+func findLifecycleTarget(target string) (*lifecycleTarget, error) {
+	pid, err := exactResolver().PID(target)
+	if err != nil {
+		return nil, err
+	}
+	if exists, err := process.PidExists(int32(pid)); err == nil && !exists {
+		return nil, &resolve.NoProcessError{Target: target}
+	}
+	p, err := process.NewProcess(int32(pid))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read process info: %v", err)
+	}
+	t := &lifecycleTarget{pid: pid}
+	if t.exec, err = p.Name(); err != nil {
+		return nil, fmt.Errorf("cannot read process info: %v", err)
+	}
+	if t.created, err = p.CreateTime(); err != nil {
+		return nil, fmt.Errorf("cannot read process info: %v", err)
+	}
+	return t, nil
+}
+
+func (t *lifecycleTarget) String() string {
+	return fmt.Sprintf("%s (%d)", t.exec, t.pid)
+}
+
+// running reports whether the process still runs, a zombie not counting.
+func (t *lifecycleTarget) running() bool {
+	if exists, err := process.PidExists(int32(t.pid)); err == nil && !exists {
+		return false
+	}
+	p, err := process.NewProcess(int32(t.pid))
+	if err != nil {
+		return false
+	}
+	if created, err := p.CreateTime(); err == nil && created != t.created {
+		return false
+	}
+	if status, err := p.Status(); err == nil && status == "Z" {
+		return false
+	}
+	return true
+}
+
+// waitExit waits up to timeout for the process to exit and reports whether
+// it did.
+func (t *lifecycleTarget) waitExit(timeout time.Duration) bool {
+	for deadline := time.Now().Add(timeout); ; time.Sleep(100 * time.Millisecond) {
+		if !t.running() {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+	}
+}
+
+// signal sends sig to the process. Windows has no signals: SIGTERM asks the
+// process to close with taskkill, which the console programs ignore, and
+// SIGKILL terminates it.
+func (t *lifecycleTarget) signal(sig syscall.Signal) error {
+	if runtime.GOOS == "windows" {
+		args := []string{"/pid", strconv.Itoa(t.pid)}
+		switch sig {
+		case syscall.SIGKILL:
+			args = append([]string{"/f"}, args...)
+		case syscall.SIGTERM:
+		default:
+			return fmt.Errorf("Windows has no %v", sig)
+		}
+		if out, err := exec.Command("taskkill", args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("taskkill: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+	p, err := os.FindProcess(t.pid)
+	if err != nil {
+		return err
+	}
+	return p.Signal(sig)
+}
+
+// stopTarget asks the process to shut down with SIGTERM, which the Decred
+// processes handle by closing their databases, and kills it when it hasn't
+// exited after grace, unless noKill.
+func stopTarget(t *lifecycleTarget, grace time.Duration, noKill bool) error {
+	start := time.Now()
+	if err := t.signal(syscall.SIGTERM); err != nil {
+		if runtime.GOOS != "windows" {
+			return fmt.Errorf("cannot signal %v: %v", t, err)
+		}
+		fmt.Fprintf(os.Stderr, "cannot ask %v to exit: %v\n", t, err)
+		grace = 0
+	} else {
+		fmt.Fprintf(os.Stderr, "sent SIGTERM to %v, waiting up to %v for it to exit...\n", t, grace)
+	}
+	if t.waitExit(grace) {
+		fmt.Printf("%v stopped after %v\n", t, time.Since(start).Round(time.Millisecond))
+		return nil
+	}
+	if noKill {
+		return fmt.Errorf("%v didn't exit within %v", t, grace)
+	}
+	fmt.Fprintf(os.Stderr, "%v didn't exit within %v, killing it\n", t, grace)
+	if err := t.signal(syscall.SIGKILL); err != nil {
+		return fmt.Errorf("cannot kill %v: %v", t, err)
+	}
+	if !t.waitExit(killWait) {
+		return fmt.Errorf("%v still runs %v after it was killed", t, killWait)
+	}
+	fmt.Printf("%v killed after %v\n", t, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// stopProcess shuts a process down gracefully, see stopTarget. It warns when
+// the process runs as a service, whose manager may start it again.
+func stopProcess(args []string) error {
+	fs := flag.NewFlagSet("stop", flag.ExitOnError)
+	grace := fs.Duration("timeout", defaultStopTimeout, "how long to wait for the process to exit before killing it")
+	noKill := fs.Bool("no-kill", false, "fail rather than kill the process when it doesn't exit in time")
+	target := parseTargetFlags(fs, args)
+	if target == "" {
+		return errors.New("missing PID or exec name")
+	}
+	t, err := findLifecycleTarget(target)
+	if err != nil {
+		return err
+	}
+	if s := findServices([]int{t.pid})[t.pid]; s != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v runs as %s (%s), which may start it again\n", t, s.Unit, s.Manager)
+	}
+	return stopTarget(t, *grace, *noKill)
+}
+
+// startDetached starts the executable at path with args in dir, for it to
+// outlive dcrps and its terminal, and returns its PID. It runs in a session
+// of its own, out of reach of the signals of the terminal. Its output is
+// discarded: the Decred processes write their logs to files.
+func startDetached(path string, args []string, dir string) (int, error) {
+	c := exec.Command(path, args...)
+	c.Dir = dir
+	setDetached(c)
+	if err := c.Start(); err != nil {
+		return 0, err
+	}
+	pid := c.Process.Pid
+	c.Process.Release()
+	return pid, nil
+}
+
+// restartedProcess returns the PID of a process with the exec name of t
+// other than t started since, if any.
+func restartedProcess(t *lifecycleTarget, since time.Time) (int, bool) {
+	for _, p := range dcrps.ListMatching(func(exec string) bool { return exec == t.exec }) {
+		if p.PID == t.pid {
+			continue
+		}
+		pr, err := process.NewProcess(int32(p.PID))
+		if err != nil {
+			continue
+		}
+		// The clocks of the start times tick in tens of milliseconds.
+		if created, err := pr.CreateTime(); err == nil && created >= since.Add(-time.Second).UnixNano()/1e6 {
+			return p.PID, true
+		}
+	}
+	return 0, false
+}
+
+// restartProcess restarts a process: with its manager when it runs as a
+// service, otherwise by stopping it as stop does and starting its executable
+// again with its command line, in its working directory and in the
+// environment of dcrps. It then waits for the new process to appear and,
+// when the old one ran the agent, for its agent to answer, exiting as
+// wait-agent does when either doesn't.
+func restartProcess(args []string) error {
+	fs := flag.NewFlagSet("restart", flag.ExitOnError)
+	grace := fs.Duration("timeout", defaultStopTimeout, "how long to wait for the process to exit before killing it")
+	noKill := fs.Bool("no-kill", false, "fail rather than kill the process when it doesn't exit in time")
+	wait := fs.Duration("wait", time.Minute, "how long to wait for the process to start again and its agent to answer")
+	target := parseTargetFlags(fs, args)
+	if target == "" {
+		return errors.New("missing PID or exec name")
+	}
+	t, err := findLifecycleTarget(target)
+	if err != nil {
+		return err
+	}
+	_, err = internal.GetPort(t.pid)
+	hadAgent := err == nil
+
+	begin := time.Now()
+	pid := 0
+	if s := findServices([]int{t.pid})[t.pid]; s != nil && s.restartCommand() != nil {
+		argv := s.restartCommand()
+		fmt.Fprintf(os.Stderr, "restarting %s with %s\n", s.Unit, strings.Join(argv, " "))
+		c := exec.Command(argv[0], argv[1:]...)
+		c.Stdout = os.Stderr
+		c.Stderr = os.Stderr
+		if err := c.Run(); err != nil {
+			return fmt.Errorf("%s: %v", argv[0], err)
+		}
+	} else {
+		p, err := process.NewProcess(int32(t.pid))
+		if err != nil {
+			return fmt.Errorf("cannot read process info: %v", err)
+		}
+		cmdline, err := p.CmdlineSlice()
+		if err != nil || len(cmdline) == 0 {
+			return fmt.Errorf("cannot read the command line of %v: %v", t, err)
+		}
+		path, err := p.Exe()
+		if err != nil {
+			return fmt.Errorf("cannot read the executable of %v: %v", t, err)
+		}
+		dir, err := p.Cwd()
+		if err != nil {
+			return fmt.Errorf("cannot read the working directory of %v: %v", t, err)
+		}
+		if err := stopTarget(t, *grace, *noKill); err != nil {
+			return err
+		}
+		// The upgraded executable, when the running one was replaced.
+		path = strings.TrimSuffix(path, deletedSuffix)
+		if pid, err = startDetached(path, cmdline[1:], dir); err != nil {
+			return fmt.Errorf("cannot start %s: %v", path, err)
+		}
+	}
+
+	deadline := time.Now().Add(*wait)
+	for pid == 0 {
+		var ok bool
+		if pid, ok = restartedProcess(t, begin); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			fmt.Fprintf(os.Stderr, "no %s process started within %v\n", t.exec, *wait)
+			exit(exitNoProcess)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	if !hadAgent {
+		fmt.Printf("%s restarted as %d\n", t.exec, pid)
+		return nil
+	}
+	addr, err := waitForAgent(strconv.Itoa(pid), deadline, 500*time.Millisecond)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s restarted as %d, but its agent didn't answer within %v: %v\n",
+			t.exec, pid, *wait, err)
+		exit(exitAgentUnreachable)
+	}
+	fmt.Printf("%s restarted as %d, agent ready at %v\n", t.exec, pid, addr)
+	return nil
+}
+
+// hupProcess sends SIGHUP to a process, which the processes that handle it
+// take to reopen their logs or reload their config. The others exit on it,
+// as the Go runtime exits by default, which hup reports with an error.
+func hupProcess(args []string) error {
+	fs := flag.NewFlagSet("hup", flag.ExitOnError)
+	target := parseTargetFlags(fs, args)
+	if target == "" {
+		return errors.New("missing PID or exec name")
+	}
+	if runtime.GOOS == "windows" {
+		return errors.New("Windows has no SIGHUP")
+	}
+	t, err := findLifecycleTarget(target)
+	if err != nil {
+		return err
+	}
+	if err := t.signal(syscall.SIGHUP); err != nil {
+		return fmt.Errorf("cannot signal %v: %v", t, err)
+	}
+	if t.waitExit(time.Second) {
+		return fmt.Errorf("%v exited on SIGHUP, it doesn't handle it", t)
+	}
+	fmt.Printf("sent SIGHUP to %v\n", t)
+	return nil
+}
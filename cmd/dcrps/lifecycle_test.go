@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/process"
+)
+
+func TestStopTarget(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no sleep command")
+	}
+	// A shell ignoring SIGTERM, which stays a zombie once killed until the
+	// test, its parent, waits for it.
+	c := exec.Command("sh", "-c", "trap '' TERM; echo; sleep 30; true")
+	out, err := c.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Wait()
+	// The trap is set once it wrote the line.
+	if _, err := out.Read(make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+	p, err := process.NewProcess(int32(c.Process.Pid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := &lifecycleTarget{pid: c.Process.Pid, exec: "sh"}
+	if target.created, err = p.CreateTime(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := stopTarget(target, 200*time.Millisecond, true); err == nil {
+		t.Error("-no-kill: got no error")
+	}
+	if !target.running() {
+		t.Fatal("the process exited on SIGTERM")
+	}
+	if err := stopTarget(target, 200*time.Millisecond, false); err != nil {
+		t.Fatal(err)
+	}
+	if target.running() {
+		t.Error("the killed process still runs")
+	}
+
+	// Another process with the PID.
+	target = &lifecycleTarget{pid: target.pid, created: target.created - 1}
+	if target.running() {
+		t.Error("another process with the PID: running")
+	}
+}
+
+func TestStartDetached(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("reads the session from /proc")
+	}
+	path, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip(err)
+	}
+	pid, err := startDetached(path, []string{"30"}, os.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := os.FindProcess(pid)
+	defer p.Kill()
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The session is the 6th field, after the command in parentheses.
+	fields := strings.Fields(string(stat[strings.LastIndex(string(stat), ")")+1:]))
+	if len(fields) < 4 || fields[3] != fmt.Sprint(pid) {
+		t.Errorf("got the fields %v after the command, want the session %d", fields, pid)
+	}
+}
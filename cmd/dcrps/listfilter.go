@@ -0,0 +1,67 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/google/gops/goprocess"
+)
+
+// isGlob reports whether s is a glob pattern of the listing rather than a
+// PID, exec name or command.
+func isGlob(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+// execMatcher returns the func reporting whether an exec name matches the
+// glob pattern, as filepath.Match does, or else the regular expression re,
+// which need only match part of the name. The match ignores case when fold
+// is set.
+func execMatcher(glob, re string, fold bool) (func(exec string) bool, error) {
+	if re != "" {
+		r, err := compileExecRegexp(re, fold)
+		if err != nil {
+			return nil, err
+		}
+		return r.MatchString, nil
+	}
+	if fold {
+		glob = strings.ToLower(glob)
+	}
+	// Report a malformed pattern now rather than never match.
+	if _, err := filepath.Match(glob, ""); err != nil {
+		return nil, err
+	}
+	return func(exec string) bool {
+		if fold {
+			exec = strings.ToLower(exec)
+		}
+		ok, _ := filepath.Match(glob, exec)
+		return ok
+	}, nil
+}
+
+// compileExecRegexp compiles the regexp re of exec names, matching regardless
+// of case when fold is set.
+func compileExecRegexp(re string, fold bool) (*regexp.Regexp, error) {
+	if fold {
+		re = "(?i)" + re
+	}
+	return regexp.Compile(re)
+}
+
+// filterExec keeps the processes of ps whose exec name matches.
+func filterExec(ps []goprocess.P, match func(exec string) bool) []goprocess.P {
+	var kept []goprocess.P
+	for _, p := range ps {
+		if match(p.Exec) {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestExecMatcher(t *testing.T) {
+	tests := []struct {
+		glob, re string
+		fold     bool
+		exec     string
+		want     bool
+	}{
+		{"dcrwallet*", "", false, "dcrwallet", true},
+		{"dcrwallet*", "", false, "dcrwallet-1.8.0", true},
+		{"dcrwallet*", "", false, "dcrd", false},
+		{"dcr?", "", false, "dcrd", true},
+		{"dcr?", "", false, "dcrctl", false},
+		{"DCR*", "", false, "dcrd", false},
+		{"DCR*", "", true, "dcrd", true},
+		{"", "dcr(d|ctl)", false, "dcrctl", true},
+		{"", "dcr(d|ctl)", false, "dcrdata", true},
+		{"", "dcr(d|ctl)$", false, "dcrdata", false},
+		{"", "^DCRD$", true, "dcrd", true},
+	}
+	for _, test := range tests {
+		match, err := execMatcher(test.glob, test.re, test.fold)
+		if err != nil {
+			t.Errorf("execMatcher(%q, %q): %v", test.glob, test.re, err)
+			continue
+		}
+		if got := match(test.exec); got != test.want {
+			t.Errorf("execMatcher(%q, %q, %v)(%q): got=%v want=%v",
+				test.glob, test.re, test.fold, test.exec, got, test.want)
+		}
+	}
+
+	for _, test := range []struct{ glob, re string }{{"dcr[", ""}, {"", "dcr("}} {
+		if _, err := execMatcher(test.glob, test.re, false); err == nil {
+			t.Errorf("execMatcher(%q, %q): expected an error", test.glob, test.re)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/google/gops/goprocess"
+	"github.com/shirou/gopsutil/process"
+)
+
+// ANSI escape sequences of the -watch screen.
+const (
+	clearScreen = "\x1b[H\x1b[2J"
+	hideCursor  = "\x1b[?25l"
+	showCursor  = "\x1b[?25h"
+)
+
+// usageSampler samples the usage of the listed processes frame after frame.
+// It keeps the processes across frames to measure their CPU usage from one
+// frame to the next.
+type usageSampler struct {
+	procs map[int]*process.Process
+}
+
+// sample returns the usage of ps since the previous sample. The processes
+// that exited since are forgotten and those that appeared have no CPU
+// usage yet.
+func (s *usageSampler) sample(ps []goprocess.P) map[int]processUsage {
+	defer benchPhase("process collection")()
+	procs := make(map[int]*process.Process, len(ps))
+	usage := make(map[int]processUsage, len(ps))
+	for _, p := range ps {
+		pr, seen := s.procs[p.PID]
+		if !seen {
+			var err error
+			pr, err = process.NewProcess(int32(p.PID))
+			if err != nil {
+				// Exited since it was listed.
+				continue
+			}
+		}
+		var u processUsage
+		// The first call only records the CPU times to measure from.
+		if v, err := pr.Percent(0); err == nil && seen {
+			u.cpu, u.cpuKnown = v, true
+		}
+		readMemUsage(pr, &u)
+		procs[p.PID] = pr
+		usage[p.PID] = u
+	}
+	s.procs = procs
+	return usage
+}
+
+// watchProcesses prints the listing with the CPU and memory usage of the
+// processes again every interval, on a cleared screen when the standard
+// output is a terminal, until interrupted. Only the processes whose exec
+// name matches are listed when match is set.
+func watchProcesses(interval time.Duration, match func(exec string) bool) {
+	tty := isTerminal(os.Stdout)
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+	if tty {
+		fmt.Print(hideCursor)
+		defer fmt.Print(showCursor)
+	}
+
+	sampler := &usageSampler{}
+	t := &processTable{groupBy: *groupBy, totals: *totals}
+	t.setColumns()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for frame := 0; ; frame++ {
+		dcrPs := dcrProcesses()
+		if match != nil {
+			dcrPs = filterExec(dcrPs, match)
+		}
+		t.uptimes = nil
+		if *sortBy == "uptime" || needsColumn("uptime") {
+			t.uptimes = processUptimes(dcrPs)
+		}
+		t.usage = sampler.sample(dcrPs)
+		sortProcesses(dcrPs, *sortBy, *reverse, t.uptimes, t.usage)
+		t.nspids = nil
+		if *pidNSMap || needsColumn("nspid") {
+			t.nspids = namespacePIDs(dcrPs)
+		}
+		t.readServiceColumns(dcrPs)
+
+		switch {
+		case tty:
+			fmt.Print(clearScreen)
+		case frame > 0:
+			fmt.Println()
+		}
+		fmt.Printf("Every %v: dcrps  %s\n\n", interval, time.Now().Format("2006-01-02 15:04:05"))
+		if len(dcrPs) == 0 {
+			fmt.Println("no matching processes")
+		}
+		t.print(os.Stdout, dcrPs)
+
+		select {
+		case <-ticker.C:
+		case <-interrupt:
+			return
+		}
+	}
+}
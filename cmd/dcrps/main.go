@@ -0,0 +1,1728 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Program dcrps is a tool to list currently running Decred Go processes.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dcrlabs/dcrps/pkg/dcrps"
+	"github.com/dcrlabs/dcrps/resolve"
+	"github.com/google/gops/goprocess"
+	"github.com/shirou/gopsutil/process"
+)
+
+var (
+	prefix        = flag.String("prefix", defaultPrefix(), "comma-separated exec name prefixes of the processes")
+	execMatch     = flag.String("match", "", "regexp of the exec names of the processes, besides -prefix")
+	allProcs      = flag.Bool("all", false, "list and resolve all the Go processes")
+	each          = flag.Bool("each", false, "run agent commands against every process sharing the exec name")
+	normalizeExec = flag.Bool("normalize-exec", false, "strip version suffixes from exec names")
+	execExact     = flag.Bool("exec-exact", false, "require exact exec name matches")
+	strictAgent   = flag.Bool("strict-agent", false, "fail fast when the target runs no agent")
+	groupBy       = flag.String("group-by", "", "group the listing by network or exec")
+	jsonOutput    = flag.Bool("json", false, "print JSON instead of tables")
+	outFormat     = new(outputFormat)
+	pidOnly       = flag.Bool("pid-only", false, "list only the PIDs")
+	print0        = flag.Bool("print0", false, "list NUL-separated paths or PIDs")
+	agentPortFile = flag.String("agent-port-file", "", "file holding the agent address")
+	caseFold      = flag.Bool("exec-case-insensitive", caseInsensitiveFS, "match exec names regardless of case")
+	sortBy        = flag.String("sort", "", "sort the listing by pid, ppid, exec, mem, cpu or uptime")
+	reverse       = flag.Bool("reverse", false, "reverse the order of the listing")
+	timeout       = flag.Duration("timeout", 0, "timeout of each round trip to the agent")
+	peerFilter    = flag.String("connected-to", "", "keep the processes connected to an IP or CIDR range")
+	outputFD      = flag.Int("output-fd", 1, "file descriptor to write the JSON output to")
+	pidNSMap      = flag.Bool("pid-namespace-map", false, "show the PIDs of the processes in their PID namespace")
+	themeName     = flag.String("theme", "", "color theme: light, dark or none")
+	execRegex     = flag.String("regex", "", "list only the processes whose exec name matches the regexp")
+	totals        = flag.Bool("totals", false, "add the CPU and memory usage and their totals to the listing")
+	columns       = flag.String("columns", "", "comma-separated columns of the listing")
+	noHeader      = flag.Bool("no-header", false, "leave out the header of the -columns listing")
+	watchList     = flag.Bool("watch", false, "refresh the listing every -interval until interrupted")
+	listInterval  = flag.Duration("interval", 2*time.Second, "refresh interval of -watch")
+	agentPort     = flag.Int("agent-port", 0, "agent port of the remote hosts given without one")
+	dialTimeout   = flag.Duration("connect-timeout", 5*time.Second, "timeout of the connection to the agent")
+	tlsCert       = flag.String("cert", "", "client certificate of the tls:// targets")
+	tlsKey        = flag.String("key", "", "key of the -cert client certificate")
+	tlsCA         = flag.String("ca", "", "CA certificates verifying the tls:// targets")
+	tokenFile     = flag.String("token-file", "", "file holding the token of the tls:// targets")
+	benchmark     = flag.Bool("benchmark", false, "print the time spent in each phase to stderr")
+	retry         = flag.Int("retry", 0, "retries of read-only agent requests whose connection is reset")
+	portFromConf  = flag.Bool("detect-port-from-config", true, "read the agent address from the app config")
+	sshHost       = flag.String("ssh", "", "reach the agents of a remote host through ssh, as user@host")
+	fdWarn        = flag.Float64("fd-warn", 80, "warn when a process uses this percent of its open files or memory maps limit")
+)
+
+func init() {
+	flag.BoolVar(watchList, "w", false, "shorthand for -watch")
+	flag.Var(outFormat, "o", "print json or csv instead of tables")
+}
+
+// defaultPrefix returns the default of -prefix: $DCRPS_PREFIX when set, even
+// empty, or else dcrPrefix.
+func defaultPrefix() string {
+	if prefix, ok := os.LookupEnv("DCRPS_PREFIX"); ok {
+		return prefix
+	}
+	return dcrPrefix
+}
+
+// caseInsensitiveFS is set on the systems whose file systems usually ignore
+// case.
+const caseInsensitiveFS = runtime.GOOS == "windows" || runtime.GOOS == "darwin"
+
+// resolver resolves the command targets. It is set up from the flags in main.
+var resolver *resolve.Resolver
+
+// newResolver returns a resolver set up from the flags.
+func newResolver() *resolve.Resolver {
+	r := &resolve.Resolver{
+		Prefixes:      resolve.ParsePrefixes(*prefix),
+		NormalizeExec: *normalizeExec,
+		Exact:         *execExact,
+		Fuzzy:         true,
+		PortFile:      *agentPortFile,
+
+		CaseInsensitive: *caseFold,
+		ConfigFallback:  *portFromConf,
+		AgentPort:       *agentPort,
+	}
+	switch {
+	case *allProcs:
+		r.Prefixes = nil
+	case *execMatch != "":
+		re, err := compileExecRegexp(*execMatch, *caseFold)
+		if err != nil {
+			usage("invalid -match: " + err.Error())
+		}
+		r.Pattern = re
+	}
+	if isTerminal(os.Stdin) && isTerminal(os.Stderr) {
+		r.Choose = chooseProcess
+	}
+	r.Matched = func(name string, p goprocess.P) {
+		fmt.Fprintf(os.Stderr, "%s matches %s (PID %d)\n", name, p.Exec, p.PID)
+	}
+	return r
+}
+
+// exactResolver returns a resolver taking exec names only as they are
+// listed, for the commands that act on the process, as stop does, or report
+// on its state, as wait-agent does, which a looser match would mislead into
+// the wrong process, dcrdata for a dcrd that is down.
+func exactResolver() *resolve.Resolver {
+	r := newResolver()
+	r.Fuzzy = false
+	return r
+}
+
+// parseCommandFlags parses the arguments of a command with its flag set. The
+// global flags are accepted too, so they may also follow the command name.
+func parseCommandFlags(fs *flag.FlagSet, args []string) {
+	flag.VisitAll(func(f *flag.Flag) {
+		if fs.Lookup(f.Name) == nil {
+			fs.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+	fs.Parse(args)
+	resolver = newResolver()
+}
+
+// parseInterspersedFlags parses the arguments of a command whose flags may
+// come before, between or after its positional arguments, which it returns.
+func parseInterspersedFlags(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		parseCommandFlags(fs, args)
+		if fs.NArg() == 0 {
+			return positional
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// parseTargetFlags parses the arguments of a command that takes a target
+// and flags. It returns the target, or the empty string when it is missing.
+func parseTargetFlags(fs *flag.FlagSet, args []string) string {
+	positional := parseInterspersedFlags(fs, args)
+	if len(positional) == 0 {
+		return ""
+	}
+	return positional[0]
+}
+
+// Exit codes, documented in helpText.
+const (
+	exitFailure          = 1
+	exitUsage            = 2 // unknown command or invalid flags
+	exitAgentUnreachable = 3
+	exitNoProcess        = 4 // no matching process, e.g. the target is down
+	exitUnresolved       = 5 // the target can't be resolved otherwise
+)
+
+// exitCode returns the exit code of a command that failed with err.
+func exitCode(err error) int {
+	switch err.(type) {
+	case *resolve.NoProcessError:
+		return exitNoProcess
+	case *resolve.NoAgentError, *dcrps.DialError:
+		return exitAgentUnreachable
+	case *resolve.AmbiguousError:
+		return exitUnresolved
+	}
+	return exitFailure
+}
+
+const (
+	dcrPrefix = resolve.DefaultPrefix
+
+	helpText = `dcrps is a tool to list and diagnose Decred Go processes.
+
+dcrps [flags] <"help"|"tree">
+dcrps [flags] <cmd> <exec|pid|addr> ...
+dcrps [flags] <exec|pid> # displays process info
+dcrps [flags] <pattern> # lists the processes whose exec name matches
+
+Flags:
+    -prefix list     Sets the comma-separated exec name prefixes of the
+                     processes dcrps lists and resolves by name, e.g.
+                     "dcr,politeia". Empty lists all the Go processes.
+                     Defaults to $DCRPS_PREFIX when set, else to the prefix
+                     of the configuration file, else "dcr".
+    -match re        Also counts the processes whose exec name matches the
+                     regular expression re, whatever their prefix, e.g.
+                     '^(politeiad|vspd)$'. With an empty -prefix, only those
+                     count.
+    -all             Counts all the Go processes, whatever -prefix and
+                     -match.
+    -normalize-exec  Strips trailing version suffixes such as "-1.8.0" from
+                     exec names, so "dcrd-1.8.0" is matched as "dcrd".
+    -each            Runs the agent commands against each of the processes
+                     sharing the exec name of the target, under a header
+                     naming the process, rather than failing as the target
+                     is ambiguous. The target "all" runs them against every
+                     process running the agent, with or without -each:
+                         dcrps memstats all
+                         dcrps -each stats dcrwallet
+                     A process that fails doesn't stop the others; the exit
+                     status is that of the first failure. The pprof and
+                     trace commands can't run against several processes.
+    -exec-exact      Resolves exec names only by an exact match of the name
+                     dcrps lists them by, never by looser matching such as
+                     the substring of one. Meant for scripts that must not
+                     hit an unintended process.
+    -strict-agent    Makes agent commands check that a local target runs
+                     the agent before dialing it and exit with status 3
+                     (agent unreachable) when it doesn't, 4 when it isn't
+                     running and 5 when it is ambiguous. Targets given as a
+                     host:port address or through -agent-port-file can't be
+                     checked and are dialed as usual.
+    -connected-to ip Keeps only the processes with an established connection
+                     to the remote IP, or to one in a CIDR range such as
+                     10.0.0.0/8, in the listing, the tree and the commands
+                     working on all the processes, to find the nodes a peer
+                     is connected to.
+    -output-fd n     Writes the JSON output to the file descriptor n rather
+                     than to the standard output, e.g. for a calling program
+                     to read it apart from the diagnostics on the standard
+                     error. It must be open for writing. Defaults to 1.
+                         dcrps -json -output-fd 3 3>ps.json
+    -pid-namespace-map
+                     Adds a column after the PID to the listing, and a
+                     "nspid" field to its JSON, with the PID a process in
+                     another PID namespace, e.g. a container, sees itself
+                     as, read from /proc/<pid>/status, or "-" for the other
+                     processes. Linux only.
+    -theme name      Selects the colors of the terminal output, in the
+                     listing, the tree highlights, the heatmap and the watch
+                     alerts: dark, light (for light backgrounds) or none (no
+                     color). Defaults to the one suiting the background told
+                     by $COLORFGBG, else dark. $NO_COLOR turns color off.
+    -regex re        Lists only the processes whose exec name matches the
+                     regular expression re, e.g. 'dcr(d|ctl)$'. A glob
+                     pattern such as 'dcrwallet*' given in place of a
+                     command filters the listing the same way. Both match
+                     regardless of case with -exec-case-insensitive.
+                     Prints "no matching processes" and exits with status
+                     4 when none matches.
+    -totals          Adds the CPU usage of each process over its lifetime,
+                     its resident memory and its share of the host memory
+                     to the listing, and their totals under it with the
+                     number of processes.
+    -columns list    Prints only the given columns of the listing, in that
+                     order, under a header of their names: pid, nspid,
+                     ppid, exec, agent, version, cpu, mem, mem%, uptime,
+                     unit (the systemd unit, launchd label or Windows
+                     service the process runs as), stale (whether its
+                     binary was replaced on disk since it started) and
+                     path. The default is the full set the other flags ask
+                     for, with no header.
+                         dcrps -columns pid,exec,version
+    -no-header       Leaves out the header of the -columns listing and of
+                     the -o csv output, e.g. for scripts.
+    -w, -watch       Prints the listing again every -interval, on a cleared
+                     screen, with the CPU usage of each process since the
+                     previous refresh and its resident memory, until
+                     interrupted with Ctrl-C. The columns keep their widths
+                     as processes come and go.
+    -interval d      Sets the refresh interval of -watch. Defaults to 2s.
+    -agent-port n    Sets the agent port of the remote hosts given as an
+                     address target without one, as an IP address or a
+                     domain name, since gops agents have no default port:
+                         dcrps -agent-port 9000 stack 10.0.0.5
+                     Targets given as host:port don't need it. The remote
+                     targets are dialed directly, never looked up locally.
+    -connect-timeout d
+                     Sets the timeout of the connection to the agent, so that
+                     a firewalled or down host fails fast. Defaults to 5s.
+    -ssh user@host   Reaches the agents of a remote host through the ssh
+                     client, so that their ports needn't be exposed. The
+                     listing lists the agents of the remote user, from the
+                     PID files in its gops config dir, and the agent
+                     commands resolve their target among them, or take a
+                     host:port as the remote host sees it, and dial it with
+                     "ssh -W". ssh runs in batch mode, with the keys and
+                     ~/.ssh/config of the user, and never prompts:
+                         dcrps -ssh admin@vps.example.com stack dcrd
+    -cert file       Sets the client certificate, in PEM, with which dcrps
+                     authenticates to the agents of tls:// targets. The key
+                     is read from the same file unless -key is given.
+    -key file        Sets the PEM key of the -cert client certificate.
+    -ca file         Sets the PEM CA certificates verifying the tls:// targets,
+                     instead of the system ones.
+    -token-file path Sets the file whose first line is the token dcrps sends
+                     tls:// targets, as a line ahead of each request, for the
+                     proxies that check one. Defaults to $DCRPS_AGENT_TOKEN.
+    -benchmark       Prints the time spent in each phase of the run to the
+                     standard error: the process enumeration, the resolution
+                     of the target, the per-process collection and the agent
+                     dial and request, to tell where a slow run spends it.
+    -retry n         Sends a request of a read-only agent command again, up
+                     to n times, when the connection is reset while reading
+                     the response, as happens to busy agents. gc and setgc
+                     are never retried. Refused connections aren't retried
+                     either. Defaults to 0.
+    -detect-port-from-config
+                     When the agent of a local process left no PID file,
+                     reads its address from the app's config file, the one
+                     given with -C/--configfile on its command line or else
+                     <app>.conf in its -A/--appdata or default data
+                     directory, e.g. ~/.dcrd/dcrd.conf. The address is the
+                     value of the agentaddr or gopsaddr key, as host:port or
+                     as a local port. On by default; =false disables it.
+    -fd-warn percent Warns in the process info, and makes fds fail, when a
+                     process has this share of its open files limit open or
+                     of the vm.max_map_count memory maps mapped. Defaults to
+                     80.
+    -timeout d       Sets the timeout of each round trip to the agent,
+                     overriding the defaults of the agent commands listed
+                     below. With no -timeout, the other commands wait for
+                     the agent as long as it takes.
+    -group-by kind   Groups the process listing under a header per group,
+                     with the number of processes in each. By "network",
+                     groups by mainnet/testnet/simnet/regnet as selected on
+                     the command line; by "exec", groups by exec name.
+    -json            Prints JSON instead of a table or tree (listing, tree,
+                     process info, threads, memstats), alone on the standard
+                     output. The process info fields that can't be read are
+                     null. The listing has the PID, PPID, exec, agent flag,
+                     build version and path of each process, with its CPU
+                     usage over its lifetime, resident memory, share of the
+                     host memory and threads, null when they can't be read.
+                     The listing and tree JSON can be rendered again with
+                     the render command.
+    -o format        Prints the listing, the process info and the tree in a
+                     structured format instead: json, the same as -json, or
+                     csv, with a header row naming the fields as the JSON
+                     does. The fields that can't be read are empty. The CSV
+                     tree has a row per node, depth-first, with its depth;
+                     the CSV process info counts the connections by state.
+                     table selects the tables, overriding the format of the
+                     configuration file.
+                         dcrps -o csv | cut -d, -f1,3
+    -exec-case-insensitive
+                     Matches exec names and the dcr prefix regardless of
+                     case, so "Dcrd" is found as "dcrd". On by default on
+                     Windows and macOS, whose file systems usually ignore
+                     case; -exec-case-insensitive=false turns it off there.
+                     Applies to -exec-exact matches too.
+    -agent-port-file path
+                     Reads the agent address of the target from the file at
+                     path, holding host:port or a local port, instead of
+                     discovering it from the PID. Address targets still take
+                     precedence.
+    -sort key        Sorts the process listing by key: "pid", "ppid" or
+                     "exec" (ascending), "mem" (resident memory) or "cpu"
+                     (CPU usage over the lifetime, or since the previous
+                     refresh with -watch), largest first, which add the
+                     usage columns, or "uptime" (longest running first and
+                     adds an uptime column). Processes whose sort value is
+                     unknown come last. Defaults to ascending PID.
+    -reverse         Reverses the order of the listing, but for the
+                     processes whose sort value is unknown, which still
+                     come last.
+    -pid-only        Lists only the PIDs of the processes, one per line.
+    -print0          Lists the paths of the processes, or their PIDs with
+                     -pid-only, each followed by a NUL byte rather than a
+                     newline, for "xargs -0". Excludes -json and -group-by.
+
+The flags may also be given after the command name.
+
+Aliases for commands with preset flags can be defined in the configuration
+file, $DCRPS_CONFIG or ~/.dcrps.toml, and are used like the commands:
+
+    [aliases]
+    hprof = "pprof-heap -svg"
+
+Aliases can't take the name of a built-in command. The configuration file
+also sets the defaults of -prefix, -match, -all and -o, which the flags and
+$DCRPS_PREFIX override, and names the agents of remote hosts, which the
+agent commands take as their target:
+
+    [processes]
+    prefix = "dcr,politeia"
+    match = "^vspd$"
+
+    [output]
+    format = "json"
+
+    [agents]
+    vps-dcrd = "tls://vps.example.com:9443"
+
+    dcrps stack vps-dcrd
+
+Commands with no argument:
+    help        Displays this message.
+    tree        Displays process tree.
+                Flags: -highlight <exec|pid> (marks the process in the tree,
+                in color on terminals unless $NO_COLOR is set), -path (also
+                marks the ancestors of the highlighted process), -markdown
+                (prints the tree as a nested Markdown list for issues and
+                wikis, with exec, version and agent per process), -dot
+                (prints the tree as a Graphviz DOT graph), -json, -heatmap
+                (shows the CPU usage of each process, sampled over -interval
+                d, default 1s, and colors it from green to red on terminals
+                unless $NO_COLOR is set), -collapse (shows the identical
+                sibling subtrees, same exec, version and children, once
+                with their count as "(x20)").
+    selftest    Probes every agent command on each agent-enabled process and
+                prints a process by command matrix of the results.
+                Flags: -timeout d (default 3s), -long (also probe the 30s
+                pprof-cpu and 5s trace captures).
+    threads     Prints the OS thread count of every process, sorted, with
+                the total. Flags: -sort threads|pid|exec (default threads),
+                -threshold n (marks processes with more than n threads).
+    top         Redraws a table of the processes every interval until
+                interrupted, like top: their CPU usage since the previous
+                refresh, resident memory, goroutines (agent only) and
+                connections, not counting listening sockets.
+                Flags: -interval d (default 2s), -sort pid|exec|cpu|rss|
+                goroutines|conns (default cpu, the largest values first).
+    watch-restarts
+                Samples the processes until interrupted and reports every
+                restart, i.e. an exec whose process was replaced by a new
+                one, with the number of its restarts in the window.
+                Flags: -interval d (default 2s), -window d (default 5m).
+    orphans     Lists the processes whose parent is gone or isn't a dcr
+                process, with the reason: parent gone, reparented to init
+                after their parent exited, or a parent that is not a dcr
+                process. Services that systemd started are top-level by
+                design and not listed. Flags: -json.
+    stale       Lists the processes whose binary was replaced on disk since
+                they started, as by an upgrade, with the command that
+                restarts the service they run as, and exits with status 1
+                when there is one. Flags: -json.
+    clean-agents
+                Reports the stale PID files that gops agents left in the gops
+                config dir: those of exited processes and of PIDs now reused
+                by a process that isn't a Go program. Flags: -prune (removes
+                the PID files of exited processes; reused PIDs are only
+                reported).
+    metrics     Prints the metrics of the processes in the Prometheus text
+                format: CPU time, resident memory, threads, open files,
+                connections, start time and, through the agent, goroutines,
+                with the time they were collected at. Flags: -o file (writes
+                them to file atomically, e.g. from cron for the node_exporter
+                textfile collector).
+                    dcrps metrics -o /var/lib/node_exporter/dcr.prom
+    export      Serves the metrics of the processes to Prometheus at /metrics
+                until interrupted: those of metrics and, through the agent,
+                the heap, memory and GC stats of memstats, scraped every
+                interval, each labeled with the PID, exec and Go version.
+                Flags: -listen host:port (default :9123), -interval d
+                (default 15s).
+                    dcrps export -listen :9123
+    serve       Serves the listing and the agent commands of the processes
+                over HTTP until interrupted, for monitoring systems and web
+                dashboards: GET /processes (the -json listing), and under
+                /process/{pid} the process info, memstats (?raw=1 for all of
+                them), stats, stack (?dedupe=1), version and
+                pprof/heap|cpu|mutex|block (?seconds=n for cpu), and POST
+                /process/{pid}/gc. Only the listed processes are served, one
+                agent request at a time, and the failures are JSON with an
+                error. Flags: -listen host:port (default 127.0.0.1:7070),
+                -auth-token-file file (the clients must send its first line
+                as "Authorization: Bearer <token>", else $DCRPS_SERVE_TOKEN;
+                required beyond the loopback), -allow list (the endpoints
+                served, default all but gc).
+                    DCRPS_SERVE_TOKEN=s3cret dcrps serve -listen :7070 -allow processes,stats,stack
+    render      Reads a listing or tree captured with -json from the standard
+                input and renders it. Flags: -format table|tree|dot (defaults
+                to the form it was captured in).
+                    dcrps -json > ps.json; dcrps render -format dot < ps.json
+    watch       Samples the processes until interrupted and prints an ALERT
+                line when a process crosses a threshold, and a cleared line
+                when it drops back. Thresholds are "metric op number" with
+                metric one of memory (%), rss (bytes), cpu (%), threads,
+                goroutines (agent only) and connections, op one of > >= <
+                <= == !=. Flags: -alert expr (repeatable), -rss-limit size
+                (alerts on rss>size, e.g. 2GB), -goroutines-limit n (alerts
+                on goroutines>n), -interval d (default 2s), -exit (exits
+                with status 1 on the first alert), -gc-stall d (alerts when
+                the agent reports no GC for longer than d while the heap
+                grew, with the growth, and clears once a GC ran),
+                -snapshot-dir dir (captures the stack trace, the goroutines
+                grouped by stack and the heap profile of the process of
+                each alert into a tar.gz in dir, agent only),
+                -exec-on-trigger cmd (runs cmd with sh -c, or cmd /C on
+                Windows, on each alert, after the snapshot, taken into the
+                current directory without -snapshot-dir; cmd gets DCRPS_PID,
+                DCRPS_EXEC, DCRPS_ALERT and DCRPS_SNAPSHOT, the path of the
+                snapshot or empty, and the sampling waits for it, so keep it
+                short or background its slow work), -hook-timeout d (kills
+                cmd after d, default 1m).
+                    dcrps watch -alert 'memory>80' -alert 'goroutines>5000'
+                    dcrps watch -gc-stall 5m -exit
+                    dcrps watch -rss-limit 2GB -goroutines-limit 50000 -exec-on-trigger ./notify.sh
+    record      Samples the processes every interval until interrupted and
+                appends their resident memory and, through the agent, their
+                heap, heap objects, sys memory, goroutines and GC counters to
+                the history database, a file of one JSON record per line,
+                $DCRPS_HISTORY or ~/.dcrps-history.jsonl, for report. The
+                exec names or PIDs given as arguments restrict the processes.
+                Flags: -interval d (default 1m), -db file.
+                    nohup dcrps record dcrd dcrwallet &
+    completion  Prints the completion script of bash, zsh or fish, which
+                completes the commands, the flags and the names and PIDs of
+                the running processes:
+                    source <(dcrps completion bash)
+                    dcrps completion zsh > "${fpath[1]}/_dcrps"
+                    dcrps completion fish > ~/.config/fish/completions/dcrps.fish
+
+Commands with <exec|pid> argument:
+    cpu-history Samples the CPU usage and prints it as a sparkline.
+                Flags: -samples n (default 10), -interval d (default 1s).
+    dash        Redraws a dashboard of the process every interval until
+                interrupted, for incident response: the graphs of its CPU
+                usage, heap, goroutines and connections, its GC cycles and,
+                for dcrps agents, the histogram of its latest GC pauses.
+                Keys: g runs a GC, s saves the stack trace, t saves a 5s
+                trace, q quits. Needs a terminal. Flags: -interval d
+                (default 2s), -history n (default 60 samples).
+    diagnose    Prints a triage report: the process info, goroutine count,
+                brief memstats, a GC pressure verdict, the connections by
+                state and the most common top stack frames. The runtime
+                sections need the agent, which the report tells missing or
+                unreachable. Flags: -o file (writes the report to file).
+    snapshot    Collects the process info, the stack trace and the goroutines
+                grouped by stack, the memstats, runtime stats and version,
+                the heap profile, a CPU profile and, for dcrps agents, the
+                application stats into a single timestamped tar.gz to attach
+                to bug reports. What can't be collected is listed in its
+                errors.txt. Flags: -o file (default dcrps-snapshot-<exec>-
+                <pid>-<time>.tar.gz), -cpu-duration d (default 5s, 0 skips
+                the CPU profile; the stock agent profiles for 30s).
+                    dcrps snapshot dcrd
+    profile     Captures profiles on a schedule into a directory, named
+                <exec|pid>-<type>-<time>.pprof, and removes the oldest of
+                each type, until interrupted. The target is resolved for
+                each capture, so an exec name survives restarts. Flags:
+                -every d (default 10m), -keep n (default 24 of each type,
+                0 keeps all), -types list (default heap; heap, cpu, mutex,
+                block), -out dir (default the current one), -cpu-duration
+                d (default 10s; the stock agent profiles for 30s).
+                    dcrps profile dcrwallet -every 10m -types heap,cpu -out /var/log/dcrps
+    conns       Lists the connections of the process with what they serve by
+                the well-known Decred ports (p2p, dcrd-rpc, wallet-rpc and
+                wallet-grpc of each network, vspd, dcrdata, politeia, ln-p2p
+                and ln-grpc, or other) and their direction: inbound when
+                accepted on a port the process listens on, outbound
+                otherwise. Warns on the standard error when dcrd, or a
+                process with P2P peers, has no outbound P2P peer left.
+                Flags: -summary (prints the counts of each class by
+                direction instead), -json.
+                    dcrps conns dcrd -summary
+    report      Prints the trends of the process over the history that record
+                sampled: the first, last, lowest and highest value of each
+                metric, its change per hour and its sparkline, with the GC
+                cycles and pauses of the window and the restarts of the
+                exec, for slow leaks. Flags: -since d (default 24h), -db
+                file, -width n (of the sparklines, default 60), -json.
+                    dcrps report dcrd -since 72h
+    core        Dumps the core of the process, for when its agent no longer
+                answers, into <dir>/core-<exec>-<pid>-<time>.<pid> with
+                gcore, which leaves it running, along with a copy of its
+                binary (.bin) and its path, command line and build info
+                (.txt) for delve to open it with "dlv core". Flags: -out dir
+                (default the current one), -no-binary (doesn't copy the
+                binary), -abort (crashes the process with SIGABRT instead,
+                without gcore; it needs GOTRACEBACK=crash and the kernel
+                writes the core by its core_pattern).
+                    dcrps core dcrd -out /var/crash
+    check-connections
+                Checks that no listed process has more connections, not
+                counting listening sockets, than its maximum and exits
+                with status 1 when one has. Each target may carry its own
+                maximum as <exec|pid>=max, the others use -max n:
+                    dcrps check-connections -max 150 dcrd dcrwallet=20
+    agent-info  Dials the agent and dumps the connection details and what it
+                reports about itself, raw: its Go version and, for agents
+                that support it, its info with the PID the process sees
+                itself as. For local processes, compares that PID to the host
+                PID, which differs in another PID namespace (a container).
+    wait-agent  Waits for a process to appear and then for its agent to
+                answer, and exits with status 0 once it does, with 4 when
+                no process appeared, with 3 when the agent never answered
+                and with 5 at once when several processes match. Flags:
+                -timeout d (the whole wait, default 1m), -interval d
+                (polling interval, default 500ms).
+                    dcrps wait-agent dcrd -timeout 60s
+    fds         Prints the open files of the process against its limit,
+                with their count by kind: socket, database (the block
+                database, the wallet and the files of directories named
+                *db), log, file, pipe, device and other (epoll instances
+                and the like), and its memory maps against the
+                vm.max_map_count limit, as the process info does. Exits with
+                status 1 when a limit is used past -fd-warn percent. The
+                kinds and the maps are Linux only. Flags: -list (lists every
+                descriptor with what it refers to), -json.
+                    dcrps fds dcrd -list
+    waitstart   Same as wait-agent, for the scripts that also use stop and
+                restart.
+    stop        Sends SIGTERM to the process, which the Decred processes
+                handle by shutting down cleanly, waits for it to exit and
+                kills it when it hasn't after -timeout d (default 1m), unless
+                -no-kill, which fails instead. On Windows, asks it to close
+                with taskkill. Warns when it runs as a service, whose manager
+                may start it again.
+    restart     Restarts the process with its service manager when it runs
+                as a service, otherwise stops it as stop does and starts its
+                executable again, the upgraded one when it was replaced,
+                with its command line, in its working directory and in the
+                environment of dcrps. Then waits up to -wait d (default 1m)
+                for the new process and, when the old one ran the agent, for
+                its agent to answer, exiting as wait-agent does. Flags:
+                -timeout d and -no-kill as for stop.
+                    dcrps restart dcrd -timeout 2m
+    hup         Sends SIGHUP to the process, for the programs that reopen
+                their logs or reload their config on it. Exits with status 1
+                when the process exits on it instead, as Go programs do
+                unless they handle it.
+    health      Reports whether a dcrd or dcrwallet process works: its
+                runtime stats when it runs the agent, then what its JSON-RPC
+                server answers, the height and sync height and the peer
+                count of dcrd, or the height, the dcrd connection and the
+                unlock state of dcrwallet. The server is found among the
+                listening sockets of the process, on the port of its
+                rpclisten or else on the RPC port of its app, and queried
+                with the credentials and the certificate of its command
+                line and config file. Exits with status 1 when the server
+                doesn't answer. Flags: -rpcserver host:port, -rpccert file
+                and -notls (override what was found), -json.
+                    dcrps health dcrwallet
+
+Commands with <exec|pid|addr> argument:
+    stack       Prints the stack trace. Flags: -dedupe or -dedup (prints
+                each unique stack once with the count of the goroutines
+                sharing it and the range of their waits, largest first,
+                after the count of the goroutines by state).
+    gc          Runs the garbage collector and blocks until successful.
+    setgc	    Sets the garbage collection target percentage.
+    memstats    Prints the allocation and garbage collection stats. With
+                -json, prints a subset of them as a JSON runtime.MemStats,
+                or all of them with -raw-memstats. Stock agents don't
+                report some, which are then zero. Flags: -delta d (reads
+                them twice d apart and prints the change of the counters,
+                total-alloc, mallocs, frees, num-gc and gc-pause-total, with
+                their rates per second over the measured interval).
+                    dcrps memstats dcrd -delta 10s
+    version     Prints the Go version used to build the program.
+    stats       Prints the vital runtime stats. For local processes, also
+                prints the host CPU count and warns when GOMAXPROCS differs.
+    trace       Runs the runtime tracer and launches "go tool trace" once the
+                window elapsed. Flags: -duration d (the window, default 5s,
+                also accepted as a param), -out file (saves the trace to
+                file, kept once go tool trace exits), -no-launch (only
+                saves the trace, e.g. on servers with no browser). Agents
+                that don't support -duration, such as the stock one, trace
+                for 5s, which dcrps warns of.
+                    dcrps trace dcrd -duration 30s
+                    dcrps trace dcrd -duration 1m -out stall.trace -no-launch
+    pprof-heap  Reads the heap profile and launches "go tool pprof".
+    pprof-cpu   Reads the CPU profile and launches "go tool pprof".
+    pprof-mutex Reads the mutex contention profile and launches "go tool
+                pprof". The process must enable it with
+                runtime.SetMutexProfileFraction, or the agent with
+                -fraction n (samples 1 in n contention events for
+                -duration d, default 10s, then restores the fraction).
+    pprof-block Reads the blocking profile and launches "go tool pprof". The
+                process must enable it with runtime.SetBlockProfileRate, or
+                the agent with -rate n (samples a blocking event per n ns
+                blocked, 1 for all, for -duration d, default 10s, then
+                restores the rate). The stock agent serves neither, and
+                only dcrps agents set the rates, which an interrupt during
+                -duration restores too.
+                    dcrps pprof-mutex dcrd -fraction 5 -duration 30s
+    pprof-wall  Samples the stacks of the goroutines -hz n times a second
+                (default 10, at most 100) for -duration d (default 30s) or
+                until interrupted, into a wall-clock profile that tells the
+                time of every goroutine, on the CPU or blocked, such as on
+                I/O, locks or channels, which the CPU profile doesn't, and
+                launches "go tool pprof" on it. The samples carry the state
+                of the goroutines as their "state" tag, e.g. for -tagfocus
+                state=running. Warns when the stack dumps are too slow for
+                the rate. Flags: -out file (keeps the profile), -no-launch.
+                    dcrps pprof-wall dcrwallet -duration 30s -http :8081
+                All the pprof commands accept -http host:port to serve the
+                interactive pprof web UI at that address instead of the
+                command line.
+    pprof-heap-diff
+                Reads the heap profile and prints the allocation sites that
+                grew the most since a baseline profile, such as one of
+                snapshot or profile, with "go tool pprof -base". Flags:
+                -baseline file (required), -save file (writes the fresh
+                profile, e.g. as the next baseline), -n count (default 20),
+                -sample inuse_space|inuse_objects|alloc_space|alloc_objects
+                (default inuse_space).
+                    dcrps pprof-heap-diff dcrwallet -baseline heap.pprof
+    flame       Reads a CPU profile and renders it as an interactive SVG flame
+                graph, with no need for the go tool or Graphviz: clicking a
+                frame zooms on it and hovering shows its time. Flags:
+                -duration d (default 30s; the stock agent profiles for
+                30s), -out file (default flame-<time>.svg without -serve),
+                -serve host:port (serves it over HTTP until interrupted).
+                    dcrps flame dcrd -duration 10s -serve :8080
+    gcwatch     Prints a line per GC cycle until interrupted, with its pause,
+                the heap goal it ran to, the heap once done and the goal of
+                the next cycle, then the count, rate and percentiles of the
+                pauses with their histogram. dcrps agents stream the cycles;
+                the memstats of the others are polled, which tells every
+                pause of the full memstats but only the heap sizes and, from
+                the stock agent, the pause of the last cycle of each poll.
+                Flags: -interval d (polling interval, default 250ms),
+                -duration d (stops after d), -poll (polls even when the
+                agent streams).
+                    dcrps gcwatch dcrwallet -duration 10m
+    appstats    Prints the application stats the process registered with the
+                agent of github.com/dcrlabs/dcrps/agent, such as its peer
+                count, mempool size or sync height, next to the runtime
+                ones of stats. Flags: -json.
+    compare     Snapshots the memstats, the goroutines and the OS threads,
+                then again once a key is typed or after -after d, and prints
+                the change of each with the rates of the counters and the
+                goroutine counts by the function at the top of their stacks
+                that changed, highlighting what grew by more than
+                -threshold percent (default 10). Flags: -json.
+                    dcrps compare dcrd -after 10m
+    commands    Prints the commands the agent supports, as it reports them
+                or, for agents that can't, as inferred from its Go version.
+
+Each round trip to the agent times out by default after 10s for stack,
+memstats, version, stats, setgc, commands, appstats, compare, whose wait
+between its snapshots never does, each sample of pprof-wall and the polls
+of gcwatch, whose stream never does either, the window plus 25s for trace
+and flame, 1m for gc, pprof-heap, pprof-mutex, pprof-block and
+pprof-heap-diff, and 2m for pprof-cpu. Use -timeout to change it.
+
+An addr given as tls://host:port is dialed over TLS, for the agents of remote
+hosts served through a TLS proxy, such as stunnel or ghostunnel, as the agent
+itself only serves plain TCP. The proxy is verified as host, and -cert, -ca
+and -token-file set the credentials:
+
+    dcrps stack tls://vps.example.com:9443 -cert client.pem -ca ca.pem
+
+All commands with a <exec|pid|addr> argument require the agent running on the Go
+process. The symbol "*" next to the process name indicates the process runs the
+agent.
+
+An exec name no process has exactly matches the processes whose name contains
+it, regardless of case, unless -exec-exact: "dcrps stack wallet" reaches
+dcrwallet. When several processes match, or share the name, dcrps lists them
+and asks for one on a terminal, or else fails with status 5 so that one is
+given by PID. The process info of a bare name, stop, restart, hup, core -abort,
+wait-agent, waitstart and check-connections take exact names only. dcrps
+notes on stderr the process a name matched loosely.
+
+Exit status:
+    0  Success.
+    1  The command failed.
+    2  Unknown command or invalid flags.
+    3  The agent is unreachable: the target runs no agent or its host can't be
+       connected to.
+    4  No matching process: the listing is empty or the target is not running.
+    5  The target can't be resolved otherwise, e.g. an exec name several
+       processes share or an invalid address.`
+)
+
+func main() {
+	flag.Usage = func() { usage("") }
+	flag.Parse()
+	defer printBenchmark()
+	cfg, err := loadConfig(configPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config: %v\n", err)
+		exit(exitFailure)
+	}
+	if err := cfg.applyDefaults(); err != nil {
+		fmt.Fprintf(os.Stderr, "config: %v\n", err)
+		exit(exitFailure)
+	}
+	if *groupBy != "" && !containsString(groupKinds, *groupBy) {
+		usage("invalid -group-by value " + *groupBy)
+	}
+	if *sortBy != "" && !containsString(listSortKeys, *sortBy) {
+		usage("invalid -sort key " + *sortBy)
+	}
+	if *retry < 0 {
+		usage("invalid -retry count")
+	}
+	if *themeName != "" && !containsString(themeNames, *themeName) {
+		usage("invalid -theme " + *themeName)
+	}
+	if *jsonOutput && csvOutput() {
+		usage("-o csv can't be used with -json")
+	}
+	structured := *jsonOutput || csvOutput()
+	if (*print0 || *pidOnly) && (structured || *groupBy != "") {
+		usage("-print0 and -pid-only can't be used with -json, -o or -group-by")
+	}
+	if *watchList && (*print0 || *pidOnly || structured) {
+		usage("-watch can't be used with -print0, -pid-only, -json or -o")
+	}
+	if *totals && (*print0 || *pidOnly || structured) {
+		usage("-totals can't be used with -print0, -pid-only, -json or -o")
+	}
+	if *columns != "" {
+		if _, err := parseColumns(*columns); err != nil {
+			usage("invalid -columns: " + err.Error())
+		}
+		if *print0 || *pidOnly || structured {
+			usage("-columns can't be used with -print0, -pid-only, -json or -o")
+		}
+	}
+	if *agentPort < 0 || *agentPort > 65535 {
+		usage("invalid -agent-port " + strconv.Itoa(*agentPort))
+	}
+	if *dialTimeout <= 0 {
+		usage("invalid -connect-timeout " + dialTimeout.String())
+	}
+	if *listInterval <= 0 {
+		usage("invalid -interval " + listInterval.String())
+	}
+	resolver = newResolver()
+
+	args := cfg.expandAlias(flag.Args())
+	var match func(exec string) bool
+	if *execRegex != "" || (len(args) == 1 && isGlob(args[0])) {
+		var glob string
+		switch {
+		case *execRegex == "":
+			glob, args = args[0], nil
+		case len(args) > 0:
+			usage("-regex only applies to the listing")
+		}
+		match, err = execMatcher(glob, *execRegex, *caseFold)
+		if err != nil {
+			usage("invalid pattern: " + err.Error())
+		}
+	}
+	if *sshHost != "" && (*watchList || match != nil) {
+		usage("-ssh can't be used with -watch, -regex or a glob")
+	}
+	if len(args) < 1 {
+		if *sshHost != "" {
+			if err := listRemoteAgents(); err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				exit(exitCode(err))
+			}
+			return
+		}
+		if *watchList {
+			watchProcesses(*listInterval, match)
+			return
+		}
+		processes(match)
+		return
+	}
+	if *watchList {
+		usage("-watch only applies to the listing")
+	}
+
+	cmd := args[0]
+	if _, ok := cmds[cmd]; *sshHost != "" && !ok && cmd != "help" {
+		usage("-ssh only applies to the listing and the agent commands")
+	}
+
+	// See if it is a PID.
+	pid, err := strconv.Atoi(cmd)
+	if err == nil {
+		processInfo(pid)
+		return
+	}
+
+	if cmd == "help" {
+		usage("")
+	}
+
+	if csvOutput() && !csvCommand(cmd) {
+		usage("-o csv only applies to the listing, the process info and the tree")
+	}
+
+	if fn, ok := localCmds[cmd]; ok {
+		if err := fn(args[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			exit(exitCode(err))
+		}
+		return
+	}
+
+	ac, ok := cmds[cmd]
+	if !ok {
+		// Only the exact names, so that a mistyped command isn't taken
+		// for the processes it happens to match.
+		resolver.Fuzzy = false
+		if _, ok := resolver.Lookup(cmd); ok {
+			pid, err := resolver.PID(cmd)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				exit(exitUnresolved)
+			}
+			processInfo(pid)
+			return
+		}
+		usage("unknown subcommand")
+	}
+	if len(args) < 2 {
+		usage("Missing PID or address.")
+	}
+
+	if ps, ok := batchProcesses(args[1]); ok {
+		if toolCommands[cmd] {
+			usage(cmd + " can't run against several processes")
+		}
+		if len(ps) == 0 {
+			fmt.Fprintln(os.Stderr, "no process runs the agent")
+			exit(exitNoProcess)
+		}
+		if code := runBatch(cmd, ac, ps, args[2:]); code != 0 {
+			exit(code)
+		}
+		return
+	}
+
+	target, serverName := splitTLSTarget(cfg.agentAddr(args[1]))
+	if serverName == "" && (*tlsCert != "" || *tlsCA != "" || *tokenFile != "") {
+		usage("-cert, -ca and -token-file only apply to tls:// targets")
+	}
+	if serverName != "" && !strings.Contains(target, ":") {
+		// Never looked up locally.
+		if *agentPort == 0 {
+			usage("tls:// targets need a port, as host:port or with -agent-port")
+		}
+		target = net.JoinHostPort(target, strconv.Itoa(*agentPort))
+	}
+	tlsServerName = serverName
+
+	if *strictAgent {
+		if err := preflightAgent(target); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			exit(exitCode(err))
+		}
+	}
+
+	done := benchPhase("resolution")
+	addr, err := resolveAgent(target)
+	done()
+	if err != nil {
+		code := exitCode(err)
+		if code == exitFailure {
+			code = exitUnresolved
+		}
+		if _, ok := err.(*resolve.AmbiguousError); ok {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			exit(code)
+		}
+		fmt.Fprintf(os.Stderr, "Couldn't resolve addr or pid %v to TCPAddress: %v\n",
+			args[1], err)
+		exit(code)
+	}
+
+	var params []string
+	if len(args) > 2 {
+		params = append(params, args[2:]...)
+	}
+	cmdTimeout = ac.timeout
+	if err := ac.fn(*addr, params); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		exit(exitCode(err))
+	}
+}
+
+// csvCommand reports whether -o csv applies to cmd: the tree, and the
+// process info of the targets naming no command, which the bare names are.
+func csvCommand(cmd string) bool {
+	if cmd == "tree" {
+		return true
+	}
+	_, local := localCmds[cmd]
+	_, agent := cmds[cmd]
+	return !local && !agent
+}
+
+// localCmds are the commands that work from the local process table rather
+// than a single agent address. They receive the arguments after their name.
+var localCmds = map[string]func(args []string) error{
+	"tree":        tree,
+	"selftest":    selftest,
+	"cpu-history": cpuHistory,
+	"threads":     threads,
+	"diagnose":    diagnose,
+	"snapshot":    snapshot,
+	"profile":     profile,
+	"dash":        dash,
+	"conns":       conns,
+	"report":      report,
+	"core":        core,
+
+	"check-connections": checkConnections,
+	"render":            render,
+	"clean-agents":      cleanAgents,
+	"wait-agent":        waitAgent,
+	"waitstart":         waitAgent,
+	"stop":              stopProcess,
+	"restart":           restartProcess,
+	"hup":               hupProcess,
+	"metrics":           metrics,
+	"export":            export,
+	"serve":             serve,
+	"agent-info":        agentInfo,
+	"health":            health,
+	"stale":             listStale,
+	"fds":               fds,
+	"orphans":           orphans,
+
+	"top":            top,
+	"watch-restarts": watchRestarts,
+	"watch":          watch,
+	"record":         record,
+}
+
+// dcrProcesses returns the running Go processes that count as dcr processes,
+// by -prefix, -match and -all, only those connected to the -connected-to
+// range when set. Those whose executable was replaced are listed too.
+func dcrProcesses() []goprocess.P {
+	peers, err := peerFilterNet()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		exit(exitFailure)
+	}
+	return connectedProcesses(peers)
+}
+
+// connectedProcesses returns the dcr processes as dcrProcesses does, only
+// those connected to peers when not nil.
+func connectedProcesses(peers *net.IPNet) []goprocess.P {
+	done := benchPhase("enumeration")
+	dcrPs := dcrps.ListMatching(resolver.Match)
+	if replaced := replacedProcesses(resolver.Match, dcrPs); len(replaced) > 0 {
+		dcrPs = append(dcrPs, replaced...)
+		sort.Slice(dcrPs, func(i, j int) bool { return dcrPs[i].PID < dcrPs[j].PID })
+	}
+	done()
+	if peers != nil {
+		dcrPs = filterConnectedTo(dcrPs, peers)
+	}
+	return dcrPs
+}
+
+// peerFilterNet returns the range of -connected-to, nil when unset.
+func peerFilterNet() (*net.IPNet, error) {
+	if *peerFilter == "" {
+		return nil, nil
+	}
+	ipnet, err := parseIPNet(*peerFilter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -connected-to: %v", err)
+	}
+	return ipnet, nil
+}
+
+// writeProcessList writes the paths of ps, or their PIDs when pidOnly, one
+// per line or, when print0, each followed by a NUL byte, for xargs.
+func writeProcessList(w io.Writer, ps []goprocess.P, pidOnly, print0 bool) {
+	sep := "\n"
+	if print0 {
+		sep = "\x00"
+	}
+	for _, p := range ps {
+		if pidOnly {
+			fmt.Fprint(w, p.PID, sep)
+		} else {
+			fmt.Fprint(w, p.Path, sep)
+		}
+	}
+}
+
+// processes prints the listing of the processes, only those whose exec name
+// matches when match is set.
+func processes(match func(exec string) bool) {
+	dcrPs := dcrProcesses()
+	if match != nil {
+		dcrPs = filterExec(dcrPs, match)
+		if len(dcrPs) == 0 {
+			printEmptyListing()
+			fmt.Fprintln(os.Stderr, "no matching processes")
+			exit(exitNoProcess)
+		}
+	}
+	if len(dcrPs) == 0 {
+		printEmptyListing()
+		exit(exitNoProcess)
+	}
+
+	var uptimes map[int]time.Duration
+	if *sortBy == "uptime" || needsColumn("uptime") {
+		uptimes = processUptimes(dcrPs)
+	}
+	var usage map[int]processUsage
+	if *totals || *sortBy == "cpu" || *sortBy == "mem" || needsColumn("cpu", "mem", "mem%") ||
+		*jsonOutput || csvOutput() {
+		usage = processUsages(dcrPs)
+	}
+	sortProcesses(dcrPs, *sortBy, *reverse, uptimes, usage)
+
+	if *pidOnly || *print0 {
+		writeProcessList(os.Stdout, dcrPs, *pidOnly, *print0)
+		return
+	}
+
+	var nspids map[int]int
+	if *pidNSMap || needsColumn("nspid") {
+		nspids = namespacePIDs(dcrPs)
+	}
+
+	switch {
+	case *jsonOutput:
+		printJSON(listingJSON(dcrPs, nspids, usage))
+		return
+	case csvOutput():
+		printCSV(processCSVHeader, listingCSV(listingJSON(dcrPs, nspids, usage)))
+		return
+	}
+
+	t := &processTable{
+		nspids:  nspids,
+		uptimes: uptimes,
+		usage:   usage,
+		groupBy: *groupBy,
+		totals:  *totals,
+	}
+	t.setColumns()
+	t.readServiceColumns(dcrPs)
+	t.print(os.Stdout, dcrPs)
+}
+
+// printEmptyListing prints the empty JSON or CSV listing, when asked for.
+func printEmptyListing() {
+	switch {
+	case *jsonOutput:
+		printJSON([]processJSON{})
+	case csvOutput():
+		printCSV(processCSVHeader, nil)
+	}
+}
+
+// processTable is the listing table. Its optional columns are shown when
+// their values are set, unless the columns are chosen.
+type processTable struct {
+	nspids  map[int]int           // the PIDs in their own PID namespace
+	uptimes map[int]time.Duration // the uptimes
+	usage   map[int]processUsage  // the CPU and memory usage
+	groupBy string                // the kind of the groups, see -group-by
+
+	// services and stale are only read for the columns chosen with
+	// -columns: the service units and whether the binaries were replaced.
+	services map[int]*serviceInfo
+	stale    map[int]bool
+
+	// totals adds the memory percentage column and a row of the usage
+	// totals under the table, see -totals.
+	totals bool
+
+	// cols are the columns chosen with -columns, in order. The header
+	// row of their names is printed when header is set.
+	cols   []string
+	header bool
+
+	// widths are the least widths of the columns. They only grow as the
+	// table is printed, so that the columns stay put across the frames of
+	// -watch.
+	widths []int
+}
+
+// tableColumns are the columns of the listing table, as -columns names them.
+var tableColumns = []string{
+	"pid", "nspid", "ppid", "exec", "agent", "version",
+	"cpu", "mem", "mem%", "uptime", "unit", "stale", "path",
+}
+
+// parseColumns parses the comma-separated list of columns of -columns.
+func parseColumns(list string) ([]string, error) {
+	var cols []string
+	for _, col := range strings.Split(list, ",") {
+		col = strings.ToLower(strings.TrimSpace(col))
+		if !containsString(tableColumns, col) {
+			return nil, fmt.Errorf("unknown column %q, want a comma-separated list of %s",
+				col, strings.Join(tableColumns, ", "))
+		}
+		cols = append(cols, col)
+	}
+	return cols, nil
+}
+
+// needsColumn reports whether the listing shows one of cols, by default or
+// as chosen with -columns.
+func needsColumn(cols ...string) bool {
+	if *columns == "" {
+		return false
+	}
+	chosen, _ := parseColumns(*columns)
+	for _, col := range cols {
+		if containsString(chosen, col) {
+			return true
+		}
+	}
+	return false
+}
+
+// setColumns sets the columns chosen with -columns, with their header unless
+// -no-header is set.
+func (t *processTable) setColumns() {
+	if *columns == "" {
+		return
+	}
+	t.cols, _ = parseColumns(*columns)
+	t.header = !*noHeader
+}
+
+// readServiceColumns reads the services and the stale binaries of ps when
+// their columns are chosen.
+func (t *processTable) readServiceColumns(ps []goprocess.P) {
+	t.services, t.stale = nil, nil
+	if needsColumn("unit") {
+		t.services = processServices(ps)
+	}
+	if needsColumn("stale") {
+		t.stale = staleBinaries(ps)
+	}
+}
+
+// minWidths are the least widths of the columns whose values change the most
+// across the frames of -watch, fitting "100.0%" and "999.99MB".
+var minWidths = map[string]int{"cpu": 6, "mem": 8, "mem%": 6}
+
+// agentColumn is the column of the agent mark, colored once padded.
+const agentColumn = "agent"
+
+// columns returns the columns of the table, the chosen ones or else those
+// whose values are set, the path last.
+func (t *processTable) columns() []string {
+	if t.cols != nil {
+		return t.cols
+	}
+	cols := []string{"pid"}
+	if t.nspids != nil {
+		cols = append(cols, "nspid")
+	}
+	cols = append(cols, "ppid", "exec", agentColumn, "version")
+	if t.usage != nil {
+		cols = append(cols, "cpu", "mem")
+		if t.totals {
+			cols = append(cols, "mem%")
+		}
+	}
+	if t.uptimes != nil {
+		cols = append(cols, "uptime")
+	}
+	return append(cols, "path")
+}
+
+// cells returns the values of the columns of p, "-" for the unknown ones.
+func (t *processTable) cells(p goprocess.P, cols []string) []string {
+	cells := make([]string, len(cols))
+	for i, col := range cols {
+		v := "-"
+		switch col {
+		case "pid":
+			v = strconv.Itoa(p.PID)
+		case "nspid":
+			if n, ok := t.nspids[p.PID]; ok {
+				v = strconv.Itoa(n)
+			}
+		case "ppid":
+			v = strconv.Itoa(p.PPID)
+		case "exec":
+			v = p.Exec
+		case agentColumn:
+			v = " "
+			if p.Agent {
+				v = "*"
+			}
+		case "version":
+			v = p.BuildVersion
+		case "cpu":
+			if u, ok := t.usage[p.PID]; ok && u.cpuKnown {
+				v = fmt.Sprintf("%.1f%%", u.cpu)
+			}
+		case "mem":
+			if u, ok := t.usage[p.PID]; ok && u.rss > 0 {
+				v = formatBytes(u.rss)
+			}
+		case "mem%":
+			if u, ok := t.usage[p.PID]; ok && u.memKnown {
+				v = fmt.Sprintf("%.1f%%", u.memPercent)
+			}
+		case "uptime":
+			if u, ok := t.uptimes[p.PID]; ok {
+				v = u.Round(time.Second).String()
+			}
+		case "unit":
+			if s, ok := t.services[p.PID]; ok {
+				v = s.Unit
+			}
+		case "stale":
+			if stale, ok := t.stale[p.PID]; ok {
+				v = "no"
+				if stale {
+					v = "yes"
+				}
+			}
+		case "path":
+			v = p.Path
+		}
+		cells[i] = v
+	}
+	return cells
+}
+
+// totalCells returns the values of the totals row: the summed usage of ps
+// under its columns and blanks under the others.
+func (t *processTable) totalCells(ps []goprocess.P, cols []string) []string {
+	var cpu, memPercent float64
+	var rss uint64
+	for _, p := range ps {
+		u := t.usage[p.PID]
+		cpu += u.cpu
+		rss += u.rss
+		memPercent += u.memPercent
+	}
+	cells := make([]string, len(cols))
+	for i, col := range cols {
+		switch col {
+		case "cpu":
+			cells[i] = fmt.Sprintf("%.1f%%", cpu)
+		case "mem":
+			cells[i] = formatBytes(rss)
+		case "mem%":
+			cells[i] = fmt.Sprintf("%.1f%%", memPercent)
+		}
+	}
+	return cells
+}
+
+// print prints ps as the table to w, right-aligning the columns but the
+// path, grouped by the groupBy kind when set and followed by the totals when
+// set.
+func (t *processTable) print(w io.Writer, ps []goprocess.P) {
+	cols := t.columns()
+	if len(t.widths) != len(cols) {
+		t.widths = make([]int, len(cols))
+		for i, col := range cols {
+			t.widths[i] = minWidths[col]
+		}
+	}
+	grow := func(cells []string) {
+		for i, c := range cells {
+			if len(c) > t.widths[i] {
+				t.widths[i] = len(c)
+			}
+		}
+	}
+	var header []string
+	if t.header {
+		header = make([]string, len(cols))
+		for i, col := range cols {
+			header[i] = strings.ToUpper(col)
+		}
+		grow(header)
+	}
+	// The widths are computed over all the processes so that the groups
+	// line up with each other.
+	rows := make(map[int][]string, len(ps))
+	for _, p := range ps {
+		rows[p.PID] = t.cells(p, cols)
+		grow(rows[p.PID])
+	}
+	var totals []string
+	if t.totals {
+		totals = t.totalCells(ps, cols)
+		grow(totals)
+	}
+
+	writeRow := func(cells []string, agent bool, tail string) {
+		var b strings.Builder
+		for i, c := range cells {
+			pad := strings.Repeat(" ", t.widths[i]-len(c))
+			if cols[i] == agentColumn && agent {
+				c = agentMark(c)
+			}
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			if cols[i] == "path" {
+				b.WriteString(c + pad)
+			} else {
+				b.WriteString(pad + c)
+			}
+		}
+		if tail != "" {
+			b.WriteString(" " + tail)
+		}
+		fmt.Fprintln(w, strings.TrimRight(b.String(), " "))
+	}
+	printRow := func(p goprocess.P) {
+		writeRow(rows[p.PID], p.Agent, "")
+	}
+
+	if header != nil {
+		writeRow(header, false, "")
+	}
+	if t.groupBy == "" {
+		for _, p := range ps {
+			printRow(p)
+		}
+	} else {
+		keys, groups := groupProcesses(ps, t.groupBy)
+		for i, key := range keys {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "%s (%d)\n", key, len(groups[key]))
+			for _, p := range groups[key] {
+				printRow(p)
+			}
+		}
+	}
+
+	if totals == nil {
+		return
+	}
+	separator := make([]string, len(cols))
+	for i, c := range totals {
+		if c != "" {
+			separator[i] = strings.Repeat("-", t.widths[i])
+		}
+	}
+	writeRow(separator, false, "")
+	label := fmt.Sprintf("total of %d processes", len(ps))
+	if i := len(cols) - 1; cols[i] == "path" {
+		// Under the paths, which are left-aligned.
+		totals[i], label = label, ""
+		if len(totals[i]) > t.widths[i] {
+			t.widths[i] = len(totals[i])
+		}
+	}
+	writeRow(totals, false, label)
+}
+
+// processInfo prints the info of the process with the given PID. It exits
+// with exitNoProcess when there is none.
+func processInfo(pid int) {
+	if *jsonOutput || csvOutput() {
+		info, err := newProcessInfoJSON(pid)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot read process info: %v\n", err)
+			exit(exitNoProcess)
+		}
+		if csvOutput() {
+			printCSV(processInfoCSVHeader, [][]string{info.csvRecord(pid)})
+			return
+		}
+		printJSON(info)
+		return
+	}
+	if err := writeProcessInfo(os.Stdout, pid, true); err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot read process info: %v\n", err)
+		exit(exitNoProcess)
+	}
+}
+
+// processInfoJSON is the process info printed with -json. The fields that
+// can't be read are null.
+type processInfoJSON struct {
+	Parent        *int32   `json:"parent"`
+	Threads       *int32   `json:"threads"`
+	MemoryPercent *float32 `json:"memoryPercent"`
+	CPUPercent    *float64 `json:"cpuPercent"`
+	Username      *string  `json:"username"`
+	Cmdline       *string  `json:"cmdline"`
+	OpenFiles     *int32   `json:"openFiles"`
+	// OpenFilesLimit is the RLIMIT_NOFILE of the process, Linux only.
+	OpenFilesLimit *openFilesLimitJSON `json:"openFilesLimit"`
+	// OpenFilesByKind counts the open files by kind, socket, database,
+	// log, file, pipe, device or other, and MemoryMaps the memory mapped
+	// regions, Linux only.
+	OpenFilesByKind map[string]int  `json:"openFilesByKind"`
+	MemoryMaps      *memoryMapsJSON `json:"memoryMaps"`
+	// ResourceWarnings tell the limits used past -fd-warn percent.
+	ResourceWarnings []string         `json:"resourceWarnings"`
+	Connections      []connectionJSON `json:"connections"`
+	ConnectionStates map[string]int   `json:"connectionStates"`
+	// Service is the service the process runs as, null for the others.
+	Service *serviceInfo `json:"service"`
+	// StaleBinary is set when the executable was replaced on disk since
+	// the process started.
+	StaleBinary *bool `json:"staleBinary"`
+}
+
+// processInfoCSVHeader is the header of the CSV process info, naming the
+// fields as its JSON does. The connections are only counted, by state in
+// connectionStates as "state=count" pairs separated by spaces, as the open
+// files are by kind in openFilesByKind, and memoryMaps counts the regions.
+var processInfoCSVHeader = []string{
+	"pid", "parent", "threads", "memoryPercent", "cpuPercent", "username",
+	"cmdline", "openFiles", "openFilesSoftLimit", "openFilesHardLimit",
+	"connections", "connectionStates", "service", "serviceRestarts",
+	"staleBinary", "openFilesByKind", "memoryMaps",
+}
+
+// csvRecord returns the record of the CSV process info of the process with
+// the given PID. The fields that can't be read are empty.
+func (info *processInfoJSON) csvRecord(pid int) []string {
+	var soft, hard *int64
+	if l := info.OpenFilesLimit; l != nil {
+		soft, hard = &l.Soft, &l.Hard
+	}
+	var service string
+	var restarts *int
+	if info.Service != nil {
+		service, restarts = info.Service.Unit, info.Service.Restarts
+	}
+	var maps *int
+	if info.MemoryMaps != nil {
+		maps = &info.MemoryMaps.Regions
+	}
+	var conns, states string
+	if info.Connections != nil {
+		conns = strconv.Itoa(len(info.Connections))
+		names := make([]string, 0, len(info.ConnectionStates))
+		for state := range info.ConnectionStates {
+			names = append(names, state)
+		}
+		sort.Strings(names)
+		for i, state := range names {
+			names[i] = fmt.Sprintf("%s=%d", state, info.ConnectionStates[state])
+		}
+		states = strings.Join(names, " ")
+	}
+	return []string{
+		strconv.Itoa(pid), csvValue(info.Parent), csvValue(info.Threads),
+		csvValue(info.MemoryPercent), csvValue(info.CPUPercent),
+		csvValue(info.Username), csvValue(info.Cmdline),
+		csvValue(info.OpenFiles), csvValue(soft), csvValue(hard),
+		conns, states, service, csvValue(restarts), csvValue(info.StaleBinary),
+		formatFDKindsCSV(info.OpenFilesByKind), csvValue(maps),
+	}
+}
+
+// openFilesLimitJSON is the open files limit of the process info printed with
+// -json. Unlimited is -1.
+type openFilesLimitJSON struct {
+	Soft int64 `json:"soft"`
+	Hard int64 `json:"hard"`
+}
+
+// openFilesLimit returns the soft and hard limits of the open files of p, -1
+// when unlimited, as read from /proc/<pid>/limits on Linux.
+func openFilesLimit(p *process.Process) (soft, hard int64, ok bool) {
+	limits, err := p.Rlimit()
+	if err != nil {
+		return 0, 0, false
+	}
+	value := func(v int32) int64 {
+		if v == math.MaxInt32 {
+			return -1
+		}
+		return int64(v)
+	}
+	for _, l := range limits {
+		if l.Resource == process.RLIMIT_NOFILE {
+			return value(l.Soft), value(l.Hard), true
+		}
+	}
+	return 0, 0, false
+}
+
+// formatLimit formats a limit, -1 as unlimited.
+func formatLimit(v int64) string {
+	if v < 0 {
+		return "unlimited"
+	}
+	return strconv.FormatInt(v, 10)
+}
+
+// connectionJSON is a connection of the process info printed with -json, with
+// what it serves by the Decred ports and whether it's inbound or outbound.
+type connectionJSON struct {
+	Local     string `json:"local"`
+	Remote    string `json:"remote"`
+	Status    string `json:"status"`
+	Class     string `json:"class"`
+	Network   string `json:"network,omitempty"`
+	Direction string `json:"direction,omitempty"`
+}
+
+func newProcessInfoJSON(pid int) (*processInfoJSON, error) {
+	p, err := process.NewProcess(int32(pid))
+	if err != nil {
+		return nil, err
+	}
+	var info processInfoJSON
+	if v, err := p.Parent(); err == nil {
+		info.Parent = &v.Pid
+	}
+	if v, err := p.NumThreads(); err == nil {
+		info.Threads = &v
+	}
+	u := readUsage(p)
+	if u.memKnown {
+		v := float32(u.memPercent)
+		info.MemoryPercent = &v
+	}
+	if u.cpuKnown {
+		info.CPUPercent = &u.cpu
+	}
+	if v, err := p.Username(); err == nil {
+		info.Username = &v
+	}
+	if v, err := p.Cmdline(); err == nil {
+		info.Cmdline = &v
+	}
+	fds := readFDReport(p, false)
+	info.OpenFiles, info.OpenFilesLimit = fds.Open, fds.Limit
+	info.OpenFilesByKind, info.MemoryMaps = fds.ByKind, fds.Maps
+	info.ResourceWarnings = fds.Warnings
+	if s, ok := findServices([]int{pid})[pid]; ok {
+		s.readDetails(pid)
+		info.Service = s
+	}
+	if v, _, err := staleBinary(pid); err == nil {
+		info.StaleBinary = &v
+	}
+	if v, err := p.Connections(); err == nil {
+		info.ConnectionStates = make(map[string]int)
+		for _, sc := range connectionStates(v) {
+			info.ConnectionStates[sc.State] = sc.Count
+		}
+		info.Connections = make([]connectionJSON, 0, len(v))
+		for _, c := range classifyConnections(v) {
+			info.Connections = append(info.Connections, newConnectionJSON(c))
+		}
+	}
+	return &info, nil
+}
+
+// writeProcessInfo writes the info of the process with the given PID to w,
+// with all its connections when listConns is set.
+func writeProcessInfo(w io.Writer, pid int, listConns bool) error {
+	defer benchPhase("process collection")()
+	p, err := process.NewProcess(int32(pid))
+	if err != nil {
+		return err
+	}
+	if v, err := p.Parent(); err == nil {
+		fmt.Fprintf(w, "parent PID:\t%v\n", v.Pid)
+	}
+	if v, err := p.NumThreads(); err == nil {
+		fmt.Fprintf(w, "threads:\t%v\n", v)
+	}
+	u := readUsage(p)
+	if u.memKnown {
+		fmt.Fprintf(w, "memory usage:\t%.3f%%\n", u.memPercent)
+	}
+	if u.cpuKnown {
+		fmt.Fprintf(w, "cpu usage:\t%.3f%%\n", u.cpu)
+	}
+	if v, err := p.Username(); err == nil {
+		fmt.Fprintf(w, "username:\t%v\n", v)
+	}
+	if v, err := p.Cmdline(); err == nil {
+		fmt.Fprintf(w, "cmd+args:\t%v\n", v)
+	}
+	writeFDReport(w, readFDReport(p, false))
+	if s, ok := findServices([]int{pid})[pid]; ok {
+		s.readDetails(pid)
+		fmt.Fprintf(w, "service:\t%s\n", formatService(s))
+	}
+	if stale, path, err := staleBinary(pid); err == nil && stale {
+		fmt.Fprintf(w, "binary:\t%s was replaced on disk since the process started, restart it\n", path)
+	}
+	if !listConns {
+		return nil
+	}
+	if v, err := p.Connections(); err == nil {
+		states := connectionStates(v)
+		counts := make([]string, len(states))
+		for i, sc := range states {
+			counts[i] = fmt.Sprintf("%s %d", strings.ToLower(sc.State), sc.Count)
+		}
+		fmt.Fprintf(w, "connections:\t%d", len(v))
+		if len(counts) > 0 {
+			fmt.Fprintf(w, " (%s)", strings.Join(counts, ", "))
+		}
+		fmt.Fprintln(w)
+		for _, c := range classifyConnections(v) {
+			fmt.Fprintf(w, "local/remote:\t%v:%v <-> %v:%v (%v, %s)\n",
+				c.Laddr.IP, c.Laddr.Port, c.Raddr.IP, c.Raddr.Port, c.Status, connClassList(c))
+		}
+	}
+	return nil
+}
+
+// exit prints the -benchmark breakdown and exits with code.
+func exit(code int) {
+	printBenchmark()
+	os.Exit(code)
+}
+
+func usage(msg string) {
+	if msg != "" {
+		fmt.Printf("dcrps: %v\n", msg)
+	}
+	fmt.Fprintf(os.Stderr, "%v\n", helpText)
+	exit(exitUsage)
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dcrlabs/dcrps/pkg/dcrps"
+	"github.com/dcrlabs/dcrps/resolve"
+	"github.com/google/gops/goprocess"
+)
+
+func TestProcessInfoJSON(t *testing.T) {
+	info, err := newProcessInfoJSON(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Parent == nil || int(*info.Parent) != os.Getppid() {
+		t.Errorf("parent: got %v want %d", info.Parent, os.Getppid())
+	}
+	if runtime.GOOS == "linux" {
+		if info.OpenFiles == nil || *info.OpenFiles < 3 {
+			t.Errorf("open files: got %v, want at least the standard streams", info.OpenFiles)
+		}
+		if l := info.OpenFilesLimit; l == nil || l.Soft == 0 {
+			t.Errorf("open files limit: got %+v", l)
+		}
+	}
+	b, err := json.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"parent", "threads", "memoryPercent", "cpuPercent", "username", "cmdline",
+		"openFiles", "openFilesLimit", "connections", "connectionStates"} {
+		if !strings.Contains(string(b), `"`+key+`":`) {
+			t.Errorf("missing %s in %s", key, b)
+		}
+	}
+}
+
+func TestProcessTableWidths(t *testing.T) {
+	ps := []goprocess.P{
+		{PID: 100, PPID: 1, Exec: "dcrwallet", BuildVersion: "go1.12", Path: "/bin/dcrwallet", Agent: true},
+		{PID: 12345, PPID: 100, Exec: "dcrd", BuildVersion: "go1.12", Path: "/bin/dcrd"},
+	}
+	table := &processTable{usage: map[int]processUsage{
+		100: {rss: 1 << 20},
+	}}
+	var b bytes.Buffer
+	table.print(&b, ps)
+	want := "  100   1 dcrwallet * go1.12      -   1.00MB /bin/dcrwallet\n" +
+		"12345 100      dcrd   go1.12      -        - /bin/dcrd\n"
+	if got := b.String(); got != want {
+		t.Errorf("first frame:\n%swant:\n%s", got, want)
+	}
+
+	// The wide process exited and a CPU usage is known: the columns stay.
+	table.usage = map[int]processUsage{100: {cpu: 7.5, cpuKnown: true, rss: 1 << 20}}
+	b.Reset()
+	table.print(&b, ps[:1])
+	want = "  100   1 dcrwallet * go1.12   7.5%   1.00MB /bin/dcrwallet\n"
+	if got := b.String(); got != want {
+		t.Errorf("second frame:\n%swant:\n%s", got, want)
+	}
+}
+
+func TestProcessTableTotals(t *testing.T) {
+	ps := []goprocess.P{
+		{PID: 100, PPID: 1, Exec: "dcrd", BuildVersion: "go1.12", Path: "/bin/dcrd"},
+		{PID: 101, PPID: 100, Exec: "dcrctl", BuildVersion: "go1.12", Path: "/bin/dcrctl"},
+		// Exited before its usage was read.
+		{PID: 102, PPID: 100, Exec: "dcrctl", BuildVersion: "go1.12", Path: "/bin/dcrctl"},
+	}
+	table := &processTable{totals: true, usage: map[int]processUsage{
+		100: {cpu: 12.5, cpuKnown: true, rss: 3 << 20, memPercent: 2.5, memKnown: true},
+		101: {cpu: 0.25, cpuKnown: true, rss: 1 << 20, memPercent: 0.5, memKnown: true},
+	}}
+	var b bytes.Buffer
+	table.print(&b, ps)
+	want := "100   1   dcrd   go1.12  12.5%   3.00MB   2.5% /bin/dcrd\n" +
+		"101 100 dcrctl   go1.12   0.2%   1.00MB   0.5% /bin/dcrctl\n" +
+		"102 100 dcrctl   go1.12      -        -      - /bin/dcrctl\n" +
+		"                        ------ -------- ------\n" +
+		"                         12.8%   4.00MB   3.0% total of 3 processes\n"
+	if got := b.String(); got != want {
+		t.Errorf("totals:\n%swant:\n%s", got, want)
+	}
+}
+
+func TestProcessTableColumns(t *testing.T) {
+	ps := []goprocess.P{
+		{PID: 100, PPID: 1, Exec: "dcrd", BuildVersion: "go1.12", Path: "/bin/dcrd"},
+		{PID: 10100, PPID: 100, Exec: "dcrctl", BuildVersion: "go1.12", Path: "/bin/dcrctl"},
+	}
+	cols, err := parseColumns("path, exec,pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		header bool
+		want   string
+	}{
+		{true, "PATH          EXEC   PID\n" +
+			"/bin/dcrd     dcrd   100\n" +
+			"/bin/dcrctl dcrctl 10100\n"},
+		{false, "/bin/dcrd     dcrd   100\n" +
+			"/bin/dcrctl dcrctl 10100\n"},
+	}
+	for _, test := range tests {
+		var b bytes.Buffer
+		(&processTable{cols: cols, header: test.header}).print(&b, ps)
+		if got := b.String(); got != test.want {
+			t.Errorf("header=%v:\n%swant:\n%s", test.header, got, test.want)
+		}
+	}
+
+	if _, err := parseColumns("pid,name"); err == nil {
+		t.Error("unknown column: no error")
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{&resolve.NoProcessError{Target: "dcrd"}, exitNoProcess},
+		{&resolve.NoAgentError{PID: 10, Err: os.ErrNotExist}, exitAgentUnreachable},
+		{&dcrps.DialError{Err: os.ErrNotExist}, exitAgentUnreachable},
+		{&resolve.AmbiguousError{Name: "dcrd"}, exitUnresolved},
+		{os.ErrNotExist, exitFailure},
+	}
+	for _, test := range tests {
+		if got := exitCode(test.err); got != test.want {
+			t.Errorf("exitCode(%T): got=%v want=%v", test.err, got, test.want)
+		}
+	}
+}
+
+func TestCSVCommand(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		want bool
+	}{
+		{"tree", true},
+		{"dcrd", true}, // the process info of a bare name
+		{"stack", false},
+		{"fds", false},
+		{"top", false},
+	}
+	for _, test := range tests {
+		if got := csvCommand(test.cmd); got != test.want {
+			t.Errorf("csvCommand(%s): got=%v want=%v", test.cmd, got, test.want)
+		}
+	}
+}
+
+func TestWriteProcessList(t *testing.T) {
+	ps := []goprocess.P{
+		{PID: 100, Exec: "dcrd", Path: "/opt/decred/dcrd"},
+		{PID: 101, Exec: "dcrwallet", Path: "/opt/my wallet/dcrwallet"},
+	}
+	tests := []struct {
+		pidOnly, print0 bool
+		want            string
+	}{
+		{true, false, "100\n101\n"},
+		{true, true, "100\x00101\x00"},
+		{false, true, "/opt/decred/dcrd\x00/opt/my wallet/dcrwallet\x00"},
+	}
+	for _, test := range tests {
+		var b bytes.Buffer
+		writeProcessList(&b, ps, test.pidOnly, test.print0)
+		if got := b.String(); got != test.want {
+			t.Errorf("writeProcessList, pidOnly %v print0 %v: got %q, want %q",
+				test.pidOnly, test.print0, got, test.want)
+		}
+	}
+}
+
+func TestProcessTableUptime(t *testing.T) {
+	ps := []goprocess.P{
+		{PID: 100, PPID: 1, Exec: "dcrd", BuildVersion: "go1.12", Path: "/bin/dcrd"},
+		// Its start time couldn't be read.
+		{PID: 101, PPID: 100, Exec: "dcrctl", BuildVersion: "go1.12", Path: "/bin/dcrctl"},
+	}
+	table := &processTable{uptimes: map[int]time.Duration{100: 26*time.Hour + 1500*time.Millisecond}}
+	var b bytes.Buffer
+	table.print(&b, ps)
+	want := "100   1   dcrd   go1.12 26h0m2s /bin/dcrd\n" +
+		"101 100 dcrctl   go1.12       - /bin/dcrctl\n"
+	if got := b.String(); got != want {
+		t.Errorf("uptime:\n%swant:\n%s", got, want)
+	}
+}
+
+func TestProcessUptimes(t *testing.T) {
+	// No process has the PID 0 to read the start time of.
+	uptimes := processUptimes([]goprocess.P{{PID: os.Getpid()}, {PID: 0}})
+	if u, ok := uptimes[os.Getpid()]; !ok || u < 0 || u > time.Hour {
+		t.Errorf("uptime of the test: got=%v,%v", u, ok)
+	}
+	if _, ok := uptimes[0]; ok {
+		t.Error("uptime of PID 0: got one")
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"runtime"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/gops/signal"
+)
+
+// memStatsSummary is the curated subset of runtime.MemStats printed by
+// memstats -json, with the same field names.
+type memStatsSummary struct {
+	Alloc        uint64
+	TotalAlloc   uint64
+	Sys          uint64
+	HeapAlloc    uint64
+	HeapInuse    uint64
+	HeapObjects  uint64
+	NextGC       uint64
+	LastGC       uint64
+	PauseTotalNs uint64
+	NumGC        uint32
+}
+
+func newMemStatsSummary(s *runtime.MemStats) memStatsSummary {
+	return memStatsSummary{
+		Alloc:        s.Alloc,
+		TotalAlloc:   s.TotalAlloc,
+		Sys:          s.Sys,
+		HeapAlloc:    s.HeapAlloc,
+		HeapInuse:    s.HeapInuse,
+		HeapObjects:  s.HeapObjects,
+		NextGC:       s.NextGC,
+		LastGC:       s.LastGC,
+		PauseTotalNs: s.PauseTotalNs,
+		NumGC:        s.NumGC,
+	}
+}
+
+// readMemStats reads the full memstats of the agent at addr, from the JSON
+// of dcrps agents or else from the text of the stock agent, in which case
+// full is false.
+func readMemStats(addr net.TCPAddr) (s *runtime.MemStats, full bool, err error) {
+	s, full, err = agentClient().MemStats(addr)
+	return s, full, agentError(err)
+}
+
+// memStatsDelta is the change of the cumulative memstats over an interval,
+// printed by memstats -delta.
+type memStatsDelta struct {
+	Interval        time.Duration `json:"intervalNs"` // the measured wall clock
+	TotalAlloc      uint64        `json:"totalAlloc"`
+	Mallocs         uint64        `json:"mallocs"`
+	Frees           uint64        `json:"frees"`
+	NumGC           uint32        `json:"numGC"`
+	PauseTotalNs    uint64        `json:"pauseTotalNs"`
+	HeapAllocBefore uint64        `json:"heapAllocBefore"`
+	HeapAllocAfter  uint64        `json:"heapAllocAfter"`
+}
+
+// newMemStatsDelta returns the change from the memstats before to after,
+// read interval apart. The cumulative counters going back means the process
+// restarted in between.
+func newMemStatsDelta(before, after *runtime.MemStats, interval time.Duration) (*memStatsDelta, error) {
+	if after.TotalAlloc < before.TotalAlloc || after.Mallocs < before.Mallocs ||
+		after.Frees < before.Frees || after.NumGC < before.NumGC ||
+		after.PauseTotalNs < before.PauseTotalNs {
+		return nil, errors.New("the memstats counters went back, the process may have restarted")
+	}
+	return &memStatsDelta{
+		Interval:        interval,
+		TotalAlloc:      after.TotalAlloc - before.TotalAlloc,
+		Mallocs:         after.Mallocs - before.Mallocs,
+		Frees:           after.Frees - before.Frees,
+		NumGC:           after.NumGC - before.NumGC,
+		PauseTotalNs:    after.PauseTotalNs - before.PauseTotalNs,
+		HeapAllocBefore: before.HeapAlloc,
+		HeapAllocAfter:  after.HeapAlloc,
+	}, nil
+}
+
+// write writes the delta with the per-second rates to w, labeled with the
+// measured interval and the requested one.
+func (d *memStatsDelta) write(w io.Writer, requested time.Duration) {
+	secs := d.Interval.Seconds()
+	rate := func(n uint64) float64 { return float64(n) / secs }
+	pause := time.Duration(d.PauseTotalNs)
+	fmt.Fprintf(w, "memstats delta over %v (requested %v):\n",
+		d.Interval.Round(time.Millisecond), requested)
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	fmt.Fprintf(tw, "total-alloc:\t+%s\t(%s/s)\n", formatBytes(d.TotalAlloc), formatBytes(uint64(rate(d.TotalAlloc))))
+	fmt.Fprintf(tw, "mallocs:\t+%d\t(%.1f/s)\n", d.Mallocs, rate(d.Mallocs))
+	fmt.Fprintf(tw, "frees:\t+%d\t(%.1f/s)\n", d.Frees, rate(d.Frees))
+	fmt.Fprintf(tw, "num-gc:\t+%d\t(%.2f/s)\n", d.NumGC, rate(uint64(d.NumGC)))
+	fmt.Fprintf(tw, "gc-pause-total:\t+%v\t(%.3f%% of the interval)\n",
+		pause, 100*pause.Seconds()/secs)
+	fmt.Fprintf(tw, "heap-alloc:\t%s -> %s\n", formatBytes(d.HeapAllocBefore), formatBytes(d.HeapAllocAfter))
+	tw.Flush()
+}
+
+// memStatsDeltaJSON is the delta printed by memstats -delta -json, with the
+// per-second rates.
+type memStatsDeltaJSON struct {
+	*memStatsDelta
+	TotalAllocPerSec float64 `json:"totalAllocPerSec"`
+	MallocsPerSec    float64 `json:"mallocsPerSec"`
+	FreesPerSec      float64 `json:"freesPerSec"`
+	NumGCPerSec      float64 `json:"numGCPerSec"`
+}
+
+// sampleMemStatsDelta reads the memstats of the agent at addr twice, interval
+// apart, and returns their delta over the wall clock time between the reads.
+func sampleMemStatsDelta(addr net.TCPAddr, interval time.Duration) (*memStatsDelta, error) {
+	before, _, err := readMemStats(addr)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	time.Sleep(interval)
+	after, _, err := readMemStats(addr)
+	if err != nil {
+		return nil, err
+	}
+	return newMemStatsDelta(before, after, time.Since(start))
+}
+
+func memStats(addr net.TCPAddr, params []string) error {
+	fs := flag.NewFlagSet("memstats", flag.ExitOnError)
+	raw := fs.Bool("raw-memstats", false, "print the complete runtime.MemStats with -json")
+	delta := fs.Duration("delta", 0, "print the change of the counters over this interval")
+	parseCommandFlags(fs, params)
+	if *delta < 0 || (*delta > 0 && *raw) {
+		return errors.New("-delta must be positive and excludes -raw-memstats")
+	}
+	if *delta > 0 {
+		d, err := sampleMemStatsDelta(addr, *delta)
+		if err != nil {
+			return err
+		}
+		if *jsonOutput {
+			secs := d.Interval.Seconds()
+			printJSON(memStatsDeltaJSON{
+				memStatsDelta:    d,
+				TotalAllocPerSec: float64(d.TotalAlloc) / secs,
+				MallocsPerSec:    float64(d.Mallocs) / secs,
+				FreesPerSec:      float64(d.Frees) / secs,
+				NumGCPerSec:      float64(d.NumGC) / secs,
+			})
+			return nil
+		}
+		fmt.Println(addr)
+		d.write(os.Stdout, *delta)
+		return nil
+	}
+	if !*jsonOutput {
+		return cmdWithPrint(addr, signal.MemStats)
+	}
+
+	s, full, err := readMemStats(addr)
+	if err != nil {
+		return err
+	}
+	if !*raw {
+		printJSON(newMemStatsSummary(s))
+		return nil
+	}
+	if !full {
+		fmt.Fprintln(os.Stderr, "warning: the agent doesn't report the complete "+
+			"memstats; the fields missing from its text output are zero")
+	}
+	printJSON(s)
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestMemStatsDelta(t *testing.T) {
+	before := &runtime.MemStats{TotalAlloc: 1 << 20, Mallocs: 100, Frees: 50,
+		NumGC: 3, PauseTotalNs: 1e6, HeapAlloc: 1 << 20}
+	after := &runtime.MemStats{TotalAlloc: 5 << 20, Mallocs: 300, Frees: 250,
+		NumGC: 5, PauseTotalNs: 3e6, HeapAlloc: 2 << 20}
+	d, err := newMemStatsDelta(before, after, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	d.write(&b, 2*time.Second)
+	want := `memstats delta over 2s (requested 2s):
+total-alloc:    +4.00MB (2.00MB/s)
+mallocs:        +200    (100.0/s)
+frees:          +200    (100.0/s)
+num-gc:         +2      (1.00/s)
+gc-pause-total: +2ms    (0.100% of the interval)
+heap-alloc:     1.00MB -> 2.00MB
+`
+	if got := b.String(); got != want {
+		t.Errorf("delta:\n%swant:\n%s", got, want)
+	}
+
+	// A restart in between.
+	if _, err := newMemStatsDelta(after, before, time.Second); err == nil {
+		t.Error("expected an error when the counters go back")
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dcrlabs/dcrps/pkg/dcrps"
+	"github.com/google/gops/goprocess"
+	"github.com/google/gops/signal"
+	"github.com/shirou/gopsutil/process"
+)
+
+// metricFamily is a metric of the Prometheus text format with its value for
+// each process that reports it.
+type metricFamily struct {
+	name, typ, help string
+	read            func(p goprocess.P, pr *process.Process) (float64, bool)
+}
+
+// metricFamilies are the per-process metrics, each read from a process.
+var metricFamilies = []metricFamily{
+	{"dcrps_process_cpu_seconds_total", "counter", "User and system CPU time spent in seconds.",
+		func(_ goprocess.P, pr *process.Process) (float64, bool) {
+			t, err := pr.Times()
+			if err != nil {
+				return 0, false
+			}
+			return t.User + t.System, true
+		}},
+	{"dcrps_process_resident_memory_bytes", "gauge", "Resident memory size in bytes.",
+		func(_ goprocess.P, pr *process.Process) (float64, bool) {
+			m, err := pr.MemoryInfo()
+			if err != nil {
+				return 0, false
+			}
+			return float64(m.RSS), true
+		}},
+	{"dcrps_process_threads", "gauge", "Number of OS threads.",
+		func(_ goprocess.P, pr *process.Process) (float64, bool) {
+			n, err := pr.NumThreads()
+			return float64(n), err == nil
+		}},
+	{"dcrps_process_open_fds", "gauge", "Number of open file descriptors.",
+		func(_ goprocess.P, pr *process.Process) (float64, bool) {
+			n, err := pr.NumFDs()
+			return float64(n), err == nil
+		}},
+	{"dcrps_process_connections", "gauge", "Number of connections, not counting listening sockets.",
+		func(_ goprocess.P, pr *process.Process) (float64, bool) {
+			conns, err := pr.Connections()
+			if err != nil {
+				return 0, false
+			}
+			var n int
+			for _, c := range conns {
+				if c.Status != "LISTEN" {
+					n++
+				}
+			}
+			return float64(n), true
+		}},
+	{"dcrps_process_start_time_seconds", "gauge", "Start time of the process since the Unix epoch in seconds.",
+		func(_ goprocess.P, pr *process.Process) (float64, bool) {
+			ms, err := pr.CreateTime()
+			return float64(ms) / 1000, err == nil
+		}},
+	{"dcrps_process_goroutines", "gauge", "Number of goroutines, as reported by the agent.",
+		func(p goprocess.P, _ *process.Process) (float64, bool) {
+			if !p.Agent {
+				return 0, false
+			}
+			addr, err := resolver.Resolve(strconv.Itoa(p.PID))
+			if err != nil {
+				return 0, false
+			}
+			out, err := cmd(*addr, signal.Stats)
+			if err != nil {
+				return 0, false
+			}
+			n, ok := intValue(dcrps.ParseKeyValues(out), "goroutines")
+			return float64(n), ok
+		}},
+}
+
+// escapeLabel escapes a label value of the Prometheus text format.
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// processLabels returns the labels identifying p, with its Go version.
+func processLabels(p goprocess.P) string {
+	return fmt.Sprintf(`pid="%d",exec="%s",version="%s"`,
+		p.PID, escapeLabel(p.Exec), escapeLabel(p.BuildVersion))
+}
+
+// writeMetrics writes the metrics of ps to w in the Prometheus text format,
+// with the time they were collected at.
+func writeMetrics(w io.Writer, ps []goprocess.P, now time.Time) {
+	procs := make([]*process.Process, len(ps))
+	for i, p := range ps {
+		procs[i], _ = process.NewProcess(int32(p.PID))
+	}
+
+	fmt.Fprintln(w, "# HELP dcrps_process_info Information about the dcr process.")
+	fmt.Fprintln(w, "# TYPE dcrps_process_info gauge")
+	for _, p := range ps {
+		fmt.Fprintf(w, "dcrps_process_info{%s,agent=\"%t\"} 1\n", processLabels(p), p.Agent)
+	}
+	for _, m := range metricFamilies {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ)
+		for i, p := range ps {
+			if procs[i] == nil {
+				continue
+			}
+			if v, ok := m.read(p, procs[i]); ok {
+				fmt.Fprintf(w, "%s{%s} %v\n", m.name, processLabels(p), v)
+			}
+		}
+	}
+	fmt.Fprintln(w, "# HELP dcrps_metrics_timestamp_seconds Time the metrics were collected at since the Unix epoch in seconds.")
+	fmt.Fprintln(w, "# TYPE dcrps_metrics_timestamp_seconds gauge")
+	fmt.Fprintf(w, "dcrps_metrics_timestamp_seconds %v\n", float64(now.UnixNano())/1e9)
+}
+
+// writeFileAtomic writes data to the file at path through a temporary file
+// in the same directory renamed over it, so that readers never see a partial
+// file.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp) // fails once renamed
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	// The exporter often runs as another user.
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// metrics prints the metrics of the dcr processes in the Prometheus text
+// format, or writes them to a file for the node_exporter textfile collector.
+func metrics(args []string) error {
+	fs := flag.NewFlagSet("metrics", flag.ExitOnError)
+	out := fs.String("o", "", "write the metrics to file atomically")
+	parseCommandFlags(fs, args)
+
+	var buf bytes.Buffer
+	writeMetrics(&buf, dcrProcesses(), time.Now())
+	if *out == "" {
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	return writeFileAtomic(*out, buf.Bytes())
+}
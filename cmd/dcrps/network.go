@@ -0,0 +1,63 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/shirou/gopsutil/process"
+)
+
+// Decred networks, in the order listings show them.
+var networks = []string{"mainnet", "testnet", "simnet", "regnet"}
+
+// networkFromArgs classifies a Decred command line by its --testnet, --simnet
+// and --regnet flags, which all the Decred daemons share. The flags may be
+// written with one or two dashes and with an explicit boolean value. Without
+// any of them the process is on mainnet.
+func networkFromArgs(args []string) string {
+	network := "mainnet"
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name := strings.TrimLeft(arg, "-")
+		value := true
+		if i := strings.Index(name, "="); i >= 0 {
+			v, err := strconv.ParseBool(name[i+1:])
+			if err != nil {
+				continue
+			}
+			name, value = name[:i], v
+		}
+		switch name {
+		case "testnet", "simnet", "regnet":
+			if value {
+				network = name
+			}
+		}
+	}
+	return network
+}
+
+// processNetwork returns the Decred network the process with the given PID
+// runs on. Networks selected in a config file rather than on the command line
+// are not seen, and "unknown" is returned when the command line can't be
+// read.
+func processNetwork(pid int) string {
+	p, err := process.NewProcess(int32(pid))
+	if err != nil {
+		return "unknown"
+	}
+	args, err := p.CmdlineSlice()
+	if err != nil {
+		return "unknown"
+	}
+	if len(args) > 0 {
+		args = args[1:]
+	}
+	return networkFromArgs(args)
+}
@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestNetworkFromArgs(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, "mainnet"},
+		{[]string{"--appdata=/data"}, "mainnet"},
+		{[]string{"--testnet"}, "testnet"},
+		{[]string{"-testnet"}, "testnet"},
+		{[]string{"--simnet=1"}, "simnet"},
+		{[]string{"--regnet=true"}, "regnet"},
+		{[]string{"--testnet=false"}, "mainnet"},
+		{[]string{"--testnet=0", "--simnet"}, "simnet"},
+		{[]string{"testnet"}, "mainnet"},
+	}
+	for _, test := range tests {
+		if got := networkFromArgs(test.args); got != test.want {
+			t.Errorf("networkFromArgs(%q): got=%v want=%v", test.args, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/google/gops/goprocess"
+)
+
+// namespacePIDs returns the PIDs the processes of ps that run in a nested
+// PID namespace see themselves as, by host PID. It is empty but on Linux.
+func namespacePIDs(ps []goprocess.P) map[int]int {
+	nspids := make(map[int]int)
+	if runtime.GOOS != "linux" {
+		return nspids
+	}
+	for _, p := range ps {
+		b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/status", p.PID))
+		if err != nil {
+			continue
+		}
+		if nspid, ok := parseNSpid(b); ok {
+			nspids[p.PID] = nspid
+		}
+	}
+	return nspids
+}
+
+// parseNSpid returns the innermost PID of the NSpid line of a
+// /proc/<pid>/status file, the PID in each PID namespace from the outermost,
+// when the process is in a nested namespace.
+func parseNSpid(status []byte) (int, bool) {
+	scanner := bufio.NewScanner(bytes.NewReader(status))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "NSpid:") {
+			continue
+		}
+		fields := strings.Fields(line[len("NSpid:"):])
+		if len(fields) < 2 {
+			return 0, false
+		}
+		pid, err := strconv.Atoi(fields[len(fields)-1])
+		return pid, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestParseNSpid(t *testing.T) {
+	tests := []struct {
+		status string
+		pid    int
+		ok     bool
+	}{
+		{"Name:\tdcrd\nNSpid:\t4321\t1\nNSpgid:\t4321\t1\n", 1, true},
+		{"Name:\tdcrd\nNSpid:\t4321\t87\t12\n", 12, true},
+		{"Name:\tdcrd\nNSpid:\t4321\n", 0, false}, // not nested
+		{"Name:\tdcrd\nPid:\t4321\n", 0, false},   // kernels before 4.1
+	}
+	for _, test := range tests {
+		pid, ok := parseNSpid([]byte(test.status))
+		if pid != test.pid || ok != test.ok {
+			t.Errorf("parseNSpid(%q): got=%v,%v want=%v,%v", test.status, pid, ok, test.pid, test.ok)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/shirou/gopsutil/process"
+)
+
+// orphan is a dcr process with no dcr parent.
+type orphan struct {
+	PID    int    `json:"pid"`
+	Exec   string `json:"exec"`
+	PPID   int    `json:"ppid"`
+	Parent string `json:"parent,omitempty"` // the exec of the parent
+	Reason string `json:"reason"`
+}
+
+// systemdUnit returns the systemd service whose cgroup the process with the
+// given PID is in, read from /proc, or "" when it isn't in one or /proc is
+// missing.
+func systemdUnit(pid int) string {
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return ""
+	}
+	return serviceFromCgroup(b)
+}
+
+// serviceFromCgroup returns the systemd service of a /proc/<pid>/cgroup file.
+func serviceFromCgroup(b []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		// hierarchy-ID:controllers:path
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		path := fields[2]
+		unit := path[strings.LastIndex(path, "/")+1:]
+		if strings.HasSuffix(unit, ".service") {
+			return unit
+		}
+	}
+	return ""
+}
+
+// findOrphans returns the dcr processes at the top of the process tree, those
+// whose parent is gone or isn't a dcr process. The processes that init
+// started as a systemd service are top-level by design and left out.
+func findOrphans() []orphan {
+	var orphans []orphan
+	for _, top := range buildProcessTree().children {
+		nodes := top.children
+		if top.process != nil {
+			// A process with a PPID of 0.
+			nodes = []*psNode{top}
+		}
+		for _, n := range nodes {
+			p := n.process
+			o := orphan{PID: p.PID, Exec: p.Exec, PPID: p.PPID}
+			parent, err := process.NewProcess(int32(p.PPID))
+			switch {
+			case p.PPID <= 0:
+				o.Reason = "no parent in this PID namespace"
+			case err != nil:
+				o.Reason = "parent gone"
+			case p.PPID == 1:
+				if systemdUnit(p.PID) != "" {
+					continue
+				}
+				o.Parent, _ = parent.Name()
+				o.Reason = "reparented to init, its parent exited"
+			default:
+				o.Parent, _ = parent.Name()
+				o.Reason = "parent is not a dcr process"
+			}
+			orphans = append(orphans, o)
+		}
+	}
+	return orphans
+}
+
+// orphans lists the dcr processes that lost their supervisor or never had a
+// dcr one.
+func orphans(args []string) error {
+	fs := flag.NewFlagSet("orphans", flag.ExitOnError)
+	parseCommandFlags(fs, args)
+
+	list := findOrphans()
+	if *jsonOutput {
+		if list == nil {
+			list = []orphan{}
+		}
+		printJSON(list)
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, o := range list {
+		parent := o.Parent
+		if parent == "" {
+			parent = "-"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\n", o.PID, o.Exec, o.PPID, parent, o.Reason)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestServiceFromCgroup(t *testing.T) {
+	tests := []struct {
+		cgroup string
+		want   string
+	}{
+		{"0::/system.slice/dcrd.service\n", "dcrd.service"},
+		{"12:pids:/system.slice/dcrwallet.service\n1:name=systemd:/system.slice/dcrwallet.service\n", "dcrwallet.service"},
+		{"0::/user.slice/user-1000.slice/session-2.scope\n", ""},
+		{"0::/\n", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := serviceFromCgroup([]byte(test.cgroup)); got != test.want {
+			t.Errorf("serviceFromCgroup(%q): got=%v want=%v", test.cgroup, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// outputFormat is the structured output format selected with -o: "json",
+// which is -json, or "csv". It is empty by default, and "table" selects the
+// tables again over the format of the configuration file.
+type outputFormat string
+
+// outputFormats are the formats -o takes.
+var outputFormats = []string{"json", "csv", "table"}
+
+func (f *outputFormat) String() string { return string(*f) }
+
+func (f *outputFormat) Set(s string) error {
+	switch s {
+	case "json":
+		*jsonOutput = true
+	case "csv":
+	case "table":
+		*jsonOutput = false
+	default:
+		return fmt.Errorf("invalid format %q, want json, csv or table", s)
+	}
+	*f = outputFormat(s)
+	return nil
+}
+
+// csvOutput reports whether CSV is printed instead of tables, see -o.
+func csvOutput() bool {
+	return *outFormat == "csv"
+}
+
+// dataOut is the writer of the JSON output once opened by dataOutput.
+var dataOut io.Writer
+
+// dataOutput returns the writer of the JSON output: the standard output or
+// the -output-fd file descriptor. It exits when that can't be written to.
+func dataOutput() io.Writer {
+	if dataOut != nil {
+		return dataOut
+	}
+	if *outputFD == 1 {
+		dataOut = os.Stdout
+		return dataOut
+	}
+	f, err := openOutputFD(*outputFD)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -output-fd: %v\n", err)
+		exit(exitFailure)
+	}
+	dataOut = f
+	return dataOut
+}
+
+// openOutputFD returns the file of the file descriptor fd, checking that it
+// is open for writing.
+func openOutputFD(fd int) (*os.File, error) {
+	if fd < 0 {
+		return nil, fmt.Errorf("negative file descriptor %d", fd)
+	}
+	f := os.NewFile(uintptr(fd), fmt.Sprintf("fd %d", fd))
+	if f == nil {
+		return nil, fmt.Errorf("file descriptor %d is invalid", fd)
+	}
+	if _, err := f.Stat(); err != nil {
+		return nil, fmt.Errorf("file descriptor %d is not open", fd)
+	}
+	// An empty write still checks that the file is open for writing.
+	if _, err := f.Write(nil); err != nil {
+		return nil, fmt.Errorf("file descriptor %d is not writable: %v", fd, err)
+	}
+	return f, nil
+}
+
+// printJSON prints v as indented JSON to the data output.
+func printJSON(v interface{}) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		exit(exitFailure)
+	}
+	fmt.Fprintf(dataOutput(), "%s\n", b)
+}
+
+// printCSV prints the records as CSV to the data output, under the header row
+// unless -no-header is set.
+func printCSV(header []string, records [][]string) {
+	w := csv.NewWriter(dataOutput())
+	if !*noHeader {
+		w.Write(header)
+	}
+	w.WriteAll(records)
+	if err := w.Error(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		exit(exitFailure)
+	}
+}
+
+// csvValue formats a value of a CSV record, empty when v is a nil pointer,
+// as the fields that can't be read are.
+func csvValue(v interface{}) string {
+	switch v := v.(type) {
+	case *int32:
+		if v != nil {
+			return strconv.FormatInt(int64(*v), 10)
+		}
+	case *uint64:
+		if v != nil {
+			return strconv.FormatUint(*v, 10)
+		}
+	case *float32:
+		if v != nil {
+			return strconv.FormatFloat(float64(*v), 'f', -1, 32)
+		}
+	case *float64:
+		if v != nil {
+			return strconv.FormatFloat(*v, 'f', -1, 64)
+		}
+	case *string:
+		if v != nil {
+			return *v
+		}
+	case *int64:
+		if v != nil {
+			return strconv.FormatInt(*v, 10)
+		}
+	case *int:
+		if v != nil {
+			return strconv.Itoa(*v)
+		}
+	case *bool:
+		if v != nil {
+			return strconv.FormatBool(*v)
+		}
+	default:
+		return fmt.Sprint(v)
+	}
+	return ""
+}
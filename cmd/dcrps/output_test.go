@@ -0,0 +1,24 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestOpenOutputFD(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	if _, err := openOutputFD(int(w.Fd())); err != nil {
+		t.Errorf("write end: %v", err)
+	}
+	if _, err := openOutputFD(int(r.Fd())); err == nil {
+		t.Errorf("read end: got no error")
+	}
+	if _, err := openOutputFD(-1); err == nil {
+		t.Errorf("-1: got no error")
+	}
+}
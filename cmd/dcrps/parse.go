@@ -0,0 +1,46 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// intValue returns the integer value of key.
+func intValue(values map[string]string, key string) (int64, bool) {
+	v, err := strconv.ParseInt(values[key], 10, 64)
+	return v, err == nil
+}
+
+// durationValue returns the value of key written as a time.Duration.
+func durationValue(values map[string]string, key string) (time.Duration, bool) {
+	d, err := time.ParseDuration(values[key])
+	return d, err == nil
+}
+
+// byteUnits are the multipliers of the byte sizes of parseByteSize, by the
+// first letter of their unit.
+var byteUnits = map[byte]float64{'K': 1 << 10, 'M': 1 << 20, 'G': 1 << 30, 'T': 1 << 40}
+
+// parseByteSize parses a byte size such as "2GB", "512M" or "1024", the
+// units in powers of 1024 as formatBytes writes them.
+func parseByteSize(s string) (uint64, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	v = strings.TrimSuffix(strings.TrimSuffix(v, "B"), "I")
+	mult := 1.0
+	if n := len(v); n > 0 {
+		if m, ok := byteUnits[v[n-1]]; ok {
+			mult, v = m, strings.TrimSpace(v[:n-1])
+		}
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("invalid byte size %q, want a number of bytes with an optional unit K, M, G or T", s)
+	}
+	return uint64(f * mult), nil
+}
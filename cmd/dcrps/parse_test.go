@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dcrlabs/dcrps/pkg/dcrps"
+)
+
+func TestGOMAXPROCSWarning(t *testing.T) {
+	tests := []struct {
+		stats    string
+		hostCPUs int
+		warn     bool
+	}{
+		{"goroutines: 10\nGOMAXPROCS: 8\nnum CPU: 8\n", 8, false},
+		{"goroutines: 10\nGOMAXPROCS: 2\nnum CPU: 8\n", 8, true},
+		{"goroutines: 10\nGOMAXPROCS: 16\n", 8, true},
+		// An agent that doesn't report it.
+		{"goroutines: 10\n", 8, false},
+		{"GOMAXPROCS: many\n", 8, false},
+	}
+	for _, test := range tests {
+		w := gomaxprocsWarning(dcrps.ParseKeyValues([]byte(test.stats)), test.hostCPUs)
+		if (w != "") != test.warn {
+			t.Errorf("gomaxprocsWarning(%q, %d): got %q, want a warning %v",
+				test.stats, test.hostCPUs, w, test.warn)
+		}
+		if test.warn && !strings.HasPrefix(w, "warning: GOMAXPROCS ") {
+			t.Errorf("gomaxprocsWarning(%q, %d): got %q", test.stats, test.hostCPUs, w)
+		}
+	}
+}
+
+func TestIntDurationValue(t *testing.T) {
+	values := dcrps.ParseKeyValues([]byte("num-gc: 677\ngc-pause-total: 17.5ms\nodd line\nenable-gc: true\n"))
+	if v, ok := intValue(values, "num-gc"); !ok || v != 677 {
+		t.Errorf("intValue(num-gc): got=%v,%v", v, ok)
+	}
+	if _, ok := intValue(values, "enable-gc"); ok {
+		t.Error("intValue(enable-gc): got a value")
+	}
+	if _, ok := intValue(values, "missing"); ok {
+		t.Error("intValue(missing): got a value")
+	}
+	if d, ok := durationValue(values, "gc-pause-total"); !ok || d.String() != "17.5ms" {
+		t.Errorf("durationValue(gc-pause-total): got=%v,%v", d, ok)
+	}
+	if _, ok := durationValue(values, "num-gc"); ok {
+		t.Error("durationValue(num-gc): got a value")
+	}
+}
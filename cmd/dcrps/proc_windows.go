@@ -0,0 +1,33 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// setProcessGroup does nothing on Windows, where taskkill finds the processes
+// c starts in turn as its descendants.
+func setProcessGroup(c *exec.Cmd) {}
+
+// killProcessGroup kills p and its descendants.
+func killProcessGroup(p *os.Process) error {
+	out, err := exec.Command("taskkill", "/f", "/t", "/pid", strconv.Itoa(p.Pid)).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("taskkill: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// setDetached makes c start in a process group of its own, which the Ctrl-C
+// of the console of dcrps doesn't reach.
+func setDetached(c *exec.Cmd) {
+	c.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
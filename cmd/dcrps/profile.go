@@ -0,0 +1,185 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	ossignal "os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	dcrsignal "github.com/dcrlabs/dcrps/signal"
+	"github.com/google/gops/signal"
+)
+
+// profileSignals are the signals of the profiles the profile command
+// captures, by the name -types takes.
+var profileSignals = map[string]byte{
+	"heap":  signal.HeapProfile,
+	"cpu":   signal.CPUProfile,
+	"mutex": dcrsignal.MutexProfile,
+	"block": dcrsignal.BlockProfile,
+}
+
+// profileTypes are the names of profileSignals, in the order they are
+// captured.
+var profileTypes = []string{"heap", "cpu", "mutex", "block"}
+
+// parseProfileTypes parses the comma-separated list of profile types of
+// -types, returning them in the order they are captured.
+func parseProfileTypes(list string) ([]string, error) {
+	seen := make(map[string]bool)
+	for _, typ := range strings.Split(list, ",") {
+		typ = strings.ToLower(strings.TrimSpace(typ))
+		if _, ok := profileSignals[typ]; !ok {
+			return nil, fmt.Errorf("unknown profile type %q, want a comma-separated list of %s",
+				typ, strings.Join(profileTypes, ", "))
+		}
+		seen[typ] = true
+	}
+	var types []string
+	for _, typ := range profileTypes {
+		if seen[typ] {
+			types = append(types, typ)
+		}
+	}
+	return types, nil
+}
+
+// profilePrefix returns the prefix of the names of the profiles of type typ
+// of target, such as "dcrwallet-heap-".
+func profilePrefix(target, typ string) string {
+	return safeFileName(target) + "-" + typ + "-"
+}
+
+// profileName returns the name of the profile of type typ of target captured
+// at now, such as "dcrwallet-heap-20190102T150405.pprof". The names of the
+// profiles of a target and type sort by time.
+func profileName(target, typ string, now time.Time) string {
+	return profilePrefix(target, typ) + now.Format("20060102T150405") + ".pprof"
+}
+
+// rotateProfiles removes the oldest profiles of dir named with prefix so that
+// keep of them remain. The other files of dir are left alone.
+func rotateProfiles(dir, prefix string, keep int) error {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, fi := range fis {
+		name := fi.Name()
+		if fi.Mode().IsRegular() && strings.HasPrefix(name, prefix) && strings.HasSuffix(name, ".pprof") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for len(names) > keep {
+		if err := os.Remove(filepath.Join(dir, names[0])); err != nil {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// captureProfile captures the profile of type typ of target into dir, then
+// rotates its profiles. It returns the path of the profile, or "" when the
+// process has no samples of it, as for the mutex and block profiles that it
+// didn't enable.
+func captureProfile(target, typ, dir string, cpuWindow time.Duration, keep int) (string, error) {
+	addr, err := resolver.Resolve(target)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	var out []byte
+	if typ == "cpu" {
+		out, err = captureCPUProfile(*addr, cpuWindow)
+	} else {
+		cmdTimeout = time.Minute
+		out, err = cmd(*addr, profileSignals[typ])
+	}
+	if err != nil || len(out) == 0 {
+		return "", err
+	}
+	path := filepath.Join(dir, profileName(target, typ, now))
+	if err := writeFileAtomic(path, out); err != nil {
+		return "", err
+	}
+	if keep > 0 {
+		if err := rotateProfiles(dir, profilePrefix(target, typ), keep); err != nil {
+			return path, fmt.Errorf("cannot rotate the %s profiles: %v", typ, err)
+		}
+	}
+	return path, nil
+}
+
+// profile captures the profiles of a process every interval into a directory,
+// keeping the latest of each type, until interrupted. The target is resolved
+// for each capture, so that the profiles go on once an exec restarts.
+func profile(args []string) error {
+	fs := flag.NewFlagSet("profile", flag.ExitOnError)
+	every := fs.Duration("every", 10*time.Minute, "time between captures")
+	keep := fs.Int("keep", 24, "profiles of each type to keep, 0 for all")
+	typeList := fs.String("types", "heap", "comma-separated profile types: "+strings.Join(profileTypes, ", "))
+	dir := fs.String("out", ".", "directory to write the profiles to")
+	cpuWindow := fs.Duration("cpu-duration", 10*time.Second, "window of the CPU profile")
+	target := parseTargetFlags(fs, args)
+	if target == "" {
+		return errors.New("missing PID, exec name or address")
+	}
+	if *every <= 0 {
+		return errors.New("every must be positive")
+	}
+	if *keep < 0 {
+		return fmt.Errorf("invalid -keep %d", *keep)
+	}
+	types, err := parseProfileTypes(*typeList)
+	if err != nil {
+		return fmt.Errorf("invalid -types: %v", err)
+	}
+	if *cpuWindow <= 0 || *cpuWindow >= *every {
+		return fmt.Errorf("invalid -cpu-duration %v, want a positive window shorter than -every", *cpuWindow)
+	}
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		return err
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	ossignal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer ossignal.Stop(interrupt)
+	ticker := time.NewTicker(*every)
+	defer ticker.Stop()
+	fmt.Fprintf(os.Stderr, "capturing the %s profiles of %s into %s every %v\n",
+		strings.Join(types, ", "), target, *dir, *every)
+	for {
+		// A failed capture, such as of a process restarting, must not
+		// end the history.
+		for _, typ := range types {
+			path, err := captureProfile(target, typ, *dir, *cpuWindow, *keep)
+			switch {
+			case err != nil:
+				fmt.Fprintf(os.Stderr, "profile: %s: %v\n", typ, err)
+			case path == "":
+				fmt.Fprintf(os.Stderr, "profile: %s: no samples, the process didn't enable it\n", typ)
+			default:
+				fmt.Printf("Profile saved to: %s\n", path)
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-interrupt:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	dcrsignal "github.com/dcrlabs/dcrps/signal"
+	"github.com/google/gops/signal"
+)
+
+func TestParseProfileTypes(t *testing.T) {
+	got, err := parseProfileTypes("cpu, HEAP,cpu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"heap", "cpu"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseProfileTypes: got=%v want=%v", got, want)
+	}
+	if _, err := parseProfileTypes("heap,goroutine"); err == nil {
+		t.Error("parseProfileTypes: no error for an unknown type")
+	}
+}
+
+func TestRotateProfiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcrps-profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	start := time.Date(2019, 1, 2, 15, 4, 5, 0, time.UTC)
+	var names []string
+	for i := 0; i < 4; i++ {
+		now := start.Add(time.Duration(i) * 10 * time.Minute)
+		names = append(names, profileName("dcrwallet", "heap", now), profileName("dcrwallet", "cpu", now))
+	}
+	names = append(names, "notes.txt", profileName("dcrd", "heap", start))
+	for _, name := range names {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rotateProfiles(dir, profilePrefix("dcrwallet", "heap"), 2); err != nil {
+		t.Fatal(err)
+	}
+
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, fi := range fis {
+		got = append(got, fi.Name())
+	}
+	want := []string{
+		"dcrd-heap-20190102T150405.pprof",
+		"dcrwallet-cpu-20190102T150405.pprof",
+		"dcrwallet-cpu-20190102T151405.pprof",
+		"dcrwallet-cpu-20190102T152405.pprof",
+		"dcrwallet-cpu-20190102T153405.pprof",
+		"dcrwallet-heap-20190102T152405.pprof",
+		"dcrwallet-heap-20190102T153405.pprof",
+		"notes.txt",
+	}
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rotateProfiles:\ngot=%v\nwant=%v", got, want)
+	}
+}
+
+func TestProfileError(t *testing.T) {
+	tests := []struct {
+		p     byte
+		out   string
+		empty bool // an *emptyProfileError
+		err   bool
+	}{
+		{dcrsignal.MutexProfile, "profile", false, false},
+		{dcrsignal.MutexProfile, "", true, true},
+		{dcrsignal.BlockProfile, "", true, true},
+		{signal.HeapProfile, "", false, true},
+	}
+	for _, test := range tests {
+		err := profileError(test.p, []byte(test.out))
+		_, empty := err.(*emptyProfileError)
+		if (err != nil) != test.err || empty != test.empty {
+			t.Errorf("profileError(%#x, %q): got %v", test.p, test.out, err)
+		}
+	}
+	if err := profileError(dcrsignal.BlockProfile, nil); !strings.Contains(err.Error(), "SetBlockProfileRate") {
+		t.Errorf("empty block profile: got %v", err)
+	}
+}
+
+// rateServer serves an agent with the capabilities caps whose mutex profile
+// fraction starts at rate, answering the requests to set it as the agent of
+// the agent package does. It returns its address and the rates it was set to.
+func rateServer(t *testing.T, caps string, rate int) (*net.TCPAddr, *[]int) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var set []int
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			buf := make([]byte, 1+binary.MaxVarintLen64)
+			conn.Read(buf)
+			switch buf[0] {
+			case dcrsignal.Capabilities:
+				fmt.Fprint(conn, caps)
+			case dcrsignal.SetMutexProfileFraction:
+				v, _ := binary.Varint(buf[1:])
+				set = append(set, int(v))
+				fmt.Fprintf(conn, "%d\n", rate)
+				rate = int(v)
+			}
+			conn.Close()
+		}
+	}()
+	return l.Addr().(*net.TCPAddr), &set
+}
+
+func TestSampleProfile(t *testing.T) {
+	addr, set := rateServer(t, "stack\nprofile-rates\n", 0)
+	err := sampleProfile(*addr, dcrsignal.SetMutexProfileFraction, "mutex profile fraction", 5, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(*set) != "[5 0]" {
+		t.Errorf("got the rates %v, want 5 and then the previous 0", *set)
+	}
+
+	addr, set = rateServer(t, "stack\n", 0)
+	err = sampleProfile(*addr, dcrsignal.SetMutexProfileFraction, "mutex profile fraction", 5, time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "can't set the mutex profile fraction") {
+		t.Errorf("without the capability: got %v", err)
+	}
+	if len(*set) != 0 {
+		t.Errorf("without the capability: got the rates %v", *set)
+	}
+
+	if err := sampleProfile(*addr, dcrsignal.SetMutexProfileFraction, "mutex profile fraction", 5, 0); err == nil {
+		t.Error("no window: got no error")
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"github.com/google/gops/goprocess"
+)
+
+// processJSON is a process of the JSON listing.
+type processJSON struct {
+	PID          int    `json:"pid"`
+	PPID         int    `json:"ppid"`
+	Exec         string `json:"exec"`
+	Agent        bool   `json:"agent"`
+	BuildVersion string `json:"buildVersion"`
+	Path         string `json:"path"`
+	NSPID        int    `json:"nspid,omitempty"` // in its PID namespace
+
+	// The usage of the process, over its lifetime for the CPU, null when
+	// it can't be read.
+	CPUPercent    *float64 `json:"cpuPercent"`
+	RSS           *uint64  `json:"rss"`
+	MemoryPercent *float64 `json:"memoryPercent"`
+	Threads       *int32   `json:"threads"`
+}
+
+// processCSVHeader is the header of the CSV listing, naming the fields as
+// the JSON listing does.
+var processCSVHeader = []string{
+	"pid", "ppid", "exec", "agent", "buildVersion", "path", "nspid",
+	"cpuPercent", "rss", "memoryPercent", "threads",
+}
+
+// csvRecord returns the record of p in the CSV listing. The fields that
+// can't be read are empty.
+func (p processJSON) csvRecord() []string {
+	nspid := ""
+	if p.NSPID != 0 {
+		nspid = strconv.Itoa(p.NSPID)
+	}
+	return []string{
+		strconv.Itoa(p.PID), strconv.Itoa(p.PPID), p.Exec,
+		strconv.FormatBool(p.Agent), p.BuildVersion, p.Path, nspid,
+		csvValue(p.CPUPercent), csvValue(p.RSS), csvValue(p.MemoryPercent),
+		csvValue(p.Threads),
+	}
+}
+
+func newProcessJSON(p goprocess.P) processJSON {
+	return processJSON{
+		PID:          p.PID,
+		PPID:         p.PPID,
+		Exec:         p.Exec,
+		Agent:        p.Agent,
+		BuildVersion: p.BuildVersion,
+		Path:         p.Path,
+	}
+}
+
+func (p processJSON) process() goprocess.P {
+	return goprocess.P{
+		PID:          p.PID,
+		PPID:         p.PPID,
+		Exec:         p.Exec,
+		Agent:        p.Agent,
+		BuildVersion: p.BuildVersion,
+		Path:         p.Path,
+	}
+}
+
+// listingJSON returns the JSON listing of ps, with the PIDs in their PID
+// namespace in nspids and the usage in usage.
+func listingJSON(ps []goprocess.P, nspids map[int]int, usage map[int]processUsage) []processJSON {
+	list := make([]processJSON, 0, len(ps))
+	for _, p := range ps {
+		pj := newProcessJSON(p)
+		pj.NSPID = nspids[p.PID]
+		if u, ok := usage[p.PID]; ok {
+			if u.cpuKnown {
+				pj.CPUPercent = &u.cpu
+			}
+			if u.rss > 0 {
+				pj.RSS = &u.rss
+			}
+			if u.memKnown {
+				pj.MemoryPercent = &u.memPercent
+			}
+			if u.threadsKnown {
+				pj.Threads = &u.threads
+			}
+		}
+		list = append(list, pj)
+	}
+	return list
+}
+
+// listingCSV returns the records of the CSV listing of list.
+func listingCSV(list []processJSON) [][]string {
+	records := make([][]string, 0, len(list))
+	for _, p := range list {
+		records = append(records, p.csvRecord())
+	}
+	return records
+}
+
+// nodeJSON is a node of the JSON tree. The nodes of the parent PIDs that are
+// not dcr processes only have a PID and children.
+type nodeJSON struct {
+	PID          int        `json:"pid"`
+	PPID         int        `json:"ppid,omitempty"`
+	Exec         string     `json:"exec,omitempty"`
+	Agent        bool       `json:"agent,omitempty"`
+	BuildVersion string     `json:"buildVersion,omitempty"`
+	Path         string     `json:"path,omitempty"`
+	Count        int        `json:"count,omitempty"` // of a collapsed subtree
+	Children     []nodeJSON `json:"children,omitempty"`
+}
+
+// treeCSVHeader is the header of the CSV tree, whose records are the nodes
+// in depth-first order with their depth, the top-level nodes at 0.
+var treeCSVHeader = []string{
+	"depth", "pid", "ppid", "exec", "agent", "buildVersion", "path", "count",
+}
+
+// treeCSV returns the records of the CSV tree of t. The fields the nodes of
+// the parent PIDs lack are empty.
+func treeCSV(t treeRootJSON) [][]string {
+	var records [][]string
+	var walk func(nodes []nodeJSON, depth int)
+	walk = func(nodes []nodeJSON, depth int) {
+		for _, n := range nodes {
+			record := []string{strconv.Itoa(depth), strconv.Itoa(n.PID), "", "", "", "", "", ""}
+			if n.Exec != "" {
+				record[2] = strconv.Itoa(n.PPID)
+				record[3] = n.Exec
+				record[4] = strconv.FormatBool(n.Agent)
+				record[5] = n.BuildVersion
+				record[6] = n.Path
+			}
+			if n.Count != 0 {
+				record[7] = strconv.Itoa(n.Count)
+			}
+			records = append(records, record)
+			walk(n.Children, depth+1)
+		}
+	}
+	walk(t.Tree, 0)
+	return records
+}
+
+// treeRootJSON is the JSON tree.
+type treeRootJSON struct {
+	Tree []nodeJSON `json:"tree"`
+}
+
+func treeJSON(root *psNode) treeRootJSON {
+	var convert func(n *psNode) nodeJSON
+	convert = func(n *psNode) nodeJSON {
+		nj := nodeJSON{PID: n.pid, Count: n.count}
+		if p := n.process; p != nil {
+			nj.PPID = p.PPID
+			nj.Exec = p.Exec
+			nj.Agent = p.Agent
+			nj.BuildVersion = p.BuildVersion
+			nj.Path = p.Path
+		}
+		for _, child := range n.children {
+			nj.Children = append(nj.Children, convert(child))
+		}
+		return nj
+	}
+	var t treeRootJSON
+	for _, n := range root.children {
+		t.Tree = append(t.Tree, convert(n))
+	}
+	return t
+}
+
+// processes returns the processes of the tree, parents first.
+func (t treeRootJSON) processes() []goprocess.P {
+	var ps []goprocess.P
+	var walk func(nodes []nodeJSON)
+	walk = func(nodes []nodeJSON) {
+		for _, n := range nodes {
+			if n.Exec != "" {
+				ps = append(ps, goprocess.P{
+					PID:          n.PID,
+					PPID:         n.PPID,
+					Exec:         n.Exec,
+					Agent:        n.Agent,
+					BuildVersion: n.BuildVersion,
+					Path:         n.Path,
+				})
+			}
+			walk(n.Children)
+		}
+	}
+	walk(t.Tree)
+	return ps
+}
+
+// render reads a listing or tree printed with -json from the standard input
+// and renders it as a table, tree or DOT graph.
+func render(args []string) error {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	format := fs.String("format", "", "render as table, tree or dot")
+	parseCommandFlags(fs, args)
+
+	in, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+	in = bytes.TrimSpace(in)
+	if len(in) == 0 {
+		return errors.New("no JSON listing or tree on the standard input")
+	}
+
+	var ps []goprocess.P
+	var nspids map[int]int
+	captured := "table"
+	switch in[0] {
+	case '[':
+		var list []processJSON
+		if err := json.Unmarshal(in, &list); err != nil {
+			return fmt.Errorf("invalid JSON listing: %v", err)
+		}
+		for _, p := range list {
+			ps = append(ps, p.process())
+			if p.NSPID != 0 {
+				if nspids == nil {
+					nspids = make(map[int]int)
+				}
+				nspids[p.PID] = p.NSPID
+			}
+		}
+	case '{':
+		var t treeRootJSON
+		if err := json.Unmarshal(in, &t); err != nil {
+			return fmt.Errorf("invalid JSON tree: %v", err)
+		}
+		ps = t.processes()
+		captured = "tree"
+	default:
+		return errors.New("the input is not a JSON listing or tree")
+	}
+
+	if *format == "" {
+		*format = captured
+	}
+	switch *format {
+	case "table":
+		(&processTable{nspids: nspids}).print(os.Stdout, ps)
+	case "tree", "dot":
+		renderTree(processTree(ps), nil, nil, *format)
+	default:
+		return fmt.Errorf("invalid format %q, want table, tree or dot", *format)
+	}
+	return nil
+}
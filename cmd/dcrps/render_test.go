@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/google/gops/goprocess"
+)
+
+func TestTreeJSONRoundTrip(t *testing.T) {
+	ps := []goprocess.P{
+		{PID: 10, PPID: 1, Exec: "dcrd", Path: "/bin/dcrd", Agent: true},
+		{PID: 11, PPID: 10, Exec: "dcrctl", Path: "/bin/dcrctl"},
+		{PID: 21, PPID: 20, Exec: "dcrwallet", Path: "/bin/dcrwallet"},
+	}
+	b, err := json.Marshal(treeJSON(processTree(ps)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tj treeRootJSON
+	if err := json.Unmarshal(b, &tj); err != nil {
+		t.Fatal(err)
+	}
+	got := tj.processes()
+	if len(got) != len(ps) {
+		t.Fatalf("processes: got %d want %d", len(got), len(ps))
+	}
+	if s, want := treeString(processTree(got)), treeString(processTree(ps)); s != want {
+		t.Errorf("round trip: got=%v want=%v", s, want)
+	}
+	if !got[0].Agent || got[0].Path != "/bin/dcrd" {
+		t.Errorf("round trip lost fields: %+v", got[0])
+	}
+}
+
+func TestListingCSV(t *testing.T) {
+	ps := []goprocess.P{
+		{PID: 10, PPID: 1, Exec: "dcrd", BuildVersion: "go1.12", Path: "/bin/dcrd", Agent: true},
+		// Exited before its usage was read.
+		{PID: 11, PPID: 10, Exec: "dcrctl", BuildVersion: "go1.12", Path: "/bin/dcrctl"},
+	}
+	usage := map[int]processUsage{
+		10: {cpu: 1.5, cpuKnown: true, rss: 4096, memPercent: 0.25, memKnown: true, threads: 8, threadsKnown: true},
+	}
+	got := listingCSV(listingJSON(ps, map[int]int{10: 1}, usage))
+	want := [][]string{
+		{"10", "1", "dcrd", "true", "go1.12", "/bin/dcrd", "1", "1.5", "4096", "0.25", "8"},
+		{"11", "10", "dcrctl", "false", "go1.12", "/bin/dcrctl", "", "", "", "", ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("listing:\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestTreeCSV(t *testing.T) {
+	ps := []goprocess.P{
+		{PID: 10, PPID: 1, Exec: "dcrd", Path: "/bin/dcrd", Agent: true},
+		{PID: 11, PPID: 10, Exec: "dcrctl", Path: "/bin/dcrctl"},
+	}
+	got := treeCSV(treeJSON(processTree(ps)))
+	want := [][]string{
+		{"0", "1", "", "", "", "", "", ""},
+		{"1", "10", "1", "dcrd", "true", "", "/bin/dcrd", ""},
+		{"2", "11", "10", "dcrctl", "false", "", "/bin/dcrctl", ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tree:\ngot  %q\nwant %q", got, want)
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// historyMetric is a value of the history records report prints the trend
+// of.
+type historyMetric struct {
+	name   string
+	value  func(r *historyRecord) (float64, bool)
+	format func(v float64) string
+}
+
+func uint64Value(v *uint64) (float64, bool) {
+	if v == nil {
+		return 0, false
+	}
+	return float64(*v), true
+}
+
+func formatBytesValue(v float64) string {
+	return formatBytes(uint64(v))
+}
+
+func formatCount(v float64) string {
+	return fmt.Sprintf("%.0f", v)
+}
+
+// historyMetrics are the metrics of report, in the order it prints them.
+var historyMetrics = []historyMetric{
+	{"rss", func(r *historyRecord) (float64, bool) { return uint64Value(r.RSS) }, formatBytesValue},
+	{"heap", func(r *historyRecord) (float64, bool) { return uint64Value(r.HeapAlloc) }, formatBytesValue},
+	{"heap-objects", func(r *historyRecord) (float64, bool) { return uint64Value(r.HeapObjects) }, formatCount},
+	{"sys", func(r *historyRecord) (float64, bool) { return uint64Value(r.Sys) }, formatBytesValue},
+	{"goroutines", func(r *historyRecord) (float64, bool) {
+		if r.Goroutines == nil {
+			return 0, false
+		}
+		return float64(*r.Goroutines), true
+	}, formatCount},
+}
+
+// metricTrend is the trend of a metric over the records it was read in.
+type metricTrend struct {
+	Name    string    `json:"name"`
+	First   float64   `json:"first"`
+	Last    float64   `json:"last"`
+	Min     float64   `json:"min"`
+	Max     float64   `json:"max"`
+	PerHour float64   `json:"perHour"` // the change from the first to the last
+	Values  []float64 `json:"-"`
+}
+
+// newMetricTrend returns the trend of m over records, false when no record
+// holds it.
+func newMetricTrend(m historyMetric, records []historyRecord) (metricTrend, bool) {
+	t := metricTrend{Name: m.name}
+	var first, last time.Time
+	for i := range records {
+		v, ok := m.value(&records[i])
+		if !ok {
+			continue
+		}
+		if len(t.Values) == 0 {
+			t.First, t.Min, t.Max, first = v, v, v, records[i].Time
+		}
+		if v < t.Min {
+			t.Min = v
+		}
+		if v > t.Max {
+			t.Max = v
+		}
+		t.Last, last = v, records[i].Time
+		t.Values = append(t.Values, v)
+	}
+	if len(t.Values) == 0 {
+		return t, false
+	}
+	if hours := last.Sub(first).Hours(); hours > 0 {
+		t.PerHour = (t.Last - t.First) / hours
+	}
+	return t, true
+}
+
+// gcActivity returns the GC cycles and pause time of records, summed over
+// consecutive records of the same process as the counters restart with it.
+func gcActivity(records []historyRecord) (cycles uint64, pause time.Duration, ok bool) {
+	var prev *historyRecord
+	for i := range records {
+		r := &records[i]
+		if r.NumGC == nil || r.PauseTotalNs == nil {
+			continue
+		}
+		ok = true
+		if prev != nil && prev.PID == r.PID && *r.NumGC >= *prev.NumGC {
+			cycles += uint64(*r.NumGC - *prev.NumGC)
+			pause += time.Duration(*r.PauseTotalNs - *prev.PauseTotalNs)
+		}
+		prev = r
+	}
+	return cycles, pause, ok
+}
+
+// historyRestarts counts the changes of PID of records.
+func historyRestarts(records []historyRecord) int {
+	var n int
+	for i := 1; i < len(records); i++ {
+		if records[i].PID != records[i-1].PID {
+			n++
+		}
+	}
+	return n
+}
+
+// downsample averages values into n buckets, keeping them when there are
+// not more.
+func downsample(values []float64, n int) []float64 {
+	if len(values) <= n {
+		return values
+	}
+	out := make([]float64, n)
+	for i := range out {
+		lo, hi := i*len(values)/n, (i+1)*len(values)/n
+		var sum float64
+		for _, v := range values[lo:hi] {
+			sum += v
+		}
+		out[i] = sum / float64(hi-lo)
+	}
+	return out
+}
+
+// formatRate formats the change per hour v with format, such as "+1.5MB/h".
+func formatRate(v float64, format func(float64) string) string {
+	sign := "+"
+	if v < 0 {
+		sign, v = "-", -v
+	}
+	return sign + format(v) + "/h"
+}
+
+// historyReport is the report of a process, printed as JSON with -json.
+type historyReport struct {
+	Target    string        `json:"target"`
+	Samples   int           `json:"samples"`
+	From      time.Time     `json:"from"`
+	To        time.Time     `json:"to"`
+	Restarts  int           `json:"restarts"`
+	Metrics   []metricTrend `json:"metrics"`
+	GCCycles  *uint64       `json:"gcCycles"`
+	GCPauseNs *int64        `json:"gcPauseNs"`
+	gcPerHour float64
+	formats   map[string]func(float64) string
+}
+
+// newHistoryReport returns the report of target over records, which are
+// not empty.
+func newHistoryReport(target string, records []historyRecord) *historyReport {
+	rep := &historyReport{
+		Target:   target,
+		Samples:  len(records),
+		From:     records[0].Time,
+		To:       records[len(records)-1].Time,
+		Restarts: historyRestarts(records),
+		Metrics:  []metricTrend{},
+		formats:  make(map[string]func(float64) string),
+	}
+	for _, m := range historyMetrics {
+		if t, ok := newMetricTrend(m, records); ok {
+			rep.Metrics = append(rep.Metrics, t)
+			rep.formats[m.name] = m.format
+		}
+	}
+	if cycles, pause, ok := gcActivity(records); ok {
+		ns := pause.Nanoseconds()
+		rep.GCCycles, rep.GCPauseNs = &cycles, &ns
+		if hours := rep.To.Sub(rep.From).Hours(); hours > 0 {
+			rep.gcPerHour = float64(cycles) / hours
+		}
+	}
+	return rep
+}
+
+// writeHistoryReport writes rep to w, with the sparkline of each metric over
+// width characters drawn with blocks.
+func writeHistoryReport(w io.Writer, rep *historyReport, width int, blocks []rune) error {
+	restarts := "no restart"
+	if rep.Restarts == 1 {
+		restarts = "1 restart"
+	} else if rep.Restarts > 1 {
+		restarts = fmt.Sprintf("%d restarts", rep.Restarts)
+	}
+	fmt.Fprintf(w, "%s: %d samples from %s to %s (%v), %s\n\n", rep.Target, rep.Samples,
+		rep.From.Format("2006-01-02 15:04"), rep.To.Format("2006-01-02 15:04"),
+		rep.To.Sub(rep.From).Round(time.Minute), restarts)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "METRIC\tFIRST\tLAST\tMIN\tMAX\tCHANGE\t")
+	for _, t := range rep.Metrics {
+		format := rep.formats[t.Name]
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", t.Name, format(t.First), format(t.Last),
+			format(t.Min), format(t.Max), formatRate(t.PerHour, format),
+			sparklineOf(downsample(t.Values, width), blocks))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if rep.GCCycles != nil {
+		fmt.Fprintf(w, "\ngc: %d cycles, %.1f/h, paused %v in total\n", *rep.GCCycles, rep.gcPerHour,
+			time.Duration(*rep.GCPauseNs))
+	}
+	return nil
+}
+
+// report prints the trends of the memory, goroutines and GC of a process
+// over the history that record sampled.
+func report(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	since := fs.Duration("since", 24*time.Hour, "window of the history to report")
+	db := fs.String("db", historyPath(), "history database")
+	width := fs.Int("width", 60, "width of the sparklines")
+	target := parseTargetFlags(fs, args)
+	if target == "" {
+		return errors.New("missing PID or exec name")
+	}
+	if *since <= 0 {
+		return fmt.Errorf("invalid -since %v", *since)
+	}
+	if *width < 1 {
+		return fmt.Errorf("invalid -width %d", *width)
+	}
+	if *db == "" {
+		return errors.New("no home directory for the history database, use -db or $" + historyEnvKey)
+	}
+	f, err := os.Open(*db)
+	if err != nil {
+		return fmt.Errorf("cannot read the history, is record running? %v", err)
+	}
+	defer f.Close()
+	records, err := readHistory(f, target, time.Now().Add(-*since))
+	if err != nil {
+		return fmt.Errorf("cannot read the history: %v", err)
+	}
+	if len(records) == 0 {
+		return fmt.Errorf("no history of %s in the last %v", target, *since)
+	}
+
+	rep := newHistoryReport(target, records)
+	if *jsonOutput {
+		printJSON(rep)
+		return nil
+	}
+	blocks := asciiSparkBlocks
+	if utf8Locale() {
+		blocks = sparkBlocks
+	}
+	return writeHistoryReport(os.Stdout, rep, *width, blocks)
+}
@@ -0,0 +1,131 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/shirou/gopsutil/process"
+)
+
+// instance identifies a process across samples. The start time tells a
+// restarted process apart from an earlier one with a reused PID.
+type instance struct {
+	pid     int
+	created int64
+}
+
+// restartTracker counts the restarts of each exec over a sliding window.
+type restartTracker struct {
+	window    time.Duration
+	instances map[string][]instance
+	restarts  map[string][]time.Time
+}
+
+func newRestartTracker(window time.Duration) *restartTracker {
+	return &restartTracker{
+		window:    window,
+		instances: make(map[string][]instance),
+		restarts:  make(map[string][]time.Time),
+	}
+}
+
+// restart describes a detected restart.
+type restart struct {
+	exec     string
+	from, to int
+	count    int // restarts within the window
+}
+
+// sample records the instances seen at now and returns the restarts since
+// the previous sample. An exec restarted when one of its instances is gone
+// and a new one took its place.
+func (t *restartTracker) sample(now time.Time, seen map[string][]instance) []restart {
+	var found []restart
+	for exec, cur := range seen {
+		prev, ok := t.instances[exec]
+		if !ok {
+			continue
+		}
+		gone := difference(prev, cur)
+		added := difference(cur, prev)
+		for i := 0; i < len(gone) && i < len(added); i++ {
+			t.restarts[exec] = append(t.restarts[exec], now)
+			found = append(found, restart{exec: exec, from: gone[i].pid, to: added[i].pid})
+		}
+	}
+	// The instances of execs no longer running are kept so that a process
+	// missing from a sample and then back counts as a restart.
+	for exec, cur := range seen {
+		t.instances[exec] = cur
+	}
+
+	for exec, times := range t.restarts {
+		i := 0
+		for i < len(times) && now.Sub(times[i]) > t.window {
+			i++
+		}
+		t.restarts[exec] = times[i:]
+	}
+	for i := range found {
+		found[i].count = len(t.restarts[found[i].exec])
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].exec < found[j].exec })
+	return found
+}
+
+// difference returns the instances of a not in b.
+func difference(a, b []instance) []instance {
+	var d []instance
+outer:
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				continue outer
+			}
+		}
+		d = append(d, x)
+	}
+	return d
+}
+
+// watchRestarts samples the dcr processes and reports each restart with the
+// number of restarts of that exec within the window.
+func watchRestarts(args []string) error {
+	fs := flag.NewFlagSet("watch-restarts", flag.ExitOnError)
+	interval := fs.Duration("interval", 2*time.Second, "time between samples")
+	window := fs.Duration("window", 5*time.Minute, "window restarts are counted over")
+	parseCommandFlags(fs, args)
+	if *interval <= 0 || *window <= 0 {
+		return errors.New("interval and window must be positive")
+	}
+
+	t := newRestartTracker(*window)
+	for {
+		seen := make(map[string][]instance)
+		for _, p := range dcrProcesses() {
+			pr, err := process.NewProcess(int32(p.PID))
+			if err != nil {
+				continue
+			}
+			created, err := pr.CreateTime()
+			if err != nil {
+				continue
+			}
+			key := resolver.Key(p.Exec)
+			seen[key] = append(seen[key], instance{pid: p.PID, created: created})
+		}
+		now := time.Now()
+		for _, r := range t.sample(now, seen) {
+			fmt.Printf("%s %s restarted (PID %d -> %d), %d times in %v\n",
+				now.Format("15:04:05"), r.exec, r.from, r.to, r.count, *window)
+		}
+		time.Sleep(*interval)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRestartTracker(t *testing.T) {
+	tracker := newRestartTracker(5 * time.Minute)
+	start := time.Unix(1000, 0)
+
+	samples := []struct {
+		after time.Duration
+		seen  map[string][]instance
+		want  []restart
+	}{
+		{0, map[string][]instance{"dcrd": {{100, 1}}, "dcrwallet": {{200, 1}}}, nil},
+		{time.Minute, map[string][]instance{"dcrd": {{101, 2}}, "dcrwallet": {{200, 1}}},
+			[]restart{{"dcrd", 100, 101, 1}}},
+		// dcrd is down for a sample.
+		{2 * time.Minute, map[string][]instance{"dcrwallet": {{200, 1}}}, nil},
+		// A reused PID with a new start time is a restart too.
+		{3 * time.Minute, map[string][]instance{"dcrd": {{101, 3}}, "dcrwallet": {{200, 1}}},
+			[]restart{{"dcrd", 101, 101, 2}}},
+		// The first restart has left the window.
+		{7 * time.Minute, map[string][]instance{"dcrd": {{102, 4}}, "dcrwallet": {{200, 1}}},
+			[]restart{{"dcrd", 101, 102, 2}}},
+	}
+	for i, s := range samples {
+		got := tracker.sample(start.Add(s.after), s.seen)
+		if len(got) != len(s.want) {
+			t.Fatalf("sample %d: got=%v want=%v", i, got, s.want)
+		}
+		for j := range got {
+			if got[j] != s.want[j] {
+				t.Errorf("sample %d: got=%v want=%v", i, got[j], s.want[j])
+			}
+		}
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/gops/signal"
+)
+
+// probe checks that a single agent command answers.
+type probe struct {
+	name string
+	// long probes take a fixed capture window on the agent side and are
+	// only run with -long.
+	long bool
+	run  func(addr net.TCPAddr, timeout time.Duration) error
+}
+
+// probeSignal returns a probe func that sends sig and expects a non-empty
+// response.
+func probeSignal(sig byte) func(net.TCPAddr, time.Duration) error {
+	return func(addr net.TCPAddr, timeout time.Duration) error {
+		out, err := cmdDeadline(addr, timeout, sig)
+		if err != nil {
+			return err
+		}
+		if len(out) == 0 {
+			return errors.New("empty response")
+		}
+		return nil
+	}
+}
+
+var prevGCPercent = regexp.MustCompile(`Previous value was (-?[0-9]+)`)
+
+// probeSetGC sets the GC percentage and restores the previous value reported
+// by the agent, leaving the process as it was found.
+func probeSetGC(addr net.TCPAddr, timeout time.Duration) error {
+	setgc := func(perc int64) ([]byte, error) {
+		buf := make([]byte, binary.MaxVarintLen64)
+		binary.PutVarint(buf, perc)
+		return cmdDeadline(addr, timeout, signal.SetGCPercent, buf...)
+	}
+	out, err := setgc(100)
+	if err != nil {
+		return err
+	}
+	m := prevGCPercent.FindSubmatch(out)
+	if m == nil {
+		return fmt.Errorf("unexpected response %q", out)
+	}
+	prev, err := strconv.ParseInt(string(m[1]), 10, 64)
+	if err != nil {
+		return err
+	}
+	if prev == 100 {
+		return nil
+	}
+	_, err = setgc(prev)
+	return err
+}
+
+// timeout returns how long p may take, the long captures being far slower
+// than the probe timeout given.
+func (p probe) timeout(timeout time.Duration) time.Duration {
+	switch p.name {
+	case "pprof-cpu":
+		return 30*time.Second + timeout
+	case "trace":
+		return 5*time.Second + timeout
+	}
+	return timeout
+}
+
+// probeCell returns the matrix cell of the result err of p: "-" when p was
+// skipped, a long probe without long, "FAIL" when it failed and "ok".
+func probeCell(p probe, long bool, err error) string {
+	switch {
+	case p.long && !long:
+		return "-"
+	case err != nil:
+		return "FAIL"
+	}
+	return "ok"
+}
+
+// probes are run in order against every agent-enabled process.
+var probes = []probe{
+	{name: "stack", run: probeSignal(signal.StackTrace)},
+	{name: "gc", run: probeSignal(signal.GC)},
+	{name: "setgc", run: probeSetGC},
+	{name: "memstats", run: probeSignal(signal.MemStats)},
+	{name: "version", run: probeSignal(signal.Version)},
+	{name: "stats", run: probeSignal(signal.Stats)},
+	{name: "pprof-heap", run: probeSignal(signal.HeapProfile)},
+	{name: "binary", run: probeSignal(signal.BinaryDump)},
+	{name: "pprof-cpu", long: true, run: probeSignal(signal.CPUProfile)},
+	{name: "trace", long: true, run: probeSignal(signal.Trace)},
+}
+
+// selftest probes every agent command of each agent-enabled dcr process and
+// prints a process by command matrix of the results.
+func selftest(args []string) error {
+	fs := flag.NewFlagSet("selftest", flag.ExitOnError)
+	timeout := fs.Duration("timeout", 3*time.Second, "timeout for each probe")
+	long := fs.Bool("long", false, "also probe the long-running captures")
+	parseCommandFlags(fs, args)
+
+	var targets []int
+	var names []string
+	for _, p := range dcrProcesses() {
+		if !p.Agent {
+			continue
+		}
+		targets = append(targets, p.PID)
+		names = append(names, p.Exec)
+	}
+	if len(targets) == 0 {
+		return errors.New("no agent-enabled dcr processes found")
+	}
+
+	// Processes are probed concurrently, but the commands of one process
+	// are sent one at a time since the agent serves a single connection at
+	// a time.
+	results := make([][]error, len(targets))
+	var wg sync.WaitGroup
+	for i, pid := range targets {
+		results[i] = make([]error, len(probes))
+		wg.Add(1)
+		go func(i, pid int) {
+			defer wg.Done()
+			addr, err := resolver.Resolve(strconv.Itoa(pid))
+			if err != nil {
+				for j := range probes {
+					results[i][j] = err
+				}
+				return
+			}
+			for j, p := range probes {
+				if p.long && !*long {
+					continue
+				}
+				results[i][j] = p.run(*addr, p.timeout(*timeout))
+			}
+		}(i, pid)
+	}
+	wg.Wait()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprint(w, "PID\tEXEC")
+	for _, p := range probes {
+		fmt.Fprintf(w, "\t%s", p.name)
+	}
+	fmt.Fprintln(w)
+	var failures []string
+	for i, pid := range targets {
+		fmt.Fprintf(w, "%d\t%s", pid, names[i])
+		for j, p := range probes {
+			cell := probeCell(p, *long, results[i][j])
+			if cell == "FAIL" {
+				failures = append(failures, fmt.Sprintf("%d %s %s: %v",
+					pid, names[i], p.name, results[i][j]))
+			}
+			fmt.Fprintf(w, "\t%s", cell)
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+
+	if len(failures) > 0 {
+		fmt.Println()
+		for _, f := range failures {
+			fmt.Println(f)
+		}
+		return fmt.Errorf("%d probes failed", len(failures))
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestProbeCell(t *testing.T) {
+	short := probe{name: "stack"}
+	long := probe{name: "trace", long: true}
+	failed := errors.New("empty response")
+	tests := []struct {
+		p    probe
+		long bool
+		err  error
+		want string
+	}{
+		{short, false, nil, "ok"},
+		{short, false, failed, "FAIL"},
+		{short, true, failed, "FAIL"},
+		{long, false, nil, "-"},
+		// A skipped probe has no result, even one left by a failed resolve.
+		{long, false, failed, "-"},
+		{long, true, nil, "ok"},
+		{long, true, failed, "FAIL"},
+	}
+	for _, test := range tests {
+		if got := probeCell(test.p, test.long, test.err); got != test.want {
+			t.Errorf("probeCell(%s, long %v, %v): got %q, want %q",
+				test.p.name, test.long, test.err, got, test.want)
+		}
+	}
+}
+
+func TestProbeTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		want time.Duration
+	}{
+		{"stack", 3 * time.Second},
+		{"pprof-cpu", 33 * time.Second},
+		{"trace", 8 * time.Second},
+	}
+	for _, test := range tests {
+		if got := (probe{name: test.name}).timeout(3 * time.Second); got != test.want {
+			t.Errorf("timeout of %s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+// setGCServer serves an agent whose GC percentage starts at perc and
+// answers the set GC percentage requests as the agent does. It returns its
+// address and the percentages it was set to.
+func setGCServer(t *testing.T, perc int64) (*net.TCPAddr, *[]int64) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var set []int64
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			buf := make([]byte, 1+binary.MaxVarintLen64)
+			conn.Read(buf)
+			v, _ := binary.Varint(buf[1:])
+			set = append(set, v)
+			fmt.Fprintf(conn, "New GC percent set to %v. Previous value was %v.\n", v, perc)
+			perc = v
+			conn.Close()
+		}
+	}()
+	return l.Addr().(*net.TCPAddr), &set
+}
+
+func TestProbeSetGC(t *testing.T) {
+	tests := []struct {
+		perc int64
+		want []int64
+	}{
+		// The percentage probed with is left as it was.
+		{100, []int64{100}},
+		{50, []int64{100, 50}},
+		{-1, []int64{100, -1}},
+	}
+	for _, test := range tests {
+		addr, set := setGCServer(t, test.perc)
+		if err := probeSetGC(*addr, time.Second); err != nil {
+			t.Errorf("probeSetGC from %d: %v", test.perc, err)
+			continue
+		}
+		if fmt.Sprint(*set) != fmt.Sprint(test.want) {
+			t.Errorf("probeSetGC from %d: set %v, want %v", test.perc, *set, test.want)
+		}
+	}
+}
@@ -0,0 +1,384 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	ossignal "os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/dcrlabs/dcrps/pkg/dcrps"
+	"github.com/dcrlabs/dcrps/resolve"
+	dcrsignal "github.com/dcrlabs/dcrps/signal"
+	"github.com/google/gops/goprocess"
+	"github.com/google/gops/signal"
+)
+
+// serveEndpoints are the endpoints of serve, by the names -allow permits
+// them by: the listing and the process info, and the commands of the agent
+// with /process/{pid}/ and their name, the pprof ones under pprof/.
+var serveEndpoints = []string{
+	"processes", "info", "memstats", "stats", "stack", "version",
+	"pprof-heap", "pprof-cpu", "pprof-mutex", "pprof-block", "gc",
+}
+
+func isServeEndpoint(name string) bool {
+	return indexOf(serveEndpoints, name) < len(serveEndpoints)
+}
+
+// defaultServeAllow are the endpoints serve permits by default: all but gc,
+// which changes the process.
+const defaultServeAllow = "processes,info,memstats,stats,stack,version," +
+	"pprof-heap,pprof-cpu,pprof-mutex,pprof-block"
+
+// parseServeAllow parses the comma-separated list of endpoints of -allow.
+func parseServeAllow(list string) (map[string]bool, error) {
+	allow := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !isServeEndpoint(name) {
+			return nil, fmt.Errorf("unknown endpoint %q, the endpoints are %s",
+				name, strings.Join(serveEndpoints, ", "))
+		}
+		allow[name] = true
+	}
+	if len(allow) == 0 {
+		return nil, errors.New("-allow permits no endpoint")
+	}
+	return allow, nil
+}
+
+// serveToken returns the token the clients of serve must send: the first
+// line of path, or else $DCRPS_SERVE_TOKEN. It is "" when there is none.
+func serveToken(path string) (string, error) {
+	if path == "" {
+		return os.Getenv("DCRPS_SERVE_TOKEN"), nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid -auth-token-file: %v", err)
+	}
+	token := strings.TrimSpace(strings.SplitN(string(b), "\n", 2)[0])
+	if token == "" {
+		return "", fmt.Errorf("invalid -auth-token-file: %s holds no token", path)
+	}
+	return token, nil
+}
+
+// isLoopbackListen reports whether the listen address addr only accepts
+// connections from this host.
+func isLoopbackListen(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// apiServer serves the listing of the dcr processes and the commands of their
+// agents as JSON, text or profiles over HTTP.
+type apiServer struct {
+	token string // the bearer token of the clients, "" for none
+	allow map[string]bool
+	peers *net.IPNet // the -connected-to range of the listing, nil for none
+
+	// mu serializes the requests past their checks, as they share the
+	// resolver and set the global cmdTimeout.
+	mu sync.Mutex
+}
+
+// apiError is the JSON body of the failed requests.
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		status = http.StatusInternalServerError
+		b, _ = json.Marshal(apiError{err.Error()})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(b, '\n'))
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeAPIJSON(w, status, apiError{err.Error()})
+}
+
+// apiStatus returns the HTTP status of the failure err of a request to an
+// agent, by the exit status dcrps fails with.
+func apiStatus(err error) int {
+	switch exitCode(err) {
+	case exitNoProcess:
+		return http.StatusNotFound
+	case exitAgentUnreachable:
+		return http.StatusBadGateway
+	}
+	if strings.HasPrefix(err.Error(), "the agent didn't answer") {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
+
+// authorized reports whether r carries the token, in constant time.
+func (s *apiServer) authorized(r *http.Request) bool {
+	if s.token == "" {
+		return true
+	}
+	h := r.Header.Get("Authorization")
+	if !strings.HasPrefix(h, "Bearer ") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(h[len("Bearer "):]), []byte(s.token)) == 1
+}
+
+// route returns the endpoint of path, and the PID for those of a process.
+func route(path string) (endpoint string, pid int, ok bool) {
+	if path == "/processes" {
+		return "processes", 0, true
+	}
+	parts := strings.Split(strings.TrimPrefix(path, "/process/"), "/")
+	if !strings.HasPrefix(path, "/process/") || len(parts) > 3 {
+		return "", 0, false
+	}
+	pid, err := strconv.Atoi(parts[0])
+	if err != nil || pid <= 0 {
+		return "", 0, false
+	}
+	switch {
+	case len(parts) == 1:
+		return "info", pid, true
+	case len(parts) == 3 && parts[1] == "pprof":
+		endpoint = "pprof-" + parts[2]
+	case len(parts) == 2 && !strings.HasPrefix(parts[1], "pprof"):
+		endpoint = parts[1]
+	default:
+		return "", 0, false
+	}
+	if !isServeEndpoint(endpoint) {
+		return "", 0, false
+	}
+	return endpoint, pid, true
+}
+
+func (s *apiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="dcrps"`)
+		writeAPIError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+		return
+	}
+	endpoint, pid, ok := route(r.URL.Path)
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("no endpoint %s", r.URL.Path))
+		return
+	}
+	if !s.allow[endpoint] {
+		writeAPIError(w, http.StatusForbidden, fmt.Errorf("the %s endpoint is not allowed, see -allow", endpoint))
+		return
+	}
+	method := http.MethodGet
+	if endpoint == "gc" {
+		method = http.MethodPost
+	}
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeAPIError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s takes %s", r.URL.Path, method))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if endpoint == "processes" {
+		ps := connectedProcesses(s.peers)
+		writeAPIJSON(w, http.StatusOK, listingJSON(ps, nil, processUsages(ps)))
+		return
+	}
+	p, ok, err := goprocess.Find(pid)
+	if err != nil || !ok || !resolver.Match(p.Exec) {
+		// Only the processes of the listing are served.
+		writeAPIError(w, http.StatusNotFound, &resolve.NoProcessError{Target: strconv.Itoa(pid)})
+		return
+	}
+	if endpoint == "info" {
+		info, err := newProcessInfoJSON(pid)
+		if err != nil {
+			writeAPIError(w, http.StatusNotFound, err)
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, info)
+		return
+	}
+	if !p.Agent {
+		writeAPIError(w, http.StatusBadGateway, fmt.Errorf("process %d (%s) is not running the agent", pid, p.Exec))
+		return
+	}
+	addr, err := resolver.Resolve(strconv.Itoa(pid))
+	if err != nil {
+		writeAPIError(w, apiStatus(err), err)
+		return
+	}
+	s.serveAgent(w, r, endpoint, *addr)
+}
+
+// serveAgent serves endpoint from the agent at addr.
+func (s *apiServer) serveAgent(w http.ResponseWriter, r *http.Request, endpoint string, addr net.TCPAddr) {
+	q := r.URL.Query()
+	cmdTimeout = 10 * time.Second
+	var (
+		out []byte
+		err error
+	)
+	switch endpoint {
+	case "memstats":
+		ms, full, err := readMemStats(addr)
+		if err != nil {
+			writeAPIError(w, apiStatus(err), err)
+			return
+		}
+		if q.Get("raw") == "" {
+			writeAPIJSON(w, http.StatusOK, newMemStatsSummary(ms))
+			return
+		}
+		w.Header().Set("X-Dcrps-Full-Memstats", strconv.FormatBool(full))
+		writeAPIJSON(w, http.StatusOK, ms)
+		return
+	case "stats":
+		if out, err = cmd(addr, signal.Stats); err == nil {
+			writeAPIJSON(w, http.StatusOK, dcrps.ParseKeyValues(out))
+			return
+		}
+	case "stack":
+		if out, err = cmd(addr, signal.StackTrace); err == nil && q.Get("dedupe") != "" {
+			out = []byte(dedupeReport(dcrps.ParseStack(out)))
+		}
+	case "version":
+		out, err = cmd(addr, signal.Version)
+	case "gc":
+		cmdTimeout = time.Minute
+		if _, err = cmd(addr, signal.GC); err == nil {
+			writeAPIJSON(w, http.StatusOK, struct{}{})
+			return
+		}
+	case "pprof-heap", "pprof-mutex", "pprof-block":
+		sigs := map[string]byte{
+			"pprof-heap":  signal.HeapProfile,
+			"pprof-mutex": dcrsignal.MutexProfile,
+			"pprof-block": dcrsignal.BlockProfile,
+		}
+		cmdTimeout = time.Minute
+		out, err = cmd(addr, sigs[endpoint])
+		if err == nil && len(out) == 0 {
+			if msg, ok := emptyProfileErrors[sigs[endpoint]]; ok {
+				err = errors.New(msg)
+			} else {
+				err = errors.New("failed to read the profile")
+			}
+		}
+	case "pprof-cpu":
+		window := defaultCPUProfileWindow
+		if v := q.Get("seconds"); v != "" {
+			n, perr := strconv.Atoi(v)
+			if perr != nil || n <= 0 {
+				writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid seconds %q", v))
+				return
+			}
+			window = time.Duration(n) * time.Second
+		}
+		if out, err = captureCPUProfile(addr, window); err == nil && len(out) == 0 {
+			err = errors.New("failed to read the profile")
+		}
+	}
+	if err != nil {
+		writeAPIError(w, apiStatus(err), err)
+		return
+	}
+	if strings.HasPrefix(endpoint, "pprof-") {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%d.pprof"`,
+			strings.TrimPrefix(endpoint, "pprof-"), addr.Port))
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	w.Write(out)
+}
+
+// serve serves the listing of the dcr processes and the commands of their
+// agents over HTTP until interrupted, for monitoring systems and dashboards.
+func serve(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:7070", "address to serve the API at")
+	tokenPath := fs.String("auth-token-file", "", "file holding the bearer token of the clients")
+	allowList := fs.String("allow", defaultServeAllow, "comma-separated endpoints to serve")
+	parseCommandFlags(fs, args)
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %q", fs.Args())
+	}
+	allow, err := parseServeAllow(*allowList)
+	if err != nil {
+		return err
+	}
+	token, err := serveToken(*tokenPath)
+	if err != nil {
+		return err
+	}
+	// Checked here, as the listing would otherwise fail each request.
+	peers, err := peerFilterNet()
+	if err != nil {
+		return err
+	}
+	if token == "" && !isLoopbackListen(*listen) {
+		return fmt.Errorf("refusing to serve %s beyond this host without a token, "+
+			"see -auth-token-file", *listen)
+	}
+
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: &apiServer{token: token, allow: allow, peers: peers}}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.Serve(l) }()
+	names := make([]string, 0, len(allow))
+	for name := range allow {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(os.Stderr, "serving the API at http://%s/, endpoints %s\n", l.Addr(), strings.Join(names, ","))
+
+	interrupt := make(chan os.Signal, 1)
+	ossignal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer ossignal.Stop(interrupt)
+	select {
+	case err := <-serveErr:
+		return err
+	case <-interrupt:
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return srv.Shutdown(ctx)
+	}
+}
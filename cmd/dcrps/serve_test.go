@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRoute(t *testing.T) {
+	tests := []struct {
+		path     string
+		endpoint string
+		pid      int
+		ok       bool
+	}{
+		{"/processes", "processes", 0, true},
+		{"/process/42", "info", 42, true},
+		{"/process/42/memstats", "memstats", 42, true},
+		{"/process/42/stack", "stack", 42, true},
+		{"/process/42/gc", "gc", 42, true},
+		{"/process/42/pprof/heap", "pprof-heap", 42, true},
+		{"/process/42/pprof/cpu", "pprof-cpu", 42, true},
+		{"/process/42/pprof-heap", "", 0, false},
+		{"/process/42/pprof/goroutine", "", 0, false},
+		{"/process/42/trace", "", 0, false},
+		{"/process/dcrd/stack", "", 0, false},
+		{"/process/-1", "", 0, false},
+		{"/process/42/stack/more", "", 0, false},
+		{"/", "", 0, false},
+	}
+	for _, test := range tests {
+		endpoint, pid, ok := route(test.path)
+		if endpoint != test.endpoint || pid != test.pid || ok != test.ok {
+			t.Errorf("route(%q): got=%q, %d, %t want=%q, %d, %t", test.path,
+				endpoint, pid, ok, test.endpoint, test.pid, test.ok)
+		}
+	}
+}
+
+func TestParseServeAllow(t *testing.T) {
+	allow, err := parseServeAllow(defaultServeAllow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allow["gc"] || !allow["stack"] || !allow["pprof-cpu"] {
+		t.Errorf("default allow: got=%v", allow)
+	}
+	if _, err := parseServeAllow("stack,trace"); err == nil {
+		t.Error("unknown endpoint: got no error")
+	}
+	if _, err := parseServeAllow(" , "); err == nil {
+		t.Error("empty list: got no error")
+	}
+}
+
+func TestIsLoopbackListen(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"127.0.0.1:7070": true,
+		"localhost:7070": true,
+		"[::1]:7070":     true,
+		":7070":          false,
+		"0.0.0.0:7070":   false,
+		"10.0.0.5:7070":  false,
+		"nonsense":       false,
+	} {
+		if got := isLoopbackListen(addr); got != want {
+			t.Errorf("isLoopbackListen(%q): got=%t want=%t", addr, got, want)
+		}
+	}
+}
+
+func TestAPIServerRejects(t *testing.T) {
+	s := &apiServer{token: "s3cret", allow: map[string]bool{"stack": true, "gc": true}}
+	tests := []struct {
+		method, path, auth string
+		status             int
+	}{
+		{"GET", "/processes", "", http.StatusUnauthorized},
+		{"GET", "/processes", "Bearer wrong", http.StatusUnauthorized},
+		{"GET", "/processes", "s3cret", http.StatusUnauthorized},
+		{"GET", "/processes", "Bearer s3cret", http.StatusForbidden},
+		{"GET", "/process/42/memstats", "Bearer s3cret", http.StatusForbidden},
+		{"GET", "/nowhere", "Bearer s3cret", http.StatusNotFound},
+		{"GET", "/process/42/gc", "Bearer s3cret", http.StatusMethodNotAllowed},
+		{"POST", "/process/42/stack", "Bearer s3cret", http.StatusMethodNotAllowed},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, test.path, nil)
+		if test.auth != "" {
+			r.Header.Set("Authorization", test.auth)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		if w.Code != test.status {
+			t.Errorf("%s %s with %q: got=%d want=%d", test.method, test.path, test.auth, w.Code, test.status)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s %s: got Content-Type %q", test.method, test.path, ct)
+		}
+	}
+}
+
+func TestServeInvalidPeerFilter(t *testing.T) {
+	defer func(v string) { *peerFilter = v }(*peerFilter)
+	*peerFilter = "10.0.0.0/33"
+	err := serve([]string{"-listen", "127.0.0.1:0"})
+	if err == nil || !strings.Contains(err.Error(), "invalid -connected-to") {
+		t.Errorf("got %v, want the -connected-to error before serving", err)
+	}
+}
+
+func TestAPIServerPeerFilter(t *testing.T) {
+	// No process is connected to the documentation range.
+	_, peers, _ := net.ParseCIDR("192.0.2.0/24")
+	s := &apiServer{allow: map[string]bool{"processes": true}, peers: peers}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/processes", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got=%d want=%d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	var ps []json.RawMessage
+	if err := json.Unmarshal(w.Body.Bytes(), &ps); err != nil || len(ps) != 0 {
+		t.Errorf("got %s, want no process", w.Body)
+	}
+}
@@ -0,0 +1,441 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dcrlabs/dcrps/internal"
+	"github.com/google/gops/goprocess"
+	"github.com/shirou/gopsutil/process"
+	goversion "rsc.io/goversion/version"
+)
+
+// Service managers.
+const (
+	managerSystemd = "systemd"
+	managerLaunchd = "launchd"
+	managerWindows = "windows"
+)
+
+// serviceInfo is the service a process runs as, under systemd, launchd or
+// the Windows service manager.
+type serviceInfo struct {
+	Manager string `json:"manager"`
+	Unit    string `json:"unit"` // the unit, label or service name
+	// User is set for the units of a systemd user manager.
+	User bool `json:"user,omitempty"`
+	// Started is when the manager last started the main process of the
+	// unit and Restarts how many times it restarted it, when it tells.
+	Started  *time.Time `json:"started,omitempty"`
+	Restarts *int       `json:"restarts,omitempty"`
+}
+
+// parseCgroupUnit returns the systemd unit of a process from its
+// /proc/<pid>/cgroup file. The processes of the user manager itself and of
+// the login sessions aren't in a unit of their own.
+func parseCgroupUnit(cgroup []byte) (unit string, user bool) {
+	scanner := bufio.NewScanner(bytes.NewReader(cgroup))
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		// The hierarchy of systemd: its named one in cgroup v1, the
+		// unified one in v2.
+		if fields[1] != "name=systemd" && !(fields[0] == "0" && fields[1] == "") {
+			continue
+		}
+		elems := strings.Split(fields[2], "/")
+		for i := len(elems) - 1; i >= 0; i-- {
+			if !strings.HasSuffix(elems[i], ".service") {
+				continue
+			}
+			if strings.HasPrefix(elems[i], "user@") {
+				return "", false
+			}
+			return elems[i], strings.Contains(fields[2], "/user@")
+		}
+		return "", false
+	}
+	return "", false
+}
+
+// parseLaunchctlList returns the labels of the jobs of "launchctl list" by
+// PID, leaving out the ones not running.
+func parseLaunchctlList(out []byte) map[int]string {
+	labels := make(map[int]string)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		if pid, err := strconv.Atoi(fields[0]); err == nil {
+			labels[pid] = fields[2]
+		}
+	}
+	return labels
+}
+
+// parseTasklistServices returns the services of the processes of
+// "tasklist /svc /fo csv /nh" by PID, leaving out the processes hosting
+// none. A process hosting several is given the first.
+func parseTasklistServices(out []byte) map[int]string {
+	services := make(map[int]string)
+	records, _ := csv.NewReader(bytes.NewReader(out)).ReadAll()
+	for _, r := range records {
+		if len(r) != 3 || r[2] == "N/A" {
+			continue
+		}
+		if pid, err := strconv.Atoi(r[1]); err == nil {
+			services[pid] = strings.Split(r[2], ",")[0]
+		}
+	}
+	return services
+}
+
+// findServices returns the services of the processes with the given PIDs, by
+// PID, leaving out the processes that aren't services. It is empty on the
+// systems with none of the known managers.
+func findServices(pids []int) map[int]*serviceInfo {
+	services := make(map[int]*serviceInfo)
+	switch runtime.GOOS {
+	case "linux":
+		for _, pid := range pids {
+			b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid))
+			if err != nil {
+				continue
+			}
+			if unit, user := parseCgroupUnit(b); unit != "" {
+				services[pid] = &serviceInfo{Manager: managerSystemd, Unit: unit, User: user}
+			}
+		}
+	case "darwin":
+		out, err := exec.Command("launchctl", "list").Output()
+		if err != nil {
+			return services
+		}
+		labels := parseLaunchctlList(out)
+		for _, pid := range pids {
+			if label, ok := labels[pid]; ok {
+				services[pid] = &serviceInfo{Manager: managerLaunchd, Unit: label}
+			}
+		}
+	case "windows":
+		out, err := exec.Command("tasklist", "/svc", "/fo", "csv", "/nh").Output()
+		if err != nil {
+			return services
+		}
+		names := parseTasklistServices(out)
+		for _, pid := range pids {
+			if name, ok := names[pid]; ok {
+				services[pid] = &serviceInfo{Manager: managerWindows, Unit: name}
+			}
+		}
+	}
+	return services
+}
+
+// systemdTimestampLayout is how systemctl show writes the timestamps.
+const systemdTimestampLayout = "Mon 2006-01-02 15:04:05 MST"
+
+// parseSystemctlShow reads the start time of the main process and the
+// restart count of a unit from the output of "systemctl show" into s. The
+// restart count needs systemd 235.
+func parseSystemctlShow(out []byte, s *serviceInfo) {
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		i := strings.Index(line, "=")
+		if i < 0 {
+			continue
+		}
+		key, v := line[:i], line[i+1:]
+		switch key {
+		case "NRestarts":
+			if n, err := strconv.Atoi(v); err == nil {
+				s.Restarts = &n
+			}
+		case "ExecMainStartTimestamp":
+			if t, err := time.ParseInLocation(systemdTimestampLayout, v, time.Local); err == nil {
+				s.Started = &t
+			}
+		}
+	}
+}
+
+// readDetails reads the start time and the restart count of s from its
+// manager, when it tells: systemd does, the others only through the start
+// time of the process, which pid is.
+func (s *serviceInfo) readDetails(pid int) {
+	if s.Manager == managerSystemd {
+		args := []string{"show", "-p", "NRestarts", "-p", "ExecMainStartTimestamp", s.Unit}
+		if s.User {
+			args = append([]string{"--user"}, args...)
+		}
+		if out, err := exec.Command("systemctl", args...).Output(); err == nil {
+			parseSystemctlShow(out, s)
+		}
+	}
+	if s.Started != nil {
+		return
+	}
+	if p, err := process.NewProcess(int32(pid)); err == nil {
+		if created, err := p.CreateTime(); err == nil {
+			t := time.Unix(0, created*int64(time.Millisecond))
+			s.Started = &t
+		}
+	}
+}
+
+// restartCommand returns the command that restarts s with its manager.
+func (s *serviceInfo) restartCommand() []string {
+	switch s.Manager {
+	case managerSystemd:
+		if s.User {
+			return []string{"systemctl", "--user", "restart", s.Unit}
+		}
+		return []string{"systemctl", "restart", s.Unit}
+	case managerLaunchd:
+		return []string{"launchctl", "kickstart", "-k", "system/" + s.Unit}
+	case managerWindows:
+		return []string{"powershell", "-Command", "Restart-Service", s.Unit}
+	}
+	return nil
+}
+
+// deletedSuffix is what Linux appends to the /proc/<pid>/exe link of a
+// process whose executable was removed or replaced.
+const deletedSuffix = " (deleted)"
+
+// staleBinary reports whether the executable of the process with the given
+// PID was replaced on disk since the process started, such as by an upgrade,
+// and returns its path. On Linux, the running image is compared to the file
+// at the path; elsewhere, the modification time of the file to the start
+// time of the process.
+func staleBinary(pid int) (stale bool, path string, err error) {
+	if runtime.GOOS == "linux" {
+		link := fmt.Sprintf("/proc/%d/exe", pid)
+		path, err := os.Readlink(link)
+		if err != nil {
+			return false, "", err
+		}
+		if strings.HasSuffix(path, deletedSuffix) {
+			return true, strings.TrimSuffix(path, deletedSuffix), nil
+		}
+		image, err := os.Stat(link)
+		if err != nil {
+			return false, path, err
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			return true, path, nil
+		}
+		return !os.SameFile(image, fi), path, nil
+	}
+	p, err := process.NewProcess(int32(pid))
+	if err != nil {
+		return false, "", err
+	}
+	if path, err = p.Exe(); err != nil {
+		return false, "", err
+	}
+	created, err := p.CreateTime()
+	if err != nil {
+		return false, path, err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return true, path, nil
+	}
+	return fi.ModTime().After(time.Unix(0, created*int64(time.Millisecond))), path, nil
+}
+
+// parseProcStat returns the exec name and the parent PID of a process from
+// its /proc/<pid>/stat file, whose name is in parentheses and may contain
+// spaces and parentheses itself.
+func parseProcStat(stat []byte) (exec string, ppid int, ok bool) {
+	s := string(stat)
+	open, end := strings.Index(s, "("), strings.LastIndex(s, ")")
+	if open < 0 || end < open {
+		return "", 0, false
+	}
+	// The state, then the parent PID.
+	fields := strings.Fields(s[end+1:])
+	if len(fields) < 2 {
+		return "", 0, false
+	}
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return "", 0, false
+	}
+	return s[open+1 : end], ppid, true
+}
+
+// replacedProcesses returns the Go processes whose executable was removed or
+// replaced on Linux and whose exec name match reports, leaving out those in
+// known. goprocess can't list them: it reads the executable at its path,
+// which is gone or isn't the one running, where they are read through their
+// /proc/<pid>/exe link instead. It is empty on the other systems.
+func replacedProcesses(match func(exec string) bool, known []goprocess.P) []goprocess.P {
+	if runtime.GOOS != "linux" {
+		return nil
+	}
+	dirs, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+	seen := make(map[int]bool)
+	for _, p := range known {
+		seen[p.PID] = true
+	}
+	var ps []goprocess.P
+	for _, d := range dirs {
+		pid, err := strconv.Atoi(d.Name())
+		if err != nil || seen[pid] {
+			continue
+		}
+		link := fmt.Sprintf("/proc/%d/exe", pid)
+		path, err := os.Readlink(link)
+		if err != nil || !strings.HasSuffix(path, deletedSuffix) {
+			continue
+		}
+		stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		if err != nil {
+			continue
+		}
+		exec, ppid, ok := parseProcStat(stat)
+		if !ok || !match(exec) {
+			continue
+		}
+		v, err := goversion.ReadExe(link)
+		if err != nil {
+			continue
+		}
+		p := goprocess.P{PID: pid, PPID: ppid, Exec: exec,
+			Path: strings.TrimSuffix(path, deletedSuffix), BuildVersion: v.Release}
+		if pidfile, err := internal.PIDFile(pid); err == nil {
+			_, err := os.Stat(pidfile)
+			p.Agent = err == nil
+		}
+		ps = append(ps, p)
+	}
+	return ps
+}
+
+// processServices returns the services of ps, by PID.
+func processServices(ps []goprocess.P) map[int]*serviceInfo {
+	defer benchPhase("process collection")()
+	pids := make([]int, len(ps))
+	for i, p := range ps {
+		pids[i] = p.PID
+	}
+	return findServices(pids)
+}
+
+// staleBinaries returns whether the executables of ps were replaced since
+// they started, by PID, leaving out the ones that can't be told.
+func staleBinaries(ps []goprocess.P) map[int]bool {
+	defer benchPhase("process collection")()
+	stale := make(map[int]bool)
+	for _, p := range ps {
+		if v, _, err := staleBinary(p.PID); err == nil {
+			stale[p.PID] = v
+		}
+	}
+	return stale
+}
+
+// formatService formats s for the process info, e.g. "dcrd.service
+// (systemd), started 2019-05-13 10:00:00, 2 restarts".
+func formatService(s *serviceInfo) string {
+	v := fmt.Sprintf("%s (%s)", s.Unit, s.Manager)
+	if s.User {
+		v = fmt.Sprintf("%s (%s user)", s.Unit, s.Manager)
+	}
+	if s.Started != nil {
+		v += ", started " + s.Started.Format("2006-01-02 15:04:05")
+	}
+	if s.Restarts != nil {
+		v += fmt.Sprintf(", %d restarts", *s.Restarts)
+	}
+	return v
+}
+
+// staleProcess is a process listed by stale.
+type staleProcess struct {
+	PID     int          `json:"pid"`
+	Exec    string       `json:"exec"`
+	Path    string       `json:"path"`
+	Service *serviceInfo `json:"service"`
+	// Restart is the command that restarts the service, when known.
+	Restart string `json:"restart,omitempty"`
+}
+
+// listStale lists the processes whose executable was replaced on disk since
+// they started, as by an upgrade, with the command that restarts their
+// service, and fails when there is one.
+func listStale(args []string) error {
+	fs := flag.NewFlagSet("stale", flag.ExitOnError)
+	parseCommandFlags(fs, args)
+	ps := dcrProcesses()
+	services := processServices(ps)
+	found := []staleProcess{}
+	unknown := 0
+	for _, p := range ps {
+		stale, path, err := staleBinary(p.PID)
+		if err != nil {
+			unknown++
+			continue
+		}
+		if !stale {
+			continue
+		}
+		sp := staleProcess{PID: p.PID, Exec: p.Exec, Path: path, Service: services[p.PID]}
+		if sp.Service != nil {
+			sp.Restart = strings.Join(sp.Service.restartCommand(), " ")
+		}
+		found = append(found, sp)
+	}
+	if unknown > 0 {
+		fmt.Fprintf(os.Stderr, "cannot tell for %d of the %d processes, their executables can't be read\n",
+			unknown, len(ps))
+	}
+
+	if *jsonOutput {
+		printJSON(found)
+	} else if len(found) == 0 {
+		fmt.Println("no process runs a replaced binary")
+	} else {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "PID\tEXEC\tBINARY\tRESTART WITH")
+		for _, sp := range found {
+			restart := sp.Restart
+			if restart == "" {
+				restart = "-"
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", sp.PID, sp.Exec, sp.Path, restart)
+		}
+		tw.Flush()
+	}
+	if len(found) > 0 {
+		return fmt.Errorf("%d of %d processes run a binary replaced on disk since they started, restart them",
+			len(found), len(ps))
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCgroupUnit(t *testing.T) {
+	tests := []struct {
+		cgroup string
+		unit   string
+		user   bool
+	}{
+		{"0::/system.slice/dcrd.service\n", "dcrd.service", false},
+		{"12:pids:/system.slice/dcrd.service\n1:name=systemd:/system.slice/dcrwallet.service\n", "dcrwallet.service", false},
+		{"0::/user.slice/user-1000.slice/user@1000.service/app.slice/dcrd.service\n", "dcrd.service", true},
+		{"0::/user.slice/user-1000.slice/user@1000.service/init.scope\n", "", false},
+		{"0::/user.slice/user-1000.slice/session-2.scope\n", "", false},
+		{"0::/\n", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		unit, user := parseCgroupUnit([]byte(tt.cgroup))
+		if unit != tt.unit || user != tt.user {
+			t.Errorf("%q: got %q, %v want %q, %v", tt.cgroup, unit, user, tt.unit, tt.user)
+		}
+	}
+}
+
+func TestParseLaunchctlList(t *testing.T) {
+	out := "PID\tStatus\tLabel\n" +
+		"412\t0\torg.decred.dcrd\n" +
+		"-\t0\torg.decred.dcrwallet\n"
+	got := parseLaunchctlList([]byte(out))
+	if len(got) != 1 || got[412] != "org.decred.dcrd" {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestParseTasklistServices(t *testing.T) {
+	out := `"System Idle Process","0","N/A"
+"svchost.exe","812","BrokerInfrastructure,DcomLaunch"
+"dcrd.exe","2204","dcrd"
+"dcrwallet.exe","2310","N/A"
+`
+	got := parseTasklistServices([]byte(out))
+	if len(got) != 2 || got[812] != "BrokerInfrastructure" || got[2204] != "dcrd" {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestParseSystemctlShow(t *testing.T) {
+	var s serviceInfo
+	parseSystemctlShow([]byte("NRestarts=3\nExecMainStartTimestamp=Mon 2019-05-13 10:00:00 UTC\n"), &s)
+	if s.Restarts == nil || *s.Restarts != 3 {
+		t.Errorf("restarts: got %v", s.Restarts)
+	}
+	if want := time.Date(2019, 5, 13, 10, 0, 0, 0, time.UTC); s.Started == nil || !s.Started.Equal(want) {
+		t.Errorf("started: got %v want %v", s.Started, want)
+	}
+
+	// Never started, and a systemd too old to count the restarts.
+	s = serviceInfo{}
+	parseSystemctlShow([]byte("ExecMainStartTimestamp=\n"), &s)
+	if s.Restarts != nil || s.Started != nil {
+		t.Errorf("got %+v", s)
+	}
+}
+
+func TestParseProcStat(t *testing.T) {
+	exec, ppid, ok := parseProcStat([]byte("5406 (dcr (x) d) S 1 5406 5406 0 -1 4194560"))
+	if !ok || exec != "dcr (x) d" || ppid != 1 {
+		t.Errorf("got %q, %d, %v", exec, ppid, ok)
+	}
+	if _, _, ok := parseProcStat([]byte("5406 dcrd")); ok {
+		t.Error("no parentheses: got ok")
+	}
+}
+
+func TestRestartCommand(t *testing.T) {
+	tests := []struct {
+		s    serviceInfo
+		want string
+	}{
+		{serviceInfo{Manager: managerSystemd, Unit: "dcrd.service"}, "systemctl restart dcrd.service"},
+		{serviceInfo{Manager: managerSystemd, Unit: "dcrd.service", User: true}, "systemctl --user restart dcrd.service"},
+		{serviceInfo{Manager: managerLaunchd, Unit: "org.decred.dcrd"}, "launchctl kickstart -k system/org.decred.dcrd"},
+		{serviceInfo{Manager: managerWindows, Unit: "dcrd"}, "powershell -Command Restart-Service dcrd"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(tt.s.restartCommand(), " "); got != tt.want {
+			t.Errorf("%+v: got %q want %q", tt.s, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dcrlabs/dcrps/pkg/dcrps"
+	dcrsignal "github.com/dcrlabs/dcrps/signal"
+	"github.com/google/gops/goprocess"
+	"github.com/google/gops/signal"
+)
+
+// defaultCPUProfileWindow is the window of the CPU profile of the stock agent,
+// which can't be told another one.
+const defaultCPUProfileWindow = 30 * time.Second
+
+// snapshotFile is a file of the snapshot bundle.
+type snapshotFile struct {
+	name string
+	data []byte
+}
+
+// snapshotBundle collects the files of a snapshot, and the errors of those
+// that couldn't be collected, to write them as a tar.gz.
+type snapshotBundle struct {
+	dir    string // the top directory of the files in the archive
+	files  []snapshotFile
+	errors []string
+}
+
+func (b *snapshotBundle) add(name string, data []byte) {
+	b.files = append(b.files, snapshotFile{name, data})
+}
+
+// addErr records that the named file couldn't be collected.
+func (b *snapshotBundle) addErr(name string, err error) {
+	b.errors = append(b.errors, fmt.Sprintf("%s: %v", name, err))
+	fmt.Fprintf(os.Stderr, "snapshot: %s: %v\n", name, err)
+}
+
+// archive returns the tar.gz of the files, with errors.txt listing the
+// errors when there are some.
+func (b *snapshotBundle) archive(now time.Time) ([]byte, error) {
+	files := b.files
+	if len(b.errors) > 0 {
+		files = append(files, snapshotFile{"errors.txt", []byte(strings.Join(b.errors, "\n") + "\n")})
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for _, f := range files {
+		hdr := &tar.Header{
+			Name:    b.dir + "/" + f.name,
+			Mode:    0644,
+			Size:    int64(len(f.data)),
+			ModTime: now,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// safeFileName returns name with the characters that don't belong in a file
+// name replaced.
+func safeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// snapshotName returns the name of the snapshot of the process named name,
+// such as "dcrps-snapshot-dcrd-1234-20190102T150405".
+func snapshotName(name string, now time.Time) string {
+	return fmt.Sprintf("dcrps-snapshot-%s-%s", safeFileName(name), now.Format("20060102T150405"))
+}
+
+// captureCPUProfile reads a CPU profile over window from the agent at addr,
+// or over the fixed window of the agents without the CPUProfileDuration
+// capability, which it warns of.
+func captureCPUProfile(addr net.TCPAddr, window time.Duration) ([]byte, error) {
+	ok, err := agentCapable(addr, dcrsignal.CPUProfileDuration)
+	if err != nil {
+		return nil, err
+	}
+	var params []byte
+	if ok {
+		params = make([]byte, binary.MaxVarintLen64)
+		params = params[:binary.PutVarint(params, int64(window/time.Millisecond))]
+	} else {
+		fmt.Fprintf(os.Stderr, "warning: the agent doesn't support -cpu-duration, "+
+			"it profiles for %v\n", defaultCPUProfileWindow)
+		window = defaultCPUProfileWindow
+	}
+	fmt.Printf("Profiling CPU for %v...\n", window)
+	cmdTimeout = window + traceTimeoutSlack
+	return cmd(addr, signal.CPUProfile, params...)
+}
+
+// snapshot collects the process info, stacks, memstats, runtime stats and
+// heap and CPU profiles of a process into a single tar.gz for bug reports.
+func snapshot(args []string) error {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	out := fs.String("o", "", "write the bundle to file")
+	cpuWindow := fs.Duration("cpu-duration", 5*time.Second, "window of the CPU profile, 0 for none")
+	target := parseTargetFlags(fs, args)
+	if target == "" {
+		return errors.New("missing PID, exec name or address")
+	}
+	if *cpuWindow < 0 {
+		return fmt.Errorf("invalid -cpu-duration %v", *cpuWindow)
+	}
+
+	now := time.Now()
+	name := target
+	var info bytes.Buffer
+	// Address targets have no local process to report on.
+	local := !strings.Contains(target, ":")
+	if local {
+		pid, err := resolver.PID(target)
+		if err != nil {
+			return err
+		}
+		name = fmt.Sprint(pid)
+		if p, ok, err := goprocess.Find(pid); err == nil && ok {
+			name = fmt.Sprintf("%s-%d", p.Exec, pid)
+		}
+		fmt.Fprintf(&info, "dcrps snapshot %s at %s\n\n", target, now.Format(time.RFC3339))
+		if err := writeProcessInfo(&info, pid, true); err != nil {
+			return fmt.Errorf("cannot read process info: %v", err)
+		}
+	}
+	b := &snapshotBundle{dir: snapshotName(name, now)}
+	if local {
+		b.add("process.txt", info.Bytes())
+	}
+
+	addr, err := resolver.Resolve(target)
+	if err != nil {
+		return err
+	}
+	// Each request but the CPU profile gets the timeout of the quick
+	// commands, unless -timeout is set.
+	requests := []struct {
+		name   string
+		signal byte
+	}{
+		{"version.txt", signal.Version},
+		{"stats.txt", signal.Stats},
+		{"stack.txt", signal.StackTrace},
+		{"memstats.txt", signal.MemStats},
+		{"heap.pprof", signal.HeapProfile},
+	}
+	for _, r := range requests {
+		cmdTimeout = 10 * time.Second
+		out, err := cmd(*addr, r.signal)
+		if err == nil && len(out) == 0 {
+			err = errors.New("no response")
+		}
+		if err != nil {
+			if _, ok := err.(*dcrps.DialError); ok {
+				return err
+			}
+			b.addErr(r.name, err)
+			continue
+		}
+		b.add(r.name, out)
+		if r.signal == signal.StackTrace {
+			b.add("goroutines.txt", []byte(dedupeReport(dcrps.ParseStack(out))))
+		}
+	}
+	cmdTimeout = 10 * time.Second
+	if s, full, err := readMemStats(*addr); err == nil && full {
+		js, _ := json.MarshalIndent(s, "", "  ")
+		b.add("memstats.json", append(js, '\n'))
+	}
+	if values, err := readAppStats(*addr); err == nil {
+		js, _ := json.MarshalIndent(values, "", "  ")
+		b.add("appstats.json", append(js, '\n'))
+	}
+	if *cpuWindow > 0 {
+		if out, err := captureCPUProfile(*addr, *cpuWindow); err != nil {
+			b.addErr("cpu.pprof", err)
+		} else {
+			b.add("cpu.pprof", out)
+		}
+	}
+
+	data, err := b.archive(now)
+	if err != nil {
+		return err
+	}
+	path := *out
+	if path == "" {
+		path = b.dir + ".tar.gz"
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return err
+	}
+	fmt.Printf("Snapshot saved to: %s\n", path)
+	return nil
+}
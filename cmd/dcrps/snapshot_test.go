@@ -0,0 +1,59 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestSnapshotArchive(t *testing.T) {
+	now := time.Date(2019, 1, 2, 15, 4, 5, 0, time.UTC)
+	b := &snapshotBundle{dir: snapshotName("dcrd-1234", now)}
+	b.add("stack.txt", []byte("goroutine 1 [running]:\n"))
+	b.errors = append(b.errors, "cpu.pprof: "+errors.New("timeout").Error())
+	data, err := b.archive(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(zr)
+	got := make(map[string]string)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[hdr.Name] = string(b)
+	}
+	want := map[string]string{
+		"dcrps-snapshot-dcrd-1234-20190102T150405/stack.txt":  "goroutine 1 [running]:\n",
+		"dcrps-snapshot-dcrd-1234-20190102T150405/errors.txt": "cpu.pprof: timeout\n",
+	}
+	if len(got) != len(want) {
+		t.Errorf("got files %v", got)
+	}
+	for name, data := range want {
+		if got[name] != data {
+			t.Errorf("%s: got=%q want=%q", name, got[name], data)
+		}
+	}
+}
+
+func TestSnapshotName(t *testing.T) {
+	now := time.Date(2019, 1, 2, 15, 4, 5, 0, time.UTC)
+	if got, want := snapshotName("10.0.0.5:9000", now), "dcrps-snapshot-10.0.0.5_9000-20190102T150405"; got != want {
+		t.Errorf("got=%v want=%v", got, want)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/gops/goprocess"
+	"github.com/shirou/gopsutil/process"
+)
+
+// listSortKeys are the valid -sort values of the process listing.
+var listSortKeys = []string{"pid", "ppid", "exec", "mem", "cpu", "uptime"}
+
+// processUptimes returns the uptime of each of ps, leaving out the processes
+// whose start time can't be read.
+func processUptimes(ps []goprocess.P) map[int]time.Duration {
+	defer benchPhase("process collection")()
+	uptimes := make(map[int]time.Duration)
+	now := time.Now()
+	for _, p := range ps {
+		pr, err := process.NewProcess(int32(p.PID))
+		if err != nil {
+			continue
+		}
+		created, err := pr.CreateTime()
+		if err != nil {
+			continue
+		}
+		uptimes[p.PID] = now.Sub(time.Unix(0, created*int64(time.Millisecond)))
+	}
+	return uptimes
+}
+
+// sortProcesses sorts ps by key, stably: by pid, ppid or exec in ascending
+// order, by mem or cpu from the largest usage or by uptime from the longest
+// running. The processes whose usage or uptime is unknown come last. reverse
+// reverses the order but for them, or the order of ps with no key.
+func sortProcesses(ps []goprocess.P, key string, reverse bool,
+	uptimes map[int]time.Duration, usage map[int]processUsage) {
+
+	if key == "" {
+		if reverse {
+			for i, j := 0, len(ps)-1; i < j; i, j = i+1, j-1 {
+				ps[i], ps[j] = ps[j], ps[i]
+			}
+		}
+		return
+	}
+	// value returns the sort value of p, larger first, and whether it is
+	// known.
+	value := func(p goprocess.P) (float64, bool) {
+		switch key {
+		case "mem":
+			u, ok := usage[p.PID]
+			return float64(u.rss), ok && u.rss > 0
+		case "cpu":
+			u, ok := usage[p.PID]
+			return u.cpu, ok && u.cpuKnown
+		case "uptime":
+			u, ok := uptimes[p.PID]
+			return float64(u), ok
+		}
+		return 0, true
+	}
+	// before reports whether a sorts before b in ascending order of the
+	// key, or of the larger value first.
+	before := func(a, b goprocess.P) bool {
+		switch key {
+		case "pid":
+			return a.PID < b.PID
+		case "ppid":
+			if a.PPID != b.PPID {
+				return a.PPID < b.PPID
+			}
+			return a.PID < b.PID
+		case "exec":
+			if a.Exec != b.Exec {
+				return a.Exec < b.Exec
+			}
+			return a.PID < b.PID
+		}
+		va, _ := value(a)
+		vb, _ := value(b)
+		return va > vb
+	}
+	sort.SliceStable(ps, func(i, j int) bool {
+		_, iok := value(ps[i])
+		_, jok := value(ps[j])
+		if iok != jok {
+			return iok
+		}
+		if reverse {
+			return before(ps[j], ps[i])
+		}
+		return before(ps[i], ps[j])
+	})
+}
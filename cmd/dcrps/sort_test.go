@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/gops/goprocess"
+)
+
+func TestSortProcesses(t *testing.T) {
+	list := func() []goprocess.P {
+		return []goprocess.P{
+			{PID: 30, PPID: 1, Exec: "dcrwallet"},
+			{PID: 10, PPID: 2, Exec: "dcrd"},
+			{PID: 20, PPID: 1, Exec: "dcrctl"},
+			{PID: 40, PPID: 2, Exec: "dcrd"},
+		}
+	}
+	usage := map[int]processUsage{
+		10: {cpu: 5, cpuKnown: true, rss: 300},
+		20: {cpu: 0.5, cpuKnown: true, rss: 100},
+		30: {cpu: 9, cpuKnown: true, rss: 200},
+		// 40 exited before its usage was read.
+	}
+	uptimes := map[int]time.Duration{10: time.Hour, 20: time.Second, 40: time.Minute}
+	tests := []struct {
+		key     string
+		reverse bool
+		want    []int
+	}{
+		{"", false, []int{30, 10, 20, 40}},
+		{"", true, []int{40, 20, 10, 30}},
+		{"pid", false, []int{10, 20, 30, 40}},
+		{"pid", true, []int{40, 30, 20, 10}},
+		{"ppid", false, []int{20, 30, 10, 40}},
+		{"exec", false, []int{20, 10, 40, 30}},
+		{"mem", false, []int{10, 30, 20, 40}},
+		{"mem", true, []int{20, 30, 10, 40}},
+		{"cpu", false, []int{30, 10, 20, 40}},
+		{"uptime", false, []int{10, 40, 20, 30}},
+		{"uptime", true, []int{20, 40, 10, 30}},
+	}
+	for _, test := range tests {
+		ps := list()
+		sortProcesses(ps, test.key, test.reverse, uptimes, usage)
+		for i, p := range ps {
+			if p.PID != test.want[i] {
+				t.Errorf("sortProcesses(%q, reverse %v): got PID %d at %d, want %v",
+					test.key, test.reverse, p.PID, i, test.want)
+				break
+			}
+		}
+	}
+}
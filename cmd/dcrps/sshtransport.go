@@ -0,0 +1,291 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dcrlabs/dcrps/pkg/dcrps"
+	"github.com/dcrlabs/dcrps/resolve"
+	"github.com/google/gops/goprocess"
+)
+
+// sshArgs returns the arguments of the ssh client to run command on the -ssh
+// host with the options opts, failing rather than prompting and within
+// -connect-timeout. The host follows "--", so that one starting with "-"
+// can't pass for an option, such as -oProxyCommand running a local command;
+// ssh takes no option after it.
+func sshArgs(opts []string, command ...string) []string {
+	secs := int((*dialTimeout + time.Second - 1) / time.Second)
+	args := append([]string{"-o", "BatchMode=yes", "-o", "ConnectTimeout=" + strconv.Itoa(secs)}, opts...)
+	return append(append(args, "--", *sshHost), command...)
+}
+
+// sshListScript lists the agents of the user of the remote host from the PID
+// files they leave in the gops config dir, as "pid port exec" lines, leaving
+// out those of exited processes. It runs with sh, whatever the login shell.
+const sshListScript = `dir="${GOPS_CONFIG_DIR:-$HOME/.config/gops}"
+for f in "$dir"/*; do
+	pid=$(basename "$f")
+	case $pid in ''|*[!0-9]*) continue;; esac
+	ps -p "$pid" >/dev/null 2>&1 || continue
+	exe=$(readlink "/proc/$pid/exe" 2>/dev/null) || exe=$(ps -o comm= -p "$pid")
+	exe=${exe% (deleted)}
+	printf '%s %s %s\n' "$pid" "$(cat "$f")" "$(basename "$exe")"
+done
+`
+
+// remoteAgent is an agent of the -ssh host.
+type remoteAgent struct {
+	PID  int    `json:"pid"`
+	Exec string `json:"exec"`
+	Port int    `json:"port"`
+}
+
+// parseRemoteAgents parses the output of sshListScript, sorted by PID.
+func parseRemoteAgents(out []byte) []remoteAgent {
+	var agents []remoteAgent
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		fields := strings.SplitN(s.Text(), " ", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		pid, err1 := strconv.Atoi(fields[0])
+		port, err2 := strconv.Atoi(strings.TrimSpace(fields[1]))
+		if err1 != nil || err2 != nil || port <= 0 || port > 65535 {
+			continue
+		}
+		agents = append(agents, remoteAgent{PID: pid, Exec: fields[2], Port: port})
+	}
+	sort.Slice(agents, func(i, j int) bool { return agents[i].PID < agents[j].PID })
+	return agents
+}
+
+var (
+	remoteAgentsOnce sync.Once
+	remoteAgentList  []remoteAgent
+	remoteAgentsErr  error
+)
+
+// remoteAgents lists the agents of the -ssh host that the resolver matches,
+// once per run.
+func remoteAgents() ([]remoteAgent, error) {
+	remoteAgentsOnce.Do(func() {
+		c := exec.Command("ssh", sshArgs(nil, "sh", "-s")...)
+		c.Stdin = strings.NewReader(sshListScript)
+		var stderr bytes.Buffer
+		c.Stderr = &stderr
+		out, err := c.Output()
+		if err != nil {
+			remoteAgentsErr = fmt.Errorf("ssh %s: %v: %s", *sshHost, err, strings.TrimSpace(stderr.String()))
+			return
+		}
+		for _, a := range parseRemoteAgents(out) {
+			if resolver.Match(a.Exec) {
+				remoteAgentList = append(remoteAgentList, a)
+			}
+		}
+	})
+	return remoteAgentList, remoteAgentsErr
+}
+
+// resolveRemote resolves target, a PID, an exec name or a host:port as the
+// remote host sees it, among the agents of the -ssh host.
+func resolveRemote(agents []remoteAgent, target string) (*net.TCPAddr, error) {
+	if strings.Contains(target, ":") {
+		addr, err := net.ResolveTCPAddr("tcp", target)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse dst address: %v", err)
+		}
+		return addr, nil
+	}
+	var found []remoteAgent
+	pid, err := strconv.Atoi(target)
+	for _, a := range agents {
+		if err == nil && a.PID == pid || err != nil && resolver.Key(a.Exec) == resolver.Key(target) {
+			found = append(found, a)
+		}
+	}
+	switch len(found) {
+	case 0:
+		if err == nil {
+			return nil, &resolve.NoAgentError{PID: pid, Err: fmt.Errorf("no agent PID file on %s", *sshHost)}
+		}
+		return nil, &resolve.NoProcessError{Target: target}
+	case 1:
+		return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: found[0].Port}, nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "multiple agents with the name %s on %s, use a PID instead:", target, *sshHost)
+	for _, a := range found {
+		fmt.Fprintf(&b, "\n  %d %s", a.PID, a.Exec)
+	}
+	return nil, errors.New(b.String())
+}
+
+// resolveAgent resolves target to the address of its agent, on the -ssh host
+// when set.
+func resolveAgent(target string) (*net.TCPAddr, error) {
+	if *sshHost == "" {
+		return resolver.Resolve(target)
+	}
+	agents, err := remoteAgents()
+	if err != nil {
+		return nil, err
+	}
+	return resolveRemote(agents, target)
+}
+
+// remoteBatchProcesses is batchProcesses for the -ssh host.
+func remoteBatchProcesses(target string) ([]goprocess.P, bool) {
+	if target != batchTarget && !*each {
+		return nil, false
+	}
+	agents, err := remoteAgents()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		exit(exitAgentUnreachable)
+	}
+	var ps []goprocess.P
+	for _, a := range agents {
+		if target == batchTarget || resolver.Key(a.Exec) == resolver.Key(target) {
+			ps = append(ps, goprocess.P{PID: a.PID, Exec: a.Exec, Agent: true})
+		}
+	}
+	if target != batchTarget && len(ps) < 2 {
+		return nil, false
+	}
+	return ps, true
+}
+
+// listRemoteAgents prints the agents of the -ssh host.
+func listRemoteAgents() error {
+	agents, err := remoteAgents()
+	if err != nil {
+		return err
+	}
+	if *jsonOutput {
+		if agents == nil {
+			agents = []remoteAgent{}
+		}
+		printJSON(agents)
+		return nil
+	}
+	if len(agents) == 0 {
+		return &resolve.NoProcessError{Target: "on " + *sshHost}
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, a := range agents {
+		fmt.Fprintf(w, "%d\t%s*\t127.0.0.1:%d\n", a.PID, a.Exec, a.Port)
+	}
+	return w.Flush()
+}
+
+// sshAddr is the address of an end of an sshConn.
+type sshAddr string
+
+func (a sshAddr) Network() string { return "ssh" }
+func (a sshAddr) String() string  { return string(a) }
+
+// sshConn is a connection to an agent forwarded by "ssh -W" over its standard
+// input and output.
+type sshConn struct {
+	cmd    *exec.Cmd
+	r, w   *os.File // the pipes to read from and write to ssh
+	stderr bytes.Buffer
+	addr   net.TCPAddr
+
+	waitOnce sync.Once
+	waitErr  error
+}
+
+// dialSSH connects to the agent at addr, as the -ssh host sees it, through
+// the ssh client.
+func dialSSH(addr net.TCPAddr) (net.Conn, error) {
+	stdinR, stdinW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		stdinR.Close()
+		stdinW.Close()
+		return nil, err
+	}
+	c := &sshConn{r: stdoutR, w: stdinW, addr: addr}
+	c.cmd = exec.Command("ssh", sshArgs([]string{"-W", addr.String()})...)
+	c.cmd.Stdin, c.cmd.Stdout, c.cmd.Stderr = stdinR, stdoutW, &c.stderr
+	err = c.cmd.Start()
+	stdinR.Close()
+	stdoutW.Close()
+	if err != nil {
+		stdoutR.Close()
+		stdinW.Close()
+		return nil, fmt.Errorf("ssh: %v", err)
+	}
+	return c, nil
+}
+
+// wait waits for ssh to exit, once, and returns why it failed, as when it
+// couldn't connect to the host or the agent.
+func (c *sshConn) wait() error {
+	c.waitOnce.Do(func() {
+		if err := c.cmd.Wait(); err != nil {
+			c.waitErr = &dcrps.DialError{Addr: c.addr, Err: fmt.Errorf("ssh %s: %v: %s",
+				*sshHost, err, strings.TrimSpace(c.stderr.String()))}
+		}
+	})
+	return c.waitErr
+}
+
+func (c *sshConn) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if err == io.EOF {
+		if werr := c.wait(); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+func (c *sshConn) Write(p []byte) (int, error) {
+	return c.w.Write(p)
+}
+
+func (c *sshConn) Close() error {
+	c.w.Close()
+	c.r.Close()
+	// ssh may still run when the response wasn't read to the end.
+	c.cmd.Process.Kill()
+	c.wait()
+	return nil
+}
+
+func (c *sshConn) LocalAddr() net.Addr  { return sshAddr(*sshHost) }
+func (c *sshConn) RemoteAddr() net.Addr { return sshAddr(*sshHost + ":" + c.addr.String()) }
+
+func (c *sshConn) SetDeadline(t time.Time) error {
+	if err := c.r.SetDeadline(t); err != nil {
+		return err
+	}
+	return c.w.SetDeadline(t)
+}
+
+func (c *sshConn) SetReadDeadline(t time.Time) error  { return c.r.SetReadDeadline(t) }
+func (c *sshConn) SetWriteDeadline(t time.Time) error { return c.w.SetWriteDeadline(t) }
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dcrlabs/dcrps/resolve"
+)
+
+func TestParseRemoteAgents(t *testing.T) {
+	out := []byte("4021 40763 dcrwallet\n" +
+		"311 9999 dcrd\n" +
+		"77 notaport dcrd\n" +
+		"garbage\n" +
+		"512 41000 my app\n")
+	want := []remoteAgent{
+		{PID: 311, Exec: "dcrd", Port: 9999},
+		{PID: 512, Exec: "my app", Port: 41000},
+		{PID: 4021, Exec: "dcrwallet", Port: 40763},
+	}
+	if got := parseRemoteAgents(out); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseRemoteAgents: got=%+v want=%+v", got, want)
+	}
+}
+
+func TestResolveRemote(t *testing.T) {
+	defer func(r *resolve.Resolver) { resolver = r }(resolver)
+	resolver = &resolve.Resolver{Prefixes: []string{"dcr"}}
+	agents := []remoteAgent{
+		{PID: 311, Exec: "dcrd", Port: 9999},
+		{PID: 4021, Exec: "dcrwallet", Port: 40763},
+		{PID: 4022, Exec: "dcrwallet", Port: 40764},
+	}
+	tests := []struct {
+		target string
+		want   string
+		err    bool
+	}{
+		{"dcrd", "127.0.0.1:9999", false},
+		{"4022", "127.0.0.1:40764", false},
+		{"10.0.0.5:8000", "10.0.0.5:8000", false},
+		{"dcrwallet", "", true},
+		{"vspd", "", true},
+		{"12", "", true},
+	}
+	for _, test := range tests {
+		addr, err := resolveRemote(agents, test.target)
+		if test.err {
+			if err == nil {
+				t.Errorf("resolveRemote(%q): got=%v, want an error", test.target, addr)
+			}
+			continue
+		}
+		if err != nil || addr.String() != test.want {
+			t.Errorf("resolveRemote(%q): got=%v, %v want=%v", test.target, addr, err, test.want)
+		}
+	}
+	if _, err := resolveRemote(agents, "vspd"); exitCode(err) != exitNoProcess {
+		t.Errorf("resolveRemote of no process: exit code %d, want %d", exitCode(err), exitNoProcess)
+	}
+	if _, err := resolveRemote(agents, "12"); exitCode(err) != exitAgentUnreachable {
+		t.Errorf("resolveRemote of no agent: exit code %d, want %d", exitCode(err), exitAgentUnreachable)
+	}
+}
+
+func TestSSHArgs(t *testing.T) {
+	defer func(host string, timeout time.Duration) {
+		*sshHost, *dialTimeout = host, timeout
+	}(*sshHost, *dialTimeout)
+	*dialTimeout = 1500 * time.Millisecond
+	tests := []struct {
+		host    string
+		opts    []string
+		command []string
+		want    []string
+	}{
+		{"node1", nil, []string{"sh", "-s"},
+			[]string{"-o", "BatchMode=yes", "-o", "ConnectTimeout=2", "--", "node1", "sh", "-s"}},
+		// The options go before the host, past which ssh takes none.
+		{"node1", []string{"-W", "127.0.0.1:9000"}, nil,
+			[]string{"-o", "BatchMode=yes", "-o", "ConnectTimeout=2", "-W", "127.0.0.1:9000", "--", "node1"}},
+		// A host that would be an option: still the host.
+		{"-oProxyCommand=touch /tmp/pwned", nil, []string{"sh", "-s"},
+			[]string{"-o", "BatchMode=yes", "-o", "ConnectTimeout=2", "--", "-oProxyCommand=touch /tmp/pwned", "sh", "-s"}},
+	}
+	for _, test := range tests {
+		*sshHost = test.host
+		if got := sshArgs(test.opts, test.command...); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("sshArgs(%q, %q) with -ssh %q: got %q, want %q", test.opts, test.command, test.host, got, test.want)
+		}
+	}
+}
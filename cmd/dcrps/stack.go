@@ -0,0 +1,186 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dcrlabs/dcrps/pkg/dcrps"
+)
+
+// frame is a function call in a goroutine stack.
+type frame = dcrps.Frame
+
+// goroutine is one goroutine of a stack dump.
+type goroutine = dcrps.Goroutine
+
+// funcCount is the number of goroutines with a given function.
+type funcCount struct {
+	Func  string
+	Count int
+}
+
+// topFrames counts the goroutines by the function at the top of their
+// stacks, most common first.
+func topFrames(gs []goroutine) []funcCount {
+	counts := make(map[string]int)
+	for _, g := range gs {
+		if len(g.Frames) > 0 {
+			counts[g.Frames[0].Func]++
+		}
+	}
+	fcs := make([]funcCount, 0, len(counts))
+	for fn, n := range counts {
+		fcs = append(fcs, funcCount{fn, n})
+	}
+	sort.Slice(fcs, func(i, j int) bool {
+		if fcs[i].Count != fcs[j].Count {
+			return fcs[i].Count > fcs[j].Count
+		}
+		return fcs[i].Func < fcs[j].Func
+	})
+	return fcs
+}
+
+// stackGroup is the goroutines sharing a state and a stack.
+type stackGroup struct {
+	goroutine       // the first of them
+	IDs       []int // of all of them
+
+	// The shortest and longest wait in minutes of the Waiting goroutines
+	// that report how long they have been blocked.
+	MinWait, MaxWait int
+	Waiting          int
+}
+
+// waitMinutes returns how many minutes g has been blocked, when reported.
+func waitMinutes(g goroutine) (int, bool) {
+	var n int
+	if _, err := fmt.Sscanf(g.Wait, "%d minutes", &n); err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// stackKey identifies the state and stack of g.
+func stackKey(g goroutine) string {
+	var b strings.Builder
+	b.WriteString(g.State)
+	for _, f := range g.Frames {
+		b.WriteString("\n" + f.Func + "\t" + f.File)
+	}
+	b.WriteString("\n" + g.CreatedBy)
+	return b.String()
+}
+
+// dedupeGoroutines groups the goroutines with identical states and stacks,
+// largest group first.
+func dedupeGoroutines(gs []goroutine) []stackGroup {
+	index := make(map[string]int)
+	var groups []stackGroup
+	for _, g := range gs {
+		key := stackKey(g)
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, stackGroup{goroutine: g})
+		}
+		sg := &groups[i]
+		sg.IDs = append(sg.IDs, g.ID)
+		if n, ok := waitMinutes(g); ok {
+			if sg.Waiting == 0 || n < sg.MinWait {
+				sg.MinWait = n
+			}
+			if n > sg.MaxWait {
+				sg.MaxWait = n
+			}
+			sg.Waiting++
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return len(groups[i].IDs) > len(groups[j].IDs)
+	})
+	return groups
+}
+
+// formatStackGroups writes each group once with its goroutine count, in the
+// layout of the stack dumps. The state is followed by the range of the waits
+// of the goroutines that report one.
+func formatStackGroups(groups []stackGroup) string {
+	var b strings.Builder
+	for i, g := range groups {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		state := g.State
+		switch {
+		case g.Waiting == 0:
+		case g.MinWait == g.MaxWait:
+			state += fmt.Sprintf(", %d minutes", g.MaxWait)
+		default:
+			state += fmt.Sprintf(", %d-%d minutes", g.MinWait, g.MaxWait)
+		}
+		if len(g.IDs) == 1 {
+			fmt.Fprintf(&b, "1 goroutine (%d) [%s]:\n", g.ID, state)
+		} else {
+			fmt.Fprintf(&b, "%d goroutines [%s]:\n", len(g.IDs), state)
+		}
+		for _, f := range g.Frames {
+			b.WriteString(f.Func + "\n")
+			if f.File != "" {
+				b.WriteString("\t" + f.File + "\n")
+			}
+		}
+		if g.CreatedBy != "" {
+			b.WriteString("created by " + g.CreatedBy + "\n")
+		}
+	}
+	return b.String()
+}
+
+// goroutineStates counts the goroutines by state, their wait reason when
+// blocked, most common first.
+func goroutineStates(gs []goroutine) []stateCount {
+	counts := make(map[string]int)
+	for _, g := range gs {
+		counts[g.State]++
+	}
+	scs := make([]stateCount, 0, len(counts))
+	for state, n := range counts {
+		scs = append(scs, stateCount{state, n})
+	}
+	sort.Slice(scs, func(i, j int) bool {
+		if scs[i].Count != scs[j].Count {
+			return scs[i].Count > scs[j].Count
+		}
+		return scs[i].State < scs[j].State
+	})
+	return scs
+}
+
+// dedupeReport returns the report of stack -dedupe on gs: the counts of the
+// goroutines, of the unique stacks and by state, then the stack groups.
+func dedupeReport(gs []goroutine) string {
+	groups := dedupeGoroutines(gs)
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d goroutines, %d unique stacks\n", len(gs), len(groups))
+	states := goroutineStates(gs)
+	for i, sc := range states {
+		if i == 0 {
+			b.WriteString("states: ")
+		} else {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%s %d", sc.State, sc.Count)
+	}
+	if len(states) > 0 {
+		b.WriteString("\n")
+	}
+	b.WriteString("\n" + formatStackGroups(groups))
+	return b.String()
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dcrlabs/dcrps/pkg/dcrps"
+)
+
+const testDump = `goroutine 7 [running]:
+runtime/pprof.writeGoroutineStacks({0x7fbcc1cfa628, 0x1eb732df0010})
+	/usr/local/go/src/runtime/pprof/pprof.go:816 +0x69
+github.com/google/gops/agent.listen()
+	/root/go/pkg/mod/github.com/google/gops@v0.3.6/agent/agent.go:129 +0x165
+created by github.com/google/gops/agent.Listen in goroutine 1
+	/root/go/pkg/mod/github.com/google/gops@v0.3.6/agent/agent.go:110 +0x325
+
+goroutine 1 [chan receive, 12 minutes]:
+main.(*server).run(0xc000010000)
+	/src/server.go:42 +0x20
+main.main()
+	/src/main.go:10 +0x96
+
+goroutine 8 [select, 3 minutes, locked to thread]:
+main.(*server).run(0xc000010000)
+	/src/server.go:42 +0x20
+created by main.main
+	/src/main.go:8 +0x6a
+`
+
+func TestTopFrames(t *testing.T) {
+	top := topFrames(dcrps.ParseStack([]byte(testDump)))
+	if len(top) != 2 || top[0] != (funcCount{"main.(*server).run", 2}) {
+		t.Errorf("topFrames: got=%v", top)
+	}
+}
+
+func TestDedupeGoroutines(t *testing.T) {
+	worker := `goroutine %d [chan receive]:
+main.worker(0x%x)
+	/src/worker.go:12 +0x1d
+created by main.main
+	/src/main.go:20 +0x40
+
+`
+	var dump string
+	for id := 10; id < 13; id++ {
+		dump += fmt.Sprintf(worker, id, id)
+	}
+	dump += testDump
+	groups := dedupeGoroutines(dcrps.ParseStack([]byte(dump)))
+	var got [][]int
+	for _, g := range groups {
+		got = append(got, g.IDs)
+	}
+	// The arguments differ but not the stacks.
+	want := [][]int{{10, 11, 12}, {7}, {1}, {8}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("dedupeGoroutines: got=%v want=%v", got, want)
+	}
+}
+
+func TestDedupeReport(t *testing.T) {
+	dump := `goroutine 10 [chan receive, 3 minutes]:
+main.worker(0xa)
+	/src/worker.go:12 +0x1d
+created by main.main
+	/src/main.go:20 +0x40
+
+goroutine 11 [chan receive, 187 minutes]:
+main.worker(0xb)
+	/src/worker.go:12 +0x1d
+created by main.main
+	/src/main.go:20 +0x40
+
+goroutine 12 [chan receive]:
+main.worker(0xc)
+	/src/worker.go:12 +0x1d
+created by main.main
+	/src/main.go:20 +0x40
+
+` + testDump
+	report := dedupeReport(dcrps.ParseStack([]byte(dump)))
+	for _, want := range []string{
+		"6 goroutines, 4 unique stacks\nstates: chan receive 4, running 1, select 1\n\n",
+		"3 goroutines [chan receive, 3-187 minutes]:\nmain.worker\n",
+		"1 goroutine (1) [chan receive, 12 minutes]:\n",
+		"1 goroutine (7) [running]:\n",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("dedupeReport: missing %q in:\n%s", want, report)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/dcrlabs/dcrps/resolve"
+)
+
+// isTerminal reports whether f is a character device such as a terminal, as
+// opposed to a pipe or a file.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// utf8Locale reports whether the locale settings ask for UTF-8 output.
+func utf8Locale() bool {
+	for _, key := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if v := os.Getenv(key); v != "" {
+			v = strings.ToUpper(v)
+			return strings.Contains(v, "UTF-8") || strings.Contains(v, "UTF8")
+		}
+	}
+	return false
+}
+
+// cbreakTerminal switches the terminal of the standard input to reading each
+// key as it is typed, without echoing it, through stty. The returned func
+// restores the previous settings.
+func cbreakTerminal() (restore func(), err error) {
+	stty := func(args ...string) ([]byte, error) {
+		cmd := exec.Command("stty", args...)
+		cmd.Stdin = os.Stdin
+		return cmd.Output()
+	}
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty("-icanon", "-echo", "min", "1"); err != nil {
+		return nil, err
+	}
+	return func() { stty(strings.TrimSpace(string(saved))) }, nil
+}
+
+// chooseProcess prompts on the terminal for one of the processes of an
+// ambiguous target, the Choose of the resolver when both the standard input
+// and error are terminals.
+func chooseProcess(e *resolve.AmbiguousError) (int, bool) {
+	return promptProcess(os.Stdin, os.Stderr, e)
+}
+
+// promptProcess lists the processes of e numbered on out and reads the
+// number of one from in. An empty line or the end of in picks none.
+func promptProcess(in io.Reader, out io.Writer, e *resolve.AmbiguousError) (int, bool) {
+	if e.Fuzzy {
+		fmt.Fprintf(out, "several processes match %s:\n", e.Name)
+	} else {
+		fmt.Fprintf(out, "several processes are named %s:\n", e.Name)
+	}
+	for i, p := range e.Processes {
+		fmt.Fprintf(out, "  %d) %d %s\n", i+1, p.PID, resolve.CommandLine(p))
+	}
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprintf(out, "pick one [1-%d]: ", len(e.Processes))
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return 0, false
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			return 0, false
+		}
+		if n, err := strconv.Atoi(line); err == nil && n >= 1 && n <= len(e.Processes) {
+			return e.Processes[n-1].PID, true
+		}
+	}
+}
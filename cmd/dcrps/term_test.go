@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/dcrlabs/dcrps/resolve"
+	"github.com/google/gops/goprocess"
+)
+
+func TestPromptProcess(t *testing.T) {
+	e := &resolve.AmbiguousError{Name: "wallet", Fuzzy: true, Processes: []goprocess.P{
+		{PID: 1 << 30, Exec: "dcrwallet", Path: "/bin/dcrwallet"},
+		{PID: 1<<30 + 1, Exec: "dcrwallet", Path: "/bin/dcrwallet"},
+	}}
+	var out bytes.Buffer
+	pid, ok := promptProcess(strings.NewReader("3\nx\n2\n"), &out, e)
+	if !ok || pid != 1<<30+1 {
+		t.Errorf("got %d, %v", pid, ok)
+	}
+	if !strings.Contains(out.String(), "2) 1073741825 /bin/dcrwallet") {
+		t.Errorf("got prompt %q", out.String())
+	}
+	if _, ok := promptProcess(strings.NewReader("\n"), &out, e); ok {
+		t.Error("empty line: got a process")
+	}
+	if _, ok := promptProcess(strings.NewReader(""), &out, e); ok {
+		t.Error("end of input: got a process")
+	}
+}
+
+func TestUTF8Locale(t *testing.T) {
+	keys := []string{"LC_ALL", "LC_CTYPE", "LANG"}
+	saved := make(map[string]string)
+	for _, key := range keys {
+		saved[key] = os.Getenv(key)
+	}
+	defer func() {
+		for key, v := range saved {
+			os.Setenv(key, v)
+		}
+	}()
+	tests := []struct {
+		lcAll, lcCtype, lang string
+		want                 bool
+	}{
+		{"", "", "en_US.UTF-8", true},
+		{"", "", "en_US.utf8", true},
+		{"", "", "C", false},
+		{"", "", "", false},
+		// The first one set wins, as for the C library.
+		{"C", "", "en_US.UTF-8", false},
+		{"", "en_US.UTF-8", "C", true},
+	}
+	for _, test := range tests {
+		os.Setenv("LC_ALL", test.lcAll)
+		os.Setenv("LC_CTYPE", test.lcCtype)
+		os.Setenv("LANG", test.lang)
+		if got := utf8Locale(); got != test.want {
+			t.Errorf("utf8Locale with LC_ALL=%q LC_CTYPE=%q LANG=%q: got %v, want %v",
+				test.lcAll, test.lcCtype, test.lang, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/shirou/gopsutil/process"
+)
+
+// threadCount is the thread count of one process.
+type threadCount struct {
+	PID     int    `json:"pid"`
+	Exec    string `json:"exec"`
+	Threads int    `json:"threads"`
+	// Over is set when the count exceeds the -threshold.
+	Over bool `json:"over,omitempty"`
+}
+
+// sortThreadCounts sorts counts by key: threads, the most first, pid or exec.
+func sortThreadCounts(counts []threadCount, key string) error {
+	switch key {
+	case "threads":
+		sort.SliceStable(counts, func(i, j int) bool {
+			return counts[i].Threads > counts[j].Threads
+		})
+	case "pid":
+		sort.SliceStable(counts, func(i, j int) bool {
+			return counts[i].PID < counts[j].PID
+		})
+	case "exec":
+		sort.SliceStable(counts, func(i, j int) bool {
+			return counts[i].Exec < counts[j].Exec
+		})
+	default:
+		return fmt.Errorf("invalid sort key %q", key)
+	}
+	return nil
+}
+
+// threads prints the OS thread count of every dcr process with the total.
+func threads(args []string) error {
+	fs := flag.NewFlagSet("threads", flag.ExitOnError)
+	sortBy := fs.String("sort", "threads", "sort by threads, pid or exec")
+	threshold := fs.Int("threshold", 0, "mark processes with more threads")
+	parseCommandFlags(fs, args)
+
+	var counts []threadCount
+	var total int
+	for _, p := range dcrProcesses() {
+		pr, err := process.NewProcess(int32(p.PID))
+		if err != nil {
+			continue // exited since it was listed
+		}
+		n, err := pr.NumThreads()
+		if err != nil {
+			continue
+		}
+		counts = append(counts, threadCount{
+			PID:     p.PID,
+			Exec:    p.Exec,
+			Threads: int(n),
+			Over:    *threshold > 0 && int(n) > *threshold,
+		})
+		total += int(n)
+	}
+
+	if err := sortThreadCounts(counts, *sortBy); err != nil {
+		return err
+	}
+
+	if *jsonOutput {
+		return json.NewEncoder(dataOutput()).Encode(struct {
+			Processes []threadCount `json:"processes"`
+			Total     int           `json:"total"`
+		}{counts, total})
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.AlignRight)
+	for _, c := range counts {
+		mark := ""
+		if c.Over {
+			mark = " !"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\n", c.PID, c.Exec, c.Threads, mark)
+	}
+	fmt.Fprintf(w, "\ttotal\t%d\t\n", total)
+	w.Flush()
+	return nil
+}
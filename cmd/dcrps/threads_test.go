@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestSortThreadCounts(t *testing.T) {
+	list := func() []threadCount {
+		return []threadCount{
+			{PID: 30, Exec: "dcrwallet", Threads: 12},
+			{PID: 10, Exec: "dcrd", Threads: 20},
+			{PID: 20, Exec: "dcrctl", Threads: 12},
+			{PID: 40, Exec: "dcrd", Threads: 8},
+		}
+	}
+	tests := []struct {
+		key  string
+		want []int
+	}{
+		// Equal counts keep the order they were listed in.
+		{"threads", []int{10, 30, 20, 40}},
+		{"pid", []int{10, 20, 30, 40}},
+		{"exec", []int{20, 10, 40, 30}},
+	}
+	for _, test := range tests {
+		counts := list()
+		if err := sortThreadCounts(counts, test.key); err != nil {
+			t.Errorf("sortThreadCounts(%q): %v", test.key, err)
+			continue
+		}
+		for i, c := range counts {
+			if c.PID != test.want[i] {
+				t.Errorf("sortThreadCounts(%q): got PID %d at %d, want %v", test.key, c.PID, i, test.want)
+				break
+			}
+		}
+	}
+	if err := sortThreadCounts(list(), "mem"); err == nil {
+		t.Error("sortThreadCounts(mem): got no error")
+	}
+}
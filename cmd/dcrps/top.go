@@ -0,0 +1,190 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	ossignal "os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dcrlabs/dcrps/pkg/dcrps"
+	"github.com/google/gops/goprocess"
+	"github.com/google/gops/signal"
+	"github.com/shirou/gopsutil/process"
+)
+
+// topSortKeys are the valid -sort values of top, one per column.
+var topSortKeys = []string{"pid", "exec", "cpu", "rss", "goroutines", "conns"}
+
+// topRow is a process of the top table.
+type topRow struct {
+	p     goprocess.P
+	usage processUsage
+
+	goroutines      int64 // read through the agent
+	goroutinesKnown bool
+	conns           int // not counting the listening sockets
+	connsKnown      bool
+}
+
+// sampleTopRows returns the rows of ps, their usage sampled with s.
+func sampleTopRows(ps []goprocess.P, s *usageSampler) []topRow {
+	usage := s.sample(ps)
+	rows := make([]topRow, 0, len(ps))
+	for _, p := range ps {
+		pr, ok := s.procs[p.PID]
+		if !ok {
+			// Exited since it was listed.
+			continue
+		}
+		r := topRow{p: p, usage: usage[p.PID]}
+		r.conns, r.connsKnown = activeConnections(pr)
+		if p.Agent {
+			if addr, err := resolver.Resolve(strconv.Itoa(p.PID)); err == nil {
+				if out, err := cmd(*addr, signal.Stats); err == nil {
+					r.goroutines, r.goroutinesKnown = intValue(dcrps.ParseKeyValues(out), "goroutines")
+				}
+			}
+		}
+		rows = append(rows, r)
+	}
+	return rows
+}
+
+// activeConnections returns the number of connections of pr that are not
+// listening sockets.
+func activeConnections(pr *process.Process) (int, bool) {
+	conns, err := pr.Connections()
+	if err != nil {
+		return 0, false
+	}
+	var n int
+	for _, c := range conns {
+		if c.Status != "LISTEN" {
+			n++
+		}
+	}
+	return n, true
+}
+
+// sortTopRows sorts rows by key, stably: by pid or exec in ascending order and
+// by the other columns from the largest value. The rows whose value is
+// unknown come last.
+func sortTopRows(rows []topRow, key string) {
+	value := func(r topRow) (float64, bool) {
+		switch key {
+		case "cpu":
+			return r.usage.cpu, r.usage.cpuKnown
+		case "rss":
+			return float64(r.usage.rss), r.usage.rss > 0
+		case "goroutines":
+			return float64(r.goroutines), r.goroutinesKnown
+		case "conns":
+			return float64(r.conns), r.connsKnown
+		}
+		return 0, true
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		va, aok := value(a)
+		vb, bok := value(b)
+		if aok != bok {
+			return aok
+		}
+		switch key {
+		case "pid":
+			return a.p.PID < b.p.PID
+		case "exec":
+			if a.p.Exec != b.p.Exec {
+				return a.p.Exec < b.p.Exec
+			}
+			return a.p.PID < b.p.PID
+		}
+		return va > vb
+	})
+}
+
+// writeTopTable writes the top table of rows to w, "-" for the unknown
+// values.
+func writeTopTable(w io.Writer, rows []topRow) {
+	const format = "%7s %-16s %6s %9s %10s %5s\n"
+	fmt.Fprintf(w, format, "PID", "EXEC", "CPU", "RSS", "GOROUTINES", "CONNS")
+	for _, r := range rows {
+		cpu, rss, goroutines, conns := "-", "-", "-", "-"
+		if r.usage.cpuKnown {
+			cpu = fmt.Sprintf("%.1f%%", r.usage.cpu)
+		}
+		if r.usage.rss > 0 {
+			rss = formatBytes(r.usage.rss)
+		}
+		if r.goroutinesKnown {
+			goroutines = strconv.FormatInt(r.goroutines, 10)
+		}
+		if r.connsKnown {
+			conns = strconv.Itoa(r.conns)
+		}
+		exec := r.p.Exec
+		if r.p.Agent {
+			exec += "*"
+		}
+		fmt.Fprintf(w, format, strconv.Itoa(r.p.PID), exec, cpu, rss, goroutines, conns)
+	}
+}
+
+// top prints a live table of the processes with their CPU usage, resident
+// memory, goroutines and connections, redrawn every interval on a cleared
+// screen until interrupted.
+func top(args []string) error {
+	fs := flag.NewFlagSet("top", flag.ExitOnError)
+	interval := fs.Duration("interval", 2*time.Second, "refresh interval")
+	sortKey := fs.String("sort", "cpu", "sort by pid, exec, cpu, rss, goroutines or conns")
+	parseCommandFlags(fs, args)
+	if *interval <= 0 {
+		return fmt.Errorf("invalid -interval %v", *interval)
+	}
+	if !containsString(topSortKeys, *sortKey) {
+		return fmt.Errorf("invalid -sort key %q, want one of %s", *sortKey, strings.Join(topSortKeys, ", "))
+	}
+
+	tty := isTerminal(os.Stdout)
+	interrupt := make(chan os.Signal, 1)
+	ossignal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer ossignal.Stop(interrupt)
+	if tty {
+		fmt.Print(hideCursor)
+		defer fmt.Print(showCursor)
+	}
+
+	sampler := &usageSampler{}
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for frame := 0; ; frame++ {
+		rows := sampleTopRows(dcrProcesses(), sampler)
+		sortTopRows(rows, *sortKey)
+
+		switch {
+		case tty:
+			fmt.Print(clearScreen)
+		case frame > 0:
+			fmt.Println()
+		}
+		fmt.Printf("dcrps top - %s, %d processes, every %v, by %s\n\n",
+			time.Now().Format("15:04:05"), len(rows), *interval, *sortKey)
+		writeTopTable(os.Stdout, rows)
+
+		select {
+		case <-ticker.C:
+		case <-interrupt:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/gops/goprocess"
+)
+
+func TestSortTopRows(t *testing.T) {
+	rows := []topRow{
+		{p: goprocess.P{PID: 30, Exec: "dcrd"}, goroutines: 40, goroutinesKnown: true,
+			usage: processUsage{cpu: 1, cpuKnown: true}},
+		// No agent and its first frame.
+		{p: goprocess.P{PID: 10, Exec: "dcrctl"}},
+		{p: goprocess.P{PID: 20, Exec: "dcrwallet"}, goroutines: 80, goroutinesKnown: true,
+			usage: processUsage{cpu: 0.5, cpuKnown: true}},
+	}
+	tests := []struct {
+		key  string
+		want []int
+	}{
+		{"pid", []int{10, 20, 30}},
+		{"exec", []int{10, 30, 20}},
+		{"cpu", []int{30, 20, 10}},
+		{"goroutines", []int{20, 30, 10}},
+	}
+	for _, test := range tests {
+		sortTopRows(rows, test.key)
+		var got []int
+		for _, r := range rows {
+			got = append(got, r.p.PID)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got=%v want=%v", test.key, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,403 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/gops/goprocess"
+	"github.com/shirou/gopsutil/process"
+	"github.com/xlab/treeprint"
+)
+
+// tree displays the process tree, optionally highlighting a process.
+func tree(args []string) error {
+	fs := flag.NewFlagSet("tree", flag.ExitOnError)
+	highlight := fs.String("highlight", "", "process to highlight")
+	path := fs.Bool("path", false, "also highlight the ancestors")
+	markdown := fs.Bool("markdown", false, "print the tree as a Markdown list")
+	dot := fs.Bool("dot", false, "print the tree as a DOT graph")
+	heatmap := fs.Bool("heatmap", false, "color the processes by CPU usage")
+	collapse := fs.Bool("collapse", false, "group identical sibling subtrees")
+	interval := fs.Duration("interval", time.Second, "CPU sampling interval of -heatmap")
+	parseCommandFlags(fs, args)
+
+	highlighted := make(map[int]bool)
+	if *highlight != "" {
+		pid, err := resolver.PID(*highlight)
+		if err != nil {
+			return err
+		}
+		highlighted[pid] = true
+		if *path {
+			for _, p := range ancestors(pid, dcrProcesses()) {
+				highlighted[p] = true
+			}
+		}
+	}
+	format := "tree"
+	switch {
+	case *markdown:
+		format = "markdown"
+	case *dot:
+		format = "dot"
+	case *jsonOutput:
+		format = "json"
+	case csvOutput():
+		format = "csv"
+	}
+	root := buildProcessTree()
+	if *collapse {
+		collapseTree(root, highlighted)
+	}
+	var cpu map[int]float64
+	if *heatmap {
+		if format != "tree" {
+			return errors.New("-heatmap only applies to the tree view")
+		}
+		cpu = sampleTreeCPU(root, *interval)
+	}
+	renderTree(root, highlighted, cpu, format)
+	return nil
+}
+
+// sampleTreeCPU samples the CPU usage of the processes of the tree under
+// root over interval, in percent of a CPU.
+func sampleTreeCPU(root *psNode, interval time.Duration) map[int]float64 {
+	procs := make(map[int]*process.Process)
+	var add func(n *psNode)
+	add = func(n *psNode) {
+		if n.process != nil {
+			if p, err := process.NewProcess(int32(n.pid)); err == nil {
+				if _, err := p.Percent(0); err == nil {
+					procs[n.pid] = p
+				}
+			}
+		}
+		for _, child := range n.children {
+			add(child)
+		}
+	}
+	add(root)
+	time.Sleep(interval)
+	cpu := make(map[int]float64)
+	for pid, p := range procs {
+		if v, err := p.Percent(0); err == nil {
+			cpu[pid] = v
+		}
+	}
+	return cpu
+}
+
+// ancestors returns the PIDs of the ancestors of pid among ps, parent first.
+func ancestors(pid int, ps []goprocess.P) []int {
+	ppids := make(map[int]int)
+	for _, p := range ps {
+		ppids[p.PID] = p.PPID
+	}
+	var pids []int
+	seen := map[int]bool{pid: true}
+	for {
+		ppid, ok := ppids[pid]
+		if !ok || seen[ppid] {
+			return pids
+		}
+		seen[ppid] = true
+		pids = append(pids, ppid)
+		pid = ppid
+	}
+}
+
+// psNode is a node of the process tree. The nodes without a process stand
+// for the parents of the top-level processes and only have a PID.
+type psNode struct {
+	pid      int
+	process  *goprocess.P
+	children []*psNode
+	// count is the number of identical sibling subtrees the node stands
+	// for once collapsed, see collapseTree.
+	count int
+}
+
+// buildProcessTree builds the tree of all the running dcr processes under a
+// root node.
+func buildProcessTree() *psNode {
+	return processTree(dcrProcesses())
+}
+
+// processTree builds the tree of ps under a root node. The top-level
+// processes, whose parent is not in ps, are placed under a node of their
+// parent PID, and their children nested beneath them. PID 0 and kernel
+// threads, which have no executable, are never part of the tree, and the
+// processes with a PPID of 0 are placed at the top rather than under a 0
+// node.
+func processTree(ps []goprocess.P) *psNode {
+	var valid []goprocess.P
+	pids := make(map[int]bool)
+	for _, p := range ps {
+		if p.PID > 0 && p.Path != "" {
+			valid = append(valid, p)
+			pids[p.PID] = true
+		}
+	}
+	pstree := make(map[int][]goprocess.P)
+	for _, p := range valid {
+		if p.PPID > 0 {
+			pstree[p.PPID] = append(pstree[p.PPID], p)
+		}
+	}
+	root := &psNode{}
+	parents := make(map[int]*psNode)
+	seen := make(map[int]bool)
+	add := func(p goprocess.P) {
+		if p.PPID <= 0 {
+			constructProcessTree(pstree, p, seen, root)
+			return
+		}
+		parent, ok := parents[p.PPID]
+		if !ok {
+			parent = &psNode{pid: p.PPID}
+			parents[p.PPID] = parent
+			root.children = append(root.children, parent)
+		}
+		constructProcessTree(pstree, p, seen, parent)
+	}
+	for _, p := range valid {
+		if !pids[p.PPID] {
+			add(p)
+		}
+	}
+	// The processes left are in a PPID cycle, which a listing racing
+	// with exits and PID reuse can show.
+	for _, p := range valid {
+		if !seen[p.PID] {
+			add(p)
+		}
+	}
+	return root
+}
+
+// subtreeKey returns the identity of the subtree of n: the exec, version and
+// agent of each of its processes and its shape. The parent PID nodes, which
+// have no process, are identified by their PID and never alike.
+func subtreeKey(n *psNode) string {
+	if n.process == nil {
+		return "^" + strconv.Itoa(n.pid)
+	}
+	keys := make([]string, len(n.children))
+	for i, child := range n.children {
+		keys[i] = subtreeKey(child) + "x" + strconv.Itoa(child.weight())
+	}
+	return fmt.Sprintf("%q %q %t (%s)", n.process.Exec, n.process.BuildVersion,
+		n.process.Agent, strings.Join(keys, " "))
+}
+
+// collapseTree groups the identical sibling subtrees under n into the first
+// of them, counting the others, such as the workers a test harness spawned.
+// The highlighted processes are kept apart so that they are still shown.
+func collapseTree(n *psNode, highlighted map[int]bool) {
+	for _, child := range n.children {
+		collapseTree(child, highlighted)
+	}
+	first := make(map[string]*psNode)
+	var children []*psNode
+	for _, child := range n.children {
+		if child.process == nil || highlighted[child.pid] {
+			children = append(children, child)
+			continue
+		}
+		key := subtreeKey(child)
+		if f, ok := first[key]; ok {
+			f.count = f.weight() + child.weight()
+			continue
+		}
+		first[key] = child
+		children = append(children, child)
+	}
+	n.children = children
+}
+
+// weight returns the number of subtrees n stands for.
+func (n *psNode) weight() int {
+	if n.count < 1 {
+		return 1
+	}
+	return n.count
+}
+
+// countLabel returns the label of the count of a collapsed node, or "".
+func (n *psNode) countLabel() string {
+	if n.count <= 1 {
+		return ""
+	}
+	return " (x" + strconv.Itoa(n.count) + ")"
+}
+
+// renderTree prints the tree under root in the given format: "tree" for the
+// ASCII tree, "markdown", "dot" or "json". The processes in highlighted are
+// marked, except in JSON. The ASCII tree also shows the CPU usage in cpu as
+// a heatmap when set.
+func renderTree(root *psNode, highlighted map[int]bool, cpu map[int]float64, format string) {
+	switch format {
+	case "markdown":
+		fmt.Print(markdownTree(root, highlighted))
+		return
+	case "dot":
+		fmt.Print(dotTree(root, highlighted))
+		return
+	case "json":
+		printJSON(treeJSON(root))
+		return
+	case "csv":
+		printCSV(treeCSVHeader, treeCSV(treeJSON(root)))
+		return
+	}
+	tree := treeprint.New()
+	tree.SetValue("...")
+	for _, n := range root.children {
+		addTreeBranch(tree, n, highlighted, cpu)
+	}
+	fmt.Println(tree.String())
+}
+
+// constructProcessTree adds the node of process under parent and the
+// branches of its children in pstree, which maps the PPIDs to the child
+// processes, in a depth-first fashion. The processes in seen are skipped.
+func constructProcessTree(pstree map[int][]goprocess.P, process goprocess.P, seen map[int]bool, parent *psNode) {
+	if seen[process.PID] {
+		return
+	}
+	seen[process.PID] = true
+	node := &psNode{pid: process.PID, process: &process}
+	parent.children = append(parent.children, node)
+	for _, child := range pstree[process.PID] {
+		constructProcessTree(pstree, child, seen, node)
+	}
+}
+
+// addTreeBranch adds the branch of n to tree, with the CPU usage of its
+// processes when cpu is set.
+func addTreeBranch(tree treeprint.Tree, n *psNode, highlighted map[int]bool, cpu map[int]float64) {
+	if n.process == nil {
+		tree = tree.AddBranch(n.pid)
+	} else {
+		process := n.process
+		output := strconv.Itoa(n.pid) + " (" + process.Exec + ")" + " {" + process.BuildVersion + "}" + n.countLabel()
+		if cpu != nil {
+			v, ok := cpu[n.pid]
+			percent := "?"
+			if ok {
+				percent = fmt.Sprintf("%.1f%%", v)
+			}
+			output = heat(output+" "+percent, v)
+		}
+		if highlighted[n.pid] {
+			output = highlight(output)
+		}
+		if process.Agent {
+			tree = tree.AddMetaBranch("*", output)
+		} else {
+			tree = tree.AddBranch(output)
+		}
+	}
+	for _, child := range n.children {
+		addTreeBranch(tree, child, highlighted, cpu)
+	}
+}
+
+// markdownCode returns s as a Markdown code span, fenced by more backticks
+// than any run of them in s.
+func markdownCode(s string) string {
+	longest, run := 0, 0
+	for _, r := range s {
+		if r != '`' {
+			run = 0
+			continue
+		}
+		if run++; run > longest {
+			longest = run
+		}
+	}
+	fence := strings.Repeat("`", longest+1)
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		s = " " + s + " "
+	}
+	return fence + s + fence
+}
+
+// markdownEscaper escapes the characters with a meaning in Markdown text.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`,
+)
+
+// markdownTree renders the tree under root as a nested Markdown list, with
+// the highlighted processes in bold. The exec names are code spans and the
+// versions escaped, so that neither breaks the list.
+func markdownTree(root *psNode, highlighted map[int]bool) string {
+	var b strings.Builder
+	var add func(n *psNode, depth int)
+	add = func(n *psNode, depth int) {
+		item := strconv.Itoa(n.pid)
+		if p := n.process; p != nil {
+			item += " " + markdownCode(p.Exec) + " " + markdownEscaper.Replace(p.BuildVersion) + n.countLabel()
+			if p.Agent {
+				item += " (agent)"
+			}
+			if highlighted[n.pid] {
+				item = "**" + item + "**"
+			}
+		}
+		b.WriteString(strings.Repeat("  ", depth) + "- " + item + "\n")
+		for _, child := range n.children {
+			add(child, depth+1)
+		}
+	}
+	for _, n := range root.children {
+		add(n, 0)
+	}
+	return b.String()
+}
+
+// dotTree renders the tree under root as a Graphviz DOT graph. Processes
+// running the agent are drawn bold and the highlighted ones filled.
+func dotTree(root *psNode, highlighted map[int]bool) string {
+	var b strings.Builder
+	b.WriteString("digraph dcrps {\n")
+	var add func(n *psNode)
+	add = func(n *psNode) {
+		if p := n.process; p != nil {
+			attrs := fmt.Sprintf("label=%q", p.Exec+n.countLabel()+"\n"+strconv.Itoa(n.pid)+"\n"+p.BuildVersion)
+			var styles []string
+			if p.Agent {
+				styles = append(styles, "bold")
+			}
+			if highlighted[n.pid] {
+				styles = append(styles, "filled")
+				attrs += ", fillcolor=yellow"
+			}
+			if len(styles) > 0 {
+				attrs += fmt.Sprintf(", style=%q", strings.Join(styles, ","))
+			}
+			fmt.Fprintf(&b, "\t%d [%s];\n", n.pid, attrs)
+		} else {
+			fmt.Fprintf(&b, "\t%d [shape=plaintext];\n", n.pid)
+		}
+		for _, child := range n.children {
+			fmt.Fprintf(&b, "\t%d -> %d;\n", n.pid, child.pid)
+			add(child)
+		}
+	}
+	for _, n := range root.children {
+		add(n)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/gops/goprocess"
+)
+
+// treeString renders the tree under root on one line, children in brackets
+// and the parent PID nodes, which have no process, with a caret.
+func treeString(root *psNode) string {
+	var parts []string
+	for _, n := range root.children {
+		s := strconv.Itoa(n.pid)
+		if n.process == nil {
+			s = "^" + s
+		}
+		if len(n.children) > 0 {
+			s += treeString(n)
+		}
+		parts = append(parts, s)
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+func TestProcessTree(t *testing.T) {
+	// Listed children first so that no parent is seen before its children.
+	ps := []goprocess.P{
+		{PID: 102, PPID: 101, Exec: "dcrctl", Path: "/bin/dcrctl"},
+		{PID: 103, PPID: 101, Exec: "dcrctl", Path: "/bin/dcrctl"},
+		// An orphan, its parent isn't a dcr process.
+		{PID: 200, PPID: 50, Exec: "dcrdata", Path: "/bin/dcrdata"},
+		{PID: 101, PPID: 100, Exec: "dcrwallet", Path: "/bin/dcrwallet"},
+		{PID: 100, PPID: 1, Exec: "dcrd", Path: "/bin/dcrd"},
+		{PID: 201, PPID: 50, Exec: "dcrd", Path: "/bin/dcrd"},
+		// A PPID cycle.
+		{PID: 300, PPID: 301, Exec: "dcrd", Path: "/bin/dcrd"},
+		{PID: 301, PPID: 300, Exec: "dcrctl", Path: "/bin/dcrctl"},
+	}
+	if got, want := treeString(processTree(ps)), "[^50[200 201] ^1[100[101[102 103]]] ^301[300[301]]]"; got != want {
+		t.Errorf("processTree: got=%v want=%v", got, want)
+	}
+}
+
+func TestAncestors(t *testing.T) {
+	ps := []goprocess.P{
+		{PID: 102, PPID: 101, Exec: "dcrctl"},
+		{PID: 101, PPID: 100, Exec: "dcrwallet"},
+		{PID: 100, PPID: 1, Exec: "dcrd"},
+		// A PPID cycle.
+		{PID: 300, PPID: 301, Exec: "dcrd"},
+		{PID: 301, PPID: 300, Exec: "dcrctl"},
+	}
+	tests := []struct {
+		pid  int
+		want string
+	}{
+		// The parent of the top-level process is kept, though not listed.
+		{102, "[101 100 1]"},
+		{100, "[1]"},
+		{300, "[301]"},
+		{999, "[]"},
+	}
+	for _, test := range tests {
+		if got := fmt.Sprint(ancestors(test.pid, ps)); got != test.want {
+			t.Errorf("ancestors(%d): got=%v want=%v", test.pid, got, test.want)
+		}
+	}
+}
+
+func TestProcessTreePPIDZero(t *testing.T) {
+	ps := []goprocess.P{
+		// A container's init, whose parent is outside the namespace.
+		{PID: 1, PPID: 0, Exec: "dcrd", Path: "/bin/dcrd"},
+		{PID: 10, PPID: 1, Exec: "dcrctl", Path: "/bin/dcrctl"},
+		// Never valid nodes.
+		{PID: 0, PPID: 0, Exec: "dcrswapper", Path: "/bin/dcrswapper"},
+		{PID: 20, PPID: 2, Exec: "dcrkthread"},
+	}
+	if got, want := treeString(processTree(ps)), "[1[10]]"; got != want {
+		t.Errorf("processTree: got=%v want=%v", got, want)
+	}
+}
+
+func TestCollapseTree(t *testing.T) {
+	ps := []goprocess.P{
+		{PID: 10, PPID: 1, Exec: "dcrharness", Path: "/bin/dcrharness"},
+	}
+	// Three identical workers, each with a child, one unlike the others
+	// and a highlighted one.
+	for pid := 11; pid <= 13; pid++ {
+		ps = append(ps,
+			goprocess.P{PID: pid, PPID: 10, Exec: "dcrd", Path: "/bin/dcrd", BuildVersion: "go1.12"},
+			goprocess.P{PID: pid + 100, PPID: pid, Exec: "dcrctl", Path: "/bin/dcrctl"})
+	}
+	ps = append(ps,
+		goprocess.P{PID: 14, PPID: 10, Exec: "dcrd", Path: "/bin/dcrd", BuildVersion: "go1.11"},
+		goprocess.P{PID: 15, PPID: 10, Exec: "dcrd", Path: "/bin/dcrd", BuildVersion: "go1.12"})
+	root := processTree(ps)
+	collapseTree(root, map[int]bool{15: true})
+	if got, want := treeString(root), "[^1[10[11[111] 14 15]]]"; got != want {
+		t.Errorf("collapseTree: got=%v want=%v", got, want)
+	}
+	if got := root.children[0].children[0].children[0].count; got != 3 {
+		t.Errorf("collapseTree: got count %d want 3", got)
+	}
+}
+
+func TestMarkdownTree(t *testing.T) {
+	tests := []struct {
+		name        string
+		ps          []goprocess.P
+		highlighted map[int]bool
+		want        string
+	}{
+		{
+			name: "nesting",
+			ps: []goprocess.P{
+				{PID: 101, PPID: 100, Exec: "dcrwallet", Path: "/bin/dcrwallet", BuildVersion: "go1.12", Agent: true},
+				{PID: 100, PPID: 1, Exec: "dcrd", Path: "/bin/dcrd", BuildVersion: "go1.12"},
+				{PID: 102, PPID: 101, Exec: "dcrctl", Path: "/bin/dcrctl", BuildVersion: "go1.11"},
+			},
+			highlighted: map[int]bool{101: true},
+			want: "- 1\n" +
+				"  - 100 `dcrd` go1.12\n" +
+				"    - **101 `dcrwallet` go1.12 (agent)**\n" +
+				"      - 102 `dcrctl` go1.11\n",
+		},
+		{
+			name: "escaping",
+			ps: []goprocess.P{
+				{PID: 100, PPID: 1, Exec: "dcr`d", Path: "/bin/dcr`d", BuildVersion: "devel_*x*"},
+				{PID: 101, PPID: 1, Exec: "`dcrd``", Path: "/bin/`dcrd``", BuildVersion: "go1.12 <rc1>"},
+			},
+			want: "- 1\n" +
+				"  - 100 ``dcr`d`` devel\\_\\*x\\*\n" +
+				"  - 101 ``` `dcrd`` ``` go1.12 \\<rc1\\>\n",
+		},
+	}
+	for _, tt := range tests {
+		if got := markdownTree(processTree(tt.ps), tt.highlighted); got != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
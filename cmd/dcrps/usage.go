@@ -0,0 +1,61 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/google/gops/goprocess"
+	"github.com/shirou/gopsutil/process"
+)
+
+// processUsage is the CPU and memory usage of a process in the listing.
+type processUsage struct {
+	cpu      float64 // in percent of a CPU, since the previous frame of -watch
+	cpuKnown bool    // false on the first frame of the process
+	rss      uint64
+
+	memPercent float64 // of the host memory
+	memKnown   bool
+
+	threads      int32 // read only by readUsage
+	threadsKnown bool
+}
+
+// readMemUsage reads the memory usage of p into u.
+func readMemUsage(p *process.Process, u *processUsage) {
+	if mi, err := p.MemoryInfo(); err == nil {
+		u.rss = mi.RSS
+	}
+	if v, err := p.MemoryPercent(); err == nil {
+		u.memPercent, u.memKnown = float64(v), true
+	}
+}
+
+// readUsage returns the usage of p, its CPU usage over its lifetime.
+func readUsage(p *process.Process) processUsage {
+	var u processUsage
+	if v, err := p.CPUPercent(); err == nil {
+		u.cpu, u.cpuKnown = v, true
+	}
+	readMemUsage(p, &u)
+	if v, err := p.NumThreads(); err == nil {
+		u.threads, u.threadsKnown = v, true
+	}
+	return u
+}
+
+// processUsages returns the usage of ps, their CPU usage over their lifetime,
+// leaving out the processes that exited.
+func processUsages(ps []goprocess.P) map[int]processUsage {
+	defer benchPhase("process collection")()
+	usage := make(map[int]processUsage, len(ps))
+	for _, p := range ps {
+		pr, err := process.NewProcess(int32(p.PID))
+		if err != nil {
+			continue
+		}
+		usage[p.PID] = readUsage(pr)
+	}
+	return usage
+}
@@ -0,0 +1,106 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dcrlabs/dcrps/resolve"
+	"github.com/google/gops/signal"
+)
+
+// waitAgent waits for a process to appear and then for its agent to answer,
+// for the deploy scripts that must wait for a node to be ready. It exits with
+// exitNoProcess when no process appeared and with exitAgentUnreachable when
+// the process appeared but its agent never answered.
+func waitAgent(args []string) error {
+	fs := flag.NewFlagSet("wait-agent", flag.ExitOnError)
+	wait := fs.Duration("timeout", time.Minute, "how long to wait in all")
+	interval := fs.Duration("interval", 500*time.Millisecond, "polling interval")
+	target := parseTargetFlags(fs, args)
+	if target == "" {
+		return errors.New("missing PID, exec name or address")
+	}
+
+	deadline := time.Now().Add(*wait)
+	pid := -1
+	if !strings.Contains(target, ":") {
+		// A new resolver each time, since the resolver caches the
+		// processes it found.
+		var err error
+		pid, err = waitForProcess(target, deadline, *interval, func(target string) (int, error) {
+			return exactResolver().PID(target)
+		})
+		if _, ok := err.(*resolve.AmbiguousError); ok {
+			return err
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "no process appeared within %v: %v\n", *wait, err)
+			exit(exitNoProcess)
+		}
+	}
+
+	agentTarget := target
+	if pid > 0 {
+		// That process, as the name may have been picked from several.
+		agentTarget = strconv.Itoa(pid)
+	}
+	addr, err := waitForAgent(agentTarget, deadline, *interval)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "the agent didn't answer within %v: %v\n", *wait, err)
+		exit(exitAgentUnreachable)
+	}
+	if pid > 0 {
+		fmt.Printf("%s (%d) agent ready at %v\n", target, pid, addr)
+	} else {
+		fmt.Printf("agent ready at %v\n", addr)
+	}
+	return nil
+}
+
+// waitForProcess waits until deadline for a process of target to appear,
+// polling every interval with find, and returns its PID or the last error.
+// It gives up at once when several processes match, as more processes won't
+// make it less so.
+func waitForProcess(target string, deadline time.Time, interval time.Duration,
+	find func(target string) (int, error)) (int, error) {
+	for {
+		pid, err := find(target)
+		if err == nil {
+			return pid, nil
+		}
+		if _, ok := err.(*resolve.AmbiguousError); ok {
+			return 0, err
+		}
+		if time.Now().After(deadline) {
+			return 0, err
+		}
+		time.Sleep(interval)
+	}
+}
+
+// waitForAgent waits until deadline for the agent of target to answer,
+// polling every interval, and returns its address or the last error.
+func waitForAgent(target string, deadline time.Time, interval time.Duration) (*net.TCPAddr, error) {
+	for {
+		addr, err := newResolver().Resolve(target)
+		if err == nil {
+			if _, err = cmdDeadline(*addr, interval+time.Second, signal.Version); err == nil {
+				return addr, nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return nil, err
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dcrlabs/dcrps/resolve"
+)
+
+func TestWaitForProcess(t *testing.T) {
+	missing := &resolve.NoProcessError{Target: "dcrd"}
+	ambiguous := &resolve.AmbiguousError{Name: "dcrd"}
+	tests := []struct {
+		name    string
+		results []error // of the successive finds, the process found after
+		wait    time.Duration
+		err     error
+		finds   int
+	}{
+		{"running", nil, time.Second, nil, 1},
+		{"appearing", []error{missing, missing}, time.Second, nil, 3},
+		{"never appearing", []error{missing, missing, missing, missing, missing}, 0, missing, 1},
+		// More processes won't make it less so.
+		{"ambiguous", []error{missing, ambiguous}, time.Second, ambiguous, 2},
+	}
+	for _, test := range tests {
+		var finds int
+		find := func(target string) (int, error) {
+			finds++
+			if finds <= len(test.results) {
+				return 0, test.results[finds-1]
+			}
+			return 1 << 30, nil
+		}
+		pid, err := waitForProcess("dcrd", time.Now().Add(test.wait), time.Millisecond, find)
+		if err != test.err || finds != test.finds {
+			t.Errorf("%s: got %v after %d finds, want %v after %d", test.name, err, finds, test.err, test.finds)
+		}
+		if test.err == nil && pid != 1<<30 {
+			t.Errorf("%s: got PID %d", test.name, pid)
+		}
+	}
+}
+
+func TestWaitForAgent(t *testing.T) {
+	addr, requests := resetServer(t, 2)
+	got, err := waitForAgent(addr.String(), time.Now().Add(5*time.Second), time.Millisecond)
+	if err != nil || got.String() != addr.String() {
+		t.Errorf("got=%v,%v want=%v", got, err, addr)
+	}
+	if *requests != 3 {
+		t.Errorf("got %d requests, want the 2 reset and the answered one", *requests)
+	}
+
+	// Nothing listens there any more.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	if _, err := waitForAgent(l.Addr().String(), time.Now(), time.Millisecond); err == nil {
+		t.Error("no agent: got no error")
+	}
+}
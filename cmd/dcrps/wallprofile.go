@@ -0,0 +1,356 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	ossignal "os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dcrlabs/dcrps/pkg/dcrps"
+	"github.com/google/gops/signal"
+)
+
+// protoWriter writes the fields of a protocol buffers message, the encoding
+// of the pprof profiles.
+type protoWriter struct {
+	data []byte
+}
+
+func (w *protoWriter) varint(v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	w.data = append(w.data, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+// uint64Field writes a varint field, leaving it out when zero as protocol
+// buffers do.
+func (w *protoWriter) uint64Field(num int, v uint64) {
+	if v == 0 {
+		return
+	}
+	w.varint(uint64(num) << 3) // varint
+	w.varint(v)
+}
+
+func (w *protoWriter) bytesField(num int, data []byte) {
+	w.varint(uint64(num)<<3 | 2) // length-delimited
+	w.varint(uint64(len(data)))
+	w.data = append(w.data, data...)
+}
+
+// packedField writes a repeated varint field, packed.
+func (w *protoWriter) packedField(num int, vs []uint64) {
+	var p protoWriter
+	for _, v := range vs {
+		p.varint(v)
+	}
+	w.bytesField(num, p.data)
+}
+
+// wallLocation is a line of a function, the location of the frames of the
+// wall-clock profile.
+type wallLocation struct {
+	fn, file string
+	line     int
+}
+
+// wallSample is the wall time spent in a stack by the goroutines in a state.
+type wallSample struct {
+	state     string
+	locations []uint64 // IDs, leaf first
+	count     int64    // of the samples
+	nanos     int64
+}
+
+// wallProfile accumulates stack samples into a wall-clock profile, which
+// attributes the time between the samples to the stacks of all the
+// goroutines, running or blocked, as fgprof does.
+type wallProfile struct {
+	start   time.Time
+	period  time.Duration
+	samples map[string]*wallSample // by state and stack
+	order   []string               // the keys of samples, as added
+	locs    map[wallLocation]uint64
+	locList []wallLocation // by ID-1
+	taken   int
+	last    time.Time
+}
+
+func newWallProfile(start time.Time, period time.Duration) *wallProfile {
+	return &wallProfile{
+		start:   start,
+		period:  period,
+		samples: make(map[string]*wallSample),
+		locs:    make(map[wallLocation]uint64),
+	}
+}
+
+// parseFrameFile splits the file of a frame, such as
+// "/go/src/net/fd_unix.go:202 +0x4f", into its path and line.
+func parseFrameFile(file string) (string, int) {
+	if i := strings.Index(file, " "); i >= 0 {
+		file = file[:i]
+	}
+	i := strings.LastIndex(file, ":")
+	if i < 0 {
+		return file, 0
+	}
+	line, err := strconv.Atoi(file[i+1:])
+	if err != nil {
+		return file, 0
+	}
+	return file[:i], line
+}
+
+// selfFunc is the frame of the goroutine of the agent writing the stacks,
+// which the profile leaves out.
+const selfFunc = "runtime/pprof.writeGoroutineStacks"
+
+// add adds the stacks of gs sampled at t, each weighted with the time since
+// the previous sample, or the period for the first one.
+func (p *wallProfile) add(gs []goroutine, t time.Time) {
+	elapsed := p.period
+	if !p.last.IsZero() {
+		elapsed = t.Sub(p.last)
+	}
+	p.last = t
+	p.taken++
+	var key strings.Builder
+outer:
+	for _, g := range gs {
+		key.Reset()
+		key.WriteString(g.State)
+		ids := make([]uint64, 0, len(g.Frames))
+		for _, f := range g.Frames {
+			if f.Func == selfFunc {
+				continue outer
+			}
+			file, line := parseFrameFile(f.File)
+			loc := wallLocation{f.Func, file, line}
+			id, ok := p.locs[loc]
+			if !ok {
+				p.locList = append(p.locList, loc)
+				id = uint64(len(p.locList))
+				p.locs[loc] = id
+			}
+			ids = append(ids, id)
+			fmt.Fprintf(&key, ",%d", id)
+		}
+		s, ok := p.samples[key.String()]
+		if !ok {
+			s = &wallSample{state: g.State, locations: ids}
+			p.samples[key.String()] = s
+			p.order = append(p.order, key.String())
+		}
+		s.count++
+		s.nanos += int64(elapsed)
+	}
+}
+
+// encode returns the profile in the pprof format, gzipped, with the samples
+// and the wall time as its sample types and the state of the goroutines as
+// the "state" label of the samples.
+func (p *wallProfile) encode() ([]byte, error) {
+	strs := map[string]uint64{"": 0}
+	strList := []string{""}
+	str := func(s string) uint64 {
+		if i, ok := strs[s]; ok {
+			return i
+		}
+		strs[s] = uint64(len(strList))
+		strList = append(strList, s)
+		return strs[s]
+	}
+	valueType := func(typ, unit string) []byte {
+		var w protoWriter
+		w.uint64Field(1, str(typ))
+		w.uint64Field(2, str(unit))
+		return w.data
+	}
+
+	var w protoWriter
+	w.bytesField(1, valueType("samples", "count")) // sample_type
+	w.bytesField(1, valueType("wall", "nanoseconds"))
+	for _, key := range p.order {
+		s := p.samples[key]
+		var sw, label protoWriter
+		sw.packedField(1, s.locations)
+		sw.packedField(2, []uint64{uint64(s.count), uint64(s.nanos)})
+		label.uint64Field(1, str("state"))
+		label.uint64Field(2, str(s.state))
+		sw.bytesField(3, label.data)
+		w.bytesField(2, sw.data) // sample
+	}
+	funcs := make(map[[2]string]uint64)
+	var funcList [][2]string
+	for i, loc := range p.locList {
+		fn := [2]string{loc.fn, loc.file}
+		id, ok := funcs[fn]
+		if !ok {
+			funcList = append(funcList, fn)
+			id = uint64(len(funcList))
+			funcs[fn] = id
+		}
+		var lw, line protoWriter
+		lw.uint64Field(1, uint64(i+1))
+		line.uint64Field(1, id)
+		line.uint64Field(2, uint64(loc.line))
+		lw.bytesField(4, line.data)
+		w.bytesField(4, lw.data) // location
+	}
+	for i, fn := range funcList {
+		var fw protoWriter
+		fw.uint64Field(1, uint64(i+1))
+		fw.uint64Field(2, str(fn[0]))
+		fw.uint64Field(3, str(fn[0]))
+		fw.uint64Field(4, str(fn[1]))
+		w.bytesField(5, fw.data) // function
+	}
+	w.uint64Field(9, uint64(p.start.UnixNano()))       // time_nanos
+	w.uint64Field(10, uint64(p.last.Sub(p.start)))     // duration_nanos
+	w.bytesField(11, valueType("wall", "nanoseconds")) // period_type
+	w.uint64Field(12, uint64(p.period))                // period
+	w.uint64Field(14, str("wall"))                     // default_sample_type
+	// The strings last, once all are known.
+	for _, s := range strList {
+		w.bytesField(6, []byte(s)) // string_table
+	}
+
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	if _, err := zw.Write(w.data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// sampleWallProfile samples the stacks of the agent at addr every period
+// for window, or until interrupted, into a wall-clock profile.
+func sampleWallProfile(addr net.TCPAddr, window, period time.Duration) (*wallProfile, error) {
+	interrupt := make(chan os.Signal, 1)
+	ossignal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer ossignal.Stop(interrupt)
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	start := time.Now()
+	p := newWallProfile(start, period)
+	for deadline := start.Add(window); ; {
+		out, err := cmd(addr, signal.StackTrace)
+		if err != nil {
+			return nil, err
+		}
+		p.add(dcrps.ParseStack(out), time.Now())
+		if !time.Now().Before(deadline) {
+			return p, nil
+		}
+		select {
+		case <-ticker.C:
+		case <-interrupt:
+			fmt.Fprintln(os.Stderr, "interrupted, writing the profile of the samples taken")
+			return p, nil
+		}
+	}
+}
+
+// pprofWall builds a wall-clock profile of the goroutines, running or
+// blocked, from their stacks sampled at -hz for -duration, and launches "go
+// tool pprof" on it. The CPU profile only tells the time on the CPU, not
+// the time waiting for I/O, locks or channels, which slows most processes
+// down.
+func pprofWall(addr net.TCPAddr, params []string) error {
+	fs := flag.NewFlagSet("pprof-wall", flag.ExitOnError)
+	window := fs.Duration("duration", 30*time.Second, "how long to sample for")
+	hz := fs.Int("hz", 10, "samples per second")
+	out := fs.String("out", "", "save the profile to file, kept after go tool pprof exits")
+	noLaunch := fs.Bool("no-launch", false, "only save the profile, without launching go tool pprof")
+	httpAddr, err := parsePprofFlagSet(fs, params)
+	if err != nil {
+		return err
+	}
+	if *window <= 0 {
+		return fmt.Errorf("invalid -duration %v", *window)
+	}
+	if *hz <= 0 || *hz > 100 {
+		return fmt.Errorf("invalid -hz %d, it must be from 1 to 100", *hz)
+	}
+	period := time.Second / time.Duration(*hz)
+
+	fmt.Printf("Sampling the goroutines %d times a second for %v...\n", *hz, *window)
+	p, err := sampleWallProfile(addr, *window, period)
+	if err != nil {
+		return err
+	}
+	if elapsed := p.last.Sub(p.start); p.taken > 1 {
+		if got := float64(p.taken-1) / elapsed.Seconds(); got < 0.8*float64(*hz) {
+			fmt.Fprintf(os.Stderr, "warning: got %.1f samples a second of the %d asked, "+
+				"the stack dumps take %v\n", got, *hz, (elapsed / time.Duration(p.taken-1)).Round(time.Millisecond))
+		}
+	}
+	if len(p.samples) == 0 {
+		return errors.New("no goroutine was sampled")
+	}
+	data, err := p.encode()
+	if err != nil {
+		return err
+	}
+
+	path := *out
+	if path != "" {
+		if err := writeFileAtomic(path, data); err != nil {
+			return err
+		}
+	} else {
+		tmpfile, err := ioutil.TempFile("", "profile")
+		if err != nil {
+			return err
+		}
+		path = tmpfile.Name()
+		if err := ioutil.WriteFile(path, data, 0); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Profile dump saved to: %s\n", path)
+	if *noLaunch {
+		return nil
+	}
+	// If go tool chain not found, stopping here and keep dump file.
+	if _, err := exec.LookPath("go"); err != nil {
+		return nil
+	}
+	if *out == "" {
+		defer os.Remove(path)
+	}
+	args := []string{"tool", "pprof"}
+	if httpAddr != "" {
+		host, port, _ := net.SplitHostPort(httpAddr)
+		if host == "" {
+			host = "localhost"
+		}
+		fmt.Printf("Serving the pprof web UI at http://%s/\n", net.JoinHostPort(host, port))
+		args = append(args, "-http="+httpAddr)
+	}
+	cmd := exec.Command("go", append(args, path)...)
+	cmd.Env = os.Environ()
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
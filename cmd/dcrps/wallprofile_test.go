@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dcrlabs/dcrps/flame"
+)
+
+func TestParseFrameFile(t *testing.T) {
+	file, line := parseFrameFile("/go/src/net/fd_unix.go:202 +0x4f")
+	if file != "/go/src/net/fd_unix.go" || line != 202 {
+		t.Errorf("got %q, %d", file, line)
+	}
+	if file, line := parseFrameFile("?"); file != "?" || line != 0 {
+		t.Errorf("no line: got %q, %d", file, line)
+	}
+}
+
+func TestWallProfile(t *testing.T) {
+	blocked := goroutine{ID: 1, State: "IO wait", Frames: []frame{
+		{Func: "internal/poll.runtime_pollWait", File: "/go/src/runtime/netpoll.go:173 +0x66"},
+		{Func: "main.main", File: "/src/main.go:10 +0x20"},
+	}}
+	running := goroutine{ID: 2, State: "running", Frames: []frame{
+		{Func: "main.work", File: "/src/main.go:20 +0x10"},
+		{Func: "main.main", File: "/src/main.go:12 +0x20"},
+	}}
+	self := goroutine{ID: 3, State: "running", Frames: []frame{
+		{Func: selfFunc, File: "/go/src/runtime/pprof/pprof.go:693 +0x70"},
+	}}
+	start := time.Unix(1557741600, 0)
+	p := newWallProfile(start, 100*time.Millisecond)
+	p.add([]goroutine{blocked, running, self}, start)
+	p.add([]goroutine{blocked, self}, start.Add(300*time.Millisecond))
+
+	data, err := p.encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prof, err := flame.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][2]string{{"samples", "count"}, {"wall", "nanoseconds"}}
+	if len(prof.SampleTypes) != 2 || prof.SampleTypes[0] != want[0] || prof.SampleTypes[1] != want[1] {
+		t.Fatalf("sample types: got %v", prof.SampleTypes)
+	}
+	if prof.DefaultSampleType != 1 {
+		t.Errorf("default sample type: got %d", prof.DefaultSampleType)
+	}
+	walls := make(map[string]int64)
+	prof.Stacks(1, func(stack []string, value int64) {
+		walls[strings.Join(stack, ";")] += value
+	})
+	if len(walls) != 2 {
+		t.Errorf("got stacks %v", walls)
+	}
+	// The first sample weighs the period, the second the time since.
+	if got := walls["main.main;internal/poll.runtime_pollWait"]; got != int64(400*time.Millisecond) {
+		t.Errorf("blocked: got %v", time.Duration(got))
+	}
+	if got := walls["main.main;main.work"]; got != int64(100*time.Millisecond) {
+		t.Errorf("running: got %v", time.Duration(got))
+	}
+}
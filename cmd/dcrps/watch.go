@@ -0,0 +1,427 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/dcrlabs/dcrps/pkg/dcrps"
+	"github.com/google/gops/goprocess"
+	"github.com/google/gops/signal"
+	"github.com/shirou/gopsutil/process"
+)
+
+// procSample holds the metrics of a process at one point in time.
+type procSample struct {
+	pid     int
+	exec    string
+	agent   bool
+	metrics map[string]float64
+}
+
+// sampler samples the metrics of the dcr processes. It keeps the processes
+// between samples so that the CPU usage is measured over the interval.
+type sampler struct {
+	metrics map[string]bool // the metrics to sample
+	procs   map[int]*process.Process
+}
+
+func newSampler(metrics []string) *sampler {
+	s := &sampler{
+		metrics: make(map[string]bool),
+		procs:   make(map[int]*process.Process),
+	}
+	for _, m := range metrics {
+		s.metrics[m] = true
+	}
+	return s
+}
+
+// sample returns the metrics of the running processes. Metrics that can't be
+// read, e.g. goroutines of processes without the agent, are left out.
+func (s *sampler) sample() []procSample {
+	ps := dcrProcesses()
+	alive := make(map[int]bool)
+	var samples []procSample
+	for _, p := range ps {
+		alive[p.PID] = true
+		pr, ok := s.procs[p.PID]
+		if !ok {
+			var err error
+			pr, err = process.NewProcess(int32(p.PID))
+			if err != nil {
+				continue
+			}
+			s.procs[p.PID] = pr
+			// The first CPU reading only records the times to measure
+			// the next one from.
+			pr.Percent(0)
+		}
+		samples = append(samples, procSample{
+			pid:     p.PID,
+			exec:    p.Exec,
+			agent:   p.Agent,
+			metrics: s.sampleProcess(p, pr),
+		})
+	}
+	for pid := range s.procs {
+		if !alive[pid] {
+			delete(s.procs, pid)
+		}
+	}
+	return samples
+}
+
+func (s *sampler) sampleProcess(p goprocess.P, pr *process.Process) map[string]float64 {
+	m := make(map[string]float64)
+	if s.metrics["memory"] {
+		if v, err := pr.MemoryPercent(); err == nil {
+			m["memory"] = float64(v)
+		}
+	}
+	if s.metrics["rss"] {
+		if v, err := pr.MemoryInfo(); err == nil {
+			m["rss"] = float64(v.RSS)
+		}
+	}
+	if s.metrics["cpu"] {
+		if v, err := pr.Percent(0); err == nil {
+			m["cpu"] = v
+		}
+	}
+	if s.metrics["threads"] {
+		if v, err := pr.NumThreads(); err == nil {
+			m["threads"] = float64(v)
+		}
+	}
+	if s.metrics["connections"] {
+		if conns, err := pr.Connections(); err == nil {
+			var n int
+			for _, c := range conns {
+				if c.Status != "LISTEN" {
+					n++
+				}
+			}
+			m["connections"] = float64(n)
+		}
+	}
+	if s.metrics["gc"] && p.Agent {
+		if addr, err := resolver.Resolve(strconv.Itoa(p.PID)); err == nil {
+			if ms, _, err := readMemStats(*addr); err == nil && ms.LastGC > 0 {
+				m["heap-alloc"] = float64(ms.HeapAlloc)
+				m["last-gc"] = float64(ms.LastGC) / 1e9
+			}
+		}
+	}
+	if s.metrics["goroutines"] && p.Agent {
+		if addr, err := resolver.Resolve(strconv.Itoa(p.PID)); err == nil {
+			if out, err := cmd(*addr, signal.Stats); err == nil {
+				if v, ok := intValue(dcrps.ParseKeyValues(out), "goroutines"); ok {
+					m["goroutines"] = float64(v)
+				}
+			}
+		}
+	}
+	return m
+}
+
+// formatMetric formats a value of metric, the percentages with one decimal,
+// the sizes in bytes with their unit and the counts without.
+func formatMetric(metric string, v float64) string {
+	switch metric {
+	case "memory", "cpu":
+		return fmt.Sprintf("%.1f%%", v)
+	case "rss":
+		return formatBytes(uint64(v))
+	}
+	return fmt.Sprintf("%.0f", v)
+}
+
+// alertTrigger captures a snapshot of the process of each alert and runs the
+// hook of -exec-on-trigger.
+type alertTrigger struct {
+	hook        string // run by the shell, none when ""
+	hookTimeout time.Duration
+	dir         string // of the snapshots, none when ""
+}
+
+// hookCommand returns the command running hook with the shell of the system,
+// sh -c or, on Windows, cmd /C.
+func hookCommand(hook string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", hook)
+	}
+	return exec.Command("sh", "-c", hook)
+}
+
+// fire reacts to the alert reported by line on the process of ps. The
+// sampling waits for the hook, which is killed after hookTimeout along with
+// the processes it started.
+func (t *alertTrigger) fire(ps procSample, line string) {
+	var snapshot string
+	if t.dir != "" {
+		path, err := captureAlertSnapshot(ps, t.dir, time.Now())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "watch: %s (PID %d): cannot capture the snapshot: %v\n", ps.exec, ps.pid, err)
+		} else {
+			snapshot = path
+			fmt.Printf("Snapshot saved to: %s\n", path)
+		}
+	}
+	if t.hook == "" {
+		return
+	}
+	hook := hookCommand(t.hook)
+	setProcessGroup(hook)
+	hook.Env = append(os.Environ(),
+		"DCRPS_PID="+strconv.Itoa(ps.pid),
+		"DCRPS_EXEC="+ps.exec,
+		"DCRPS_ALERT="+line,
+		"DCRPS_SNAPSHOT="+snapshot,
+	)
+	hook.Stdout = os.Stdout
+	hook.Stderr = os.Stderr
+	if err := hook.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "watch: -exec-on-trigger: %v\n", err)
+		return
+	}
+	done := make(chan error, 1)
+	go func() { done <- hook.Wait() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "watch: -exec-on-trigger: %v\n", err)
+		}
+	case <-time.After(t.hookTimeout):
+		if err := killProcessGroup(hook.Process); err != nil {
+			fmt.Fprintf(os.Stderr, "watch: -exec-on-trigger: %v\n", err)
+		}
+		<-done
+		fmt.Fprintf(os.Stderr, "watch: -exec-on-trigger: killed after -hook-timeout %v\n", t.hookTimeout)
+	}
+}
+
+// captureAlertSnapshot writes the stack trace, the goroutines grouped by stack
+// and the heap profile of the process of ps to a tar.gz in dir, as snapshot
+// does, and returns its path.
+func captureAlertSnapshot(ps procSample, dir string, now time.Time) (string, error) {
+	if !ps.agent {
+		return "", errors.New("the process doesn't run the agent")
+	}
+	addr, err := resolver.Resolve(strconv.Itoa(ps.pid))
+	if err != nil {
+		return "", err
+	}
+	// The heap profile may take longer than the samples are given.
+	defer func(t time.Duration) { cmdTimeout = t }(cmdTimeout)
+	cmdTimeout = time.Minute
+
+	b := &snapshotBundle{dir: snapshotName(fmt.Sprintf("%s-%d", ps.exec, ps.pid), now)}
+	if out, err := cmd(*addr, signal.StackTrace); err != nil {
+		b.addErr("stack.txt", err)
+	} else {
+		b.add("stack.txt", out)
+		b.add("goroutines.txt", []byte(dedupeReport(dcrps.ParseStack(out))))
+	}
+	if out, err := cmd(*addr, signal.HeapProfile); err != nil {
+		b.addErr("heap.pprof", err)
+	} else {
+		b.add("heap.pprof", out)
+	}
+	data, err := b.archive(now)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, b.dir+".tar.gz")
+	if err := writeFileAtomic(path, data); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// watch samples the processes on an interval and reports when a process
+// crosses or clears one of the alert thresholds.
+func watch(args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	interval := fs.Duration("interval", 2*time.Second, "time between samples")
+	exitOnAlert := fs.Bool("exit", false, "exit on the first alert")
+	var alerts alertFlag
+	fs.Var(&alerts, "alert", "alert threshold expression, may be repeated")
+	gcStall := fs.Duration("gc-stall", 0, "alert when no GC ran for this long while the heap grew")
+	rssLimit := fs.String("rss-limit", "", "alert when the resident memory exceeds this size, e.g. 2GB")
+	goroutinesLimit := fs.Int("goroutines-limit", 0, "alert when the goroutines exceed this count")
+	hook := fs.String("exec-on-trigger", "", "run this shell command on each alert, after capturing a snapshot")
+	hookTimeout := fs.Duration("hook-timeout", time.Minute, "kill the -exec-on-trigger command after this long")
+	snapshotDir := fs.String("snapshot-dir", "", "capture a stack and heap snapshot into this directory on each alert")
+	parseCommandFlags(fs, args)
+	if *rssLimit != "" {
+		n, err := parseByteSize(*rssLimit)
+		if err != nil {
+			return fmt.Errorf("invalid -rss-limit: %v", err)
+		}
+		alerts = append(alerts, alertExpr{metric: "rss", op: ">", threshold: float64(n)})
+	}
+	if *goroutinesLimit < 0 {
+		return fmt.Errorf("invalid -goroutines-limit %d", *goroutinesLimit)
+	}
+	if *goroutinesLimit > 0 {
+		alerts = append(alerts, alertExpr{metric: "goroutines", op: ">", threshold: float64(*goroutinesLimit)})
+	}
+	if len(alerts) == 0 && *gcStall <= 0 {
+		return errors.New("missing -alert expression, limit or -gc-stall")
+	}
+	if *interval <= 0 {
+		return errors.New("interval must be positive")
+	}
+	if *hookTimeout <= 0 {
+		return fmt.Errorf("invalid -hook-timeout %v", *hookTimeout)
+	}
+	trigger := &alertTrigger{hook: *hook, hookTimeout: *hookTimeout, dir: *snapshotDir}
+	if trigger.hook != "" && trigger.dir == "" {
+		trigger.dir = "."
+	}
+	if trigger.dir != "" {
+		if err := os.MkdirAll(trigger.dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	var metrics []string
+	for _, a := range alerts {
+		metrics = append(metrics, a.metric)
+	}
+	if *gcStall > 0 {
+		metrics = append(metrics, "gc")
+	}
+	// An agent that hangs must not stall the sampling, and the alerts
+	// with it, for good.
+	cmdTimeout = 10 * time.Second
+	s := newSampler(metrics)
+	stalls := make(map[int]*gcStallState)
+	for _, ps := range s.sample() {
+		if *gcStall > 0 {
+			stalls[ps.pid] = newGCStallState(ps.metrics)
+		}
+	}
+
+	type alertKey struct {
+		pid  int
+		expr string
+	}
+	active := make(map[alertKey]bool)
+	for {
+		time.Sleep(*interval)
+		now := time.Now().Format("15:04:05")
+		for _, ps := range s.sample() {
+			if *gcStall > 0 {
+				st, ok := stalls[ps.pid]
+				if !ok {
+					stalls[ps.pid] = newGCStallState(ps.metrics)
+					continue
+				}
+				switch stalled, event := st.update(ps.metrics, *gcStall, time.Now()); event {
+				case "stalled":
+					line := fmt.Sprintf("ALERT %s %s (PID %d): no GC for %v while the heap grew by %s",
+						now, ps.exec, ps.pid, stalled.Round(time.Second), formatBytes(st.growth))
+					fmt.Println(alertLine(line))
+					trigger.fire(ps, line)
+					if *exitOnAlert {
+						exit(exitFailure)
+					}
+				case "cleared":
+					fmt.Printf("cleared %s %s (PID %d): GC ran after %v\n",
+						now, ps.exec, ps.pid, stalled.Round(time.Second))
+				}
+			}
+			for _, a := range alerts {
+				v, ok := ps.metrics[a.metric]
+				if !ok {
+					continue
+				}
+				key := alertKey{ps.pid, a.String()}
+				switch crossed := a.eval(v); {
+				case crossed && !active[key]:
+					active[key] = true
+					line := fmt.Sprintf("ALERT %s %s (PID %d): %s %s, alert %s",
+						now, ps.exec, ps.pid, a.metric, formatMetric(a.metric, v), a)
+					fmt.Println(alertLine(line))
+					trigger.fire(ps, line)
+					if *exitOnAlert {
+						exit(exitFailure)
+					}
+				case !crossed && active[key]:
+					delete(active, key)
+					fmt.Printf("cleared %s %s (PID %d): %s %s, alert %s\n",
+						now, ps.exec, ps.pid, a.metric, formatMetric(a.metric, v), a)
+				}
+			}
+		}
+	}
+}
+
+// gcStallState follows the GCs of a process to tell when the GC stalls: no GC
+// ran for a while although the heap kept growing.
+type gcStallState struct {
+	lastGC   float64 // seconds since the epoch, 0 when unknown
+	baseHeap float64 // the heap at the first sample after lastGC
+	growth   uint64  // of the heap since baseHeap
+	alerted  bool
+}
+
+func newGCStallState(metrics map[string]float64) *gcStallState {
+	return &gcStallState{lastGC: metrics["last-gc"], baseHeap: metrics["heap-alloc"]}
+}
+
+// update updates the state with a sample taken at now and returns "stalled"
+// when the GC just stalled for longer than limit, "cleared" when a GC ran
+// after a stall, or "", along with how long the GC stalled.
+func (st *gcStallState) update(metrics map[string]float64, limit time.Duration, now time.Time) (time.Duration, string) {
+	lastGC, ok := metrics["last-gc"]
+	if !ok {
+		return 0, ""
+	}
+	heap := metrics["heap-alloc"]
+	if lastGC != st.lastGC {
+		stalled := time.Duration((lastGC - st.lastGC) * 1e9)
+		wasAlerted := st.alerted
+		*st = gcStallState{lastGC: lastGC, baseHeap: heap}
+		if wasAlerted {
+			return stalled, "cleared"
+		}
+		return 0, ""
+	}
+	stalled := now.Sub(time.Unix(0, int64(lastGC*1e9)))
+	st.growth = 0
+	if heap > st.baseHeap {
+		st.growth = uint64(heap - st.baseHeap)
+	}
+	if st.alerted || stalled <= limit || st.growth == 0 {
+		return stalled, ""
+	}
+	st.alerted = true
+	return stalled, "stalled"
+}
+
+// formatBytes formats n bytes as the agent does, e.g. "11.84MB".
+func formatBytes(n uint64) string {
+	const units = "KMGTPE"
+	if n < 1024 {
+		return fmt.Sprintf("%dB", n)
+	}
+	v, i := float64(n)/1024, 0
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.2f%cB", v, units[i])
+}
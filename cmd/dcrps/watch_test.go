@@ -0,0 +1,69 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestGCStall(t *testing.T) {
+	start := time.Unix(1000, 0)
+	st := newGCStallState(map[string]float64{"last-gc": 1000, "heap-alloc": 100})
+	sample := func(lastGC, heap float64, after time.Duration) string {
+		_, event := st.update(map[string]float64{"last-gc": lastGC, "heap-alloc": heap}, time.Minute, start.Add(after))
+		return event
+	}
+	steps := []struct {
+		lastGC, heap float64
+		after        time.Duration
+		want         string
+	}{
+		{1000, 200, 30 * time.Second, ""}, // growing, not for long
+		{1000, 100, 90 * time.Second, ""}, // long, not growing
+		{1000, 300, 100 * time.Second, "stalled"},
+		{1000, 400, 110 * time.Second, ""}, // reported once
+		{1105, 50, 115 * time.Second, "cleared"},
+		{1105, 500, 120 * time.Second, ""},
+	}
+	for i, s := range steps {
+		if got := sample(s.lastGC, s.heap, s.after); got != s.want {
+			t.Errorf("step %d: got %q want %q", i, got, s.want)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, want := range map[uint64]string{512: "512B", 1536: "1.50KB", 12419640: "11.84MB"} {
+		if got := formatBytes(n); got != want {
+			t.Errorf("formatBytes(%d): got=%v want=%v", n, got, want)
+		}
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	for s, want := range map[string]uint64{
+		"1024": 1024, "2GB": 2 << 30, "512m": 512 << 20, "1.5K": 1536, "3 GiB": 3 << 30, "0": 0,
+	} {
+		got, err := parseByteSize(s)
+		if err != nil || got != want {
+			t.Errorf("parseByteSize(%q): got=%v, %v want=%v", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "GB", "-1G", "2XB"} {
+		if _, err := parseByteSize(s); err == nil {
+			t.Errorf("parseByteSize(%q): no error", s)
+		}
+	}
+}
+
+func TestAlertTriggerHookTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no sleep command")
+	}
+	trigger := &alertTrigger{hook: "sleep 30", hookTimeout: 100 * time.Millisecond}
+	start := time.Now()
+	trigger.fire(procSample{pid: 1, exec: "dcrd"}, "ALERT")
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("the hook ran for %v", elapsed)
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package flame renders pprof profiles as interactive SVG flame graphs, with
+// no dependency on the pprof tool or Graphviz.
+package flame
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sort"
+	"time"
+)
+
+// Node is a frame of a flame graph, with the total value of the samples
+// whose stacks run through it.
+type Node struct {
+	Name     string
+	Value    int64
+	Children []*Node
+
+	index map[string]*Node
+}
+
+func (n *Node) child(name string) *Node {
+	if c, ok := n.index[name]; ok {
+		return c
+	}
+	if n.index == nil {
+		n.index = make(map[string]*Node)
+	}
+	c := &Node{Name: name}
+	n.index[name] = c
+	n.Children = append(n.Children, c)
+	return c
+}
+
+// Depth returns the number of levels of the graph under and including n.
+func (n *Node) Depth() int {
+	var max int
+	for _, c := range n.Children {
+		if d := c.Depth(); d > max {
+			max = d
+		}
+	}
+	return max + 1
+}
+
+// Tree merges the stacks of the samples of p into the frames of a flame
+// graph, weighted by their values of the sample type of index typ, under a
+// root named "root". The children of each frame are sorted by name.
+func Tree(p *Profile, typ int) *Node {
+	root := &Node{Name: "root"}
+	p.Stacks(typ, func(stack []string, value int64) {
+		n := root
+		n.Value += value
+		for _, name := range stack {
+			n = n.child(name)
+			n.Value += value
+		}
+	})
+	var sortChildren func(n *Node)
+	sortChildren = func(n *Node) {
+		sort.Slice(n.Children, func(i, j int) bool { return n.Children[i].Name < n.Children[j].Name })
+		for _, c := range n.Children {
+			sortChildren(c)
+		}
+	}
+	sortChildren(root)
+	return root
+}
+
+// The dimensions of the SVG, in pixels.
+const (
+	width       = 1200
+	frameHeight = 18
+	margin      = 10
+	titleHeight = 40
+	charWidth   = 7   // of the 12px monospace font
+	minWidth    = 0.1 // narrower frames are left out
+)
+
+// FormatValue formats v, a value of unit, such as "1.5s" for nanoseconds.
+func FormatValue(v int64, unit string) string {
+	switch unit {
+	case "nanoseconds":
+		return time.Duration(v).String()
+	case "bytes":
+		const units = "KMGTPE"
+		if v < 1024 {
+			return fmt.Sprintf("%dB", v)
+		}
+		f, i := float64(v)/1024, 0
+		for f >= 1024 && i < len(units)-1 {
+			f /= 1024
+			i++
+		}
+		return fmt.Sprintf("%.2f%cB", f, units[i])
+	}
+	if unit == "" || unit == "count" {
+		return fmt.Sprint(v)
+	}
+	return fmt.Sprintf("%d %s", v, unit)
+}
+
+// color returns the color of the frame named name, a warm hue that stays the
+// same across graphs.
+func color(name string) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	v := h.Sum32()
+	return fmt.Sprintf("rgb(%d,%d,%d)", 205+v%50, 80+(v>>8)%120, (v>>16)%55)
+}
+
+func escape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// WriteSVG writes the flame graph of root to w as an SVG titled title, its
+// values in unit. Clicking a frame zooms on it, clicking the root zooms back
+// out, and hovering a frame shows its value.
+func WriteSVG(w io.Writer, root *Node, title, unit string) error {
+	depth := root.Depth()
+	height := titleHeight + depth*frameHeight + 2*margin
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<?xml version="1.0" standalone="no"?>
+<svg version="1.1" width="%d" height="%d" viewBox="0 0 %d %d" xmlns="http://www.w3.org/2000/svg" onload="init(evt)">
+<style>
+text { font-family: monospace; font-size: 12px; pointer-events: none; }
+g.frame { cursor: pointer; }
+g.frame:hover rect { stroke: black; stroke-width: 0.5; }
+</style>
+<script type="text/ecmascript"><![CDATA[%s]]></script>
+<rect width="100%%" height="100%%" fill="rgb(250,250,245)"/>
+<text x="%d" y="24" style="font-size: 16px">%s</text>
+`, width, height, width, height, zoomScript, margin, escape(title))
+
+	total := root.Value
+	scale := float64(width-2*margin) / float64(total)
+	if total == 0 {
+		scale = 0
+	}
+	var draw func(n *Node, x float64, level int)
+	draw = func(n *Node, x float64, level int) {
+		w := float64(n.Value) * scale
+		if w < minWidth {
+			return
+		}
+		y := titleHeight + level*frameHeight
+		percent := 100 * float64(n.Value) / float64(total)
+		fmt.Fprintf(&b, `<g class="frame" data-name="%s" onclick="zoom(this)">`, escape(n.Name))
+		fmt.Fprintf(&b, "<title>%s (%s, %.2f%%)</title>", escape(n.Name), FormatValue(n.Value, unit), percent)
+		fmt.Fprintf(&b, `<rect x="%.2f" y="%d" width="%.2f" height="%d" fill="%s" rx="2"/>`,
+			float64(margin)+x, y, w, frameHeight-1, color(n.Name))
+		fmt.Fprintf(&b, `<text x="%.2f" y="%d">%s</text></g>`+"\n", float64(margin)+x+3, y+13,
+			escape(fitText(n.Name, w)))
+		for _, c := range n.Children {
+			draw(c, x, level+1)
+			x += float64(c.Value) * scale
+		}
+	}
+	if total > 0 {
+		draw(root, 0, 0)
+	}
+	b.WriteString("</svg>\n")
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// fitText returns name cut to fit a frame of width w, with ".." when cut,
+// or "" when not even a few characters fit.
+func fitText(name string, w float64) string {
+	n := int((w - 6) / charWidth)
+	if n >= len(name) {
+		return name
+	}
+	if n < 3 {
+		return ""
+	}
+	return name[:n-2] + ".."
+}
+
+// zoomScript zooms the graph on the frame clicked: it stretches the frame and
+// its descendants to the width of the graph, widens its ancestors and hides
+// the others. The frames keep their original geometry in data attributes.
+const zoomScript = `
+var frames, left, right;
+function init(evt) {
+	frames = document.getElementsByClassName("frame");
+	if (frames.length == 0) return;
+	for (var i = 0; i < frames.length; i++) {
+		var r = frames[i].getElementsByTagName("rect")[0];
+		frames[i].setAttribute("data-x", r.getAttribute("x"));
+		frames[i].setAttribute("data-w", r.getAttribute("width"));
+		frames[i].setAttribute("data-y", r.getAttribute("y"));
+	}
+	// The root spans the graph.
+	left = parseFloat(frames[0].getAttribute("data-x"));
+	right = left + parseFloat(frames[0].getAttribute("data-w"));
+}
+function fit(name, w) {
+	var n = Math.floor((w - 6) / 7);
+	if (n >= name.length) return name;
+	if (n < 3) return "";
+	return name.substring(0, n - 2) + "..";
+}
+function zoom(g) {
+	var x = parseFloat(g.getAttribute("data-x")), w = parseFloat(g.getAttribute("data-w"));
+	var y = parseFloat(g.getAttribute("data-y"));
+	var scale = (right - left) / w;
+	for (var i = 0; i < frames.length; i++) {
+		var f = frames[i], r = f.getElementsByTagName("rect")[0], t = f.getElementsByTagName("text")[0];
+		var fx = parseFloat(f.getAttribute("data-x")), fw = parseFloat(f.getAttribute("data-w"));
+		var fy = parseFloat(f.getAttribute("data-y"));
+		var nx, nw;
+		if (fy >= y && fx >= x - 0.01 && fx + fw <= x + w + 0.01) {
+			nx = left + (fx - x) * scale; nw = fw * scale;
+		} else if (fy < y && fx <= x + 0.01 && fx + fw >= x + w - 0.01) {
+			nx = left; nw = right - left;
+		} else {
+			f.style.display = "none";
+			continue;
+		}
+		f.style.display = "";
+		r.setAttribute("x", nx); r.setAttribute("width", nw);
+		t.setAttribute("x", nx + 3);
+		t.textContent = fit(f.getAttribute("data-name"), nw);
+	}
+}
+`
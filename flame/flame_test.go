@@ -0,0 +1,135 @@
+package flame
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"testing"
+)
+
+var sink [][]byte
+
+func allocate() {
+	for i := 0; i < 100; i++ {
+		sink = append(sink, make([]byte, 4096))
+	}
+}
+
+func TestHeapProfile(t *testing.T) {
+	defer func(rate int) { runtime.MemProfileRate = rate }(runtime.MemProfileRate)
+	runtime.MemProfileRate = 1
+	allocate()
+	runtime.GC()
+	var b bytes.Buffer
+	if err := pprof.Lookup("heap").WriteTo(&b, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := Parse(b.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	typ := -1
+	for i, st := range p.SampleTypes {
+		if st == [2]string{"alloc_space", "bytes"} {
+			typ = i
+		}
+	}
+	if typ < 0 {
+		t.Fatalf("no alloc_space sample type in %v", p.SampleTypes)
+	}
+	root := Tree(p, typ)
+	if root.Value < 100*4096 {
+		t.Errorf("root value: got=%d want>=%d", root.Value, 100*4096)
+	}
+	var found bool
+	var walk func(n *Node, parent int64)
+	walk = func(n *Node, parent int64) {
+		if n.Value > parent {
+			t.Errorf("frame %s: value %d above its parent's %d", n.Name, n.Value, parent)
+		}
+		if strings.HasSuffix(n.Name, "flame.allocate") {
+			found = true
+		}
+		for _, c := range n.Children {
+			walk(c, n.Value)
+		}
+	}
+	walk(root, root.Value)
+	if !found {
+		t.Error("no flame.allocate frame")
+	}
+
+	var svg bytes.Buffer
+	if err := WriteSVG(&svg, root, "heap <test>", "bytes"); err != nil {
+		t.Fatal(err)
+	}
+	d := xml.NewDecoder(&svg)
+	for {
+		if _, err := d.Token(); err != nil {
+			if err != io.EOF {
+				t.Fatalf("invalid SVG: %v", err)
+			}
+			break
+		}
+	}
+}
+
+func TestTree(t *testing.T) {
+	p := &Profile{
+		SampleTypes: [][2]string{{"cpu", "nanoseconds"}},
+		samples: []sample{
+			{locations: []uint64{2, 1}, values: []int64{10}},
+			{locations: []uint64{3, 1}, values: []int64{5}},
+			// An inlined call: the location holds both functions,
+			// the innermost first.
+			{locations: []uint64{4}, values: []int64{1}},
+			{locations: []uint64{2}, values: []int64{0}},
+		},
+		functions: map[uint64]string{1: "main", 2: "b", 3: "a", 4: "inlined", 5: "caller"},
+		locations: map[uint64][]uint64{1: {1}, 2: {2}, 3: {3}, 4: {4, 5}},
+	}
+	root := Tree(p, 0)
+	var lines []string
+	var walk func(n *Node, indent string)
+	walk = func(n *Node, indent string) {
+		lines = append(lines, indent+n.Name+" "+FormatValue(n.Value, "nanoseconds"))
+		for _, c := range n.Children {
+			walk(c, indent+"  ")
+		}
+	}
+	walk(root, "")
+	got := strings.Join(lines, "\n")
+	want := `root 16ns
+  caller 1ns
+    inlined 1ns
+  main 15ns
+    a 5ns
+    b 10ns`
+	if got != want {
+		t.Errorf("Tree:\n%s\nwant:\n%s", got, want)
+	}
+	if d := root.Depth(); d != 3 {
+		t.Errorf("Depth: got=%d want=3", d)
+	}
+}
+
+func TestFitText(t *testing.T) {
+	tests := []struct {
+		name string
+		w    float64
+		want string
+	}{
+		{"main.main", 200, "main.main"},
+		{"runtime.mallocgc", 76, "runtime..."},
+		{"main.main", 20, ""},
+	}
+	for _, test := range tests {
+		if got := fitText(test.name, test.w); got != test.want {
+			t.Errorf("fitText(%q, %v): got=%q want=%q", test.name, test.w, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package flame
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// The wire types of the protocol buffers encoding.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// buffer reads the fields of a protocol buffers message.
+type buffer struct {
+	data []byte
+}
+
+func (b *buffer) varint() (uint64, error) {
+	v, n := binary.Uvarint(b.data)
+	if n <= 0 {
+		return 0, errors.New("invalid varint")
+	}
+	b.data = b.data[n:]
+	return v, nil
+}
+
+// field reads the next field, returning its number and wire type, and its
+// value: the varint for wireVarint, else the bytes of the field.
+func (b *buffer) field() (num int, wire int, v uint64, data []byte, err error) {
+	key, err := b.varint()
+	if err != nil {
+		return 0, 0, 0, nil, err
+	}
+	num, wire = int(key>>3), int(key&7)
+	switch wire {
+	case wireVarint:
+		v, err = b.varint()
+	case wireFixed64, wireFixed32:
+		n := 8
+		if wire == wireFixed32 {
+			n = 4
+		}
+		if len(b.data) < n {
+			return 0, 0, 0, nil, errors.New("truncated field")
+		}
+		data, b.data = b.data[:n], b.data[n:]
+	case wireBytes:
+		var n uint64
+		n, err = b.varint()
+		if err == nil && n > uint64(len(b.data)) {
+			err = errors.New("truncated field")
+		}
+		if err == nil {
+			data, b.data = b.data[:n], b.data[n:]
+		}
+	default:
+		err = fmt.Errorf("unsupported wire type %d", wire)
+	}
+	return num, wire, v, data, err
+}
+
+// varints appends the value of a repeated varint field, packed or not, to
+// vs.
+func varints(vs []uint64, wire int, v uint64, data []byte) ([]uint64, error) {
+	if wire == wireVarint {
+		return append(vs, v), nil
+	}
+	b := &buffer{data}
+	for len(b.data) > 0 {
+		v, err := b.varint()
+		if err != nil {
+			return nil, err
+		}
+		vs = append(vs, v)
+	}
+	return vs, nil
+}
+
+// sample is a sample of a profile: its stack as the IDs of its locations,
+// leaf first, and its values, one per sample type.
+type sample struct {
+	locations []uint64
+	values    []int64
+}
+
+// Profile is the part of a pprof profile that a flame graph draws.
+type Profile struct {
+	// SampleTypes are the types and units of the values of the samples,
+	// such as "cpu" and "nanoseconds".
+	SampleTypes [][2]string
+	// DefaultSampleType is the index in SampleTypes of the value to draw.
+	DefaultSampleType int
+
+	samples   []sample
+	functions map[uint64]string   // names by ID
+	locations map[uint64][]uint64 // function IDs by ID, innermost first
+}
+
+// Parse parses a profile in the pprof format, gzipped or not.
+func Parse(data []byte) (*Profile, error) {
+	if len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		data, err = ioutil.ReadAll(zr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip: %v", err)
+		}
+	}
+	p := &Profile{
+		functions: make(map[uint64]string),
+		locations: make(map[uint64][]uint64),
+	}
+	var (
+		strs         []string
+		types        [][2]uint64
+		funcNames    = make(map[uint64]uint64)
+		defaultIndex uint64
+	)
+	b := &buffer{data}
+	for len(b.data) > 0 {
+		num, wire, v, data, err := b.field()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case num == 1 && wire == wireBytes: // sample_type
+			t, err := parseValueType(data)
+			if err != nil {
+				return nil, err
+			}
+			types = append(types, t)
+		case num == 2 && wire == wireBytes: // sample
+			s, err := parseSample(data)
+			if err != nil {
+				return nil, err
+			}
+			p.samples = append(p.samples, s)
+		case num == 4 && wire == wireBytes: // location
+			id, funcs, err := parseLocation(data)
+			if err != nil {
+				return nil, err
+			}
+			p.locations[id] = funcs
+		case num == 5 && wire == wireBytes: // function
+			id, name, err := parseFunction(data)
+			if err != nil {
+				return nil, err
+			}
+			funcNames[id] = name
+		case num == 6 && wire == wireBytes: // string_table
+			strs = append(strs, string(data))
+		case num == 14 && wire == wireVarint: // default_sample_type
+			defaultIndex = v
+		}
+	}
+	str := func(i uint64) string {
+		if i < uint64(len(strs)) {
+			return strs[i]
+		}
+		return ""
+	}
+	for id, name := range funcNames {
+		p.functions[id] = str(name)
+	}
+	p.DefaultSampleType = len(types) - 1
+	for i, t := range types {
+		p.SampleTypes = append(p.SampleTypes, [2]string{str(t[0]), str(t[1])})
+		if defaultIndex != 0 && t[0] == defaultIndex {
+			p.DefaultSampleType = i
+		}
+	}
+	if len(types) == 0 {
+		return nil, errors.New("no sample type")
+	}
+	return p, nil
+}
+
+func parseValueType(data []byte) ([2]uint64, error) {
+	var t [2]uint64
+	b := &buffer{data}
+	for len(b.data) > 0 {
+		num, wire, v, _, err := b.field()
+		if err != nil {
+			return t, err
+		}
+		if wire == wireVarint && (num == 1 || num == 2) {
+			t[num-1] = v
+		}
+	}
+	return t, nil
+}
+
+func parseSample(data []byte) (sample, error) {
+	var s sample
+	var values []uint64
+	b := &buffer{data}
+	for len(b.data) > 0 {
+		num, wire, v, data, err := b.field()
+		if err != nil {
+			return s, err
+		}
+		switch num {
+		case 1:
+			s.locations, err = varints(s.locations, wire, v, data)
+		case 2:
+			values, err = varints(values, wire, v, data)
+		}
+		if err != nil {
+			return s, err
+		}
+	}
+	for _, v := range values {
+		s.values = append(s.values, int64(v))
+	}
+	return s, nil
+}
+
+func parseLocation(data []byte) (id uint64, funcs []uint64, err error) {
+	b := &buffer{data}
+	for len(b.data) > 0 {
+		num, wire, v, data, err := b.field()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch {
+		case num == 1 && wire == wireVarint:
+			id = v
+		case num == 4 && wire == wireBytes: // line
+			lb := &buffer{data}
+			for len(lb.data) > 0 {
+				num, wire, v, _, err := lb.field()
+				if err != nil {
+					return 0, nil, err
+				}
+				if num == 1 && wire == wireVarint {
+					funcs = append(funcs, v)
+				}
+			}
+		}
+	}
+	return id, funcs, nil
+}
+
+func parseFunction(data []byte) (id, name uint64, err error) {
+	b := &buffer{data}
+	for len(b.data) > 0 {
+		num, wire, v, _, err := b.field()
+		if err != nil {
+			return 0, 0, err
+		}
+		if wire != wireVarint {
+			continue
+		}
+		switch num {
+		case 1:
+			id = v
+		case 2:
+			name = v
+		}
+	}
+	return id, name, nil
+}
+
+// Stacks calls fn with the stack of each sample, root first, and its value
+// of the sample type of index typ.
+func (p *Profile) Stacks(typ int, fn func(stack []string, value int64)) {
+	var stack []string
+	for _, s := range p.samples {
+		if typ >= len(s.values) || s.values[typ] == 0 {
+			continue
+		}
+		stack = stack[:0]
+		for i := len(s.locations) - 1; i >= 0; i-- {
+			funcs := p.locations[s.locations[i]]
+			for j := len(funcs) - 1; j >= 0; j-- {
+				stack = append(stack, p.functions[funcs[j]])
+			}
+		}
+		fn(stack, s.values[typ])
+	}
+}
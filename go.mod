@@ -8,4 +8,5 @@ require (
 	github.com/stretchr/testify v1.3.0 // indirect
 	github.com/xlab/treeprint v0.0.0-20181112141820-a009c3971eca
 	golang.org/x/sys v0.0.0-20190312061237-fead79001313 // indirect
+	rsc.io/goversion v1.0.0
 )
@@ -25,14 +25,16 @@ func ConfigDir() (string, error) {
 	if runtime.GOOS == "windows" {
 		return filepath.Join(os.Getenv("APPDATA"), "gops"), nil
 	}
-	homeDir := guessUnixHomeDir()
+	homeDir := HomeDir()
 	if homeDir == "" {
 		return "", errors.New("unable to get current user home directory: os/user lookup failed; $HOME is empty")
 	}
 	return filepath.Join(homeDir, ".config", "gops"), nil
 }
 
-func guessUnixHomeDir() string {
+// HomeDir returns the home directory of the current user, or the empty
+// string when it can't be found.
+func HomeDir() string {
 	usr, err := user.Current()
 	if err == nil {
 		return usr.HomeDir
@@ -0,0 +1,209 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dcrps
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	dcrsignal "github.com/dcrlabs/dcrps/signal"
+	"github.com/google/gops/signal"
+)
+
+// Client sends requests to the agents. The zero value waits for them as long
+// as they take and never sends a request again.
+type Client struct {
+	// Timeout is how long each round trip to an agent may take, from the
+	// connection to the end of the response. Zero means no limit.
+	Timeout time.Duration
+
+	// DialTimeout is how long connecting to an agent may take when Dial
+	// is nil. Zero means the limit of the OS.
+	DialTimeout time.Duration
+
+	// Retries is how many times the requests of the read-only signals are
+	// sent again when the connection is reset while reading the response,
+	// as happens to busy agents. The others, such as GC, are never sent
+	// twice.
+	Retries int
+
+	// Dial, when set, connects to the agent at addr instead of TCP, as
+	// through a tunnel or over TLS.
+	Dial func(addr net.TCPAddr) (net.Conn, error)
+
+	// OnRetry, when set, is called with the error of each request before
+	// it is sent again.
+	OnRetry func(err error)
+}
+
+// DialError is the error of a connection to an agent that failed, as when
+// the target runs no agent or its host is unreachable. It isn't a net.Error,
+// so that a timeout isn't taken for the agent not answering.
+type DialError struct {
+	Addr    net.TCPAddr
+	Err     error
+	Timeout time.Duration // when the connection timed out
+}
+
+func (e *DialError) Error() string {
+	if e.Timeout > 0 {
+		return fmt.Sprintf("couldn't connect to the agent at %v within %v, "+
+			"the host may be down or firewalled", &e.Addr, e.Timeout)
+	}
+	return e.Err.Error()
+}
+
+// TimeoutError is the error of a request that the agent didn't answer
+// within the Timeout of the client.
+type TimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("the agent didn't answer within %v", e.Timeout)
+}
+
+// readOnlySignals are the signals that leave the process as it was, so their
+// requests may be sent again.
+var readOnlySignals = map[byte]bool{
+	signal.StackTrace:      true,
+	signal.MemStats:        true,
+	signal.Version:         true,
+	signal.HeapProfile:     true,
+	signal.CPUProfile:      true,
+	signal.Stats:           true,
+	signal.BinaryDump:      true,
+	signal.Trace:           true,
+	dcrsignal.Capabilities: true,
+	dcrsignal.Info:         true,
+	dcrsignal.MemStatsJSON: true,
+	dcrsignal.MutexProfile: true,
+	dcrsignal.BlockProfile: true,
+	dcrsignal.AppStats:     true,
+}
+
+// Request sends the signal sig, one of github.com/google/gops/signal or
+// github.com/dcrlabs/dcrps/signal, with its params to the agent at addr and
+// returns the response. It is empty when the agent doesn't know sig.
+func (c *Client) Request(addr net.TCPAddr, sig byte, params ...byte) ([]byte, error) {
+	out, err := c.requestOnce(addr, sig, params...)
+	for i := 0; i < c.Retries && readOnlySignals[sig] && isConnReset(err); i++ {
+		if c.OnRetry != nil {
+			c.OnRetry(err)
+		}
+		out, err = c.requestOnce(addr, sig, params...)
+	}
+	return out, err
+}
+
+// isConnReset reports whether err is a connection reset or a response cut
+// short.
+func isConnReset(err error) bool {
+	if err == io.ErrUnexpectedEOF {
+		return true
+	}
+	if oe, ok := err.(*net.OpError); ok {
+		err = oe.Err
+	}
+	if se, ok := err.(*os.SyscallError); ok {
+		err = se.Err
+	}
+	return err == syscall.ECONNRESET
+}
+
+// dial connects to the agent at addr, with Dial when set.
+func (c *Client) dial(addr net.TCPAddr) (net.Conn, error) {
+	if c.Dial != nil {
+		return c.Dial(addr)
+	}
+	conn, err := net.DialTimeout("tcp", addr.String(), c.DialTimeout)
+	if err != nil {
+		de := &DialError{Addr: addr, Err: err}
+		if err, ok := err.(net.Error); ok && err.Timeout() {
+			de.Timeout = c.DialTimeout
+		}
+		return nil, de
+	}
+	return conn, nil
+}
+
+func (c *Client) requestOnce(addr net.TCPAddr, sig byte, params ...byte) ([]byte, error) {
+	conn, err := c.dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if c.Timeout > 0 {
+		if err := conn.SetDeadline(time.Now().Add(c.Timeout)); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := conn.Write(append([]byte{sig}, params...)); err != nil {
+		return nil, c.timeoutError(err)
+	}
+	out, err := ioutil.ReadAll(conn)
+	if err != nil {
+		return nil, c.timeoutError(err)
+	}
+	return out, nil
+}
+
+// timeoutError returns a *TimeoutError for err when the deadline of the
+// request expired, else err.
+func (c *Client) timeoutError(err error) error {
+	if ne, ok := err.(net.Error); ok && ne.Timeout() && c.Timeout > 0 {
+		return &TimeoutError{Timeout: c.Timeout}
+	}
+	return err
+}
+
+// withTimeout returns c with a Timeout of at least d, for the captures that
+// take a window on the agent side.
+func (c *Client) withTimeout(d time.Duration) *Client {
+	if c.Timeout == 0 || c.Timeout >= d {
+		return c
+	}
+	cc := *c
+	cc.Timeout = d
+	return &cc
+}
+
+// Capabilities returns the capabilities the agent at addr reports, such as
+// the commands it serves and github.com/dcrlabs/dcrps/signal.TraceDuration.
+// The stock agent reports none.
+func (c *Client) Capabilities(addr net.TCPAddr) ([]string, error) {
+	out, err := c.Request(addr, dcrsignal.Capabilities)
+	if err != nil {
+		return nil, err
+	}
+	var caps []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			caps = append(caps, line)
+		}
+	}
+	return caps, nil
+}
+
+// Capable reports whether the agent at addr reports capability.
+func (c *Client) Capable(addr net.TCPAddr, capability string) (bool, error) {
+	caps, err := c.Capabilities(addr)
+	if err != nil {
+		return false, err
+	}
+	for _, v := range caps {
+		if v == capability {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,95 @@
+package dcrps
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gops/signal"
+)
+
+// resetServer serves an agent that resets as many connections as resets
+// midway through the response and answers "ok" on the next ones. It returns
+// its address and the count of the requests it got.
+func resetServer(t *testing.T, resets int) (*net.TCPAddr, *int) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var requests int
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Read(make([]byte, 1))
+			requests++
+			if requests <= resets {
+				conn.Write([]byte("o"))
+				conn.(*net.TCPConn).SetLinger(0)
+			} else {
+				conn.Write([]byte("ok"))
+			}
+			conn.Close()
+		}
+	}()
+	return l.Addr().(*net.TCPAddr), &requests
+}
+
+func TestRequestRetry(t *testing.T) {
+	var retried int
+	c := &Client{Retries: 2, OnRetry: func(error) { retried++ }}
+
+	addr, requests := resetServer(t, 2)
+	out, err := c.Request(*addr, signal.Stats)
+	if err != nil || string(out) != "ok" {
+		t.Errorf("stats: got %q, %v; want ok after 2 retries", out, err)
+	}
+	if *requests != 3 || retried != 2 {
+		t.Errorf("stats: got %d requests and %d retries, want 3 and 2", *requests, retried)
+	}
+
+	addr, requests = resetServer(t, 1)
+	if _, err := c.Request(*addr, signal.GC); err == nil {
+		t.Errorf("gc: got no error from the reset connection")
+	}
+	if *requests != 1 {
+		t.Errorf("gc: got %d requests, want 1: gc must never be retried", *requests)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		time.Sleep(time.Second)
+	}()
+
+	c := &Client{Timeout: 50 * time.Millisecond}
+	_, err = c.Request(*l.Addr().(*net.TCPAddr), signal.Version)
+	if err, ok := err.(*TimeoutError); !ok || err.Timeout != c.Timeout {
+		t.Errorf("got %v, want a *TimeoutError after %v", err, c.Timeout)
+	}
+}
+
+func TestParseStats(t *testing.T) {
+	s, err := ParseStats([]byte("goroutines: 12\nOS threads: 9\nGOMAXPROCS: 4\nnum CPU: 8\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Stats{Goroutines: 12, OSThreads: 9, GOMAXPROCS: 4, NumCPU: 8}); *s != want {
+		t.Errorf("got %+v, want %+v", *s, want)
+	}
+	if _, err := ParseStats([]byte("not stats")); err == nil {
+		t.Error("invalid stats: got no error")
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package dcrps lists the Decred Go processes and queries their gops agents,
+// for the tools that embed what the dcrps command does, such as Decrediton,
+// rather than run it and scrape its output.
+//
+//	for _, p := range dcrps.ListProcesses(dcrps.Filter{}) {
+//		addr, err := dcrps.ResolveTarget(strconv.Itoa(p.PID))
+//		if err != nil {
+//			continue
+//		}
+//		c := &dcrps.Client{Timeout: 10 * time.Second}
+//		if stats, err := c.Stats(*addr); err == nil {
+//			fmt.Println(p.Exec, stats.Goroutines)
+//		}
+//	}
+//
+// The agents are either the stock one of github.com/google/gops/agent or the
+// one of github.com/dcrlabs/dcrps/agent, which serves more.
+package dcrps
+
+import (
+	"net"
+	"regexp"
+	"sort"
+
+	"github.com/dcrlabs/dcrps/resolve"
+	"github.com/google/gops/goprocess"
+)
+
+// Process is a running Go process.
+type Process = goprocess.P
+
+// Filter selects processes by their executable name. The zero value selects
+// the Decred processes, whose name starts with resolve.DefaultPrefix.
+type Filter struct {
+	// Prefixes are the prefixes of the names selected.
+	Prefixes []string
+
+	// Pattern also selects the names it matches, whatever their prefix.
+	// Without Prefixes, only those are selected.
+	Pattern *regexp.Regexp
+
+	// All selects all the Go processes, whatever Prefixes and Pattern.
+	All bool
+
+	// NormalizeExec makes the names match regardless of version suffixes,
+	// see resolve.NormalizeExec.
+	NormalizeExec bool
+}
+
+// Resolver returns the resolver of the targets among the processes f
+// selects, which a *resolve.Resolver allows to configure further.
+func (f Filter) Resolver() *resolve.Resolver {
+	r := &resolve.Resolver{
+		Prefixes:      f.Prefixes,
+		Pattern:       f.Pattern,
+		NormalizeExec: f.NormalizeExec,
+	}
+	switch {
+	case f.All:
+		r.Prefixes, r.Pattern = nil, nil
+	case len(f.Prefixes) == 0 && f.Pattern == nil:
+		r.Prefixes = []string{resolve.DefaultPrefix}
+	}
+	return r
+}
+
+// ListProcesses returns the running Go processes f selects, sorted by PID.
+func ListProcesses(f Filter) []Process {
+	return ListMatching(f.Resolver().Match)
+}
+
+// ListMatching returns the running Go processes whose executable name match
+// reports, sorted by PID.
+func ListMatching(match func(exec string) bool) []Process {
+	var ps []Process
+	for _, p := range goprocess.FindAll() {
+		if match(p.Exec) {
+			ps = append(ps, p)
+		}
+	}
+	sort.Slice(ps, func(i, j int) bool { return ps[i].PID < ps[j].PID })
+	return ps
+}
+
+// ResolveTarget resolves target, the PID or the executable name of a Decred
+// process or the host:port of an agent, to the address of its agent. Its
+// errors are those of resolve.Resolver.Resolve, such as
+// *resolve.AmbiguousError when several processes have the name.
+func ResolveTarget(target string) (*net.TCPAddr, error) {
+	return Filter{}.Resolver().Resolve(target)
+}
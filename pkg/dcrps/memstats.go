@@ -0,0 +1,126 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dcrps
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	dcrsignal "github.com/dcrlabs/dcrps/signal"
+	"github.com/google/gops/signal"
+)
+
+// ParseKeyValues parses the "key: value" lines of the text responses of the
+// agents, such as those to the stats and memstats signals.
+func ParseKeyValues(out []byte) map[string]string {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		values[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+	}
+	return values
+}
+
+// intValue returns the integer value of key.
+func intValue(values map[string]string, key string) (int64, bool) {
+	v, err := strconv.ParseInt(values[key], 10, 64)
+	return v, err == nil
+}
+
+// bytesValue returns the byte count of a memstats value, which the agent
+// writes either as "123 bytes" or as "1.50KB (1536 bytes)".
+func bytesValue(values map[string]string, key string) (uint64, bool) {
+	v := values[key]
+	if i := strings.LastIndex(v, "("); i >= 0 {
+		v = v[i+1:]
+	}
+	v = strings.TrimSuffix(strings.TrimSuffix(v, ")"), " bytes")
+	n, err := strconv.ParseUint(v, 10, 64)
+	return n, err == nil
+}
+
+// lastGCLayout is how the stock agent writes the time of the last GC.
+const lastGCLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+// MemStatsFromText fills a runtime.MemStats from the memstats text of the
+// stock agent. The fields it doesn't write, such as BySize, are left zero.
+func MemStatsFromText(out []byte) *runtime.MemStats {
+	values := ParseKeyValues(out)
+	u := func(key string) uint64 {
+		n, _ := bytesValue(values, key)
+		return n
+	}
+	var s runtime.MemStats
+	s.Alloc = u("alloc")
+	s.TotalAlloc = u("total-alloc")
+	s.Sys = u("sys")
+	s.Lookups = u("lookups")
+	s.Mallocs = u("mallocs")
+	s.Frees = u("frees")
+	s.HeapAlloc = u("heap-alloc")
+	s.HeapSys = u("heap-sys")
+	s.HeapIdle = u("heap-idle")
+	s.HeapInuse = u("heap-in-use")
+	s.HeapReleased = u("heap-released")
+	s.HeapObjects = u("heap-objects")
+	s.StackInuse = u("stack-in-use")
+	s.StackSys = u("stack-sys")
+	s.MSpanInuse = u("stack-mspan-inuse")
+	s.MSpanSys = u("stack-mspan-sys")
+	s.MCacheInuse = u("stack-mcache-inuse")
+	s.MCacheSys = u("stack-mcache-sys")
+	s.OtherSys = u("other-sys")
+	s.GCSys = u("gc-sys")
+	s.NextGC = u("next-gc")
+	if t, err := time.Parse(lastGCLayout, values["last-gc"]); err == nil {
+		s.LastGC = uint64(t.UnixNano())
+	}
+	if d, err := time.ParseDuration(values["gc-pause-total"]); err == nil {
+		s.PauseTotalNs = uint64(d)
+	}
+	if n, ok := intValue(values, "num-gc"); ok {
+		s.NumGC = uint32(n)
+	}
+	if n, ok := intValue(values, "gc-pause"); ok {
+		s.PauseNs[(s.NumGC+255)%256] = uint64(n)
+	}
+	s.EnableGC = values["enable-gc"] == "true"
+	s.DebugGC = values["debug-gc"] == "true"
+	return &s
+}
+
+// MemStats reads the memstats of the agent at addr: the full ones from the
+// JSON of the agents of github.com/dcrlabs/dcrps/agent or else from the text
+// of the stock agent, in which case full is false.
+func (c *Client) MemStats(addr net.TCPAddr) (s *runtime.MemStats, full bool, err error) {
+	out, err := c.Request(addr, dcrsignal.MemStatsJSON)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(out) > 0 {
+		s = new(runtime.MemStats)
+		if err := json.Unmarshal(out, s); err != nil {
+			return nil, false, fmt.Errorf("invalid memstats JSON: %v", err)
+		}
+		return s, true, nil
+	}
+	out, err = c.Request(addr, signal.MemStats)
+	if err != nil {
+		return nil, false, err
+	}
+	return MemStatsFromText(out), false, nil
+}
@@ -0,0 +1,29 @@
+package dcrps
+
+import "testing"
+
+func TestMemStatsFromText(t *testing.T) {
+	out := []byte(`alloc: 11.84MB (12419640 bytes)
+heap-objects: 626
+next-gc: when heap-alloc >= 13.10MB (13735666 bytes)
+last-gc: 2019-05-14 04:12:53.79292809 +0000 UTC
+gc-pause-total: 17.570869ms
+gc-pause: 20016
+num-gc: 677
+enable-gc: true
+debug-gc: false
+`)
+	s := MemStatsFromText(out)
+	if s.Alloc != 12419640 || s.HeapObjects != 626 || s.NextGC != 13735666 {
+		t.Errorf("bytes: got Alloc=%d HeapObjects=%d NextGC=%d", s.Alloc, s.HeapObjects, s.NextGC)
+	}
+	if s.LastGC != 1557807173792928090 {
+		t.Errorf("LastGC: got %d", s.LastGC)
+	}
+	if s.PauseTotalNs != 17570869 || s.NumGC != 677 || s.PauseNs[164] != 20016 {
+		t.Errorf("GC: got PauseTotalNs=%d NumGC=%d PauseNs[164]=%d", s.PauseTotalNs, s.NumGC, s.PauseNs[164])
+	}
+	if !s.EnableGC || s.DebugGC {
+		t.Errorf("EnableGC=%v DebugGC=%v", s.EnableGC, s.DebugGC)
+	}
+}
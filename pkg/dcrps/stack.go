@@ -0,0 +1,87 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dcrps
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Frame is a function call in a goroutine stack.
+type Frame struct {
+	Func string // without the arguments
+	File string // with the line and pc offset
+}
+
+// Goroutine is one goroutine of a stack dump.
+type Goroutine struct {
+	ID     int
+	State  string // e.g. "chan receive"
+	Wait   string // how long it has been blocked, if reported
+	Frames []Frame
+	// CreatedBy is the function that started the goroutine.
+	CreatedBy string
+}
+
+var goroutineHeader = regexp.MustCompile(`^goroutine ([0-9]+) \[([^\]]*)\]:$`)
+
+// ParseStack parses a goroutine stack dump as written by the agents in
+// answer to the stack signal.
+func ParseStack(dump []byte) []Goroutine {
+	var gs []Goroutine
+	var g *Goroutine
+	var created bool
+	scanner := bufio.NewScanner(bytes.NewReader(dump))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := goroutineHeader.FindStringSubmatch(line); m != nil {
+			id, _ := strconv.Atoi(m[1])
+			gs = append(gs, Goroutine{ID: id})
+			g = &gs[len(gs)-1]
+			states := strings.Split(m[2], ", ")
+			g.State = states[0]
+			for _, s := range states[1:] {
+				if strings.HasSuffix(s, " minutes") {
+					g.Wait = s
+				}
+			}
+			created = false
+			continue
+		}
+		if g == nil || line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "\t") {
+			if !created && len(g.Frames) > 0 {
+				g.Frames[len(g.Frames)-1].File = strings.TrimSpace(line)
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "created by ") {
+			g.CreatedBy = funcName(strings.TrimPrefix(line, "created by "))
+			if i := strings.Index(g.CreatedBy, " in goroutine "); i >= 0 {
+				g.CreatedBy = g.CreatedBy[:i]
+			}
+			created = true
+			continue
+		}
+		g.Frames = append(g.Frames, Frame{Func: funcName(line)})
+	}
+	return gs
+}
+
+// funcName strips the argument list from a stack dump function line.
+func funcName(line string) string {
+	if strings.HasSuffix(line, ")") {
+		if i := strings.LastIndex(line, "("); i > 0 {
+			return line[:i]
+		}
+	}
+	return line
+}
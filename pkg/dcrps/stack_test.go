@@ -0,0 +1,59 @@
+package dcrps
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testDump = `goroutine 7 [running]:
+runtime/pprof.writeGoroutineStacks({0x7fbcc1cfa628, 0x1eb732df0010})
+	/usr/local/go/src/runtime/pprof/pprof.go:816 +0x69
+github.com/google/gops/agent.listen()
+	/root/go/pkg/mod/github.com/google/gops@v0.3.6/agent/agent.go:129 +0x165
+created by github.com/google/gops/agent.Listen in goroutine 1
+	/root/go/pkg/mod/github.com/google/gops@v0.3.6/agent/agent.go:110 +0x325
+
+goroutine 1 [chan receive, 12 minutes]:
+main.(*server).run(0xc000010000)
+	/src/server.go:42 +0x20
+main.main()
+	/src/main.go:10 +0x96
+
+goroutine 8 [select, 3 minutes, locked to thread]:
+main.(*server).run(0xc000010000)
+	/src/server.go:42 +0x20
+created by main.main
+	/src/main.go:8 +0x6a
+`
+
+func TestParseStack(t *testing.T) {
+	want := []Goroutine{{
+		ID:    7,
+		State: "running",
+		Frames: []Frame{
+			{"runtime/pprof.writeGoroutineStacks", "/usr/local/go/src/runtime/pprof/pprof.go:816 +0x69"},
+			{"github.com/google/gops/agent.listen", "/root/go/pkg/mod/github.com/google/gops@v0.3.6/agent/agent.go:129 +0x165"},
+		},
+		CreatedBy: "github.com/google/gops/agent.Listen",
+	}, {
+		ID:    1,
+		State: "chan receive",
+		Wait:  "12 minutes",
+		Frames: []Frame{
+			{"main.(*server).run", "/src/server.go:42 +0x20"},
+			{"main.main", "/src/main.go:10 +0x96"},
+		},
+	}, {
+		ID:    8,
+		State: "select",
+		Wait:  "3 minutes",
+		Frames: []Frame{
+			{"main.(*server).run", "/src/server.go:42 +0x20"},
+		},
+		CreatedBy: "main.main",
+	}}
+	got := ParseStack([]byte(testDump))
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseStack:\ngot=%+v\nwant=%+v", got, want)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dcrps
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	dcrsignal "github.com/dcrlabs/dcrps/signal"
+	"github.com/google/gops/signal"
+)
+
+// Stats are the vital runtime stats of a process.
+type Stats struct {
+	Goroutines int `json:"goroutines"`
+	OSThreads  int `json:"osThreads"`
+	GOMAXPROCS int `json:"gomaxprocs"`
+	NumCPU     int `json:"numCPU"`
+}
+
+// ParseStats parses the response to the stats signal.
+func ParseStats(out []byte) (*Stats, error) {
+	values := ParseKeyValues(out)
+	goroutines, ok := intValue(values, "goroutines")
+	if !ok {
+		return nil, fmt.Errorf("invalid stats %q", out)
+	}
+	s := &Stats{Goroutines: int(goroutines)}
+	for key, v := range map[string]*int{
+		"OS threads": &s.OSThreads,
+		"GOMAXPROCS": &s.GOMAXPROCS,
+		"num CPU":    &s.NumCPU,
+	} {
+		if n, ok := intValue(values, key); ok {
+			*v = int(n)
+		}
+	}
+	return s, nil
+}
+
+// Stats reads the runtime stats of the agent at addr.
+func (c *Client) Stats(addr net.TCPAddr) (*Stats, error) {
+	out, err := c.Request(addr, signal.Stats)
+	if err != nil {
+		return nil, err
+	}
+	return ParseStats(out)
+}
+
+// Stack reads the stacks of the goroutines of the agent at addr.
+func (c *Client) Stack(addr net.TCPAddr) ([]Goroutine, error) {
+	out, err := c.Request(addr, signal.StackTrace)
+	if err != nil {
+		return nil, err
+	}
+	return ParseStack(out), nil
+}
+
+// Version reads the Go version the program of the agent at addr was built
+// with, such as "go1.12.5".
+func (c *Client) Version(addr net.TCPAddr) (string, error) {
+	out, err := c.Request(addr, signal.Version)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// GC runs the garbage collector of the process of the agent at addr and
+// returns once it is done.
+func (c *Client) GC(addr net.TCPAddr) error {
+	_, err := c.Request(addr, signal.GC)
+	return err
+}
+
+// ErrNoAppStats is the error of the agents that don't serve the application
+// stats.
+var ErrNoAppStats = errors.New("the agent reports no application stats: the process must " +
+	"run the agent of github.com/dcrlabs/dcrps/agent")
+
+// AppStats reads the application stats the process of the agent at addr
+// registered with github.com/dcrlabs/dcrps/agent, the JSON of each by name.
+func (c *Client) AppStats(addr net.TCPAddr) (map[string]json.RawMessage, error) {
+	out, err := c.Request(addr, dcrsignal.AppStats)
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, ErrNoAppStats
+	}
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(out, &values); err != nil {
+		return nil, fmt.Errorf("invalid application stats JSON: %v", err)
+	}
+	return values, nil
+}
+
+// HeapProfile reads the heap profile of the agent at addr in the pprof
+// format.
+func (c *Client) HeapProfile(addr net.TCPAddr) ([]byte, error) {
+	out, err := c.Request(addr, signal.HeapProfile)
+	if err == nil && len(out) == 0 {
+		err = errors.New("the agent returned no heap profile")
+	}
+	return out, err
+}
+
+// DefaultCPUProfileWindow is the window of the CPU profiles of the agents
+// that can't be given one, such as the stock agent.
+const DefaultCPUProfileWindow = 30 * time.Second
+
+// captureSlack is the time the agents get to answer a capture on top of its
+// window.
+const captureSlack = 25 * time.Second
+
+// CPUProfile reads a CPU profile over window from the agent at addr in the
+// pprof format, or over DefaultCPUProfileWindow from the agents without the
+// CPUProfileDuration capability, and returns the window it was taken over.
+// The round trip gets the window on top of the Timeout of c.
+func (c *Client) CPUProfile(addr net.TCPAddr, window time.Duration) ([]byte, time.Duration, error) {
+	ok, err := c.Capable(addr, dcrsignal.CPUProfileDuration)
+	if err != nil {
+		return nil, 0, err
+	}
+	var params []byte
+	if ok {
+		params = make([]byte, binary.MaxVarintLen64)
+		params = params[:binary.PutVarint(params, int64(window/time.Millisecond))]
+	} else {
+		window = DefaultCPUProfileWindow
+	}
+	out, err := c.withTimeout(window+captureSlack).Request(addr, signal.CPUProfile, params...)
+	if err == nil && len(out) == 0 {
+		err = errors.New("the agent returned no CPU profile")
+	}
+	return out, window, err
+}
@@ -0,0 +1,157 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unicode"
+
+	"github.com/dcrlabs/dcrps/internal"
+	"github.com/shirou/gopsutil/process"
+)
+
+// AgentConfigKeys are the keys of a Decred app's config file that may record
+// its agent address, as a host:port or as a port of the local host.
+var AgentConfigKeys = []string{"agentaddr", "gopsaddr"}
+
+// appDataDir returns the default data directory of the Decred app named app,
+// as the Decred apps themselves compute it.
+func appDataDir(app string) string {
+	if app == "" {
+		return ""
+	}
+	upper := string(unicode.ToUpper(rune(app[0]))) + app[1:]
+	switch runtime.GOOS {
+	case "windows":
+		if dir := os.Getenv("LOCALAPPDATA"); dir != "" {
+			return filepath.Join(dir, upper)
+		}
+		return filepath.Join(os.Getenv("APPDATA"), upper)
+	case "darwin":
+		return filepath.Join(internal.HomeDir(), "Library", "Application Support", upper)
+	}
+	return filepath.Join(internal.HomeDir(), "."+app)
+}
+
+// AppPaths are where a Decred app keeps its files.
+type AppPaths struct {
+	App        string // the name of the app, e.g. "dcrd"
+	DataDir    string
+	ConfigFile string
+}
+
+// AppPathsFromArgs returns the paths of the Decred app started with the
+// command line args: its data directory, the one given with -A/--appdata or
+// else the default one, and its config file, the one given with
+// -C/--configfile or else the app's config in the data directory.
+func AppPathsFromArgs(args []string) AppPaths {
+	if len(args) == 0 {
+		return AppPaths{}
+	}
+	app := NormalizeExec(strings.TrimSuffix(filepath.Base(args[0]), ".exe"))
+	paths := AppPaths{App: app}
+	for i := 1; i < len(args); i++ {
+		name, value := args[i], ""
+		if j := strings.Index(name, "="); j >= 0 {
+			name, value = name[:j], name[j+1:]
+		} else if i+1 < len(args) {
+			value = args[i+1]
+		}
+		switch name {
+		case "-C", "--configfile":
+			paths.ConfigFile = value
+		case "-A", "--appdata":
+			paths.DataDir = value
+		}
+	}
+	if paths.DataDir == "" {
+		paths.DataDir = appDataDir(app)
+	}
+	if paths.ConfigFile == "" {
+		paths.ConfigFile = filepath.Join(paths.DataDir, app+".conf")
+	}
+	return paths
+}
+
+// appConfigFile returns the config file of the Decred app started with the
+// command line args.
+func appConfigFile(args []string) string {
+	return AppPathsFromArgs(args).ConfigFile
+}
+
+// ReadAppConfig reads the options of the config file of a Decred app at path
+// by their lowercase keys. The section headers and comments are skipped, and
+// the last value of a repeated key is kept.
+func ReadAppConfig(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	options := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == ';' || line[0] == '#' || line[0] == '[' {
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		options[key] = strings.TrimSpace(line[i+1:])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+// agentFromConfig reads the agent address recorded in the config file at
+// path.
+func agentFromConfig(path string) (*net.TCPAddr, error) {
+	options, err := ReadAppConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range AgentConfigKeys {
+		v, ok := options[key]
+		if !ok {
+			continue
+		}
+		addr, err := parsePortFile(v)
+		if err != nil {
+			return nil, fmt.Errorf("malformed %s in %s: %v", key, path, err)
+		}
+		return addr, nil
+	}
+	return nil, errors.New("no " + strings.Join(AgentConfigKeys, " or ") + " in " + path)
+}
+
+// agentFromAppConfig reads the agent address of the process with the given
+// PID from its config file.
+func agentFromAppConfig(pid int) (*net.TCPAddr, error) {
+	p, err := process.NewProcess(int32(pid))
+	if err != nil {
+		return nil, err
+	}
+	args, err := p.CmdlineSlice()
+	if err != nil {
+		return nil, err
+	}
+	path := appConfigFile(args)
+	if path == "" {
+		return nil, errors.New("no command line")
+	}
+	return agentFromConfig(path)
+}
@@ -0,0 +1,72 @@
+package resolve
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAppConfigFile(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"/bin/dcrd", "-C", "/etc/dcrd.conf"}, "/etc/dcrd.conf"},
+		{[]string{"/bin/dcrd", "--configfile=/etc/dcrd.conf"}, "/etc/dcrd.conf"},
+		{[]string{"/bin/dcrd-1.8.0", "-A", "/data"}, filepath.Join("/data", "dcrd.conf")},
+		{[]string{"dcrwallet", "--appdata=/w", "--testnet"}, filepath.Join("/w", "dcrwallet.conf")},
+		{[]string{"dcrd", "-A", "/data", "-C", "/c.conf"}, "/c.conf"},
+		{nil, ""},
+	}
+	for _, test := range tests {
+		if got := appConfigFile(test.args); got != test.want {
+			t.Errorf("appConfigFile(%q): got=%v want=%v", test.args, got, test.want)
+		}
+	}
+}
+
+func TestAppPathsFromArgs(t *testing.T) {
+	paths := AppPathsFromArgs([]string{"/bin/dcrwallet-1.8.0", "-A", "/w", "-C", "/c.conf"})
+	if want := (AppPaths{"dcrwallet", "/w", "/c.conf"}); paths != want {
+		t.Errorf("got %+v, want %+v", paths, want)
+	}
+}
+
+func TestAgentFromConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcrps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		content string
+		want    string // empty when not found or malformed
+	}{
+		{"[Application Options]\n; agentaddr=1\nagentaddr=9000\n", "127.0.0.1:9000"},
+		{"testnet=1\nGopsAddr = 10.0.0.5:9000\n", "10.0.0.5:9000"},
+		{"rpclisten=:9109\n", ""},
+		{"agentaddr=port\n", ""},
+	}
+	for i, test := range tests {
+		path := filepath.Join(dir, "dcrd.conf")
+		if err := ioutil.WriteFile(path, []byte(test.content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		addr, err := agentFromConfig(path)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%d: got %v, want an error", i, addr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+		if addr.String() != test.want {
+			t.Errorf("%d: got=%v want=%v", i, addr, test.want)
+		}
+	}
+}
@@ -0,0 +1,398 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package resolve resolves Decred Go processes, given by PID, executable name
+// or address, to the TCP address of their gops agent.
+package resolve
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dcrlabs/dcrps/internal"
+	"github.com/google/gops/goprocess"
+	"github.com/shirou/gopsutil/process"
+)
+
+// DefaultPrefix is the executable name prefix of Decred processes.
+const DefaultPrefix = "dcr"
+
+// versionSuffix matches a trailing version-like suffix of an executable name:
+// a "-", "_" or "." separator, an optional "v", dot-separated numbers and an
+// optional pre-release tag, e.g. "-1.8.0", "_v1.7" or "-1.8.0-rc1".
+var versionSuffix = regexp.MustCompile(`[-_.]v?[0-9]+(\.[0-9]+)*(-[0-9A-Za-z.]+)?$`)
+
+// NormalizeExec strips a trailing version suffix from exec so that, for
+// example, "dcrd-1.8.0" and "dcrd-v1.7.2" both become "dcrd".
+func NormalizeExec(exec string) string {
+	return versionSuffix.ReplaceAllString(exec, "")
+}
+
+// Resolver resolves targets to agent addresses. The zero value resolves the
+// executable names of all Go processes.
+type Resolver struct {
+	// Prefixes limit name resolution to the processes whose executable
+	// name starts with one of them. None, without a Pattern, means all
+	// processes.
+	Prefixes []string
+
+	// Pattern, when set, also lets the processes whose executable name
+	// matches it resolve, whatever their prefix. It is matched as it is
+	// compiled, regardless of CaseInsensitive.
+	Pattern *regexp.Regexp
+
+	// NormalizeExec makes names match regardless of version suffixes,
+	// see NormalizeExec.
+	NormalizeExec bool
+
+	// Exact requires names to be given exactly as they are keyed, so
+	// that a name is never resolved by a looser match.
+	Exact bool
+
+	// Fuzzy lets a name no process is keyed by resolve to the processes
+	// whose key contains it, regardless of case, such as "wallet" to
+	// dcrwallet. Exact overrides it.
+	Fuzzy bool
+
+	// Choose, when set, is asked to pick one of the processes of a name
+	// several processes share, as by prompting the user. The name stays
+	// ambiguous when it picks none.
+	Choose func(e *AmbiguousError) (pid int, ok bool)
+
+	// Matched, when set, is told of the process a name resolved to by
+	// the looser match of Fuzzy alone, so that the user can be warned.
+	Matched func(name string, p goprocess.P)
+
+	// CaseInsensitive makes names and the Prefixes match regardless of
+	// case, as suits case-insensitive file systems.
+	CaseInsensitive bool
+
+	// PortFile, when set, names a file holding the agent's host:port, or
+	// only its port on the local host. Local targets resolve to it rather
+	// than to the address found from their PID.
+	PortFile string
+
+	// ConfigFallback makes the local processes whose agent left no PID
+	// file resolve to the address recorded in their config file under
+	// one of the AgentConfigKeys. The config file is found from their
+	// command line as the Decred apps find it.
+	ConfigFallback bool
+
+	// AgentPort is the port of the agent of the remote hosts given
+	// without one, as an IP address or a domain name. The gops agents
+	// have no default port, so such hosts don't resolve when it is zero.
+	AgentPort int
+
+	names map[string][]goprocess.P
+}
+
+// DefaultResolver resolves the processes with the DefaultPrefix.
+var DefaultResolver = &Resolver{Prefixes: []string{DefaultPrefix}}
+
+// Resolve resolves target with the DefaultResolver.
+func Resolve(target string) (*net.TCPAddr, error) {
+	return DefaultResolver.Resolve(target)
+}
+
+// Key returns the name the process with the given executable name is keyed by.
+func (r *Resolver) Key(exec string) string {
+	if r.NormalizeExec {
+		exec = NormalizeExec(exec)
+	}
+	if r.CaseInsensitive {
+		exec = strings.ToLower(exec)
+	}
+	return exec
+}
+
+// Match reports whether exec has one of the Prefixes or matches the Pattern.
+func (r *Resolver) Match(exec string) bool {
+	if r.Pattern != nil && r.Pattern.MatchString(exec) {
+		return true
+	}
+	if len(r.Prefixes) == 0 {
+		return r.Pattern == nil
+	}
+	if r.CaseInsensitive {
+		exec = strings.ToLower(exec)
+	}
+	for _, prefix := range r.Prefixes {
+		if r.CaseInsensitive {
+			prefix = strings.ToLower(prefix)
+		}
+		if strings.HasPrefix(exec, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParsePrefixes parses a comma-separated list of prefixes. The empty list
+// has no prefixes.
+func ParsePrefixes(list string) []string {
+	var prefixes []string
+	for _, prefix := range strings.Split(list, ",") {
+		if prefix = strings.TrimSpace(prefix); prefix != "" {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+// Lookup returns the PID of the process keyed by name, or matching it when
+// Fuzzy, or -1 when several processes do.
+func (r *Resolver) Lookup(name string) (pid int, ok bool) {
+	ps, _ := r.lookup(name)
+	switch len(ps) {
+	case 0:
+		return 0, false
+	case 1:
+		return ps[0].PID, true
+	}
+	return -1, true // multiple procs with this name
+}
+
+// matches returns the processes keyed by name.
+func (r *Resolver) matches(name string) []goprocess.P {
+	if r.names == nil {
+		r.names = make(map[string][]goprocess.P)
+		for _, p := range goprocess.FindAll() {
+			if !r.Match(p.Exec) {
+				continue
+			}
+			key := r.Key(p.Exec)
+			r.names[key] = append(r.names[key], p)
+		}
+	}
+	switch {
+	case !r.Exact:
+		name = r.Key(name)
+	case r.CaseInsensitive:
+		name = strings.ToLower(name)
+	}
+	return r.names[name]
+}
+
+// lookup returns the processes keyed by name or, when there are none and
+// r is Fuzzy, those whose key contains it, which it reports. The looser
+// matches leave out the calling process, which dcr tools match but never
+// mean to target.
+func (r *Resolver) lookup(name string) (ps []goprocess.P, fuzzy bool) {
+	if ps = r.matches(name); len(ps) > 0 || !r.Fuzzy || r.Exact {
+		return ps, false
+	}
+	name = strings.ToLower(r.Key(name))
+	keys := make([]string, 0, len(r.names))
+	for key := range r.names {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !strings.Contains(strings.ToLower(key), name) {
+			continue
+		}
+		for _, p := range r.names[key] {
+			if p.PID != os.Getpid() {
+				ps = append(ps, p)
+			}
+		}
+	}
+	return ps, true
+}
+
+// AmbiguousError is the error of the resolution of a name several processes
+// share, or match when Fuzzy. It lists them so that one can be picked by
+// PID.
+type AmbiguousError struct {
+	Name      string
+	Processes []goprocess.P
+	// Fuzzy is set when the processes only matched the name loosely.
+	Fuzzy bool
+}
+
+func (e *AmbiguousError) Error() string {
+	var b strings.Builder
+	if e.Fuzzy {
+		fmt.Fprintf(&b, "multiple processes match %s, use a PID or a full name instead:", e.Name)
+	} else {
+		fmt.Fprintf(&b, "multiple processes with the name %s, use a PID instead:", e.Name)
+	}
+	for _, p := range e.Processes {
+		fmt.Fprintf(&b, "\n  %d %s", p.PID, CommandLine(p))
+	}
+	return b.String()
+}
+
+// CommandLine returns the command line of p, or its path when it can't be
+// read.
+func CommandLine(p goprocess.P) string {
+	if proc, err := process.NewProcess(int32(p.PID)); err == nil {
+		if args, err := proc.CmdlineSlice(); err == nil && len(args) > 0 {
+			return strings.Join(args, " ")
+		}
+	}
+	return p.Path
+}
+
+// NoProcessError is the error of the resolution of a target no local process
+// is identified by, as when the process is down.
+type NoProcessError struct {
+	Target string
+	Exact  bool // the target was looked up as an exact exec name
+}
+
+func (e *NoProcessError) Error() string {
+	if _, err := strconv.Atoi(e.Target); err == nil {
+		return fmt.Sprintf("no process with the PID %s", e.Target)
+	}
+	if e.Exact {
+		return fmt.Sprintf("no process with the exact exec name %s", e.Target)
+	}
+	return fmt.Sprintf("no process identifiable by %s", e.Target)
+}
+
+// NoAgentError is the error of the resolution of a local process whose agent
+// address can't be found, as when it runs no agent.
+type NoAgentError struct {
+	PID       int
+	Err       error // of the agent's PID file
+	ConfigErr error // of its app config, with the ConfigFallback
+}
+
+func (e *NoAgentError) Error() string {
+	if e.ConfigErr != nil {
+		return fmt.Sprintf("couldn't get port for PID %v: %v, nor from its config: %v",
+			e.PID, e.Err, e.ConfigErr)
+	}
+	return fmt.Sprintf("couldn't get port for PID %v: %v", e.PID, e.Err)
+}
+
+// PID resolves a local process's PID or executable name to its PID. A name
+// no process has is a *NoProcessError and a name several processes share,
+// which Choose picks none of, is an *AmbiguousError.
+func (r *Resolver) PID(target string) (int, error) {
+	pid, err := strconv.Atoi(target)
+	if err == nil {
+		return pid, nil
+	}
+	ps, fuzzy := r.lookup(target)
+	switch len(ps) {
+	case 0:
+		return 0, &NoProcessError{Target: target, Exact: r.Exact}
+	case 1:
+		if fuzzy && r.Matched != nil {
+			r.Matched(target, ps[0])
+		}
+		return ps[0].PID, nil
+	}
+	ps = append([]goprocess.P(nil), ps...)
+	sort.Slice(ps, func(i, j int) bool { return ps[i].PID < ps[j].PID })
+	e := &AmbiguousError{Name: target, Processes: ps, Fuzzy: fuzzy}
+	if r.Choose != nil {
+		if pid, ok := r.Choose(e); ok {
+			return pid, nil
+		}
+	}
+	return 0, e
+}
+
+// Resolve parses target, be it a remote host:port, a remote host, given as
+// an IP address or as a domain name no local process is named by, or a local
+// process's PID or executable name, and returns the address of its agent.
+// Remote hosts never go through the local process lookup. A local target
+// with no process is a *NoProcessError and one whose agent can't be found a
+// *NoAgentError.
+func (r *Resolver) Resolve(target string) (*net.TCPAddr, error) {
+	if net.ParseIP(target) != nil {
+		return r.remoteHost(target)
+	}
+	if strings.Contains(target, ":") {
+		// addr host:port passed
+		addr, err := net.ResolveTCPAddr("tcp", target)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse dst address: %v", err)
+		}
+		return addr, nil
+	}
+	if strings.Contains(target, ".") && len(r.matches(target)) == 0 {
+		return r.remoteHost(target)
+	}
+	if r.PortFile != "" {
+		return ReadPortFile(r.PortFile)
+	}
+	// Try to find port by pid or name. Then connect to local.
+	pid, err := r.PID(target)
+	if err != nil {
+		return nil, err
+	}
+	port, err := internal.GetPort(pid)
+	if err != nil {
+		if exists, _ := process.PidExists(int32(pid)); !exists {
+			return nil, &NoProcessError{Target: target}
+		}
+		if r.ConfigFallback {
+			addr, cerr := agentFromAppConfig(pid)
+			if cerr == nil {
+				return addr, nil
+			}
+			return nil, &NoAgentError{PID: pid, Err: err, ConfigErr: cerr}
+		}
+		return nil, &NoAgentError{PID: pid, Err: err}
+	}
+	addr, _ := net.ResolveTCPAddr("tcp", "127.0.0.1:"+port)
+	return addr, nil
+}
+
+// remoteHost returns the address of the agent of a remote host given without
+// a port, on the AgentPort.
+func (r *Resolver) remoteHost(host string) (*net.TCPAddr, error) {
+	if r.AgentPort == 0 {
+		return nil, fmt.Errorf("no port for the agent of %s: give host:port, "+
+			"or the port with -agent-port, as gops agents have no default port", host)
+	}
+	addr, err := net.ResolveTCPAddr("tcp", net.JoinHostPort(host, strconv.Itoa(r.AgentPort)))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't resolve host %s: %v", host, err)
+	}
+	return addr, nil
+}
+
+// ReadPortFile reads an agent address from the file at path. The file holds
+// either a host:port address or a port of the local host.
+func ReadPortFile(path string) (*net.TCPAddr, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	addr, err := parsePortFile(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("malformed agent port file %s: %v", path, err)
+	}
+	return addr, nil
+}
+
+func parsePortFile(s string) (*net.TCPAddr, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, fmt.Errorf("file is empty")
+	}
+	if !strings.Contains(s, ":") {
+		s = "127.0.0.1:" + s
+	}
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return nil, fmt.Errorf("invalid port %q", port)
+	}
+	return net.ResolveTCPAddr("tcp", net.JoinHostPort(host, port))
+}
@@ -0,0 +1,289 @@
+package resolve
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/gops/goprocess"
+)
+
+func TestNormalizeExec(t *testing.T) {
+	tests := []struct {
+		exec string
+		want string
+	}{
+		{"dcrd", "dcrd"},
+		{"dcrd-1.8.0", "dcrd"},
+		{"dcrd-v1.8.0", "dcrd"},
+		{"dcrwallet_1.7", "dcrwallet"},
+		{"dcrd-1.8.0-rc1", "dcrd"},
+		{"dcrd.1", "dcrd"},
+		{"dcrd2", "dcrd2"},
+		{"dcrlnd-0.3.0", "dcrlnd"},
+		{"dcrd-testnet", "dcrd-testnet"},
+	}
+	for _, test := range tests {
+		if got := NormalizeExec(test.exec); got != test.want {
+			t.Errorf("NormalizeExec(%q): got=%v want=%v", test.exec, got, test.want)
+		}
+	}
+}
+
+func TestParsePortFile(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string // empty when malformed
+	}{
+		{"9000\n", "127.0.0.1:9000"},
+		{"  10.0.0.5:9000 ", "10.0.0.5:9000"},
+		{"[::1]:9000", "[::1]:9000"},
+		{"", ""},
+		{"port", ""},
+		{"10.0.0.5:", ""},
+		{"70000", ""},
+		{"10.0.0.5:9000:1", ""},
+	}
+	for _, test := range tests {
+		addr, err := parsePortFile(test.content)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("parsePortFile(%q): expected an error, got %v", test.content, addr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parsePortFile(%q): %v", test.content, err)
+			continue
+		}
+		if g, w := addr.String(), test.want; g != w {
+			t.Errorf("parsePortFile(%q): got=%v want=%v", test.content, g, w)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		prefixes        string
+		caseInsensitive bool
+		exec            string
+		want            bool
+	}{
+		{"dcr", false, "dcrd", true},
+		{"dcr", false, "politeiad", false},
+		{"dcr,politeia", false, "politeiad", true},
+		{" dcr , politeia ", false, "dcrwallet", true},
+		{"dcr", false, "DCRD", false},
+		{"dcr", true, "DCRD", true},
+		{"DCR", true, "dcrd", true},
+		{"", false, "politeiad", true},
+		{",", false, "gopls", true},
+	}
+	for _, test := range tests {
+		r := &Resolver{Prefixes: ParsePrefixes(test.prefixes), CaseInsensitive: test.caseInsensitive}
+		if got := r.Match(test.exec); got != test.want {
+			t.Errorf("Match(%q) with prefixes %q: got=%v want=%v", test.exec, test.prefixes, got, test.want)
+		}
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		prefixes string
+		pattern  string
+		exec     string
+		want     bool
+	}{
+		{"dcr", "^(politeiad|vspd)$", "dcrd", true},
+		{"dcr", "^(politeiad|vspd)$", "vspd", true},
+		{"dcr", "^(politeiad|vspd)$", "vspd-old", false},
+		{"", "^vspd$", "vspd", true},
+		{"", "^vspd$", "dcrd", false},
+		{"", "(?i)^vspd$", "VSPD", true},
+	}
+	for _, test := range tests {
+		r := &Resolver{Prefixes: ParsePrefixes(test.prefixes), Pattern: regexp.MustCompile(test.pattern)}
+		if got := r.Match(test.exec); got != test.want {
+			t.Errorf("Match(%q) with prefixes %q and pattern %q: got=%v want=%v",
+				test.exec, test.prefixes, test.pattern, got, test.want)
+		}
+	}
+}
+
+func TestAmbiguousPID(t *testing.T) {
+	// No process has these PIDs, so their paths stand for their command
+	// lines.
+	r := &Resolver{names: map[string][]goprocess.P{
+		"dcrwallet": {
+			{PID: 1 << 30, Exec: "dcrwallet", Path: "/opt/dcrwallet"},
+			{PID: 1<<30 - 1, Exec: "dcrwallet", Path: "/bin/dcrwallet"},
+		},
+	}}
+	if pid, ok := r.Lookup("dcrwallet"); pid != -1 || !ok {
+		t.Errorf("Lookup: got=%v,%v want=-1,true", pid, ok)
+	}
+	_, err := r.PID("dcrwallet")
+	if _, ok := err.(*AmbiguousError); !ok {
+		t.Fatalf("PID: got %v, want an *AmbiguousError", err)
+	}
+	want := "multiple processes with the name dcrwallet, use a PID instead:\n" +
+		"  1073741823 /bin/dcrwallet\n" +
+		"  1073741824 /opt/dcrwallet"
+	if got := err.Error(); got != want {
+		t.Errorf("PID error:\n%v\nwant:\n%v", got, want)
+	}
+}
+
+func TestFuzzyPID(t *testing.T) {
+	names := map[string][]goprocess.P{
+		"dcrd":      {{PID: 1 << 30, Exec: "dcrd", Path: "/bin/dcrd"}},
+		"dcrwallet": {{PID: 1<<30 - 1, Exec: "dcrwallet", Path: "/bin/dcrwallet"}},
+		"dcrctl":    {{PID: 1<<30 - 2, Exec: "dcrctl", Path: "/bin/dcrctl"}},
+	}
+	r := &Resolver{Fuzzy: true, names: names}
+	if pid, err := r.PID("Wallet"); err != nil || pid != 1<<30-1 {
+		t.Errorf("PID(Wallet): got=%v,%v", pid, err)
+	}
+	if pid, err := r.PID("dcrd"); err != nil || pid != 1<<30 {
+		t.Errorf("PID(dcrd), the exact name over the looser matches: got=%v,%v", pid, err)
+	}
+	_, err := r.PID("dcr")
+	if e, ok := err.(*AmbiguousError); !ok || !e.Fuzzy || len(e.Processes) != 3 {
+		t.Errorf("PID(dcr): got %v, want a fuzzy *AmbiguousError", err)
+	}
+
+	var asked *AmbiguousError
+	r.Choose = func(e *AmbiguousError) (int, bool) {
+		asked = e
+		return e.Processes[0].PID, true
+	}
+	if pid, err := r.PID("dcr"); err != nil || asked == nil || pid != asked.Processes[0].PID {
+		t.Errorf("PID(dcr) with Choose: got=%v,%v", pid, err)
+	}
+
+	var matched []string
+	r.Matched = func(name string, p goprocess.P) {
+		matched = append(matched, name+"="+p.Exec)
+	}
+	r.PID("dcrd")
+	r.PID("wallet")
+	if len(matched) != 1 || matched[0] != "wallet=dcrwallet" {
+		t.Errorf("Matched: got %q, want only wallet=dcrwallet", matched)
+	}
+
+	r = &Resolver{Fuzzy: true, Exact: true, names: names}
+	if _, err := r.PID("wallet"); err == nil {
+		t.Error("PID(wallet) with Exact: got no error")
+	}
+	r = &Resolver{names: names}
+	if _, err := r.PID("wallet"); err == nil {
+		t.Error("PID(wallet) without Fuzzy: got no error")
+	}
+}
+
+func TestExactPID(t *testing.T) {
+	// The names are keyed as with NormalizeExec.
+	names := map[string][]goprocess.P{
+		"dcrd": {{PID: 1 << 30, Exec: "dcrd-1.8.0", Path: "/bin/dcrd-1.8.0"}},
+	}
+	tests := []struct {
+		exact  bool
+		target string
+		want   int
+		err    string
+	}{
+		{false, "dcrd", 1 << 30, ""},
+		{false, "dcrd-1.8.0", 1 << 30, ""},
+		{true, "dcrd", 1 << 30, ""},
+		{true, "dcrd-1.8.0", 0, "no process with the exact exec name dcrd-1.8.0"},
+		{false, "dcrwallet", 0, "no process identifiable by dcrwallet"},
+		{true, "dcrwallet", 0, "no process with the exact exec name dcrwallet"},
+	}
+	for _, test := range tests {
+		r := &Resolver{NormalizeExec: true, Exact: test.exact, names: names}
+		pid, err := r.PID(test.target)
+		if test.err != "" {
+			if _, ok := err.(*NoProcessError); !ok || err.Error() != test.err {
+				t.Errorf("PID(%s), exact %v: got %v, want %q", test.target, test.exact, err, test.err)
+			}
+			continue
+		}
+		if err != nil || pid != test.want {
+			t.Errorf("PID(%s), exact %v: got=%v,%v want=%v", test.target, test.exact, pid, err, test.want)
+		}
+	}
+}
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		normalize, caseInsensitive bool
+		exec                       string
+		want                       string
+	}{
+		{false, false, "Dcrd-1.8.0", "Dcrd-1.8.0"},
+		{false, true, "Dcrd-1.8.0", "dcrd-1.8.0"},
+		{true, false, "Dcrd-1.8.0", "Dcrd"},
+		{true, true, "Dcrd-1.8.0", "dcrd"},
+	}
+	for _, test := range tests {
+		r := &Resolver{NormalizeExec: test.normalize, CaseInsensitive: test.caseInsensitive}
+		if got := r.Key(test.exec); got != test.want {
+			t.Errorf("Key(%q), normalize %v, case insensitive %v: got=%v want=%v",
+				test.exec, test.normalize, test.caseInsensitive, got, test.want)
+		}
+	}
+}
+
+func TestCaseInsensitivePID(t *testing.T) {
+	// The names are keyed as with CaseInsensitive.
+	names := map[string][]goprocess.P{
+		"dcrd.exe": {{PID: 1 << 30, Exec: "Dcrd.exe", Path: `C:\Decred\Dcrd.exe`}},
+	}
+	for _, exact := range []bool{false, true} {
+		r := &Resolver{CaseInsensitive: true, Exact: exact, names: names}
+		for _, target := range []string{"dcrd.exe", "DCRD.EXE", "Dcrd.exe"} {
+			if pid, err := r.PID(target); err != nil || pid != 1<<30 {
+				t.Errorf("PID(%s), exact %v: got=%v,%v", target, exact, pid, err)
+			}
+		}
+	}
+	r := &Resolver{names: map[string][]goprocess.P{"Dcrd": names["dcrd.exe"]}}
+	if _, err := r.PID("dcrd"); err == nil {
+		t.Error("PID(dcrd) of Dcrd, case sensitive: got no error")
+	}
+}
+
+func TestResolveRemoteHost(t *testing.T) {
+	// The names are set so that no local process is looked up.
+	r := &Resolver{AgentPort: 9000, names: map[string][]goprocess.P{
+		"dcrd.1": {{PID: 1 << 30, Exec: "dcrd.1"}},
+	}}
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"10.0.0.5", "10.0.0.5:9000"},
+		{"::1", "[::1]:9000"},
+		{"10.0.0.5:9100", "10.0.0.5:9100"},
+		{"127.0.0.1", "127.0.0.1:9000"},
+	}
+	for _, test := range tests {
+		addr, err := r.Resolve(test.target)
+		if err != nil {
+			t.Errorf("Resolve(%q): %v", test.target, err)
+			continue
+		}
+		if got := addr.String(); got != test.want {
+			t.Errorf("Resolve(%q): got=%v want=%v", test.target, got, test.want)
+		}
+	}
+
+	// A local exec name with a dot is not a host.
+	if _, err := r.Resolve("dcrd.1"); err == nil || strings.Contains(err.Error(), "host") {
+		t.Errorf("Resolve(dcrd.1): got %v, want a local resolution error", err)
+	}
+	r.AgentPort = 0
+	if _, err := r.Resolve("10.0.0.5"); err == nil {
+		t.Error("Resolve(10.0.0.5) without AgentPort: expected an error")
+	}
+}
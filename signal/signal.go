@@ -0,0 +1,82 @@
+// Copyright 2019 The Decred developers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package signal contains the signals dcrps sends to the agents in addition
+// to those of github.com/google/gops/signal. Agents that don't know a signal
+// close the connection without answering, so an empty response means the
+// signal is not supported.
+package signal
+
+const (
+	// Capabilities lists the commands the agent supports, one command
+	// name per line.
+	Capabilities = byte(0x40)
+
+	// MemStatsJSON returns the runtime.MemStats of the process encoded as
+	// JSON.
+	MemStatsJSON = byte(0x41)
+
+	// Info returns what the agent knows of its process as "key: value"
+	// lines, among them its "pid" as the process sees it.
+	Info = byte(0x42)
+
+	// MutexProfile returns the mutex contention profile in the pprof
+	// format. It is empty unless the process enabled it with
+	// runtime.SetMutexProfileFraction.
+	MutexProfile = byte(0x43)
+
+	// BlockProfile returns the blocking profile in the pprof format. It
+	// is empty unless the process enabled it with
+	// runtime.SetBlockProfileRate.
+	BlockProfile = byte(0x44)
+
+	// AppStats returns the application stats the process registered with
+	// github.com/dcrlabs/dcrps/agent, such as its peer count, as a JSON
+	// object of their names to their values.
+	AppStats = byte(0x45)
+
+	// SetMutexProfileFraction sets the fraction of the mutex contention
+	// events sampled, as runtime.SetMutexProfileFraction does, to the
+	// varint following the signal. It returns the previous fraction as a
+	// decimal line. Only the agents with the ProfileRates capability know
+	// it.
+	SetMutexProfileFraction = byte(0x46)
+
+	// SetBlockProfileRate sets the rate of the blocking events sampled, as
+	// runtime.SetBlockProfileRate does, to the varint following the
+	// signal. It returns the previous rate the agent set, 0 at first, as a
+	// decimal line. Only the agents with the ProfileRates capability know
+	// it.
+	SetBlockProfileRate = byte(0x47)
+
+	// GCEvents streams a JSON object per GC cycle, one per line, until the
+	// connection closes: its "numGC", the "end" of its pause in Unix
+	// nanoseconds, its "pauseNs", the "heapBefore" goal the cycle ran to,
+	// the "heapAfter" allocated heap once it was done and the "goal" of
+	// the next cycle, in bytes. The heap sizes of the cycles that ran
+	// before the agent caught up with them are 0. Only the agents with
+	// the GCEventStream capability know it.
+	GCEvents = byte(0x48)
+)
+
+// TraceDuration is the capability of the agents that read the window of a
+// github.com/google/gops/signal.Trace from the varint of its milliseconds
+// following the signal. The stock agent traces for a fixed 5s and must not
+// be sent it.
+const TraceDuration = "trace-duration"
+
+// CPUProfileDuration is the capability of the agents that read the window of
+// a github.com/google/gops/signal.CPUProfile from the varint of its
+// milliseconds following the signal, as for TraceDuration. The stock agent
+// profiles for a fixed 30s.
+const CPUProfileDuration = "cpu-profile-duration"
+
+// ProfileRates is the capability of the agents that serve
+// SetMutexProfileFraction and SetBlockProfileRate. The stock agent resets the
+// connections of the signals followed by params it doesn't know.
+const ProfileRates = "profile-rates"
+
+// GCEventStream is the capability of the agents that serve GCEvents, on a
+// connection of its own while they serve the other signals.
+const GCEventStream = "gc-events"